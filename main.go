@@ -7,7 +7,7 @@ import (
 )
 
 func main() {
-	if cli.Run(os.Args) != nil {
-		os.Exit(1)
+	if err := cli.Run(os.Args); err != nil {
+		os.Exit(cli.ExitCode(err))
 	}
 }
@@ -0,0 +1,100 @@
+// Package aging computes expiry and decayed confidence of indicators by aging policy of each indicator source, and selects active indicators that are not expired. Refresh creates active_indicators view by Query, and export and lookup read indicators from the view. Expiry and confidence are computed when the view is read.
+package aging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+// ViewName is a view of active indicators created by Refresh.
+const ViewName = "active_indicators"
+
+// Query returns SQL to select active indicators of the sources, one row per feed, type and indicator. It returns empty string if no source is given. Result columns are:
+//   - Feed, Type, Indicator (STRING)
+//   - FirstSeen, LastSeen (TIMESTAMP): The earliest and the latest time in rows of the indicator
+//   - BaseConfidence (INT64): The highest confidence given by the source
+//   - Confidence (INT64): BaseConfidence decayed by half-life since LastSeen
+//   - ExpiresAt (TIMESTAMP): Expiration given by the provider, or LastSeen + TTL. NULL means it never expires
+//   - Tags (ARRAY<STRING>)
+func Query(sources []*model.IndicatorSource) string {
+	if len(sources) == 0 {
+		return ""
+	}
+
+	unions := make([]string, len(sources))
+	for i, src := range sources {
+		expiresAt := "Expiration"
+		if ttl := int64(src.Aging.TTL.Seconds()); ttl > 0 {
+			expiresAt = fmt.Sprintf("COALESCE(Expiration, TIMESTAMP_ADD(LastSeen, INTERVAL %d SECOND))", ttl)
+		}
+		unions[i] = fmt.Sprintf("  SELECT '%s' AS Feed, '%s' AS Type, TRIM(Indicator) AS Indicator, FirstSeen, LastSeen, Confidence, Tags, %s AS ExpiresAt, %d AS HalfLifeSeconds FROM (%s)",
+			src.Feed, src.Type, expiresAt, int64(src.Aging.HalfLife.Seconds()), src.Query)
+	}
+
+	return fmt.Sprintf(`SELECT
+  Feed,
+  Type,
+  Indicator,
+  FirstSeen,
+  LastSeen,
+  BaseConfidence,
+  IF(HalfLifeSeconds <= 0 OR LastSeen IS NULL, BaseConfidence,
+    CAST(FLOOR(BaseConfidence * POW(0.5, GREATEST(TIMESTAMP_DIFF(CURRENT_TIMESTAMP(), LastSeen, SECOND), 0) / HalfLifeSeconds)) AS INT64)) AS Confidence,
+  ExpiresAt,
+  Tags
+FROM (
+  SELECT
+    Feed,
+    Type,
+    Indicator,
+    MIN(FirstSeen) AS FirstSeen,
+    MAX(LastSeen) AS LastSeen,
+    MAX(Confidence) AS BaseConfidence,
+    IF(LOGICAL_OR(ExpiresAt IS NULL), NULL, MAX(ExpiresAt)) AS ExpiresAt,
+    MAX(HalfLifeSeconds) AS HalfLifeSeconds,
+    ARRAY_AGG(DISTINCT Tag IGNORE NULLS) AS Tags
+  FROM (
+%s
+  ) AS s LEFT JOIN UNNEST(s.Tags) AS Tag
+  WHERE Indicator != ''
+  GROUP BY Feed, Type, Indicator
+)
+WHERE ExpiresAt IS NULL OR ExpiresAt > CURRENT_TIMESTAMP()`, strings.Join(unions, "\n  UNION ALL\n"))
+}
+
+// View returns active_indicators view of the sources. It returns nil if no source is given.
+func View(sources []*model.IndicatorSource) *model.View {
+	query := Query(sources)
+	if query == "" {
+		return nil
+	}
+	return &model.View{
+		Name:        ViewName,
+		Description: "Indicators that are not expired, with confidence decayed by aging policy",
+		Query:       query,
+	}
+}
+
+// Refresh creates or updates active_indicators view by aging policy of the sources. It needs to be run again when aging policy or indicator sources are changed.
+func Refresh(ctx context.Context, client interfaces.BigQuery, sources []*model.IndicatorSource) (err error) {
+	ctx, span := utils.StartSpan(ctx, "aging.Refresh", utils.AttrTable.String(ViewName))
+	defer func() { utils.EndSpan(span, err) }()
+
+	view := View(sources)
+	if view == nil {
+		return goerr.New("no indicator source of active indicators")
+	}
+
+	if err := client.CreateOrUpdateView(ctx, view); err != nil {
+		return goerr.Wrap(err, "Fail to refresh active indicators view").With("view", ViewName)
+	}
+
+	utils.Logger().InfoContext(ctx, "Refreshed active indicators view", "view", ViewName, "sources", len(sources))
+	return nil
+}
@@ -0,0 +1,74 @@
+package aging_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/aging"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/gt"
+)
+
+var sources = []*model.IndicatorSource{
+	{
+		Feed:  types.FeedAbuseChFeodo,
+		Type:  types.IndicatorIP,
+		Query: "SELECT * FROM feodo",
+		Aging: model.AgingPolicy{TTL: 24 * time.Hour, HalfLife: time.Hour},
+	},
+	{
+		Feed:  types.FeedOTXSubscribed,
+		Type:  types.IndicatorIP,
+		Query: "SELECT * FROM otx",
+	},
+}
+
+func TestQuery(t *testing.T) {
+	query := aging.Query(sources)
+
+	// TTL is applied only to the source that has TTL
+	gt.S(t, query).Contains("SELECT 'abuse.ch-feodo' AS Feed, 'ip' AS Type, TRIM(Indicator) AS Indicator, FirstSeen, LastSeen, Confidence, Tags, COALESCE(Expiration, TIMESTAMP_ADD(LastSeen, INTERVAL 86400 SECOND)) AS ExpiresAt, 3600 AS HalfLifeSeconds FROM (SELECT * FROM feodo)")
+	gt.S(t, query).Contains("SELECT 'otx-subscribed' AS Feed, 'ip' AS Type, TRIM(Indicator) AS Indicator, FirstSeen, LastSeen, Confidence, Tags, Expiration AS ExpiresAt, 0 AS HalfLifeSeconds FROM (SELECT * FROM otx)")
+	gt.S(t, query).Contains("WHERE ExpiresAt IS NULL OR ExpiresAt > CURRENT_TIMESTAMP()")
+
+	gt.V(t, aging.Query(nil)).Equal("")
+}
+
+func TestQueryFeeds(t *testing.T) {
+	// All feeds declare aging policy, and their queries have Expiration column
+	sources := gt.R1(feed.Indicators()).NoError(t)
+	for _, src := range sources {
+		gt.V(t, src.Aging.TTL).NotEqual(0)
+		gt.V(t, src.Aging.HalfLife).NotEqual(0)
+		gt.S(t, src.Query).Contains("AS Expiration")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	mock := bq.NewMock()
+	gt.NoError(t, aging.Refresh(context.Background(), mock, sources))
+
+	// Expiry and confidence are computed when the view is read
+	gt.M(t, mock.Views).HaveKey("active_indicators")
+	gt.S(t, mock.Views["active_indicators"]).Contains("FROM (SELECT * FROM feodo)")
+	gt.S(t, mock.Views["active_indicators"]).Contains("CURRENT_TIMESTAMP()")
+	gt.A(t, mock.Queries).Length(0)
+
+	gt.Error(t, aging.Refresh(context.Background(), mock, nil))
+}
+
+func TestViewFeeds(t *testing.T) {
+	// Tables of feeds are qualified in the view
+	mock := bq.NewMock()
+	gt.NoError(t, aging.Refresh(context.Background(), mock, gt.R1(feed.Indicators()).NoError(t)))
+	view := mock.Views["active_indicators"]
+	gt.S(t, view).Contains("FROM `" + bq.MockProjectID + "." + bq.MockDatasetID + ".abusech_feodo`")
+	gt.S(t, view).Contains("FROM `" + bq.MockProjectID + "." + bq.MockDatasetID + ".otx_pulses`")
+
+	// Indicators of OTX are unnested from the latest revision of each pulse
+	gt.S(t, view).Contains("QUALIFY ROW_NUMBER() OVER (PARTITION BY ID ORDER BY Modified DESC) = 1\n) AS p, UNNEST(p.Indicators) AS i")
+}
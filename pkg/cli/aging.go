@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/m-mizutani/drone/pkg/aging"
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type agingConfig struct {
+	bq    config.BigQuery
+	aging config.Aging
+}
+
+func subAging() *cli.Command {
+	var cfg agingConfig
+
+	return &cli.Command{
+		Name:  "aging",
+		Usage: "Manage expiry and confidence decay of indicators",
+		Flags: mergeFlags([]cli.Flag{}, &cfg.bq, &cfg.aging),
+		Subcommands: []*cli.Command{
+			subAgingRefresh(&cfg),
+		},
+	}
+}
+
+func subAgingRefresh(cfg *agingConfig) *cli.Command {
+	return &cli.Command{
+		Name:  "refresh",
+		Usage: "Create or update " + aging.ViewName + " view of all feeds by aging policy. Export and lookup read indicators from the view",
+		Action: func(ctx *cli.Context) error {
+			bqClient, err := cfg.bq.Configure(ctx.Context)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to configure BigQuery")
+			}
+			defer utils.SafeClose(bqClient)
+
+			return refreshActiveIndicators(ctx.Context, bqClient, &cfg.aging)
+		},
+	}
+}
+
+// refreshActiveIndicators creates or updates active_indicators view by indicator sources of all feeds with aging policy of agingCfg. The view is always built from all feeds because export, lookup and serve read every feed from it. Tables of feeds that have not been imported yet are created empty because a view can not refer to a missing table.
+func refreshActiveIndicators(ctx context.Context, bqClient interfaces.BigQuery, agingCfg *config.Aging) error {
+	sources, err := feed.Indicators()
+	if err != nil {
+		return err
+	}
+	if err := agingCfg.Apply(sources); err != nil {
+		return err
+	}
+
+	tables, err := feed.Tables()
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		schema, err := bqClient.GetSchema(ctx, table.Name)
+		if err != nil {
+			return goerr.Wrap(err, "Fail to get table schema").With("table", table.Name)
+		}
+		if schema != nil {
+			continue
+		}
+		if err := bqClient.CreateOrUpdateSchema(ctx, table.Name, table.Schema, table.Spec); err != nil {
+			return goerr.Wrap(err, "Fail to create table").With("table", table.Name)
+		}
+	}
+
+	return aging.Refresh(ctx, bqClient, sources)
+}
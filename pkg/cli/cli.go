@@ -1,25 +1,66 @@
 package cli
 
 import (
+	"context"
+	"errors"
+
 	"github.com/m-mizutani/drone/pkg/cli/config"
 	"github.com/m-mizutani/drone/pkg/domain/types"
 	"github.com/m-mizutani/drone/pkg/utils"
 	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExitFailure is exit status when the command failed.
+	ExitFailure = 1
+	// ExitPartialFailure is exit status when some feeds or rows failed to be imported and others succeeded.
+	ExitPartialFailure = 2
 )
 
+// ExitCode returns exit status of the command for the error returned by Run.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, types.ErrPartialFailure):
+		return ExitPartialFailure
+	default:
+		return ExitFailure
+	}
+}
+
 func Run(args []string) error {
 	var (
-		logger config.Logger
+		logger  config.Logger
+		tracing config.Tracing
+		file    config.File
 
-		logCloser func()
+		logCloser   func()
+		traceCloser func()
+
+		// runCtx has the root span of the run to attach trace ID to the error
+		runCtx  = context.Background()
+		runSpan trace.Span
 	)
 
 	app := cli.App{
 		Name:    "drone",
-		Flags:   mergeFlags([]cli.Flag{}, &logger),
+		Flags:   mergeFlags([]cli.Flag{}, &logger, &tracing, &file),
 		Version: types.AppVersion,
 		Commands: []*cli.Command{
-			subImport(),
+			subImport(&file),
+			subReprocess(),
+			subState(),
+			subSchema(),
+			subViews(),
+			subMatch(),
+			subExport(),
+			subAging(),
+			subProfiles(),
+			subSTIX(),
+			subServe(),
 		},
 		Before: func(ctx *cli.Context) error {
 			f, err := logger.Configure()
@@ -27,9 +68,30 @@ func Run(args []string) error {
 				return err
 			}
 			logCloser = f
+
+			tf, err := tracing.Configure(ctx.Context)
+			traceCloser = tf
+			if err != nil {
+				return err
+			}
+			// Commands inherit context of the root command
+			ctx.Context, runSpan = utils.StartSpan(ctx.Context, "drone",
+				attribute.String("drone.command", ctx.Args().First()),
+			)
+			runCtx = ctx.Context
+
+			if err := file.Configure(); err != nil {
+				return err
+			}
 			return nil
 		},
 		After: func(ctx *cli.Context) error {
+			if runSpan != nil {
+				runSpan.End()
+			}
+			if traceCloser != nil {
+				traceCloser()
+			}
 			if logCloser != nil {
 				logCloser()
 			}
@@ -38,7 +100,7 @@ func Run(args []string) error {
 	}
 
 	if err := app.Run(args); err != nil {
-		utils.HandleError("failed to run drone", err)
+		utils.HandleError(runCtx, "failed to run drone", err)
 		return err
 	}
 
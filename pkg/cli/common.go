@@ -1,6 +1,10 @@
 package cli
 
 import (
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/goerr"
 	"github.com/urfave/cli/v2"
 )
 
@@ -16,3 +20,27 @@ func mergeFlags(base []cli.Flag, configs ...flagConfig) []cli.Flag {
 
 	return ret
 }
+
+// parseTime parses time string given by command line option. RFC3339 and date only format (YYYY-MM-DD) are acceptable.
+func parseTime(v string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, goerr.Wrap(types.ErrInvalidOption, "invalid time format").With("time", v)
+}
+
+// parseFeedIDs returns feed IDs given as arguments.
+func parseFeedIDs(ctx *cli.Context) ([]types.FeedID, error) {
+	var feedIDs []types.FeedID
+	for _, arg := range ctx.Args().Slice() {
+		feedID := types.FeedID(arg)
+		if err := feedID.Validate(); err != nil {
+			return nil, goerr.Wrap(err).With("feeds", types.FeedIDs())
+		}
+		feedIDs = append(feedIDs, feedID)
+	}
+	return feedIDs, nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type Aging struct {
+	ttl      cli.StringSlice
+	halfLife cli.StringSlice
+}
+
+func (x *Aging) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "aging-ttl",
+			Category:    "aging",
+			Usage:       "TTL of indicators without expiration as 'feed=duration' (e.g. abuse.ch-feodo=720h). 0 means indicators never expire",
+			EnvVars:     []string{"DRONE_AGING_TTL"},
+			Destination: &x.ttl,
+		},
+		&cli.StringSliceFlag{
+			Name:        "aging-half-life",
+			Category:    "aging",
+			Usage:       "Half-life of indicator confidence as 'feed=duration' (e.g. otx-subscribed=720h). 0 means confidence doesn't decay",
+			EnvVars:     []string{"DRONE_AGING_HALF_LIFE"},
+			Destination: &x.halfLife,
+		},
+	}
+}
+
+// Apply overrides aging policy of the sources by --aging-ttl and --aging-half-life. Policies of feeds that are not given are kept as declared by the feed.
+func (x *Aging) Apply(sources []*model.IndicatorSource) error {
+	ttl, err := parseFeedDurations(x.ttl.Value())
+	if err != nil {
+		return goerr.Wrap(err, "invalid --aging-ttl")
+	}
+	halfLife, err := parseFeedDurations(x.halfLife.Value())
+	if err != nil {
+		return goerr.Wrap(err, "invalid --aging-half-life")
+	}
+
+	for _, src := range sources {
+		if d, ok := ttl[src.Feed]; ok {
+			src.Aging.TTL = d
+		}
+		if d, ok := halfLife[src.Feed]; ok {
+			src.Aging.HalfLife = d
+		}
+	}
+	return nil
+}
+
+// parseFeedDurations parses 'feed=duration' values.
+func parseFeedDurations(values []string) (map[types.FeedID]time.Duration, error) {
+	result := map[types.FeedID]time.Duration{}
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "format must be feed=duration").With("value", v)
+		}
+		feedID := types.FeedID(name)
+		if err := feedID.Validate(); err != nil {
+			return nil, goerr.Wrap(err).With("value", v)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "invalid duration").With("value", v)
+		}
+		result[feedID] = d
+	}
+	return result, nil
+}
@@ -0,0 +1,44 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/gt"
+	"github.com/urfave/cli/v2"
+)
+
+func TestAgingApply(t *testing.T) {
+	apply := func(args ...string) ([]*model.IndicatorSource, error) {
+		sources := []*model.IndicatorSource{
+			{Feed: types.FeedOTXSubscribed, Type: types.IndicatorIP, Aging: model.AgingPolicy{TTL: time.Hour, HalfLife: time.Hour}},
+			{Feed: types.FeedAbuseChFeodo, Type: types.IndicatorIP, Aging: model.AgingPolicy{TTL: time.Hour, HalfLife: time.Hour}},
+		}
+
+		var cfg config.Aging
+		var applyErr error
+		app := &cli.App{
+			Flags: cfg.Flags(),
+			Action: func(ctx *cli.Context) error {
+				applyErr = cfg.Apply(sources)
+				return nil
+			},
+		}
+		gt.NoError(t, app.Run(append([]string{"drone"}, args...)))
+		return sources, applyErr
+	}
+
+	sources := gt.R1(apply("--aging-ttl", "abuse.ch-feodo=720h", "--aging-half-life", "abuse.ch-feodo=0s")).NoError(t)
+	gt.V(t, sources[0].Aging).Equal(model.AgingPolicy{TTL: time.Hour, HalfLife: time.Hour})
+	gt.V(t, sources[1].Aging).Equal(model.AgingPolicy{TTL: 720 * time.Hour})
+
+	_, err := apply("--aging-ttl", "unknown=1h")
+	gt.Error(t, err)
+	_, err = apply("--aging-ttl", "abuse.ch-feodo")
+	gt.Error(t, err)
+	_, err = apply("--aging-half-life", "abuse.ch-feodo=-1h")
+	gt.Error(t, err)
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"context"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/infra/archive"
+	"github.com/urfave/cli/v2"
+)
+
+type Archive struct {
+	uri string
+}
+
+func (x *Archive) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "archive-uri",
+			Category:    "archive",
+			Usage:       "Archive of raw response bodies for reprocessing. gs://bucket/prefix for Cloud Storage, or local directory path. Archive is disabled if empty",
+			EnvVars:     []string{"DRONE_ARCHIVE_URI"},
+			Destination: &x.uri,
+		},
+	}
+}
+
+// Enabled returns true if archive URI is given.
+func (x *Archive) Enabled() bool {
+	return x.uri != ""
+}
+
+// Configure returns archive of the URI. If archive is not enabled, it returns archive.Discard.
+func (x *Archive) Configure(ctx context.Context) (interfaces.Archive, error) {
+	if !x.Enabled() {
+		return archive.Discard, nil
+	}
+	return archive.New(ctx, x.uri)
+}
@@ -16,6 +16,10 @@ type BigQuery struct {
 	datasetID string
 	saKeyData string `masq:"secret"`
 	saKeyFile string
+
+	writeMode  string
+	batchRows  int
+	batchBytes int
 }
 
 func (x *BigQuery) Flags() []cli.Flag {
@@ -36,8 +40,9 @@ func (x *BigQuery) Flags() []cli.Flag {
 		},
 		&cli.StringFlag{
 			Name:        "bq-sa-key-data",
-			Usage:       "BigQuery service account key data",
+			Usage:       "BigQuery service account key data" + SecretUsage,
 			Destination: &x.saKeyData,
+			Action:      SecretAction(&x.saKeyData),
 			EnvVars:     []string{"DRONE_BIGQUERY_SA_KEY_DATA"},
 		},
 		&cli.StringFlag{
@@ -46,6 +51,27 @@ func (x *BigQuery) Flags() []cli.Flag {
 			Destination: &x.saKeyFile,
 			EnvVars:     []string{"DRONE_BIGQUERY_SA_KEY_FILE"},
 		},
+		&cli.StringFlag{
+			Name:        "bq-write-mode",
+			Usage:       "BigQuery write mode [committed|pending|streaming]. 'committed' and 'pending' use Storage Write API, 'streaming' uses legacy streaming insert",
+			Destination: &x.writeMode,
+			EnvVars:     []string{"DRONE_BIGQUERY_WRITE_MODE"},
+			Value:       string(bq.WriteModeCommitted),
+		},
+		&cli.IntFlag{
+			Name:        "bq-batch-rows",
+			Usage:       "Maximum number of rows in one insert batch",
+			Destination: &x.batchRows,
+			EnvVars:     []string{"DRONE_BIGQUERY_BATCH_ROWS"},
+			Value:       500,
+		},
+		&cli.IntFlag{
+			Name:        "bq-batch-bytes",
+			Usage:       "Maximum bytes of rows in one insert batch",
+			Destination: &x.batchBytes,
+			EnvVars:     []string{"DRONE_BIGQUERY_BATCH_BYTES"},
+			Value:       5 * 1024 * 1024,
+		},
 	}
 }
 
@@ -68,6 +94,8 @@ func (x *BigQuery) Configure(ctx context.Context) (interfaces.BigQuery, error) {
 	return bq.New(ctx,
 		x.projectID,
 		x.datasetID,
-		options...,
+		bq.WithClientOptions(options...),
+		bq.WithWriteMode(bq.WriteMode(x.writeMode)),
+		bq.WithBatchSize(x.batchRows, x.batchBytes),
 	)
 }
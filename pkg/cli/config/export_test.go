@@ -0,0 +1,5 @@
+package config
+
+func NewFileWithPath(path string) *File {
+	return &File{path: path}
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a YAML configuration file of drone. Values in the file are used as default of environment variables, then environment variables and command line options override them.
+type File struct {
+	path string
+
+	feeds map[types.FeedID]*FeedSetting
+}
+
+func (x *File) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "config",
+			Aliases:     []string{"c"},
+			Usage:       "Path to YAML configuration file. Values can be secret references (env:NAME, file:PATH or sm://projects/PROJECT/secrets/SECRET[/versions/VERSION])",
+			EnvVars:     []string{"DRONE_CONFIG"},
+			Destination: &x.path,
+		},
+	}
+}
+
+// FeedSetting is a setting of a feed in configuration file. A feed in the file is enabled unless enabled is false.
+type FeedSetting struct {
+	Enabled  *bool             `yaml:"enabled"`
+	Interval time.Duration     `yaml:"interval"`
+	Options  map[string]string `yaml:"options"`
+}
+
+// IsEnabled returns true if the feed is enabled.
+func (x *FeedSetting) IsEnabled() bool {
+	return x.Enabled == nil || *x.Enabled
+}
+
+// feedOptionEnvVars is environment variables of feed options in configuration file.
+var feedOptionEnvVars = map[types.FeedID]map[string]string{
+	types.FeedOTXSubscribed: {
+		"api_key":            "DRONE_OTX_API_KEY",
+		"base_url":           "DRONE_OTX_BASE_URL",
+		"parse_error":        "DRONE_OTX_PARSE_ERROR",
+		"checkpoint_max_age": "DRONE_OTX_CHECKPOINT_MAX_AGE",
+	},
+	types.FeedAbuseChFeodo: {
+		"url":         "DRONE_ABUSECH_FEODO_URL",
+		"parse_error": "DRONE_ABUSECH_FEODO_PARSE_ERROR",
+	},
+}
+
+// fileContent is schema of configuration file. Each field has environment variable that the value is applied to.
+type fileContent struct {
+	BigQuery struct {
+		ProjectID  string `yaml:"project_id" env:"DRONE_BIGQUERY_PROJECT_ID"`
+		DatasetID  string `yaml:"dataset_id" env:"DRONE_BIGQUERY_DATASET_ID"`
+		SAKeyData  string `yaml:"sa_key_data" env:"DRONE_BIGQUERY_SA_KEY_DATA"`
+		SAKeyFile  string `yaml:"sa_key_file" env:"DRONE_BIGQUERY_SA_KEY_FILE"`
+		WriteMode  string `yaml:"write_mode" env:"DRONE_BIGQUERY_WRITE_MODE"`
+		BatchRows  string `yaml:"batch_rows" env:"DRONE_BIGQUERY_BATCH_ROWS"`
+		BatchBytes string `yaml:"batch_bytes" env:"DRONE_BIGQUERY_BATCH_BYTES"`
+	} `yaml:"bigquery"`
+
+	Firestore struct {
+		ProjectID  string `yaml:"project_id" env:"DRONE_FIRESTORE_PROJECT_ID"`
+		DatabaseID string `yaml:"database_id" env:"DRONE_FIRESTORE_DATABASE_ID"`
+	} `yaml:"firestore"`
+
+	Sentry struct {
+		DSN string `yaml:"dsn" env:"DRONE_SENTRY_DSN"`
+		Env string `yaml:"env" env:"DRONE_SENTRY_ENV"`
+	} `yaml:"sentry"`
+
+	HTTP struct {
+		UserAgent  string   `yaml:"user_agent" env:"DRONE_HTTP_USER_AGENT"`
+		Timeout    string   `yaml:"timeout" env:"DRONE_HTTP_TIMEOUT"`
+		MaxRetries string   `yaml:"max_retries" env:"DRONE_HTTP_MAX_RETRIES"`
+		RateLimits []string `yaml:"rate_limits" env:"DRONE_HTTP_RATE_LIMIT"`
+		Proxy      string   `yaml:"proxy" env:"DRONE_HTTP_PROXY"`
+		CAFile     string   `yaml:"ca_file" env:"DRONE_HTTP_CA_FILE"`
+		ClientCert string   `yaml:"client_cert" env:"DRONE_HTTP_CLIENT_CERT"`
+		ClientKey  string   `yaml:"client_key" env:"DRONE_HTTP_CLIENT_KEY"`
+	} `yaml:"http"`
+
+	Notify struct {
+		SlackURL   string   `yaml:"slack_url" env:"DRONE_NOTIFY_SLACK_URL"`
+		WebhookURL string   `yaml:"webhook_url" env:"DRONE_NOTIFY_WEBHOOK_URL"`
+		Alerts     []string `yaml:"alerts" env:"DRONE_NOTIFY_ALERT"`
+		Templates  []string `yaml:"templates" env:"DRONE_NOTIFY_TEMPLATE"`
+	} `yaml:"notify"`
+
+	Aging struct {
+		TTL      []string `yaml:"ttl" env:"DRONE_AGING_TTL"`
+		HalfLife []string `yaml:"half_life" env:"DRONE_AGING_HALF_LIFE"`
+	} `yaml:"aging"`
+
+	Archive struct {
+		URI string `yaml:"uri" env:"DRONE_ARCHIVE_URI"`
+	} `yaml:"archive"`
+
+	Feeds map[types.FeedID]*FeedSetting `yaml:"feeds"`
+}
+
+// Configure loads the configuration file and sets its values to environment variables that are not set yet. Secret references in values are set as they are, and they are resolved by secret options (SecretAction), then resolved secrets are not exposed to environment variables of the process. It does nothing if the file is not given.
+func (x *File) Configure() error {
+	if x.path == "" {
+		return nil
+	}
+
+	raw, err := os.ReadFile(filepath.Clean(x.path))
+	if err != nil {
+		return goerr.Wrap(err, "Fail to read config file").With("path", x.path)
+	}
+	content, err := parseFile(raw)
+	if err != nil {
+		return goerr.Wrap(err).With("path", x.path)
+	}
+
+	envs := content.envVars()
+	names := make([]string, 0, len(envs))
+	for name := range envs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := os.LookupEnv(name); ok {
+			utils.Logger().Debug("Config file value is overridden by environment variable", "env", name)
+			continue
+		}
+		// List values are joined with comma in the same way as environment variables of list options
+		if err := os.Setenv(name, strings.Join(envs[name], ",")); err != nil {
+			return goerr.Wrap(err, "Fail to set config value").With("env", name)
+		}
+	}
+
+	x.feeds = content.Feeds
+	utils.Logger().Info("Loaded config file", "path", x.path, "feeds", len(x.feeds))
+	return nil
+}
+
+// Feeds returns settings of feeds in the configuration file.
+func (x *File) Feeds() map[types.FeedID]*FeedSetting {
+	return x.feeds
+}
+
+func parseFile(raw []byte) (*fileContent, error) {
+	var content fileContent
+	decoder := yaml.NewDecoder(strings.NewReader(string(raw)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&content); err != nil {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "invalid config file").With("err", err.Error())
+	}
+
+	for feedID, setting := range content.Feeds {
+		if err := feedID.Validate(); err != nil {
+			return nil, goerr.Wrap(err).With("feeds", types.FeedIDs())
+		}
+		if setting == nil {
+			content.Feeds[feedID] = &FeedSetting{}
+			continue
+		}
+		if setting.Interval < 0 {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "interval of feed must not be negative").With("feed", feedID)
+		}
+		for key := range setting.Options {
+			if _, ok := feedOptionEnvVars[feedID][key]; !ok {
+				return nil, goerr.Wrap(types.ErrInvalidOption, "unknown feed option").With("feed", feedID).With("option", key)
+			}
+		}
+	}
+
+	return &content, nil
+}
+
+// envVars returns values of environment variables to be set by the configuration file. A value of string field has one element.
+func (x *fileContent) envVars() map[string][]string {
+	envs := map[string][]string{}
+
+	sections := reflect.ValueOf(x).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		if section.Kind() != reflect.Struct {
+			continue
+		}
+		for j := 0; j < section.NumField(); j++ {
+			name := section.Type().Field(j).Tag.Get("env")
+			switch v := section.Field(j).Interface().(type) {
+			case string:
+				if v != "" {
+					envs[name] = []string{v}
+				}
+			case []string:
+				if len(v) > 0 {
+					envs[name] = v
+				}
+			}
+		}
+	}
+
+	for feedID, setting := range x.Feeds {
+		for key, value := range setting.Options {
+			envs[feedOptionEnvVars[feedID][key]] = []string{value}
+		}
+	}
+
+	return envs
+}
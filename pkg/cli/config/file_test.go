@@ -0,0 +1,118 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/gt"
+	"github.com/urfave/cli/v2"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "drone.yaml")
+	gt.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestFile(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key.json")
+	gt.NoError(t, os.WriteFile(keyFile, []byte(`{"type":"service_account"}`+"\n"), 0600))
+
+	path := writeConfig(t, `
+bigquery:
+  project_id: my-project
+  dataset_id: drone
+  sa_key_data: file:`+keyFile+`
+  batch_rows: 1000
+firestore:
+  project_id: my-project
+  database_id: drone
+http:
+  rate_limits: [otx=0.5:1, abuse.ch=1]
+feeds:
+  otx-subscribed:
+    interval: 1h
+    options:
+      api_key: sm://projects/my-project/secrets/otx-api-key
+  abuse.ch-feodo:
+    enabled: false
+`)
+
+	for _, name := range []string{
+		"DRONE_BIGQUERY_PROJECT_ID",
+		"DRONE_BIGQUERY_DATASET_ID",
+		"DRONE_BIGQUERY_SA_KEY_DATA",
+		"DRONE_BIGQUERY_BATCH_ROWS",
+		"DRONE_FIRESTORE_PROJECT_ID",
+		"DRONE_FIRESTORE_DATABASE_ID",
+		"DRONE_HTTP_RATE_LIMIT",
+		"DRONE_OTX_API_KEY",
+	} {
+		// t.Setenv restores variables after the test, then unset them after registration
+		t.Setenv(name, "")
+		gt.NoError(t, os.Unsetenv(name))
+	}
+	// Environment variable overrides config file
+	t.Setenv("DRONE_BIGQUERY_DATASET_ID", "override")
+
+	file := config.NewFileWithPath(path)
+	gt.NoError(t, file.Configure())
+
+	gt.V(t, os.Getenv("DRONE_BIGQUERY_PROJECT_ID")).Equal("my-project")
+	gt.V(t, os.Getenv("DRONE_BIGQUERY_DATASET_ID")).Equal("override")
+	// Secret references are not resolved into environment variables
+	gt.V(t, os.Getenv("DRONE_BIGQUERY_SA_KEY_DATA")).Equal("file:" + keyFile)
+	gt.V(t, os.Getenv("DRONE_BIGQUERY_BATCH_ROWS")).Equal("1000")
+	gt.V(t, os.Getenv("DRONE_HTTP_RATE_LIMIT")).Equal("otx=0.5:1,abuse.ch=1")
+	gt.V(t, os.Getenv("DRONE_OTX_API_KEY")).Equal("sm://projects/my-project/secrets/otx-api-key")
+
+	// The reference is resolved by secret option
+	var saKeyData string
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "bq-sa-key-data",
+				EnvVars:     []string{"DRONE_BIGQUERY_SA_KEY_DATA"},
+				Destination: &saKeyData,
+				Action:      config.SecretAction(&saKeyData),
+			},
+		},
+		Action: func(ctx *cli.Context) error { return nil },
+	}
+	gt.NoError(t, app.Run([]string{"drone"}))
+	gt.V(t, saKeyData).Equal(`{"type":"service_account"}`)
+
+	feeds := file.Feeds()
+	gt.V(t, len(feeds)).Equal(2)
+	gt.True(t, feeds[types.FeedOTXSubscribed].IsEnabled())
+	gt.V(t, feeds[types.FeedOTXSubscribed].Interval).Equal(time.Hour)
+	gt.False(t, feeds[types.FeedAbuseChFeodo].IsEnabled())
+}
+
+func TestFileInvalid(t *testing.T) {
+	testCases := map[string]string{
+		"unknown field":       "bigquery:\n  project: x\n",
+		"unknown feed":        "feeds:\n  unknown: {}\n",
+		"unknown feed option": "feeds:\n  abuse.ch-feodo:\n    options:\n      api_key: x\n",
+		"negative interval":   "feeds:\n  abuse.ch-feodo:\n    interval: -1h\n",
+	}
+
+	for name, content := range testCases {
+		t.Run(name, func(t *testing.T) {
+			file := config.NewFileWithPath(writeConfig(t, content))
+			err := file.Configure()
+			gt.True(t, errors.Is(err, types.ErrInvalidOption))
+		})
+	}
+
+	t.Run("no config file", func(t *testing.T) {
+		file := config.NewFileWithPath("")
+		gt.NoError(t, file.Configure())
+		gt.V(t, len(file.Feeds())).Equal(0)
+	})
+}
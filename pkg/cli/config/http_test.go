@@ -0,0 +1,32 @@
+package config_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/gt"
+	"github.com/urfave/cli/v2"
+)
+
+func TestHTTPRateLimit(t *testing.T) {
+	configure := func(args ...string) error {
+		var cfg config.HTTP
+		var configErr error
+		app := &cli.App{
+			Flags: cfg.Flags(),
+			Action: func(ctx *cli.Context) error {
+				_, configErr = cfg.Configure()
+				return nil
+			},
+		}
+		gt.NoError(t, app.Run(append([]string{"drone"}, args...)))
+		return configErr
+	}
+
+	gt.NoError(t, configure("--http-rate-limit", "otx=0.5:1", "--http-rate-limit", "abuse.ch=2"))
+
+	err := configure("--http-rate-limit", "otz=0.5")
+	gt.True(t, errors.Is(err, types.ErrInvalidOption))
+}
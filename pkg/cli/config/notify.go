@@ -0,0 +1,104 @@
+package config
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/notify"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type Notify struct {
+	slackURL   string `masq:"secret"`
+	webhookURL string `masq:"secret"`
+	alertTypes cli.StringSlice
+	templates  cli.StringSlice
+}
+
+func (x *Notify) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "notify-slack-url",
+			Category:    "notify",
+			Usage:       "Slack incoming webhook URL to send alerts" + SecretUsage,
+			EnvVars:     []string{"DRONE_NOTIFY_SLACK_URL"},
+			Destination: &x.slackURL,
+			Action:      SecretAction(&x.slackURL),
+		},
+		&cli.StringFlag{
+			Name:        "notify-webhook-url",
+			Category:    "notify",
+			Usage:       "URL of generic webhook to send alerts as JSON" + SecretUsage,
+			EnvVars:     []string{"DRONE_NOTIFY_WEBHOOK_URL"},
+			Destination: &x.webhookURL,
+			Action:      SecretAction(&x.webhookURL),
+		},
+		&cli.StringSliceFlag{
+			Name:        "notify-alert",
+			Category:    "notify",
+			Usage:       "Alert types to be sent [match|import_failure|feed_event]. All types are sent by default",
+			EnvVars:     []string{"DRONE_NOTIFY_ALERT"},
+			Destination: &x.alertTypes,
+		},
+		&cli.StringSliceFlag{
+			Name:        "notify-template",
+			Category:    "notify",
+			Usage:       "Message template of alert type as 'type=template' (text/template). 'type=@path' reads template from file",
+			EnvVars:     []string{"DRONE_NOTIFY_TEMPLATE"},
+			Destination: &x.templates,
+		},
+	}
+}
+
+// Configure returns Notifier that sends alerts by httpClient, e.g. built by HTTP.Client. Sent alerts are recorded in db. If no target is configured, it returns notify.Discard.
+func (x *Notify) Configure(db interfaces.Database, httpClient *http.Client) (interfaces.Notifier, error) {
+	var options []notify.Option
+	if x.slackURL != "" {
+		options = append(options, notify.WithTarget(notify.NewSlack(x.slackURL, httpClient)))
+	}
+	if x.webhookURL != "" {
+		options = append(options, notify.WithTarget(notify.NewWebhook(x.webhookURL, httpClient)))
+	}
+	if len(options) == 0 {
+		return notify.Discard, nil
+	}
+
+	if values := x.alertTypes.Value(); len(values) > 0 {
+		var alertTypes []types.AlertType
+		for _, v := range values {
+			t := types.AlertType(v)
+			if err := t.Validate(); err != nil {
+				return nil, err
+			}
+			alertTypes = append(alertTypes, t)
+		}
+		options = append(options, notify.WithAlertTypes(alertTypes...))
+	}
+
+	for _, v := range x.templates.Value() {
+		name, tmpl, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "template must be 'type=template'").With("template", v)
+		}
+		t := types.AlertType(name)
+		if err := t.Validate(); err != nil {
+			return nil, err
+		}
+
+		if path, ok := strings.CutPrefix(tmpl, "@"); ok {
+			raw, err := os.ReadFile(filepath.Clean(path))
+			if err != nil {
+				return nil, goerr.Wrap(err, "Fail to read template file").With("path", path)
+			}
+			tmpl = string(raw)
+		}
+		options = append(options, notify.WithTemplate(t, tmpl))
+	}
+
+	return notify.New(db, options...)
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"github.com/m-mizutani/drone/pkg/infra/secret"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+// SecretUsage is appended to usage of secret options.
+const SecretUsage = ". Secret reference (sm://projects/PROJECT/secrets/SECRET[/versions/VERSION], file:PATH or env:NAME) is resolved at startup"
+
+// secrets is shared by all secret options, then each secret is fetched once in a run.
+var secrets = secret.New()
+
+// SecretAction returns flag action that replaces a secret reference in the option value (e.g. sm://projects/p/secrets/s) with the secret. The action runs for a value given by either command line or environment variable. Destination of the option must be dst, and the field should have `masq:"secret"` tag to be masked in logs.
+func SecretAction(dst *string) func(*cli.Context, string) error {
+	return func(ctx *cli.Context, v string) error {
+		if !secret.IsReference(v) {
+			return nil
+		}
+
+		resolved, err := secrets.Resolve(ctx.Context, v)
+		if err != nil {
+			return goerr.Wrap(err, "Fail to resolve secret option")
+		}
+		*dst = resolved
+		return nil
+	}
+}
@@ -0,0 +1,40 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/gt"
+	"github.com/urfave/cli/v2"
+)
+
+func TestSecretAction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	gt.NoError(t, os.WriteFile(path, []byte("secret-from-file\n"), 0600))
+	t.Setenv("TEST_DRONE_SECRET_SOURCE", "secret-from-env")
+
+	run := func(env string, args ...string) string {
+		t.Setenv("TEST_DRONE_SECRET", env)
+		var dst string
+		app := &cli.App{
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "secret",
+					EnvVars:     []string{"TEST_DRONE_SECRET"},
+					Destination: &dst,
+					Action:      config.SecretAction(&dst),
+				},
+			},
+			Action: func(ctx *cli.Context) error { return nil },
+		}
+		gt.NoError(t, app.Run(append([]string{"drone"}, args...)))
+		return dst
+	}
+
+	gt.V(t, run("file:"+path)).Equal("secret-from-file")
+	gt.V(t, run("", "--secret", "env:TEST_DRONE_SECRET_SOURCE")).Equal("secret-from-env")
+	gt.V(t, run("plain-value")).Equal("plain-value")
+	gt.V(t, run("")).Equal("")
+}
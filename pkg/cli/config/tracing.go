@@ -0,0 +1,120 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/secret"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+type Tracing struct {
+	endpoint    string
+	headers     cli.StringSlice
+	sampleRatio float64
+	serviceName string
+}
+
+const tracingShutdownTimeout = 10 * time.Second
+
+func (x *Tracing) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "otlp-endpoint",
+			Category:    "tracing",
+			Usage:       "OTLP/HTTP endpoint URL to export traces, e.g. http://localhost:4318. Tracing is disabled if empty",
+			EnvVars:     []string{"DRONE_OTLP_ENDPOINT"},
+			Destination: &x.endpoint,
+		},
+		&cli.StringSliceFlag{
+			Name:        "otlp-header",
+			Category:    "tracing",
+			Usage:       "Header of OTLP export request in key=value format" + SecretUsage,
+			EnvVars:     []string{"DRONE_OTLP_HEADER"},
+			Destination: &x.headers,
+		},
+		&cli.Float64Flag{
+			Name:        "trace-sample-ratio",
+			Category:    "tracing",
+			Usage:       "Ratio of traces to be sampled [0.0-1.0]",
+			EnvVars:     []string{"DRONE_TRACE_SAMPLE_RATIO"},
+			Value:       1.0,
+			Destination: &x.sampleRatio,
+		},
+		&cli.StringFlag{
+			Name:        "trace-service-name",
+			Category:    "tracing",
+			Usage:       "Service name of traces",
+			EnvVars:     []string{"DRONE_TRACE_SERVICE_NAME"},
+			Value:       "drone",
+			Destination: &x.serviceName,
+		},
+	}
+}
+
+// Configure sets up global tracer provider exporting spans to OTLP endpoint, and returns closer function that flushes remaining spans. If endpoint is not set, spans are discarded and closer does nothing.
+func (x *Tracing) Configure(ctx context.Context) (func(), error) {
+	closer := func() {}
+	if x.endpoint == "" {
+		return closer, nil
+	}
+	if x.sampleRatio < 0 || 1 < x.sampleRatio {
+		return closer, goerr.Wrap(types.ErrInvalidOption, "--trace-sample-ratio must be between 0 and 1").With("ratio", x.sampleRatio)
+	}
+
+	headers := map[string]string{}
+	for _, h := range x.headers.Value() {
+		key, value, ok := strings.Cut(h, "=")
+		if !ok || key == "" {
+			return closer, goerr.Wrap(types.ErrInvalidOption, "OTLP header must be key=value format").With("key", key)
+		}
+		if secret.IsReference(value) {
+			resolved, err := secrets.Resolve(ctx, value)
+			if err != nil {
+				return closer, goerr.Wrap(err, "Fail to resolve OTLP header").With("key", key)
+			}
+			value = resolved
+		}
+		headers[key] = value
+	}
+
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpointURL(x.endpoint),
+		otlptracehttp.WithHeaders(headers),
+	)
+	if err != nil {
+		return closer, goerr.Wrap(err, "Fail to create OTLP exporter").With("endpoint", x.endpoint)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(x.sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(x.serviceName),
+			semconv.ServiceVersion(types.AppVersion),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	utils.Logger().Info("Enable tracing", "endpoint", x.endpoint, "sample_ratio", x.sampleRatio)
+
+	closer = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			utils.Logger().Error("Fail to shutdown tracer provider", utils.ErrLog(goerr.Wrap(err)))
+		}
+	}
+	return closer, nil
+}
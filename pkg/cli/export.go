@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/export"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type exportConfig struct {
+	bq config.BigQuery
+
+	format        string
+	output        string
+	types         cli.StringSlice
+	maxAge        time.Duration
+	minConfidence int64
+}
+
+func (x *exportConfig) Flags() []cli.Flag {
+	formats := make([]string, len(export.Formats()))
+	for i, f := range export.Formats() {
+		formats[i] = string(f)
+	}
+
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "format",
+			Aliases:     []string{"f"},
+			Category:    "export",
+			Usage:       "Output format [" + strings.Join(formats, "|") + "]",
+			EnvVars:     []string{"DRONE_EXPORT_FORMAT"},
+			Required:    true,
+			Destination: &x.format,
+		},
+		&cli.StringFlag{
+			Name:        "output",
+			Aliases:     []string{"o"},
+			Category:    "export",
+			Usage:       "Output file path. Default is stdout",
+			EnvVars:     []string{"DRONE_EXPORT_OUTPUT"},
+			Destination: &x.output,
+		},
+		&cli.StringSliceFlag{
+			Name:        "type",
+			Category:    "export",
+			Usage:       "Indicator type to be exported [ip|domain]. Default is all types written in the format",
+			EnvVars:     []string{"DRONE_EXPORT_TYPE"},
+			Destination: &x.types,
+		},
+		&cli.DurationFlag{
+			Name:        "max-age",
+			Category:    "export",
+			Usage:       "Exclude indicators that are not seen in the duration, e.g. 720h. Zero means no limit",
+			EnvVars:     []string{"DRONE_EXPORT_MAX_AGE"},
+			Destination: &x.maxAge,
+		},
+		&cli.Int64Flag{
+			Name:        "min-confidence",
+			Category:    "export",
+			Usage:       "Exclude indicators that have lower confidence (0-100)",
+			EnvVars:     []string{"DRONE_EXPORT_MIN_CONFIDENCE"},
+			Destination: &x.minConfidence,
+		},
+	}
+}
+
+func (x *exportConfig) filter(feedIDs []types.FeedID) export.Filter {
+	filter := export.Filter{
+		Feeds:         feedIDs,
+		MaxAge:        x.maxAge,
+		MinConfidence: x.minConfidence,
+	}
+	for _, t := range x.types.Value() {
+		filter.Types = append(filter.Types, types.IndicatorType(t))
+	}
+	return filter
+}
+
+func subExport() *cli.Command {
+	var cfg exportConfig
+
+	return &cli.Command{
+		Name:      "export",
+		Usage:     "Export imported indicators as blocklist, DNS RPZ zone or IDS rules",
+		ArgsUsage: "[feedID...]",
+		Flags:     mergeFlags([]cli.Flag{}, &cfg.bq, &cfg),
+		Action: func(ctx *cli.Context) error {
+			format := export.Format(cfg.format)
+			if err := format.Validate(); err != nil {
+				return err
+			}
+			feedIDs, err := parseFeedIDs(ctx)
+			if err != nil {
+				return err
+			}
+			filter := cfg.filter(feedIDs)
+			if err := filter.Validate(); err != nil {
+				return err
+			}
+
+			sources, err := feed.Indicators()
+			if err != nil {
+				return err
+			}
+			bqClient, err := cfg.bq.Configure(ctx.Context)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to configure BigQuery")
+			}
+			defer utils.SafeClose(bqClient)
+
+			var w io.Writer = os.Stdout
+			if cfg.output != "" {
+				fd, err := os.Create(cfg.output)
+				if err != nil {
+					return goerr.Wrap(err, "Fail to create output file").With("path", cfg.output)
+				}
+				defer fd.Close()
+				w = fd
+			}
+
+			return export.Export(ctx.Context, w, bqClient, sources, format, filter)
+		},
+	}
+}
@@ -1,31 +1,367 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
 	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/deadletter"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
 	"github.com/m-mizutani/drone/pkg/feed/abuse_ch"
 	"github.com/m-mizutani/drone/pkg/feed/otx"
 	"github.com/m-mizutani/drone/pkg/infra"
+	"github.com/m-mizutani/drone/pkg/infra/archive"
+	"github.com/m-mizutani/drone/pkg/infra/dryrun"
+	"github.com/m-mizutani/drone/pkg/infra/notify"
+	"github.com/m-mizutani/drone/pkg/utils"
 	"github.com/m-mizutani/goerr"
 	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type importConfig struct {
 	bq        config.BigQuery
 	firestore config.Firestore
 	sentry    config.Sentry
+	http      config.HTTP
+	notify    config.Notify
+	archive   config.Archive
+	aging     config.Aging
+
+	since  string
+	rewind bool
+	dedup  string
+
+	summaryOutput   string
+	refreshProfiles bool
+
+	dryRun      bool
+	dumpRecords bool
+	// report is set by configure in dry run mode
+	report *dryrun.Report
+}
+
+func (x *importConfig) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "since",
+			Category:    "import",
+			Usage:       "Override latest record time stored in database (RFC3339 or YYYY-MM-DD)",
+			EnvVars:     []string{"DRONE_IMPORT_SINCE"},
+			Destination: &x.since,
+		},
+		&cli.BoolFlag{
+			Name:        "rewind",
+			Category:    "import",
+			Usage:       "Rewind stored latest record time to --since before import. Without it, the stored time never goes backward",
+			EnvVars:     []string{"DRONE_IMPORT_REWIND"},
+			Destination: &x.rewind,
+		},
+		dedupFlag("import", "DRONE_IMPORT_DEDUP", &x.dedup),
+		&cli.StringFlag{
+			Name:        "summary-output",
+			Category:    "import",
+			Usage:       "Write JSON summary of the run to the file. '-' means stdout (stderr with --dump-records), and empty disables it",
+			EnvVars:     []string{"DRONE_IMPORT_SUMMARY_OUTPUT"},
+			Value:       "-",
+			Destination: &x.summaryOutput,
+		},
+		&cli.BoolFlag{
+			Name:        "refresh-profiles",
+			Category:    "import",
+			Usage:       "Refresh indicator profiles correlated across feeds after records are inserted",
+			EnvVars:     []string{"DRONE_IMPORT_REFRESH_PROFILES"},
+			Value:       true,
+			Destination: &x.refreshProfiles,
+		},
+		&cli.BoolFlag{
+			Name:        "dry-run",
+			Category:    "import",
+			Usage:       "Fetch and transform feed data, and print summary without writing to BigQuery and Firestore",
+			EnvVars:     []string{"DRONE_IMPORT_DRY_RUN"},
+			Destination: &x.dryRun,
+		},
+		&cli.BoolFlag{
+			Name:        "dump-records",
+			Category:    "import",
+			Usage:       "Dump records to be inserted as JSONL to stdout in dry run mode. Summary is printed to stderr",
+			EnvVars:     []string{"DRONE_IMPORT_DUMP_RECORDS"},
+			Destination: &x.dumpRecords,
+		},
+	}
+}
+
+func (x *importConfig) dedupMode() (types.DedupMode, error) {
+	return parseDedupMode(x.dedup)
+}
+
+// sinceTime returns parsed --since value. It returns nil if --since is not set.
+func (x *importConfig) sinceTime() (*time.Time, error) {
+	if x.since == "" {
+		if x.rewind {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "--rewind requires --since")
+		}
+		return nil, nil
+	}
+
+	t, err := parseTime(x.since)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// configure builds infra clients for the feed. If --rewind is set, latest record time of the feed is reset to --since.
+func (x *importConfig) configure(ctx context.Context, feedID types.FeedID) (*infra.Clients, error) {
+	if x.dumpRecords && !x.dryRun {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "--dump-records requires --dry-run")
+	}
+
+	bqClient, err := x.bq.Configure(ctx)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to configure BigQuery")
+	}
+	var dbClient interfaces.Database
+	dbClient, err = x.firestore.Configure(ctx)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to configure Firestore")
+	}
+
+	if x.dryRun {
+		x.report = dryrun.NewReport()
+		var options []dryrun.Option
+		if x.dumpRecords {
+			options = append(options, dryrun.WithDump(os.Stdout))
+		}
+		bqClient = dryrun.NewBigQuery(bqClient, x.report, options...)
+		dbClient = dryrun.NewDatabase(dbClient, x.report)
+	}
+
+	httpClient, err := x.http.Configure()
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to configure HTTP client")
+	}
+
+	since, err := x.sinceTime()
+	if err != nil {
+		return nil, err
+	}
+	if x.rewind && since != nil {
+		utils.Logger().WarnContext(ctx, "Rewind latest record time", "feed", feedID, "since", since)
+		if err := dbClient.SetImportLog(ctx, feedID, &model.ImportLog{
+			LatestRecord: *since,
+			CheckedAt:    time.Now(),
+		}); err != nil {
+			return nil, goerr.Wrap(err, "Fail to rewind import log").With("feed", feedID)
+		}
+	}
+
+	// Alerts are not sent and responses are not archived in dry run
+	notifier := notify.Discard
+	archiveClient := archive.Discard
+	if !x.dryRun {
+		notifyClient, err := x.http.Client()
+		if err != nil {
+			return nil, goerr.Wrap(err, "Fail to configure HTTP client")
+		}
+		if notifier, err = x.notify.Configure(dbClient, notifyClient); err != nil {
+			return nil, goerr.Wrap(err, "Fail to configure notifier")
+		}
+		if archiveClient, err = x.archive.Configure(ctx); err != nil {
+			return nil, goerr.Wrap(err, "Fail to configure archive")
+		}
+	}
+
+	return infra.New(
+		infra.WithBigQuery(bqClient),
+		infra.WithDatabase(dbClient),
+		infra.WithHTTP(httpClient),
+		infra.WithNotifier(notifier),
+		infra.WithArchive(archiveClient),
+	), nil
+}
+
+// importFeed configures clients and imports the feed by f in a span of the feed. It returns summary of the import even if the import fails. If it fails, import failure alert is sent. The alert of the same feed is sent at most once a day.
+func (x *importConfig) importFeed(ctx context.Context, feedID types.FeedID, f func(ctx context.Context, clients *infra.Clients) (*model.ImportSummary, error)) (summary *model.ImportSummary, err error) {
+	ctx, span := utils.StartSpan(ctx, "import", utils.AttrFeedID.String(feedID.String()))
+	defer func() {
+		span.SetAttributes(
+			attribute.String("drone.status", string(summary.Status)),
+			attribute.Int("drone.pages_fetched", summary.PagesFetched),
+			attribute.Int("drone.records_parsed", summary.RecordsParsed),
+			attribute.Int("drone.records_inserted", summary.RecordsInserted),
+			attribute.Int("drone.rows_failed", summary.RowsFailed),
+		)
+		utils.EndSpan(span, err)
+	}()
+
+	clients, err := x.configure(ctx, feedID)
+	if err != nil {
+		summary = model.NewImportSummary(feedID)
+		summary.Finish(err)
+		return summary, err
+	}
+	defer utils.SafeClose(clients)
+
+	summary, err = f(ctx, clients)
+	if summary == nil {
+		summary = model.NewImportSummary(feedID)
+	}
+	summary.Finish(err)
+	if err != nil {
+		notifyImportFailure(ctx, clients, feedID, err)
+		return summary, err
+	}
+
+	return summary, x.printReport()
+}
+
+func notifyImportFailure(ctx context.Context, clients *infra.Clients, feedID types.FeedID, err error) {
+	now := time.Now().UTC()
+	alert := &model.Alert{
+		Type:      types.AlertImportFailure,
+		Key:       string(feedID) + "/" + now.Format("2006-01-02"),
+		Title:     "Import of " + string(feedID) + " failed",
+		CreatedAt: now,
+		Data: struct {
+			Feed  types.FeedID
+			Error string
+		}{
+			Feed:  feedID,
+			Error: err.Error(),
+		},
+	}
+	if notifyErr := clients.Notifier().Notify(ctx, alert); notifyErr != nil {
+		utils.HandleError(ctx, "Fail to notify import failure", notifyErr)
+	}
+}
+
+// finishRun refreshes active indicators view and indicator profiles, writes summary of the run into --summary-output and returns error by status of the run.
+func (x *importConfig) finishRun(ctx context.Context, err error, summaries ...*model.ImportSummary) error {
+	x.refreshAfterImport(ctx, summaries)
+	return finishRun(ctx, x.summaryOutput, x.dumpRecords, err, summaries...)
+}
+
+// refreshAfterImport creates or updates active indicators view, and refreshes indicator profiles if --refresh-profiles is set, once per run if any feed inserted records. It's skipped in dry run. Failure of refresh doesn't fail the run because they can be refreshed later by `aging refresh` and `profiles refresh`.
+func (x *importConfig) refreshAfterImport(ctx context.Context, summaries []*model.ImportSummary) {
+	if x.dryRun {
+		return
+	}
+
+	inserted := false
+	for _, summary := range summaries {
+		if summary.RecordsInserted > 0 {
+			inserted = true
+		}
+	}
+	if !inserted {
+		return
+	}
+
+	bqClient, err := x.bq.Configure(ctx)
+	if err != nil {
+		utils.HandleError(ctx, "Fail to configure BigQuery for refresh after import", err)
+		return
+	}
+	defer utils.SafeClose(bqClient)
+	if err := refreshActiveIndicators(ctx, bqClient, &x.aging); err != nil {
+		utils.HandleError(ctx, "Fail to refresh active indicators view", err)
+	}
+	if !x.refreshProfiles {
+		return
+	}
+	if err := refreshProfiles(ctx, bqClient); err != nil {
+		utils.HandleError(ctx, "Fail to refresh indicator profiles", err)
+	}
+}
+
+// finishRun writes summary of the run into output and returns error by status of the run. If err is not nil, it's returned as it is. Partial failure is returned as types.ErrPartialFailure to exit with a distinct status.
+func finishRun(ctx context.Context, output string, dumpRecords bool, err error, summaries ...*model.ImportSummary) error {
+	run := model.NewRunSummary(summaries...)
+	if writeErr := writeSummary(output, dumpRecords, run); writeErr != nil {
+		if err != nil {
+			utils.HandleError(ctx, "Fail to write summary", writeErr)
+			return err
+		}
+		return writeErr
+	}
+
+	if err != nil {
+		return err
+	}
+	switch run.Status {
+	case types.ImportFailed:
+		return goerr.New("import failed").With("feeds", len(run.Feeds))
+	case types.ImportPartial:
+		return goerr.Wrap(types.ErrPartialFailure, "import partially failed")
+	}
+	return nil
+}
+
+// writeSummary writes JSON summary of the run into output of --summary-output.
+func writeSummary(output string, dumpRecords bool, run *model.RunSummary) error {
+	var w io.Writer
+	switch output {
+	case "":
+		return nil
+	case "-":
+		w = os.Stdout
+		// stdout is used for dumped records
+		if dumpRecords {
+			w = os.Stderr
+		}
+	default:
+		f, err := os.Create(filepath.Clean(output))
+		if err != nil {
+			return goerr.Wrap(err, "Fail to create summary file").With("path", output)
+		}
+		defer utils.SafeClose(f)
+		w = f
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(run); err != nil {
+		return goerr.Wrap(err, "Fail to write summary").With("path", output)
+	}
+	return nil
+}
+
+// printReport prints summary of dry run. It does nothing if dry run mode is disabled.
+func (x *importConfig) printReport() error {
+	if x.report == nil {
+		return nil
+	}
+
+	w := os.Stdout
+	if x.dumpRecords {
+		w = os.Stderr
+	}
+	if err := x.report.Print(w); err != nil {
+		return goerr.Wrap(err, "Fail to print dry run report")
+	}
+	return nil
 }
 
-func subImport() *cli.Command {
+func subImport(file *config.File) *cli.Command {
 	var cfg importConfig
 
 	return &cli.Command{
 		Name:    "import",
 		Usage:   "Import feed data to BigQuery",
 		Aliases: []string{"i"},
-		Flags:   mergeFlags([]cli.Flag{}, &cfg.bq, &cfg.firestore, &cfg.sentry),
+		Flags:   mergeFlags([]cli.Flag{}, &cfg.bq, &cfg.firestore, &cfg.sentry, &cfg.http, &cfg.notify, &cfg.archive, &cfg.aging, &cfg),
 		Subcommands: []*cli.Command{
 			subImportOtx(&cfg),
 			subImportAbuseCh(&cfg),
+			subImportAll(&cfg, file),
 		},
 		Before: func(ctx *cli.Context) error {
 			if err := cfg.sentry.Configure(); err != nil {
@@ -40,7 +376,80 @@ func subImport() *cli.Command {
 // OTX feed data import
 
 type otxConfig struct {
-	apiKey string `masq:"secret"`
+	apiKey           string `masq:"secret"`
+	baseURL          string
+	parseError       string
+	checkpointMaxAge time.Duration
+}
+
+// flags returns options of OTX. API key is required only if required is true because "import all" may not import OTX.
+func (x *otxConfig) flags(required bool) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "otx-api-key",
+			Usage:       "OTX API key" + config.SecretUsage,
+			EnvVars:     []string{"DRONE_OTX_API_KEY"},
+			Destination: &x.apiKey,
+			Action:      config.SecretAction(&x.apiKey),
+			Required:    required,
+		},
+		&cli.StringFlag{
+			Name:        "otx-base-url",
+			Usage:       "Base URL of OTX API",
+			EnvVars:     []string{"DRONE_OTX_BASE_URL"},
+			Value:       otx.DefaultBaseURL,
+			Destination: &x.baseURL,
+		},
+		parseErrorFlag("otx-parse-error", "DRONE_OTX_PARSE_ERROR", &x.parseError),
+		&cli.DurationFlag{
+			Name:        "otx-checkpoint-max-age",
+			Usage:       "Max age of checkpoint to resume an interrupted run. An older checkpoint restarts the run from its start time. Zero means no limit",
+			EnvVars:     []string{"DRONE_OTX_CHECKPOINT_MAX_AGE"},
+			Value:       otx.DefaultCheckpointMaxAge,
+			Destination: &x.checkpointMaxAge,
+		},
+	}
+}
+
+// parseErrorFlag returns option of parse error policy of a feed.
+func parseErrorFlag(name, envVar string, dst *string) cli.Flag {
+	return &cli.StringFlag{
+		Name:        name,
+		Usage:       "Policy of records that can not be parsed [fail|skip|dead-letter]. dead-letter writes them into " + deadletter.TableName + " table",
+		EnvVars:     []string{envVar},
+		Value:       string(types.ParseErrorFail),
+		Destination: dst,
+	}
+}
+
+// dedupFlag returns --dedup flag of the category.
+func dedupFlag(category, envVar string, dst *string) cli.Flag {
+	return &cli.StringFlag{
+		Name:        "dedup",
+		Category:    category,
+		Usage:       "Deduplication mode [watermark|hash|changes]. 'hash' inserts new or changed records, 'changes' inserts change rows into <table>_changes",
+		EnvVars:     []string{envVar},
+		Value:       string(types.DedupWatermark),
+		Destination: dst,
+	}
+}
+
+// parseDedupMode validates mode given by dedupFlag.
+func parseDedupMode(v string) (types.DedupMode, error) {
+	mode := types.DedupMode(v)
+	if err := mode.Validate(); err != nil {
+		return "", err
+	}
+	return mode, nil
+}
+
+// parseErrorPolicy validates policy given by parseErrorFlag.
+func parseErrorPolicy(v string) (types.ParseErrorPolicy, error) {
+	policy := types.ParseErrorPolicy(v)
+	if err := policy.Validate(); err != nil {
+		return "", err
+	}
+	return policy, nil
 }
 
 // subImportOtx is a subcommand of "import" command
@@ -49,15 +458,7 @@ func subImportOtx(cfg *importConfig) *cli.Command {
 	return &cli.Command{
 		Name:  "otx",
 		Usage: "Import OTX feed data to BigQuery",
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:        "otx-api-key",
-				Usage:       "OTX API key",
-				EnvVars:     []string{"DRONE_OTX_API_KEY"},
-				Destination: &otxCfg.apiKey,
-				Required:    true,
-			},
-		},
+		Flags: otxCfg.flags(true),
 		Subcommands: []*cli.Command{
 			subImportOtxSubscribed(cfg, &otxCfg),
 		},
@@ -70,29 +471,50 @@ func subImportOtxSubscribed(cfg *importConfig, otxCfg *otxConfig) *cli.Command {
 		Aliases: []string{"s"},
 		Usage:   "Import OTX subscribed feed data to BigQuery",
 		Action: func(ctx *cli.Context) error {
-			bqClient, err := cfg.bq.Configure(ctx.Context)
-			if err != nil {
-				return goerr.Wrap(err, "Fail to configure BigQuery")
-			}
-			dbClient, err := cfg.firestore.Configure(ctx.Context)
-			if err != nil {
-				return goerr.Wrap(err, "Fail to configure Firestore")
-			}
-
-			otxClient := otx.NewSubscribed(otxCfg.apiKey)
-			clients := infra.New(
-				infra.WithBigQuery(bqClient),
-				infra.WithDatabase(dbClient),
-			)
-			if err := otxClient.Import(ctx.Context, clients); err != nil {
-				return goerr.Wrap(err, "Fail to import OTX subscribed")
-			}
-
-			return nil
+			summary, err := importOTXSubscribed(ctx.Context, cfg, otxCfg)
+			return cfg.finishRun(ctx.Context, err, summary)
 		},
 	}
 }
 
+func importOTXSubscribed(ctx context.Context, cfg *importConfig, otxCfg *otxConfig) (*model.ImportSummary, error) {
+	return cfg.importFeed(ctx, types.FeedOTXSubscribed, func(ctx context.Context, clients *infra.Clients) (*model.ImportSummary, error) {
+		if otxCfg.apiKey == "" {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "OTX API key is required")
+		}
+		mode, err := cfg.dedupMode()
+		if err != nil {
+			return nil, err
+		}
+		policy, err := parseErrorPolicy(otxCfg.parseError)
+		if err != nil {
+			return nil, err
+		}
+		baseURL, err := url.Parse(otxCfg.baseURL)
+		if err != nil {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "invalid OTX base URL").With("url", otxCfg.baseURL)
+		}
+
+		options := []otx.Option{
+			otx.WithDedupMode(mode),
+			otx.WithBaseURL(baseURL),
+			otx.WithParseErrorPolicy(policy),
+			otx.WithCheckpointMaxAge(otxCfg.checkpointMaxAge),
+		}
+		if since, err := cfg.sinceTime(); err != nil {
+			return nil, err
+		} else if since != nil {
+			options = append(options, otx.WithSince(*since))
+		}
+
+		summary, err := otx.NewSubscribed(otxCfg.apiKey, options...).Import(ctx, clients)
+		if err != nil {
+			return summary, goerr.Wrap(err, "Fail to import OTX subscribed")
+		}
+		return summary, nil
+	})
+}
+
 // -----------------------------------------
 // Abuse.ch feed data import
 
@@ -106,30 +528,149 @@ func subImportAbuseCh(cfg *importConfig) *cli.Command {
 	}
 }
 
+type feodoConfig struct {
+	url        string
+	parseError string
+}
+
+func (x *feodoConfig) flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "feodo-url",
+			Usage:       "URL of Feodo blocklist JSON",
+			EnvVars:     []string{"DRONE_ABUSECH_FEODO_URL"},
+			Value:       abuse_ch.DefaultFeodoURL,
+			Destination: &x.url,
+		},
+		parseErrorFlag("feodo-parse-error", "DRONE_ABUSECH_FEODO_PARSE_ERROR", &x.parseError),
+	}
+}
+
 func subImportAbuseChFeodo(cfg *importConfig) *cli.Command {
+	var feodoCfg feodoConfig
+
 	return &cli.Command{
 		Name:  "feodo",
 		Usage: "Import abuse.ch feodo feed data to BigQuery",
+		Flags: feodoCfg.flags(),
 		Action: func(ctx *cli.Context) error {
-			bqClient, err := cfg.bq.Configure(ctx.Context)
-			if err != nil {
-				return goerr.Wrap(err, "Fail to configure BigQuery")
-			}
-			dbClient, err := cfg.firestore.Configure(ctx.Context)
-			if err != nil {
-				return goerr.Wrap(err, "Fail to configure Firestore")
+			summary, err := importFeodo(ctx.Context, cfg, &feodoCfg)
+			return cfg.finishRun(ctx.Context, err, summary)
+		},
+	}
+}
+
+func importFeodo(ctx context.Context, cfg *importConfig, feodoCfg *feodoConfig) (*model.ImportSummary, error) {
+	return cfg.importFeed(ctx, types.FeedAbuseChFeodo, func(ctx context.Context, clients *infra.Clients) (*model.ImportSummary, error) {
+		mode, err := cfg.dedupMode()
+		if err != nil {
+			return nil, err
+		}
+		policy, err := parseErrorPolicy(feodoCfg.parseError)
+		if err != nil {
+			return nil, err
+		}
+		options := []abuse_ch.Option{
+			abuse_ch.WithDedupMode(mode),
+			abuse_ch.WithURL(feodoCfg.url),
+			abuse_ch.WithParseErrorPolicy(policy),
+		}
+		if since, err := cfg.sinceTime(); err != nil {
+			return nil, err
+		} else if since != nil {
+			options = append(options, abuse_ch.WithSince(*since))
+		}
+
+		summary, err := abuse_ch.NewFeodo(options...).Import(ctx, clients)
+		if err != nil {
+			return summary, goerr.Wrap(err, "Fail to import abuse.ch feodo")
+		}
+		return summary, nil
+	})
+}
+
+// -----------------------------------------
+// Import of feeds enabled in config file
+
+func subImportAll(cfg *importConfig, file *config.File) *cli.Command {
+	var (
+		otxCfg   otxConfig
+		feodoCfg feodoConfig
+	)
+
+	return &cli.Command{
+		Name:  "all",
+		Usage: "Import feeds enabled in config file. A feed is skipped if it has been imported within its interval",
+		Flags: append(otxCfg.flags(false), feodoCfg.flags()...),
+		Action: func(ctx *cli.Context) error {
+			runners := map[types.FeedID]func(context.Context) (*model.ImportSummary, error){
+				types.FeedOTXSubscribed: func(ctx context.Context) (*model.ImportSummary, error) {
+					return importOTXSubscribed(ctx, cfg, &otxCfg)
+				},
+				types.FeedAbuseChFeodo: func(ctx context.Context) (*model.ImportSummary, error) {
+					return importFeodo(ctx, cfg, &feodoCfg)
+				},
 			}
 
-			feed := abuse_ch.NewFeodo()
-			clients := infra.New(
-				infra.WithBigQuery(bqClient),
-				infra.WithDatabase(dbClient),
-			)
-			if err := feed.Import(ctx.Context, clients); err != nil {
-				return goerr.Wrap(err, "Fail to import OTX subscribed")
+			var summaries []*model.ImportSummary
+			for _, feedID := range types.FeedIDs() {
+				setting, ok := file.Feeds()[feedID]
+				if !ok || !setting.IsEnabled() {
+					continue
+				}
+
+				run, ok := runners[feedID]
+				if !ok {
+					return goerr.New("import of feed is not supported").With("feed", feedID)
+				}
+
+				due, err := isImportDue(ctx.Context, cfg, feedID, setting.Interval)
+				if err != nil {
+					utils.HandleError(ctx.Context, "Fail to check import interval", err)
+					summary := model.NewImportSummary(feedID)
+					summary.Finish(err)
+					summaries = append(summaries, summary)
+					continue
+				}
+				if !due {
+					utils.Logger().Info("Skip feed imported within interval", "feed", feedID, "interval", setting.Interval)
+					summary := model.NewImportSummary(feedID)
+					summary.Skip()
+					summaries = append(summaries, summary)
+					continue
+				}
+
+				utils.Logger().Info("Start import", "feed", feedID)
+				summary, err := run(ctx.Context)
+				if err != nil {
+					utils.HandleError(ctx.Context, "Fail to import feed", err)
+				}
+				summaries = append(summaries, summary)
 			}
 
-			return nil
+			if len(summaries) == 0 {
+				return goerr.Wrap(types.ErrInvalidOption, "no feed is enabled in config file")
+			}
+			return cfg.finishRun(ctx.Context, nil, summaries...)
 		},
 	}
 }
+
+// isImportDue returns true if the feed has not been checked within the interval. Zero interval means that the feed is always imported.
+func isImportDue(ctx context.Context, cfg *importConfig, feedID types.FeedID, interval time.Duration) (bool, error) {
+	if interval <= 0 {
+		return true, nil
+	}
+
+	dbClient, err := cfg.firestore.Configure(ctx)
+	if err != nil {
+		return false, goerr.Wrap(err, "Fail to configure Firestore")
+	}
+	defer utils.SafeClose(dbClient)
+	log, err := dbClient.GetLatestImportLog(ctx, feedID)
+	if err != nil {
+		return false, goerr.Wrap(err, "Fail to get import log").With("feed", feedID)
+	}
+
+	return log == nil || time.Since(log.CheckedAt) >= interval, nil
+}
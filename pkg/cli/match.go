@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"errors"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/match"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type matchConfig struct {
+	bq        config.BigQuery
+	firestore config.Firestore
+	http      config.HTTP
+	notify    config.Notify
+
+	sources cli.StringSlice
+	window  time.Duration
+	until   string
+}
+
+func (x *matchConfig) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "source",
+			Category:    "match",
+			Usage:       "Log column to be matched in <table>.<column>=<type>[:<time column>] format. Type is one of [ip|domain|url|hash]. Default time column is '" + match.DefaultTimeColumn + "'",
+			EnvVars:     []string{"DRONE_MATCH_SOURCE"},
+			Required:    true,
+			Destination: &x.sources,
+		},
+		&cli.DurationFlag{
+			Name:        "window",
+			Category:    "match",
+			Usage:       "Time window of log rows to be matched, counted back from --until",
+			EnvVars:     []string{"DRONE_MATCH_WINDOW"},
+			Value:       24 * time.Hour,
+			Destination: &x.window,
+		},
+		&cli.StringFlag{
+			Name:        "until",
+			Category:    "match",
+			Usage:       "End of time window (RFC3339 or YYYY-MM-DD). Default is current time",
+			EnvVars:     []string{"DRONE_MATCH_UNTIL"},
+			Destination: &x.until,
+		},
+	}
+}
+
+// timeWindow returns [since, until) of log rows to be matched.
+func (x *matchConfig) timeWindow() (time.Time, time.Time, error) {
+	until := time.Now()
+	if x.until != "" {
+		t, err := parseTime(x.until)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		until = t
+	}
+	if x.window <= 0 {
+		return time.Time{}, time.Time{}, goerr.Wrap(types.ErrInvalidOption, "--window must be positive").With("window", x.window)
+	}
+
+	return until.Add(-x.window), until, nil
+}
+
+func subMatch() *cli.Command {
+	var cfg matchConfig
+
+	return &cli.Command{
+		Name:      "match",
+		Usage:     "Match log tables in BigQuery with imported indicators and write hits into " + match.TableName + " table",
+		ArgsUsage: "[feedID...]",
+		Flags:     mergeFlags([]cli.Flag{}, &cfg.bq, &cfg.firestore, &cfg.http, &cfg.notify, &cfg),
+		Action: func(ctx *cli.Context) error {
+			var sources []*match.Source
+			for _, v := range cfg.sources.Value() {
+				src, err := match.ParseSource(v)
+				if err != nil {
+					return err
+				}
+				sources = append(sources, src)
+			}
+
+			since, until, err := cfg.timeWindow()
+			if err != nil {
+				return err
+			}
+
+			feedIDs, err := parseFeedIDs(ctx)
+			if err != nil {
+				return err
+			}
+			indicators, err := feed.Indicators(feedIDs...)
+			if err != nil {
+				return err
+			}
+
+			bqClient, err := cfg.bq.Configure(ctx.Context)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to configure BigQuery")
+			}
+			defer utils.SafeClose(bqClient)
+			dbClient, err := cfg.firestore.Configure(ctx.Context)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to configure Firestore")
+			}
+			defer utils.SafeClose(dbClient)
+			httpClient, err := cfg.http.Client()
+			if err != nil {
+				return goerr.Wrap(err, "Fail to configure HTTP client")
+			}
+			notifier, err := cfg.notify.Configure(dbClient, httpClient)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to configure notifier")
+			}
+
+			// Inserted hits are notified even if some hits failed to be inserted, and then the partial failure is returned
+			hits, runErr := match.Run(ctx.Context, bqClient, indicators, sources, since, until)
+			if runErr != nil && !errors.Is(runErr, types.ErrPartialFailure) {
+				return runErr
+			}
+			utils.Logger().Info("Completed matching", "since", since, "until", until, "hits", len(hits))
+
+			if err := notifier.Notify(ctx.Context, match.Alerts(hits)...); err != nil {
+				return goerr.Wrap(err, "Fail to notify matches")
+			}
+
+			return runErr
+		},
+	}
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/correlate"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type profilesConfig struct {
+	bq config.BigQuery
+}
+
+func subProfiles() *cli.Command {
+	var cfg profilesConfig
+
+	return &cli.Command{
+		Name:  "profiles",
+		Usage: "Manage profiles of indicators correlated across feeds",
+		Flags: mergeFlags([]cli.Flag{}, &cfg.bq),
+		Subcommands: []*cli.Command{
+			subProfilesRefresh(&cfg),
+		},
+	}
+}
+
+func subProfilesRefresh(cfg *profilesConfig) *cli.Command {
+	return &cli.Command{
+		Name:  "refresh",
+		Usage: "Correlate indicators of all feeds into " + correlate.TableName + " table",
+		Action: func(ctx *cli.Context) error {
+			bqClient, err := cfg.bq.Configure(ctx.Context)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to configure BigQuery")
+			}
+			defer utils.SafeClose(bqClient)
+			return refreshProfiles(ctx.Context, bqClient)
+		},
+	}
+}
+
+// refreshProfiles refreshes indicator profiles by indicator sources of all feeds. Profiles are always built from all feeds because correlation across feeds is the purpose.
+func refreshProfiles(ctx context.Context, bqClient interfaces.BigQuery) error {
+	sources, err := feed.Indicators()
+	if err != nil {
+		return err
+	}
+	return correlate.Refresh(ctx, bqClient, sources)
+}
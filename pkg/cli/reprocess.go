@@ -0,0 +1,199 @@
+package cli
+
+import (
+	"os"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/infra"
+	"github.com/m-mizutani/drone/pkg/infra/dryrun"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type reprocessConfig struct {
+	bq      config.BigQuery
+	archive config.Archive
+
+	fromArchive bool
+	runIDs      cli.StringSlice
+	since       string
+	parseError  string
+	dedup       string
+	tableSuffix string
+
+	dryRun      bool
+	dumpRecords bool
+}
+
+func (x *reprocessConfig) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "from-archive",
+			Category:    "reprocess",
+			Usage:       "Replay raw response bodies stored in archive of --archive-uri",
+			Destination: &x.fromArchive,
+		},
+		&cli.StringSliceFlag{
+			Name:        "run",
+			Category:    "reprocess",
+			Usage:       "Run ID of import to be reprocessed. All archived runs are reprocessed if not set",
+			Destination: &x.runIDs,
+		},
+		&cli.StringFlag{
+			Name:        "since",
+			Category:    "reprocess",
+			Usage:       "Reprocess runs started at or after the time (RFC3339 or YYYY-MM-DD)",
+			Destination: &x.since,
+		},
+		parseErrorFlag("parse-error", "DRONE_REPROCESS_PARSE_ERROR", &x.parseError),
+		dedupFlag("reprocess", "DRONE_REPROCESS_DEDUP", &x.dedup),
+		&cli.StringFlag{
+			Name:        "table-suffix",
+			Category:    "reprocess",
+			Usage:       "Suffix of tables that replayed records are inserted into, e.g. abusech_feodo_reprocess. Tables of the import are not changed, and reprocess fails if the suffixed tables already exist",
+			EnvVars:     []string{"DRONE_REPROCESS_TABLE_SUFFIX"},
+			Value:       "_reprocess",
+			Destination: &x.tableSuffix,
+		},
+		&cli.BoolFlag{
+			Name:        "dry-run",
+			Category:    "reprocess",
+			Usage:       "Transform archived bodies and print summary without writing to BigQuery",
+			Destination: &x.dryRun,
+		},
+		&cli.BoolFlag{
+			Name:        "dump-records",
+			Category:    "reprocess",
+			Usage:       "Dump records to be inserted as JSONL to stdout in dry run mode. Summary is printed to stderr",
+			Destination: &x.dumpRecords,
+		},
+	}
+}
+
+// archiveKeys returns archived keys of the feed filtered by --run and --since.
+func (x *reprocessConfig) archiveKeys(ctx *cli.Context, clients *infra.Clients, feedID types.FeedID) ([]*model.ArchiveKey, error) {
+	var since time.Time
+	if x.since != "" {
+		t, err := parseTime(x.since)
+		if err != nil {
+			return nil, err
+		}
+		since = t
+	}
+
+	runIDs := map[string]struct{}{}
+	for _, id := range x.runIDs.Value() {
+		runIDs[id] = struct{}{}
+	}
+
+	keys, err := clients.Archive().List(ctx.Context, feedID)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []*model.ArchiveKey
+	for _, key := range keys {
+		if _, ok := runIDs[key.RunID]; len(runIDs) > 0 && !ok {
+			continue
+		}
+		if key.RunAt.Before(since) {
+			continue
+		}
+		filtered = append(filtered, key)
+	}
+
+	return filtered, nil
+}
+
+func subReprocess() *cli.Command {
+	var cfg reprocessConfig
+
+	return &cli.Command{
+		Name:      "reprocess",
+		Usage:     "Transform archived raw responses of the feed by the current transform and insert records into BigQuery tables with --table-suffix",
+		ArgsUsage: "<feedID>",
+		Flags:     mergeFlags([]cli.Flag{}, &cfg.bq, &cfg.archive, &cfg),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return goerr.Wrap(types.ErrInvalidOption, "feed ID is required").With("feeds", types.FeedIDs())
+			}
+			feedID := types.FeedID(ctx.Args().First())
+			if err := feedID.Validate(); err != nil {
+				return goerr.Wrap(err).With("feeds", types.FeedIDs())
+			}
+
+			// Archive is the only source of reprocess for now
+			if !cfg.fromArchive {
+				return goerr.Wrap(types.ErrInvalidOption, "--from-archive is required")
+			}
+			if !cfg.archive.Enabled() {
+				return goerr.Wrap(types.ErrInvalidOption, "--archive-uri is required to reprocess from archive")
+			}
+			if cfg.dumpRecords && !cfg.dryRun {
+				return goerr.Wrap(types.ErrInvalidOption, "--dump-records requires --dry-run")
+			}
+			policy, err := parseErrorPolicy(cfg.parseError)
+			if err != nil {
+				return err
+			}
+			mode, err := parseDedupMode(cfg.dedup)
+			if err != nil {
+				return err
+			}
+
+			bqClient, err := cfg.bq.Configure(ctx.Context)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to configure BigQuery")
+			}
+			archiveClient, err := cfg.archive.Configure(ctx.Context)
+			if err != nil {
+				utils.SafeClose(bqClient)
+				return goerr.Wrap(err, "Fail to configure archive")
+			}
+
+			var report *dryrun.Report
+			if cfg.dryRun {
+				report = dryrun.NewReport()
+				var options []dryrun.Option
+				if cfg.dumpRecords {
+					options = append(options, dryrun.WithDump(os.Stdout))
+				}
+				bqClient = dryrun.NewBigQuery(bqClient, report, options...)
+			}
+
+			clients := infra.New(
+				infra.WithBigQuery(bqClient),
+				infra.WithArchive(archiveClient),
+			)
+			defer utils.SafeClose(clients)
+
+			keys, err := cfg.archiveKeys(ctx, clients, feedID)
+			if err != nil {
+				return err
+			}
+			if len(keys) == 0 {
+				utils.Logger().WarnContext(ctx.Context, "No archived body to reprocess", "feed", feedID)
+			}
+
+			summary, err := feed.Reprocess(ctx.Context, clients, feedID, keys, policy, mode, cfg.tableSuffix)
+			summary.Finish(err)
+
+			if err == nil && report != nil {
+				w := os.Stdout
+				if cfg.dumpRecords {
+					w = os.Stderr
+				}
+				if err := report.Print(w); err != nil {
+					return goerr.Wrap(err, "Fail to print dry run report")
+				}
+			}
+
+			return finishRun(ctx.Context, "-", cfg.dumpRecords, err, summary)
+		},
+	}
+}
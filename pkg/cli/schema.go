@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/migration"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type schemaConfig struct {
+	bq config.BigQuery
+}
+
+func subSchema() *cli.Command {
+	var cfg schemaConfig
+
+	return &cli.Command{
+		Name:  "schema",
+		Usage: "Compare schema of feed tables with BigQuery and migrate them",
+		Flags: mergeFlags([]cli.Flag{}, &cfg.bq),
+		Subcommands: []*cli.Command{
+			subSchemaPlan(&cfg),
+			subSchemaApply(&cfg),
+		},
+	}
+}
+
+// plan builds BigQuery client and plans of tables of feeds given as arguments. All feeds are targeted if no argument is given.
+func (x *schemaConfig) plan(ctx *cli.Context) (interfaces.BigQuery, []*migration.TablePlan, error) {
+	feedIDs, err := parseFeedIDs(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tables, err := feed.Tables(feedIDs...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bqClient, err := x.bq.Configure(ctx.Context)
+	if err != nil {
+		return nil, nil, goerr.Wrap(err, "Fail to configure BigQuery")
+	}
+
+	plans, err := migration.Plan(ctx.Context, bqClient, tables)
+	if err != nil {
+		utils.SafeClose(bqClient)
+		return nil, nil, err
+	}
+
+	return bqClient, plans, nil
+}
+
+func subSchemaPlan(cfg *schemaConfig) *cli.Command {
+	return &cli.Command{
+		Name:      "plan",
+		Usage:     "Show added, changed and incompatible fields of feed tables",
+		ArgsUsage: "[feedID...]",
+		Action: func(ctx *cli.Context) error {
+			bqClient, plans, err := cfg.plan(ctx)
+			if err != nil {
+				return err
+			}
+			defer utils.SafeClose(bqClient)
+
+			return migration.Print(os.Stdout, plans)
+		},
+	}
+}
+
+func subSchemaApply(cfg *schemaConfig) *cli.Command {
+	var migrate bool
+
+	return &cli.Command{
+		Name:      "apply",
+		Usage:     "Create or update feed tables. Incompatible tables are migrated to a new version with --migrate",
+		ArgsUsage: "[feedID...]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:        "migrate",
+				Usage:       "Migrate tables that have incompatible changes: create <table>_vN, copy rows and swap view <table>",
+				Destination: &migrate,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			bqClient, plans, err := cfg.plan(ctx)
+			if err != nil {
+				return err
+			}
+			defer utils.SafeClose(bqClient)
+			if err := migration.Print(os.Stdout, plans); err != nil {
+				return err
+			}
+
+			skipped, err := migration.Apply(ctx.Context, bqClient, plans, migrate)
+			if err != nil {
+				return err
+			}
+			for _, plan := range skipped {
+				utils.Logger().Warn("Table has incompatible changes, run with --migrate to migrate it", "table", plan.Table.Name)
+			}
+			if len(skipped) > 0 {
+				return goerr.Wrap(types.ErrIncompatibleSchema, "some tables are not migrated").With("tables", len(skipped))
+			}
+
+			return nil
+		},
+	}
+}
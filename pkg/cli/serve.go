@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/lookup"
+	"github.com/m-mizutani/drone/pkg/server"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type serveConfig struct {
+	bq        config.BigQuery
+	firestore config.Firestore
+
+	addr          string
+	cacheTTL      time.Duration
+	taxii         bool
+	maxTLP        string
+	lookup        bool
+	lookupRefresh time.Duration
+}
+
+func (x *serveConfig) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "addr",
+			Category:    "serve",
+			Usage:       "Listen address of HTTP server",
+			EnvVars:     []string{"DRONE_SERVE_ADDR"},
+			Value:       "127.0.0.1:8080",
+			Destination: &x.addr,
+		},
+		&cli.DurationFlag{
+			Name:        "export-cache-ttl",
+			Category:    "serve",
+			Usage:       "Duration to reuse export result for the same request. Zero disables the cache",
+			EnvVars:     []string{"DRONE_SERVE_EXPORT_CACHE_TTL"},
+			Value:       server.DefaultCacheTTL,
+			Destination: &x.cacheTTL,
+		},
+		&cli.BoolFlag{
+			Name:        "taxii",
+			Category:    "serve",
+			Usage:       "Enable read-only TAXII 2.1 endpoints under /taxii2/. A collection is provided for each feed",
+			EnvVars:     []string{"DRONE_SERVE_TAXII"},
+			Destination: &x.taxii,
+		},
+		maxTLPFlag(&x.maxTLP),
+		&cli.BoolFlag{
+			Name:        "lookup",
+			Category:    "serve",
+			Usage:       "Enable lookup endpoints (GET/POST /lookup) backed by in-memory index of indicators",
+			EnvVars:     []string{"DRONE_SERVE_LOOKUP"},
+			Destination: &x.lookup,
+		},
+		&cli.DurationFlag{
+			Name:        "lookup-refresh-interval",
+			Category:    "serve",
+			Usage:       "Interval to check import logs. Lookup index is rebuilt when any feed has been imported",
+			EnvVars:     []string{"DRONE_SERVE_LOOKUP_REFRESH_INTERVAL"},
+			Value:       time.Minute,
+			Destination: &x.lookupRefresh,
+		},
+	}
+}
+
+func subServe() *cli.Command {
+	var cfg serveConfig
+
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "Run HTTP server that provides exported indicators, TAXII collections and indicator lookup",
+		Flags: mergeFlags([]cli.Flag{}, &cfg.bq, &cfg.firestore, &cfg),
+		Action: func(ctx *cli.Context) error {
+			sources, err := feed.Indicators()
+			if err != nil {
+				return err
+			}
+			bqClient, err := cfg.bq.Configure(ctx.Context)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to configure BigQuery")
+			}
+			defer utils.SafeClose(bqClient)
+
+			options := []server.Option{
+				server.WithCacheTTL(cfg.cacheTTL),
+			}
+			if cfg.taxii {
+				for _, feedID := range types.FeedIDs() {
+					src, err := stixSources(cfg.maxTLP, feedID)
+					if err != nil {
+						return err
+					}
+					options = append(options, server.WithTAXII(&server.Collection{Feed: feedID, Source: src[0]}))
+				}
+			}
+
+			sigCtx, stop := signal.NotifyContext(ctx.Context, syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+
+			if cfg.lookup {
+				if cfg.lookupRefresh <= 0 {
+					return goerr.Wrap(types.ErrInvalidOption, "--lookup-refresh-interval must be positive").With("interval", cfg.lookupRefresh)
+				}
+				dbClient, err := cfg.firestore.Configure(ctx.Context)
+				if err != nil {
+					return goerr.Wrap(err, "Fail to configure Firestore")
+				}
+				defer utils.SafeClose(dbClient)
+
+				svc := lookup.NewService(bqClient, dbClient, sources)
+				if _, err := svc.Refresh(ctx.Context, true); err != nil {
+					return err
+				}
+				go svc.Watch(sigCtx, cfg.lookupRefresh)
+				options = append(options, server.WithLookup(svc))
+			}
+
+			srv := &http.Server{
+				Addr:              cfg.addr,
+				Handler:           server.New(bqClient, sources, options...),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+
+			errCh := make(chan error, 1)
+			go func() {
+				utils.Logger().Info("Start HTTP server", "addr", cfg.addr)
+				if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					errCh <- goerr.Wrap(err, "Fail to run HTTP server").With("addr", cfg.addr)
+				}
+				close(errCh)
+			}()
+
+			select {
+			case err := <-errCh:
+				return err
+			case <-sigCtx.Done():
+			}
+
+			utils.Logger().Info("Shutting down HTTP server")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				return goerr.Wrap(err, "Fail to shutdown HTTP server")
+			}
+			return nil
+		},
+	}
+}
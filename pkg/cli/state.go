@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/firestore"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type stateConfig struct {
+	firestore config.Firestore
+}
+
+func subState() *cli.Command {
+	var cfg stateConfig
+
+	return &cli.Command{
+		Name:  "state",
+		Usage: "Show or modify import state (latest record time) of feeds",
+		Flags: mergeFlags([]cli.Flag{}, &cfg.firestore),
+		Subcommands: []*cli.Command{
+			subStateShow(&cfg),
+			subStateSet(&cfg),
+			subStateReset(&cfg),
+		},
+	}
+}
+
+// stateTarget returns database client and feed ID given as the first argument. The client must be closed by caller.
+func (x *stateConfig) stateTarget(ctx *cli.Context) (*firestore.Client, types.FeedID, error) {
+	if ctx.NArg() != 1 {
+		return nil, "", goerr.Wrap(types.ErrInvalidOption, "feed ID is required").With("feeds", types.FeedIDs())
+	}
+
+	feedID := types.FeedID(ctx.Args().First())
+	if err := feedID.Validate(); err != nil {
+		return nil, "", goerr.Wrap(err).With("feeds", types.FeedIDs())
+	}
+
+	db, err := x.firestore.Configure(ctx.Context)
+	if err != nil {
+		return nil, "", goerr.Wrap(err, "Fail to configure Firestore")
+	}
+
+	return db, feedID, nil
+}
+
+func subStateShow(cfg *stateConfig) *cli.Command {
+	return &cli.Command{
+		Name:      "show",
+		Usage:     "Show import state of the feed",
+		ArgsUsage: "<feedID>",
+		Action: func(ctx *cli.Context) error {
+			db, feedID, err := cfg.stateTarget(ctx)
+			if err != nil {
+				return err
+			}
+			defer utils.SafeClose(db)
+
+			log, err := db.GetLatestImportLog(ctx.Context, feedID)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to get import log").With("feed", feedID)
+			}
+
+			checkpoint, err := db.GetImportCheckpoint(ctx.Context, feedID)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to get import checkpoint").With("feed", feedID)
+			}
+
+			out := struct {
+				FeedID     types.FeedID            `json:"feed_id"`
+				ImportLog  *model.ImportLog        `json:"import_log"`
+				Checkpoint *model.ImportCheckpoint `json:"checkpoint,omitempty"`
+			}{
+				FeedID:     feedID,
+				ImportLog:  log,
+				Checkpoint: checkpoint,
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(out); err != nil {
+				return goerr.Wrap(err, "Fail to encode import log")
+			}
+
+			return nil
+		},
+	}
+}
+
+func subStateSet(cfg *stateConfig) *cli.Command {
+	var latestRecord string
+
+	return &cli.Command{
+		Name:      "set",
+		Usage:     "Overwrite latest record time of the feed. It can move the time backward. Checkpoint of interrupted import is discarded",
+		ArgsUsage: "<feedID>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "latest-record",
+				Usage:       "Latest record time (RFC3339 or YYYY-MM-DD)",
+				Destination: &latestRecord,
+				Required:    true,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			db, feedID, err := cfg.stateTarget(ctx)
+			if err != nil {
+				return err
+			}
+			defer utils.SafeClose(db)
+
+			latest, err := parseTime(latestRecord)
+			if err != nil {
+				return err
+			}
+
+			log := &model.ImportLog{
+				LatestRecord: latest,
+				CheckedAt:    time.Now(),
+			}
+			if err := db.SetImportLog(ctx.Context, feedID, log); err != nil {
+				return goerr.Wrap(err, "Fail to set import log").With("feed", feedID)
+			}
+			// Interrupted run would resume from its own start time, not the new one
+			if err := db.DeleteImportCheckpoint(ctx.Context, feedID); err != nil {
+				return goerr.Wrap(err, "Fail to delete import checkpoint").With("feed", feedID)
+			}
+
+			utils.Logger().Info("Set import state", "feed", feedID, "latest_record", latest)
+			return nil
+		},
+	}
+}
+
+func subStateReset(cfg *stateConfig) *cli.Command {
+	return &cli.Command{
+		Name:      "reset",
+		Usage:     "Remove import state, checkpoint, record hashes and snapshot of the feed. Next import starts from the initial period",
+		ArgsUsage: "<feedID>",
+		Action: func(ctx *cli.Context) error {
+			db, feedID, err := cfg.stateTarget(ctx)
+			if err != nil {
+				return err
+			}
+			defer utils.SafeClose(db)
+
+			if err := db.DeleteImportLog(ctx.Context, feedID); err != nil {
+				return goerr.Wrap(err, "Fail to delete import log").With("feed", feedID)
+			}
+			if err := db.DeleteImportCheckpoint(ctx.Context, feedID); err != nil {
+				return goerr.Wrap(err, "Fail to delete import checkpoint").With("feed", feedID)
+			}
+
+			hashes, err := db.ListRecordHashes(ctx.Context, feedID)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to list record hashes").With("feed", feedID)
+			}
+			keys := make([]string, len(hashes))
+			for i, hash := range hashes {
+				keys[i] = hash.Key
+			}
+			if err := db.DeleteRecordHashes(ctx.Context, feedID, keys); err != nil {
+				return goerr.Wrap(err, "Fail to delete record hashes").With("feed", feedID)
+			}
+			if err := db.DeleteSnapshot(ctx.Context, feedID); err != nil {
+				return goerr.Wrap(err, "Fail to delete snapshot").With("feed", feedID)
+			}
+
+			utils.Logger().Info("Reset import state", "feed", feedID)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/stix"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type stixConfig struct {
+	bq config.BigQuery
+
+	output string
+	maxTLP string
+}
+
+func (x *stixConfig) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "output",
+			Aliases:     []string{"o"},
+			Category:    "stix",
+			Usage:       "Output file path of STIX bundle. Default is stdout",
+			EnvVars:     []string{"DRONE_STIX_OUTPUT"},
+			Destination: &x.output,
+		},
+		maxTLPFlag(&x.maxTLP),
+	}
+}
+
+func maxTLPFlag(dst *string) cli.Flag {
+	return &cli.StringFlag{
+		Name:        "max-tlp",
+		Category:    "stix",
+		Usage:       "Exclude STIX objects marked with higher TLP [white|green|amber|red]",
+		EnvVars:     []string{"DRONE_STIX_MAX_TLP"},
+		Value:       "green",
+		Destination: dst,
+	}
+}
+
+// stixSources returns STIX sources of the feed that exclude objects marked with higher TLP than maxTLP.
+func stixSources(maxTLP string, feedIDs ...types.FeedID) ([]stix.Source, error) {
+	marking, ok := stix.TLPMarking(maxTLP)
+	if !ok {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "unknown TLP").With("tlp", maxTLP)
+	}
+
+	sources, err := feed.STIX(feedIDs...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sources {
+		sources[i] = stix.WithMaxTLP(sources[i], marking)
+	}
+	return sources, nil
+}
+
+func subSTIX() *cli.Command {
+	var cfg stixConfig
+
+	return &cli.Command{
+		Name:      "stix",
+		Usage:     "Export imported feed data as STIX 2.1 bundle",
+		ArgsUsage: "[feedID...]",
+		Flags:     mergeFlags([]cli.Flag{}, &cfg.bq, &cfg),
+		Action: func(ctx *cli.Context) error {
+			feedIDs, err := parseFeedIDs(ctx)
+			if err != nil {
+				return err
+			}
+			sources, err := stixSources(cfg.maxTLP, feedIDs...)
+			if err != nil {
+				return err
+			}
+
+			bqClient, err := cfg.bq.Configure(ctx.Context)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to configure BigQuery")
+			}
+			defer utils.SafeClose(bqClient)
+			objects, err := stix.Collect(ctx.Context, bqClient, sources...)
+			if err != nil {
+				return err
+			}
+
+			var w io.Writer = os.Stdout
+			if cfg.output != "" {
+				fd, err := os.Create(cfg.output)
+				if err != nil {
+					return goerr.Wrap(err, "Fail to create output file").With("path", cfg.output)
+				}
+				defer fd.Close()
+				w = fd
+			}
+
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(stix.NewBundle(objects...)); err != nil {
+				return goerr.Wrap(err, "Fail to write STIX bundle")
+			}
+			return nil
+		},
+	}
+}
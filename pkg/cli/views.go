@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"github.com/m-mizutani/drone/pkg/cli/config"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"github.com/urfave/cli/v2"
+)
+
+type viewsConfig struct {
+	bq config.BigQuery
+}
+
+func subViews() *cli.Command {
+	var cfg viewsConfig
+
+	return &cli.Command{
+		Name:  "views",
+		Usage: "Manage BigQuery views declared by feeds",
+		Flags: mergeFlags([]cli.Flag{}, &cfg.bq),
+		Subcommands: []*cli.Command{
+			subViewsSync(&cfg),
+		},
+	}
+}
+
+func subViewsSync(cfg *viewsConfig) *cli.Command {
+	return &cli.Command{
+		Name:      "sync",
+		Usage:     "Create or update views of feeds in the dataset",
+		ArgsUsage: "[feedID...]",
+		Action: func(ctx *cli.Context) error {
+			feedIDs, err := parseFeedIDs(ctx)
+			if err != nil {
+				return err
+			}
+			views, err := feed.Views(feedIDs...)
+			if err != nil {
+				return err
+			}
+
+			bqClient, err := cfg.bq.Configure(ctx.Context)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to configure BigQuery")
+			}
+			defer utils.SafeClose(bqClient)
+
+			for _, view := range views {
+				if err := bqClient.CreateOrUpdateView(ctx.Context, view); err != nil {
+					return goerr.Wrap(err, "Fail to sync view").With("view", view.Name)
+				}
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,124 @@
+// Package correlate builds profiles of indicators across feeds. Indicators of all sources are grouped by canonical value, and a profile has sources, sighting counts, first and last seen time, tags and malware families of the indicator. Refresh stores profiles into indicator_profiles table.
+package correlate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+// TableName is a table of indicator profiles refreshed by Refresh.
+const TableName = "indicator_profiles"
+
+// canonical returns SQL expression of canonical value of Indicator column by the type. IP address is formatted by BigQuery, e.g. 2001:DB8:0::1 is 2001:db8::1, and a value that is not an IP address (e.g. CIDR) is compared in lower case. IPv4-mapped IPv6 address is not converted to IPv4. Domain names and hashes are case insensitive, and URL is kept as it is because path is case sensitive.
+func canonical(t types.IndicatorType) string {
+	switch t {
+	case types.IndicatorIP:
+		return "COALESCE(NET.IP_TO_STRING(SAFE.NET.IP_FROM_STRING(TRIM(Indicator))), LOWER(TRIM(Indicator)))"
+	case types.IndicatorDomain:
+		return "RTRIM(LOWER(TRIM(Indicator)), '.')"
+	case types.IndicatorHash:
+		return "LOWER(TRIM(Indicator))"
+	default:
+		return "TRIM(Indicator)"
+	}
+}
+
+// Query returns SQL to select profiles of indicators in the sources, one row per type and canonical value. Expired indicators are also included because a profile is history of the indicator. It returns empty string if no source is given. Result columns are:
+//   - Type, Indicator (STRING): Indicator is the canonical value
+//   - Sources (ARRAY<STRING>): Feeds that have the indicator
+//   - SourceCount (INT64): Number of distinct feeds
+//   - Sightings (INT64): Number of distinct entries in all sources, e.g. pulses and C2 servers that have the indicator. A revised pulse is counted once
+//   - FirstSeen, LastSeen (TIMESTAMP): The earliest and the latest time across all feeds
+//   - MaxConfidence (INT64): The highest confidence given by the sources
+//   - Tags, MalwareFamilies (ARRAY<STRING>): Merged and deduplicated values of all feeds
+//   - Feeds (ARRAY<STRUCT>): Feed, Sightings, FirstSeen and LastSeen of each feed
+func Query(sources []*model.IndicatorSource) string {
+	if len(sources) == 0 {
+		return ""
+	}
+
+	unions := make([]string, len(sources))
+	for i, src := range sources {
+		unions[i] = fmt.Sprintf("      SELECT '%s' AS Feed, '%s' AS Type, %s AS Indicator, SightingKey, FirstSeen, LastSeen, Confidence, Tags, MalwareFamilies FROM (%s)",
+			src.Feed, src.Type, canonical(src.Type), src.Query)
+	}
+
+	return fmt.Sprintf(`SELECT
+  Type,
+  Indicator,
+  Sources,
+  ARRAY_LENGTH(Sources) AS SourceCount,
+  Sightings,
+  FirstSeen,
+  LastSeen,
+  MaxConfidence,
+  ARRAY(SELECT DISTINCT t FROM UNNEST(Tags) AS t WHERE t IS NOT NULL AND t != '' ORDER BY t) AS Tags,
+  ARRAY(SELECT DISTINCT m FROM UNNEST(MalwareFamilies) AS m WHERE m IS NOT NULL AND m != '' ORDER BY m) AS MalwareFamilies,
+  Feeds
+FROM (
+  SELECT
+    Type,
+    Indicator,
+    ARRAY_AGG(Feed ORDER BY Feed) AS Sources,
+    SUM(Sightings) AS Sightings,
+    MIN(FirstSeen) AS FirstSeen,
+    MAX(LastSeen) AS LastSeen,
+    MAX(MaxConfidence) AS MaxConfidence,
+    ARRAY_CONCAT_AGG(Tags) AS Tags,
+    ARRAY_CONCAT_AGG(MalwareFamilies) AS MalwareFamilies,
+    ARRAY_AGG(STRUCT(Feed, Sightings, FirstSeen, LastSeen) ORDER BY Feed) AS Feeds
+  FROM (
+    SELECT
+      Feed,
+      Type,
+      Indicator,
+      COUNT(DISTINCT SightingKey) AS Sightings,
+      MIN(FirstSeen) AS FirstSeen,
+      MAX(LastSeen) AS LastSeen,
+      MAX(Confidence) AS MaxConfidence,
+      ARRAY_CONCAT_AGG(Tags) AS Tags,
+      ARRAY_CONCAT_AGG(MalwareFamilies) AS MalwareFamilies
+    FROM (
+%s
+    )
+    WHERE Indicator != ''
+    GROUP BY Feed, Type, Indicator
+  )
+  GROUP BY Type, Indicator
+)`, strings.Join(unions, "\n      UNION ALL\n"))
+}
+
+// Refresh replaces indicator_profiles table with profiles of indicators in the sources. RefreshedAt column has the time of refresh.
+func Refresh(ctx context.Context, client interfaces.BigQuery, sources []*model.IndicatorSource) (err error) {
+	ctx, span := utils.StartSpan(ctx, "correlate.Refresh", utils.AttrTable.String(TableName))
+	defer func() { utils.EndSpan(span, err) }()
+
+	query := Query(sources)
+	if query == "" {
+		return goerr.New("no indicator source to correlate")
+	}
+
+	ddl, err := model.RenderQuery(fmt.Sprintf(`CREATE OR REPLACE TABLE %s
+CLUSTER BY Type, Indicator
+AS
+SELECT *, CURRENT_TIMESTAMP() AS RefreshedAt FROM (
+%s
+)`, TableName, query))
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.Query(ctx, ddl, nil); err != nil {
+		return goerr.Wrap(err, "Fail to refresh indicator profiles").With("table", TableName)
+	}
+
+	utils.Logger().InfoContext(ctx, "Refreshed indicator profiles", "table", TableName, "sources", len(sources))
+	return nil
+}
@@ -0,0 +1,64 @@
+package correlate_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/drone/pkg/correlate"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/gt"
+)
+
+var sources = []*model.IndicatorSource{
+	{
+		Feed:  types.FeedAbuseChFeodo,
+		Type:  types.IndicatorIP,
+		Query: "SELECT * FROM feodo",
+	},
+	{
+		Feed:  types.FeedOTXSubscribed,
+		Type:  types.IndicatorDomain,
+		Query: "SELECT * FROM otx",
+	},
+}
+
+func TestQuery(t *testing.T) {
+	query := correlate.Query(sources)
+
+	// Indicators are normalized by type before grouping
+	gt.S(t, query).Contains("SELECT 'abuse.ch-feodo' AS Feed, 'ip' AS Type, COALESCE(NET.IP_TO_STRING(SAFE.NET.IP_FROM_STRING(TRIM(Indicator))), LOWER(TRIM(Indicator))) AS Indicator, SightingKey, FirstSeen, LastSeen, Confidence, Tags, MalwareFamilies FROM (SELECT * FROM feodo)")
+	gt.S(t, query).Contains("SELECT 'otx-subscribed' AS Feed, 'domain' AS Type, RTRIM(LOWER(TRIM(Indicator)), '.') AS Indicator")
+	gt.S(t, query).Contains("GROUP BY Feed, Type, Indicator")
+	// Rows of the same entry, e.g. revisions of a pulse, are counted as one sighting
+	gt.S(t, query).Contains("COUNT(DISTINCT SightingKey) AS Sightings")
+	gt.S(t, query).Contains("GROUP BY Type, Indicator")
+	gt.S(t, query).Contains("ARRAY_LENGTH(Sources) AS SourceCount")
+	// Profiles include expired indicators
+	gt.S(t, query).NotContains("CURRENT_TIMESTAMP()")
+
+	gt.V(t, correlate.Query(nil)).Equal("")
+}
+
+func TestQueryFeeds(t *testing.T) {
+	// All feeds have MalwareFamilies and SightingKey columns to be merged in profiles
+	sources := gt.R1(feed.Indicators()).NoError(t)
+	for _, src := range sources {
+		gt.S(t, src.Query).Contains("MalwareFamilies")
+		gt.S(t, src.Query).Contains("AS SightingKey")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	mock := bq.NewMock()
+	gt.NoError(t, correlate.Refresh(context.Background(), mock, sources))
+	gt.A(t, mock.Queries).Length(1).At(0, func(t testing.TB, v string) {
+		gt.S(t, v).Contains("CREATE OR REPLACE TABLE indicator_profiles")
+		gt.S(t, v).Contains("CURRENT_TIMESTAMP() AS RefreshedAt")
+		gt.S(t, v).Contains("FROM (SELECT * FROM otx)")
+	})
+
+	gt.Error(t, correlate.Refresh(context.Background(), mock, nil))
+}
@@ -0,0 +1,105 @@
+// Package deadletter handles feed records that can not be parsed by parse error policy. In dead-letter policy, the records are written into drone_dead_letters table with raw payload.
+package deadletter
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/bqs"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+// TableName is a table of dead letters shared by all feeds.
+const TableName = "drone_dead_letters"
+
+// Letter is a row of dead letter table.
+type Letter struct {
+	Feed  types.FeedID
+	RunID string
+	// Payload is raw data of the record, e.g. JSON object in the response.
+	Payload   string
+	Error     string
+	CreatedAt time.Time
+}
+
+// tableSpec is a layout of dead letter table. Rows are partitioned by created time.
+var tableSpec = &model.TableSpec{
+	PartitionField:   "CreatedAt",
+	PartitionType:    bigquery.DayPartitioningType,
+	ClusteringFields: []string{"Feed"},
+}
+
+// Handler collects records that can not be parsed in an import run of the feed.
+type Handler struct {
+	feedID  types.FeedID
+	policy  types.ParseErrorPolicy
+	summary *model.ImportSummary
+
+	letters []*Letter
+	created bool
+}
+
+// New returns a handler of parse errors. Empty policy means types.ParseErrorFail.
+func New(feedID types.FeedID, policy types.ParseErrorPolicy, summary *model.ImportSummary) *Handler {
+	if policy == "" {
+		policy = types.ParseErrorFail
+	}
+	return &Handler{
+		feedID:  feedID,
+		policy:  policy,
+		summary: summary,
+	}
+}
+
+// Handle handles a record that can not be parsed. In fail policy, it returns err as it is to abort import. Otherwise, the record is counted as malformed and nil is returned to continue with next record.
+func (x *Handler) Handle(ctx context.Context, payload []byte, err error) error {
+	if x.policy == types.ParseErrorFail {
+		return err
+	}
+
+	x.summary.RecordsMalformed++
+	utils.Logger().WarnContext(ctx, "Skip malformed record", "feed", x.feedID, "policy", x.policy, utils.ErrLog(err))
+
+	if x.policy == types.ParseErrorDeadLetter {
+		x.letters = append(x.letters, &Letter{
+			Feed:      x.feedID,
+			RunID:     x.summary.RunID,
+			Payload:   string(payload),
+			Error:     err.Error(),
+			CreatedAt: time.Now(),
+		})
+	}
+	return nil
+}
+
+// Flush writes collected dead letters into dead letter table. The table is created at the first write.
+func (x *Handler) Flush(ctx context.Context, bq interfaces.BigQuery) error {
+	if len(x.letters) == 0 {
+		return nil
+	}
+
+	if !x.created {
+		schema, err := bqs.Infer(&Letter{})
+		if err != nil {
+			return goerr.Wrap(err, "Fail to infer schema").With("table", TableName)
+		}
+		if err := bq.CreateOrUpdateSchema(ctx, TableName, schema, tableSpec); err != nil {
+			return goerr.Wrap(err, "Fail to migrate dead letter table")
+		}
+		x.created = true
+	}
+
+	failed, err := x.summary.CheckInsert(bq.Insert(ctx, TableName, x.letters))
+	if err != nil {
+		return goerr.Wrap(err, "Fail to insert dead letters").With("feed", x.feedID)
+	}
+	x.summary.DeadLetters += len(x.letters) - len(failed)
+	x.letters = nil
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package deadletter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/drone/pkg/deadletter"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/gt"
+)
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	parseErr := errors.New("invalid record")
+
+	t.Run("fail policy returns error", func(t *testing.T) {
+		summary := model.NewImportSummary(types.FeedAbuseChFeodo)
+		h := deadletter.New(types.FeedAbuseChFeodo, types.ParseErrorFail, summary)
+		gt.Error(t, h.Handle(ctx, []byte(`{"x":1}`), parseErr))
+		gt.V(t, summary.RecordsMalformed).Equal(0)
+	})
+
+	t.Run("skip policy counts malformed record", func(t *testing.T) {
+		summary := model.NewImportSummary(types.FeedAbuseChFeodo)
+		h := deadletter.New(types.FeedAbuseChFeodo, types.ParseErrorSkip, summary)
+		gt.NoError(t, h.Handle(ctx, []byte(`{"x":1}`), parseErr))
+
+		mock := bq.NewMock()
+		gt.NoError(t, h.Flush(ctx, mock))
+		gt.V(t, summary.RecordsMalformed).Equal(1)
+		gt.V(t, summary.DeadLetters).Equal(0)
+		gt.V(t, len(mock.InsertedTable)).Equal(0)
+	})
+
+	t.Run("dead-letter policy writes raw payload", func(t *testing.T) {
+		summary := model.NewImportSummary(types.FeedAbuseChFeodo)
+		h := deadletter.New(types.FeedAbuseChFeodo, types.ParseErrorDeadLetter, summary)
+		gt.NoError(t, h.Handle(ctx, []byte(`{"x":1}`), parseErr))
+		gt.NoError(t, h.Handle(ctx, []byte(`{"x":2}`), parseErr))
+
+		mock := bq.NewMock()
+		gt.NoError(t, h.Flush(ctx, mock))
+		gt.V(t, summary.RecordsMalformed).Equal(2)
+		gt.V(t, summary.DeadLetters).Equal(2)
+		gt.V(t, mock.Schemas[deadletter.TableName]).NotNil()
+
+		inserted := mock.InsertedTable[deadletter.TableName]
+		gt.A(t, inserted).Length(1)
+		letters := gt.Cast[[]*deadletter.Letter](t, inserted[0])
+		gt.A(t, letters).Length(2).At(0, func(t testing.TB, v *deadletter.Letter) {
+			gt.V(t, v.Feed).Equal(types.FeedAbuseChFeodo)
+			gt.V(t, v.RunID).Equal(summary.RunID)
+			gt.V(t, v.Payload).Equal(`{"x":1}`)
+			gt.V(t, v.Error).Equal("invalid record")
+		})
+
+		// letters are not written twice
+		gt.NoError(t, h.Flush(ctx, mock))
+		gt.A(t, mock.InsertedTable[deadletter.TableName]).Length(1)
+
+		summary.Finish(nil)
+		gt.A(t, summary.Warnings).Length(1)
+	})
+}
@@ -0,0 +1,287 @@
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/bqs"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// KeyFunc returns a stable key of the record in the feed.
+type KeyFunc[T any] func(record *T) string
+
+// Result is a difference between records of the current import and record hashes stored in the database.
+type Result[T any] struct {
+	feedID  types.FeedID
+	Added   []T
+	Updated []T
+	// Removed is keys of records that are stored but not found in the current import. It is set only when the feed data is a full snapshot.
+	Removed []string
+
+	addedHashes   []*model.RecordHash
+	updatedHashes []*model.RecordHash
+}
+
+// ChangeRow is a row of change table. Record is zero value if Change is removed.
+type ChangeRow[T any] struct {
+	Change     types.ChangeType
+	Key        string
+	Hash       string
+	DetectedAt time.Time
+	Record     T
+}
+
+// Hash calculates content hash of the record. The record is serialized as JSON, so field order of struct and key order of map are stable.
+func Hash(record any) (string, error) {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return "", goerr.Wrap(err, "Fail to marshal record")
+	}
+
+	h := sha256.Sum256(raw)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// Diff compares records with hashes stored in the database. If snapshot is true, records are treated as full snapshot of the feed and stored keys that are missing in records are reported as Removed.
+func Diff[T any](ctx context.Context, db interfaces.Database, feedID types.FeedID, records []T, keyOf KeyFunc[T], snapshot bool) (*Result[T], error) {
+	now := time.Now()
+	result := &Result[T]{feedID: feedID}
+
+	keys := make([]string, len(records))
+	hashes := make([]string, len(records))
+	for i := range records {
+		hash, err := Hash(&records[i])
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = keyOf(&records[i])
+		hashes[i] = hash
+	}
+
+	var stored map[string]*model.RecordHash
+	if snapshot {
+		list, err := db.ListRecordHashes(ctx, feedID)
+		if err != nil {
+			return nil, goerr.Wrap(err, "Fail to list record hashes").With("feed", feedID)
+		}
+		stored = make(map[string]*model.RecordHash, len(list))
+		for _, hash := range list {
+			stored[hash.Key] = hash
+		}
+	} else {
+		resp, err := db.GetRecordHashes(ctx, feedID, keys)
+		if err != nil {
+			return nil, goerr.Wrap(err, "Fail to get record hashes").With("feed", feedID)
+		}
+		stored = resp
+	}
+
+	seen := make(map[string]struct{}, len(records))
+	for i := range records {
+		key, hash := keys[i], hashes[i]
+		if _, ok := seen[key]; ok {
+			continue // duplicated key in the same import
+		}
+		seen[key] = struct{}{}
+
+		recordHash := &model.RecordHash{
+			Key:       key,
+			Hash:      hash,
+			UpdatedAt: now,
+		}
+
+		if old, ok := stored[key]; !ok {
+			result.Added = append(result.Added, records[i])
+			result.addedHashes = append(result.addedHashes, recordHash)
+		} else if old.Hash != hash {
+			result.Updated = append(result.Updated, records[i])
+			result.updatedHashes = append(result.updatedHashes, recordHash)
+		}
+	}
+
+	if snapshot {
+		for key := range stored {
+			if _, ok := seen[key]; !ok {
+				result.Removed = append(result.Removed, key)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Records returns added and updated records.
+func (x *Result[T]) Records() []T {
+	return append(append([]T{}, x.Added...), x.Updated...)
+}
+
+// Changes returns change rows of added, updated and removed records.
+func (x *Result[T]) Changes(detectedAt time.Time) []ChangeRow[T] {
+	var rows []ChangeRow[T]
+	for i, rec := range x.Added {
+		rows = append(rows, ChangeRow[T]{
+			Change:     types.ChangeAdded,
+			Key:        x.addedHashes[i].Key,
+			Hash:       x.addedHashes[i].Hash,
+			DetectedAt: detectedAt,
+			Record:     rec,
+		})
+	}
+	for i, rec := range x.Updated {
+		rows = append(rows, ChangeRow[T]{
+			Change:     types.ChangeUpdated,
+			Key:        x.updatedHashes[i].Key,
+			Hash:       x.updatedHashes[i].Hash,
+			DetectedAt: detectedAt,
+			Record:     rec,
+		})
+	}
+
+	for _, key := range x.Removed {
+		rows = append(rows, ChangeRow[T]{
+			Change:     types.ChangeRemoved,
+			Key:        key,
+			DetectedAt: detectedAt,
+		})
+	}
+
+	return rows
+}
+
+// Keys returns keys of added and updated records in the same order as Records.
+func (x *Result[T]) Keys() []string {
+	keys := make([]string, 0, len(x.addedHashes)+len(x.updatedHashes))
+	for _, hash := range append(append([]*model.RecordHash{}, x.addedHashes...), x.updatedHashes...) {
+		keys = append(keys, hash.Key)
+	}
+	return keys
+}
+
+// Commit saves hashes of added and updated records and deletes hashes of removed records. It should be called after the records are inserted. Hashes of excluded keys (e.g. records that failed to be inserted) are neither saved nor deleted, then the records are detected again in next import.
+func (x *Result[T]) Commit(ctx context.Context, db interfaces.Database, excluded ...string) error {
+	skip := make(map[string]struct{}, len(excluded))
+	for _, key := range excluded {
+		skip[key] = struct{}{}
+	}
+
+	var hashes []*model.RecordHash
+	for _, hash := range append(append([]*model.RecordHash{}, x.addedHashes...), x.updatedHashes...) {
+		if _, ok := skip[hash.Key]; !ok {
+			hashes = append(hashes, hash)
+		}
+	}
+	if len(hashes) > 0 {
+		if err := db.PutRecordHashes(ctx, x.feedID, hashes); err != nil {
+			return goerr.Wrap(err, "Fail to put record hashes").With("feed", x.feedID)
+		}
+	}
+
+	var removed []string
+	for _, key := range x.Removed {
+		if _, ok := skip[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	if len(removed) > 0 {
+		if err := db.DeleteRecordHashes(ctx, x.feedID, removed); err != nil {
+			return goerr.Wrap(err, "Fail to delete record hashes").With("feed", x.feedID)
+		}
+	}
+
+	return nil
+}
+
+// changeTableSpec is a layout of change tables. Rows are partitioned by detected time.
+var changeTableSpec = &model.TableSpec{
+	PartitionField:   "DetectedAt",
+	PartitionType:    bigquery.DayPartitioningType,
+	ClusteringFields: []string{"Change", "Key"},
+}
+
+// ChangeTableName returns name of the table to store change rows of the table.
+func ChangeTableName(tableName string) string {
+	return tableName + "_changes"
+}
+
+// Insert inserts records by content hash based deduplication. In DedupHash mode, new or changed records are inserted into tableName. In DedupChanges mode, change rows are inserted into the change table of tableName. It returns number of inserted rows and keys of rows that failed to be inserted, and counts inserted rows, unchanged records and failed rows in summary. Hashes of the failed keys are not committed.
+func Insert[T any](ctx context.Context, clients *infra.Clients, summary *model.ImportSummary, feedID types.FeedID, mode types.DedupMode, tableName string, records []T, keyOf KeyFunc[T], snapshot bool) (_ int, _ []string, err error) {
+	ctx, span := utils.StartSpan(ctx, "dedup.Insert",
+		utils.AttrFeedID.String(feedID.String()),
+		utils.AttrTable.String(tableName),
+		utils.AttrRows.Int(len(records)),
+		attribute.String("drone.dedup_mode", string(mode)),
+	)
+	defer func() { utils.EndSpan(span, err) }()
+
+	result, err := Diff(ctx, clients.Database(), feedID, records, keyOf, snapshot)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	utils.Logger().InfoContext(ctx, "Diff records",
+		"feed", feedID,
+		"added", len(result.Added),
+		"updated", len(result.Updated),
+		"removed", len(result.Removed),
+	)
+
+	var inserted int
+	var failedKeys []string
+	switch mode {
+	case types.DedupHash:
+		if rows := result.Records(); len(rows) > 0 {
+			failed, err := summary.CheckInsert(clients.BigQuery().Insert(ctx, tableName, rows))
+			if err != nil {
+				return 0, nil, goerr.Wrap(err, "Fail to insert records").With("table", tableName)
+			}
+			keys := result.Keys()
+			for _, idx := range failed {
+				failedKeys = append(failedKeys, keys[idx])
+			}
+			inserted = len(rows) - len(failed)
+		}
+
+	case types.DedupChanges:
+		changeTable := ChangeTableName(tableName)
+		schema, err := bqs.Infer(&ChangeRow[T]{})
+		if err != nil {
+			return 0, nil, goerr.Wrap(err, "Fail to infer schema")
+		}
+		if err := clients.BigQuery().CreateOrUpdateSchema(ctx, changeTable, schema, changeTableSpec); err != nil {
+			return 0, nil, goerr.Wrap(err, "Fail to migrate change table").With("table", changeTable)
+		}
+
+		if rows := result.Changes(time.Now()); len(rows) > 0 {
+			failed, err := summary.CheckInsert(clients.BigQuery().Insert(ctx, changeTable, rows))
+			if err != nil {
+				return 0, nil, goerr.Wrap(err, "Fail to insert change rows").With("table", changeTable)
+			}
+			for _, idx := range failed {
+				failedKeys = append(failedKeys, rows[idx].Key)
+			}
+			inserted = len(rows) - len(failed)
+		}
+
+	default:
+		return 0, nil, goerr.Wrap(types.ErrInvalidOption, "dedup mode is not hash based").With("mode", mode)
+	}
+
+	if err := result.Commit(ctx, clients.Database(), failedKeys...); err != nil {
+		return 0, nil, err
+	}
+	summary.RecordsInserted += inserted
+	summary.RecordsSkipped += len(records) - len(result.Added) - len(result.Updated)
+
+	return inserted, failedKeys, nil
+}
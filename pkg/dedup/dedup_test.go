@@ -0,0 +1,132 @@
+package dedup_test
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/dedup"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/infra/memdb"
+	"github.com/m-mizutani/gt"
+)
+
+type testRecord struct {
+	ID     string
+	Status string
+}
+
+func testKey(r *testRecord) string { return r.ID }
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	clients := infra.New()
+	db := clients.Database()
+
+	first := []testRecord{
+		{ID: "a", Status: "online"},
+		{ID: "b", Status: "online"},
+	}
+	r1 := gt.R1(dedup.Diff(ctx, db, "test", first, testKey, true)).NoError(t)
+	gt.A(t, r1.Added).Length(2)
+	gt.A(t, r1.Updated).Length(0)
+	gt.A(t, r1.Removed).Length(0)
+	gt.NoError(t, r1.Commit(ctx, db))
+
+	second := []testRecord{
+		{ID: "a", Status: "online"},
+		{ID: "b", Status: "offline"},
+		{ID: "c", Status: "online"},
+	}
+	r2 := gt.R1(dedup.Diff(ctx, db, "test", second, testKey, true)).NoError(t)
+	gt.A(t, r2.Added).Length(1).At(0, func(t testing.TB, v testRecord) {
+		gt.Equal(t, v.ID, "c")
+	})
+	gt.A(t, r2.Updated).Length(1).At(0, func(t testing.TB, v testRecord) {
+		gt.Equal(t, v.Status, "offline")
+	})
+	gt.A(t, r2.Removed).Length(0)
+	gt.NoError(t, r2.Commit(ctx, db))
+
+	third := []testRecord{
+		{ID: "b", Status: "offline"},
+	}
+	r3 := gt.R1(dedup.Diff(ctx, db, "test", third, testKey, true)).NoError(t)
+	gt.A(t, r3.Added).Length(0)
+	gt.A(t, r3.Updated).Length(0)
+	gt.A(t, r3.Removed).Length(2)
+
+	// Removed records are not detected if data is not a snapshot
+	r4 := gt.R1(dedup.Diff(ctx, db, "test", third, testKey, false)).NoError(t)
+	gt.A(t, r4.Removed).Length(0)
+}
+
+func TestInsertChanges(t *testing.T) {
+	ctx := context.Background()
+	mock := bq.NewMock()
+	clients := infra.New(infra.WithBigQuery(mock))
+
+	summary := model.NewImportSummary("test")
+
+	records := []testRecord{
+		{ID: "a", Status: "online"},
+	}
+	insert := func(records []testRecord) int {
+		n, failed, err := dedup.Insert(ctx, clients, summary, "test", types.DedupChanges, "records", records, testKey, true)
+		gt.NoError(t, err)
+		gt.A(t, failed).Length(0)
+		return n
+	}
+	gt.Equal(t, insert(records), 1)
+
+	// no change
+	gt.Equal(t, insert(records), 0)
+
+	gt.Equal(t, insert([]testRecord{}), 1)
+
+	gt.Equal(t, summary.RecordsInserted, 2)
+	gt.Equal(t, summary.RecordsSkipped, 1)
+
+	gt.A(t, mock.InsertedData).Length(2)
+	rows := gt.Cast[[]dedup.ChangeRow[testRecord]](t, mock.InsertedData[1])
+	gt.A(t, rows).Length(1).At(0, func(t testing.TB, v dedup.ChangeRow[testRecord]) {
+		gt.Equal(t, v.Change, types.ChangeRemoved)
+		gt.Equal(t, v.Key, "a")
+	})
+}
+
+func TestInsertPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	mock := bq.NewMock()
+	db := memdb.New()
+	clients := infra.New(infra.WithBigQuery(mock), infra.WithDatabase(db))
+	summary := model.NewImportSummary("test")
+
+	// The second row is rejected by BigQuery
+	mock.InsertFunc = func(tableName string, data any) error {
+		return &types.PartialInsertError{
+			Table: tableName,
+			Total: 2,
+			Rows:  bigquery.PutMultiError{{RowIndex: 1}},
+		}
+	}
+
+	records := []testRecord{
+		{ID: "a", Status: "online"},
+		{ID: "b", Status: "online"},
+	}
+	n, failed, err := dedup.Insert(ctx, clients, summary, "test", types.DedupHash, "records", records, testKey, false)
+	gt.NoError(t, err)
+	gt.Equal(t, n, 1)
+	gt.V(t, failed).Equal([]string{"b"})
+	gt.Equal(t, summary.RowsFailed, 1)
+
+	// Hash of the failed record is not committed, then it's detected again
+	result := gt.R1(dedup.Diff(ctx, db, "test", records, testKey, false)).NoError(t)
+	gt.A(t, result.Added).Length(1).At(0, func(t testing.TB, v testRecord) {
+		gt.Equal(t, v.ID, "b")
+	})
+}
@@ -9,11 +9,67 @@ import (
 )
 
 type BigQuery interface {
-	CreateOrUpdateSchema(ctx context.Context, tableName string, schema bigquery.Schema) error
+	// CreateOrUpdateSchema creates the table with schema and spec, or merges schema into the existing table. spec can be nil.
+	CreateOrUpdateSchema(ctx context.Context, tableName string, schema bigquery.Schema, spec *model.TableSpec) error
 	Insert(ctx context.Context, tableName string, data any) error
+	// GetSchema returns schema of the existing table. It returns nil if the table does not exist.
+	GetSchema(ctx context.Context, tableName string) (bigquery.Schema, error)
+	// MigrateTable creates a new version of the table with schema and spec, copies rows and swaps the view of tableName to the new version. It returns name of the new physical table.
+	MigrateTable(ctx context.Context, tableName string, schema bigquery.Schema, spec *model.TableSpec) (string, error)
+	// CreateOrUpdateView creates the view, or replaces query and description of the existing view.
+	CreateOrUpdateView(ctx context.Context, view *model.View) error
+	// Query runs the query and returns all rows. Unqualified table names in the query are resolved in the dataset of the client.
+	Query(ctx context.Context, query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error)
+	// Close releases connections of the client.
+	Close() error
 }
 
 type Database interface {
 	PutImportLog(ctx context.Context, id types.FeedID, log *model.ImportLog) error
 	GetLatestImportLog(ctx context.Context, id types.FeedID) (*model.ImportLog, error)
+
+	// SetImportLog overwrites import log of the feed even if LatestRecord goes backward. It's used to rewind watermark manually.
+	SetImportLog(ctx context.Context, id types.FeedID, log *model.ImportLog) error
+	// DeleteImportLog removes import log of the feed. Next import will start from initial state.
+	DeleteImportLog(ctx context.Context, id types.FeedID) error
+
+	// GetImportCheckpoint returns progress of an interrupted import run of the feed. It returns nil if no run is in progress.
+	GetImportCheckpoint(ctx context.Context, id types.FeedID) (*model.ImportCheckpoint, error)
+	PutImportCheckpoint(ctx context.Context, id types.FeedID, checkpoint *model.ImportCheckpoint) error
+	// DeleteImportCheckpoint removes progress of the import run. It's called when the run completes.
+	DeleteImportCheckpoint(ctx context.Context, id types.FeedID) error
+
+	// GetRecordHashes returns record hashes of the feed for given keys. Keys that are not stored are not included in the result.
+	GetRecordHashes(ctx context.Context, id types.FeedID, keys []string) (map[string]*model.RecordHash, error)
+	// ListRecordHashes returns all record hashes of the feed.
+	ListRecordHashes(ctx context.Context, id types.FeedID) ([]*model.RecordHash, error)
+	PutRecordHashes(ctx context.Context, id types.FeedID, hashes []*model.RecordHash) error
+	DeleteRecordHashes(ctx context.Context, id types.FeedID, keys []string) error
+
+	// GetSnapshot returns the latest snapshot of the feed. It returns nil if no snapshot is stored.
+	GetSnapshot(ctx context.Context, id types.FeedID) (*model.Snapshot, error)
+	PutSnapshot(ctx context.Context, id types.FeedID, snapshot *model.Snapshot) error
+	// DeleteSnapshot removes snapshot of the feed. Next import does not detect changes from the previous records.
+	DeleteSnapshot(ctx context.Context, id types.FeedID) error
+
+	// GetHTTPCache returns validators of the last response for the cache key. It returns nil if no cache is stored.
+	GetHTTPCache(ctx context.Context, key string) (*model.HTTPCache, error)
+	PutHTTPCache(ctx context.Context, key string, cache *model.HTTPCache) error
+
+	// GetAlertLog returns a record of the alert sent with the key. It returns nil if the alert has not been sent.
+	GetAlertLog(ctx context.Context, key string) (*model.AlertLog, error)
+	PutAlertLog(ctx context.Context, log *model.AlertLog) error
+}
+
+// Notifier sends alerts to people. Alerts that have been sent are skipped.
+type Notifier interface {
+	Notify(ctx context.Context, alerts ...*model.Alert) error
+}
+
+// Archive stores raw response bodies fetched from feed providers to reprocess them by the current transform later.
+type Archive interface {
+	Put(ctx context.Context, key *model.ArchiveKey, body []byte) error
+	Get(ctx context.Context, key *model.ArchiveKey) ([]byte, error)
+	// List returns keys of archived bodies of the feed in order of run start time and page.
+	List(ctx context.Context, id types.FeedID) ([]*model.ArchiveKey, error)
 }
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+)
+
+// Alert is a notification of event detected by drone. Key identifies the alert to send it only once, e.g. feed and indicator of match.
+type Alert struct {
+	Type      types.AlertType
+	Key       string
+	Title     string
+	CreatedAt time.Time
+	// Data is detail of the alert, e.g. model.Match. It's available in message template as .Data and sent as "data" field by webhook.
+	Data any
+}
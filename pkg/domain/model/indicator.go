@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+)
+
+// IndicatorSource is a query to select indicators of the type from tables of the feed. Query must return Indicator (STRING), SightingKey (STRING), FirstSeen, LastSeen and Expiration (TIMESTAMP), Confidence (INT64, 0-100), Tags and MalwareFamilies (ARRAY<STRING>) columns, and tables in the query are referred as `{{ table "name" }}` in the same syntax as View, then the query can be used in views and query jobs (see RenderQuery). SightingKey identifies an entry of the feed that has the indicator, e.g. pulse ID, and rows of the same key are counted as one sighting. Expiration is expiry given by the provider, and NULL if the provider has no expiry.
+type IndicatorSource struct {
+	Feed  types.FeedID
+	Type  types.IndicatorType
+	Query string
+	Aging AgingPolicy
+}
+
+// AgingPolicy is how indicators get stale. An indicator without Expiration expires TTL after LastSeen, and its confidence is halved every HalfLife since LastSeen. Zero TTL means it never expires, and zero HalfLife means confidence doesn't decay.
+type AgingPolicy struct {
+	TTL      time.Duration
+	HalfLife time.Duration
+}
+
+// Match is a log row that has a value matched with an indicator.
+type Match struct {
+	MatchedAt     time.Time
+	Feed          string
+	IndicatorType string
+	Indicator     string
+	// SourceTable and SourceColumn are the log table and column that have the matched value.
+	SourceTable  string
+	SourceColumn string
+	Value        string
+	LogTimestamp time.Time
+	// LogRowHash is a fingerprint of the whole log row to find the row in the log table.
+	LogRowHash string
+}
@@ -1,8 +1,97 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+)
 
 type ImportLog struct {
 	LatestRecord time.Time
-	CheckedAt    time.Time
+	// Inserted is keys of records after LatestRecord that have already been inserted. LatestRecord stays before a record that failed to be inserted, then records after it are fetched again in next import and skipped by the keys.
+	Inserted  []string
+	CheckedAt time.Time
+}
+
+// IsNewerThan returns true if the log has later LatestRecord than the given log. Import log is not overwritten by older one, then watermark never moves backward except rewind.
+func (x *ImportLog) IsNewerThan(log *ImportLog) bool {
+	return x != nil && log != nil && x.LatestRecord.After(log.LatestRecord)
+}
+
+// WatermarkBefore returns latest, or a time just before earliestFailed if it is not after latest. Watermark never passes records that failed to be inserted, then they are imported again in next import. earliestFailed can be nil.
+func WatermarkBefore(latest time.Time, earliestFailed *time.Time) time.Time {
+	if earliestFailed != nil && !latest.Before(*earliestFailed) {
+		return earliestFailed.Add(-time.Nanosecond)
+	}
+	return latest
+}
+
+// EarliestTime returns the earlier time of t and other. Nil means no time.
+func EarliestTime(t *time.Time, other *time.Time) *time.Time {
+	if t == nil || (other != nil && other.Before(*t)) {
+		return other
+	}
+	return t
+}
+
+// ImportCheckpoint is progress of an import run that fetches multiple pages. It's stored after each page and removed when the run completes, then an interrupted run resumes from NextURL.
+type ImportCheckpoint struct {
+	// Since is the start time of the run, e.g. modified_since of OTX API. The run keeps it until completion even if it is resumed.
+	Since time.Time
+	// NextURL is a URL of the next page to be fetched.
+	NextURL string
+	// Page is a number of pages imported in the run.
+	Page int
+	// LatestRecord is the latest record time seen in the run. It's committed as watermark when the run completes. Zero means no record has been seen.
+	LatestRecord time.Time
+	// EarliestFailed is the earliest record time of records that failed to be inserted in the run. Watermark is committed before it.
+	EarliestFailed *time.Time
+	UpdatedAt      time.Time
+}
+
+// RecordHash is a content hash of a feed record. Key identifies the record in the feed (e.g. IP address and port, pulse ID) and Hash is calculated from the record content.
+type RecordHash struct {
+	Key       string
+	Hash      string
+	UpdatedAt time.Time
+}
+
+// Snapshot is a serialized full data set of a feed at the last import. It is used to detect changes between imports.
+type Snapshot struct {
+	Data      []byte
+	CreatedAt time.Time
+}
+
+// HTTPCache is validators of the last fetched response. They are sent as conditional request headers to skip unchanged downloads.
+type HTTPCache struct {
+	URL          string
+	ETag         string
+	LastModified string
+	UpdatedAt    time.Time
+}
+
+// AlertLog is a record of sent alert. It is used to prevent sending the same alert again across runs.
+type AlertLog struct {
+	Key    string
+	Type   string
+	SentAt time.Time
+}
+
+// ArchiveKey identifies a raw response body stored in archive. A body is stored for each page fetched in an import run.
+type ArchiveKey struct {
+	Feed  types.FeedID
+	RunID string
+	// RunAt is start time of the import run. Archived runs are ordered by it.
+	RunAt time.Time
+	Page  int
+}
+
+// NewArchiveKey returns a key of the page fetched in the import run of summary.
+func NewArchiveKey(summary *ImportSummary, page int) *ArchiveKey {
+	return &ArchiveKey{
+		Feed:  summary.Feed,
+		RunID: summary.RunID,
+		RunAt: summary.StartedAt,
+		Page:  page,
+	}
 }
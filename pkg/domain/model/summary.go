@@ -0,0 +1,121 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+)
+
+// ImportSummary is a machine-readable result of import of a feed. Importers count pages and records, and the caller finishes it with the result.
+type ImportSummary struct {
+	Feed types.FeedID `json:"feed"`
+	// RunID identifies the import run, e.g. in dead letter table.
+	RunID string `json:"run_id"`
+
+	Status          types.ImportStatus `json:"status"`
+	StartedAt       time.Time          `json:"started_at"`
+	DurationSeconds float64            `json:"duration_seconds"`
+
+	PagesFetched    int `json:"pages_fetched"`
+	RecordsParsed   int `json:"records_parsed"`
+	RecordsSkipped  int `json:"records_skipped"`
+	RecordsInserted int `json:"records_inserted"`
+	// RecordsMalformed is number of records that can not be parsed and are skipped by parse error policy.
+	RecordsMalformed int `json:"records_malformed"`
+	// DeadLetters is number of malformed records written into dead letter table.
+	DeadLetters int `json:"dead_letters"`
+	// RowsFailed is number of rows that failed to be inserted into any table.
+	RowsFailed int `json:"rows_failed"`
+
+	PreviousWatermark *time.Time `json:"previous_watermark"`
+	NewWatermark      *time.Time `json:"new_watermark"`
+
+	Warnings []string `json:"warnings"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func NewImportSummary(feed types.FeedID) *ImportSummary {
+	return &ImportSummary{
+		Feed:      feed,
+		RunID:     uuid.NewString(),
+		StartedAt: time.Now(),
+		Warnings:  []string{},
+	}
+}
+
+// Warn adds a warning message.
+func (x *ImportSummary) Warn(format string, args ...any) {
+	x.Warnings = append(x.Warnings, fmt.Sprintf(format, args...))
+}
+
+// CheckInsert returns indexes of rows that failed to be inserted. Partial insert error is recorded as a warning and not returned because other rows have been inserted. Other errors are returned as it is. Callers must not commit import state (watermark, record hashes and snapshot) of the failed rows, then they are imported again in next import.
+func (x *ImportSummary) CheckInsert(err error) ([]int, error) {
+	if err == nil {
+		return nil, nil
+	}
+
+	var partial *types.PartialInsertError
+	if !errors.As(err, &partial) {
+		return nil, err
+	}
+
+	x.RowsFailed += len(partial.Rows)
+	x.Warn("%s", partial.Error())
+	return partial.Indexes(), nil
+}
+
+// Finish sets duration and status by the result of import.
+func (x *ImportSummary) Finish(err error) {
+	x.DurationSeconds = time.Since(x.StartedAt).Seconds()
+	if x.RecordsMalformed > 0 {
+		x.Warn("%d records can not be parsed and are skipped (%d written into dead letter table)", x.RecordsMalformed, x.DeadLetters)
+	}
+	switch {
+	case err != nil:
+		x.Status = types.ImportFailed
+		x.Error = err.Error()
+	case x.RowsFailed > 0:
+		x.Status = types.ImportPartial
+	default:
+		x.Status = types.ImportSucceeded
+	}
+}
+
+// Skip marks the import as skipped.
+func (x *ImportSummary) Skip() {
+	x.DurationSeconds = time.Since(x.StartedAt).Seconds()
+	x.Status = types.ImportSkipped
+}
+
+// RunSummary is a result of a run of import command that imports one or more feeds.
+type RunSummary struct {
+	Status types.ImportStatus `json:"status"`
+	Feeds  []*ImportSummary   `json:"feeds"`
+}
+
+// NewRunSummary returns summary of the run. The run is failed if all imports failed, and partial if any import failed or partially failed.
+func NewRunSummary(feeds ...*ImportSummary) *RunSummary {
+	run := &RunSummary{
+		Status: types.ImportSucceeded,
+		Feeds:  append([]*ImportSummary{}, feeds...),
+	}
+
+	var failed int
+	for _, feed := range feeds {
+		switch feed.Status {
+		case types.ImportFailed:
+			failed++
+			run.Status = types.ImportPartial
+		case types.ImportPartial:
+			run.Status = types.ImportPartial
+		}
+	}
+	if failed > 0 && failed == len(feeds) {
+		run.Status = types.ImportFailed
+	}
+
+	return run
+}
@@ -0,0 +1,72 @@
+package model_test
+
+import (
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/gt"
+)
+
+func TestImportSummary(t *testing.T) {
+	t.Run("partial insert is recorded as warning", func(t *testing.T) {
+		summary := model.NewImportSummary(types.FeedAbuseChFeodo)
+		failed, err := summary.CheckInsert(&types.PartialInsertError{
+			Table: "feodo",
+			Total: 3,
+			Rows:  bigquery.PutMultiError{{RowIndex: 2}, {RowIndex: 1}},
+		})
+		gt.NoError(t, err)
+		gt.V(t, failed).Equal([]int{1, 2})
+		gt.A(t, summary.Warnings).Length(1)
+
+		summary.Finish(nil)
+		gt.V(t, summary.Status).Equal(types.ImportPartial)
+		gt.V(t, summary.RowsFailed).Equal(2)
+	})
+
+	t.Run("other insert error is returned", func(t *testing.T) {
+		summary := model.NewImportSummary(types.FeedAbuseChFeodo)
+		_, err := summary.CheckInsert(errors.New("boom"))
+		gt.Error(t, err)
+
+		summary.Finish(err)
+		gt.V(t, summary.Status).Equal(types.ImportFailed)
+		gt.V(t, summary.Error).Equal("boom")
+	})
+}
+
+func TestNewRunSummary(t *testing.T) {
+	summary := func(status types.ImportStatus) *model.ImportSummary {
+		return &model.ImportSummary{Status: status}
+	}
+
+	testCases := map[string]struct {
+		feeds    []*model.ImportSummary
+		expected types.ImportStatus
+	}{
+		"all succeeded": {
+			feeds:    []*model.ImportSummary{summary(types.ImportSucceeded), summary(types.ImportSkipped)},
+			expected: types.ImportSucceeded,
+		},
+		"partial insert": {
+			feeds:    []*model.ImportSummary{summary(types.ImportSucceeded), summary(types.ImportPartial)},
+			expected: types.ImportPartial,
+		},
+		"some feeds failed": {
+			feeds:    []*model.ImportSummary{summary(types.ImportSucceeded), summary(types.ImportFailed)},
+			expected: types.ImportPartial,
+		},
+		"all feeds failed": {
+			feeds:    []*model.ImportSummary{summary(types.ImportFailed), summary(types.ImportFailed)},
+			expected: types.ImportFailed,
+		},
+	}
+	for title, tc := range testCases {
+		t.Run(title, func(t *testing.T) {
+			gt.V(t, model.NewRunSummary(tc.feeds...).Status).Equal(tc.expected)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Table is a BigQuery table declared by feed.
+type Table struct {
+	Name   string
+	Schema bigquery.Schema
+	Spec   *TableSpec
+}
+
+// TableSpec is a physical layout of BigQuery table declared by each feed. It is applied when the table is created.
+type TableSpec struct {
+	// PartitionField is a TIMESTAMP or DATE column for time partitioning. Empty means the table is not partitioned.
+	PartitionField string
+	// PartitionType is granularity of time partitioning. Default is bigquery.DayPartitioningType.
+	PartitionType bigquery.TimePartitioningType
+	// PartitionExpiration is lifetime of each partition. Zero means partitions never expire.
+	PartitionExpiration time.Duration
+	// ClusteringFields is top-level columns to cluster the table.
+	ClusteringFields []string
+}
+
+// TimePartitioning returns time partitioning setting of the spec. It returns nil if the table is not partitioned.
+func (x *TableSpec) TimePartitioning() *bigquery.TimePartitioning {
+	if x == nil || x.PartitionField == "" {
+		return nil
+	}
+
+	partitionType := x.PartitionType
+	if partitionType == "" {
+		partitionType = bigquery.DayPartitioningType
+	}
+
+	return &bigquery.TimePartitioning{
+		Type:       partitionType,
+		Field:      x.PartitionField,
+		Expiration: x.PartitionExpiration,
+	}
+}
+
+// Clustering returns clustering setting of the spec. It returns nil if clustering fields are not declared.
+func (x *TableSpec) Clustering() *bigquery.Clustering {
+	if x == nil || len(x.ClusteringFields) == 0 {
+		return nil
+	}
+
+	return &bigquery.Clustering{
+		Fields: x.ClusteringFields,
+	}
+}
+
+type SchemaChangeKind string
+
+const (
+	// SchemaAddField is a new column that is added to the existing table.
+	SchemaAddField SchemaChangeKind = "add_field"
+	// SchemaConflict is an incompatible change of type or mode. It can not be applied to the existing table.
+	SchemaConflict SchemaChangeKind = "conflict"
+)
+
+// SchemaChange is a difference between the existing table schema and the schema declared by feed.
+type SchemaChange struct {
+	Kind SchemaChangeKind
+	// Field is a dot separated path of the column, e.g. "Indicators.Type".
+	Field  string
+	Detail string
+}
+
+func (x SchemaChange) String() string {
+	return string(x.Kind) + " " + x.Field + ": " + x.Detail
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/m-mizutani/goerr"
+)
+
+// View is a BigQuery view declared by feed. Query is a text/template with ProjectID and DatasetID. `{{ table "name" }}` is replaced with fully qualified table name in the dataset.
+type View struct {
+	Name        string
+	Description string
+	Query       string
+}
+
+// Render returns SQL of the view for the dataset.
+func (x *View) Render(projectID, datasetID string) (string, error) {
+	return renderQuery(x.Name, x.Query, map[string]string{
+		"ProjectID": projectID,
+		"DatasetID": datasetID,
+	}, func(name string) string {
+		return fmt.Sprintf("`%s.%s.%s`", projectID, datasetID, name)
+	})
+}
+
+// RenderQuery returns SQL of query for a query job of BigQuery client. `{{ table "name" }}` is replaced with the table name as it is because unqualified table names are resolved in the dataset of the client. ProjectID and DatasetID are not available.
+func RenderQuery(query string) (string, error) {
+	return renderQuery("query", query, map[string]string{}, func(name string) string {
+		return "`" + name + "`"
+	})
+}
+
+func renderQuery(name, query string, data map[string]string, table func(name string) string) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"table": table,
+	}).Parse(query)
+	if err != nil {
+		return "", goerr.Wrap(err, "Fail to parse query").With("name", name)
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", goerr.Wrap(err, "Fail to render query").With("name", name)
+	}
+
+	return buf.String(), nil
+}
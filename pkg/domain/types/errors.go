@@ -1,7 +1,50 @@
 package types
 
-import "github.com/m-mizutani/goerr"
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr"
+)
 
 var (
-	ErrInvalidOption = goerr.New("invalid option")
+	ErrInvalidOption    = goerr.New("invalid option")
+	ErrUnexpectedStatus = goerr.New("unexpected HTTP status")
+	// ErrIncompatibleSchema is returned when declared schema can not be merged into the existing table. The table needs to be migrated by `drone schema apply --migrate`.
+	ErrIncompatibleSchema = goerr.New("incompatible table schema")
+	// ErrPartialFailure is returned when a run completed but a part of it failed, e.g. some rows failed to be inserted.
+	ErrPartialFailure = goerr.New("partial failure")
 )
+
+// PartialInsertError is returned when some rows are failed to insert into BigQuery. Rows other than Rows have been inserted successfully.
+type PartialInsertError struct {
+	Table string
+	Total int
+	Rows  bigquery.PutMultiError
+}
+
+func (x *PartialInsertError) Error() string {
+	return fmt.Sprintf("%d of %d rows are failed to insert into %s", len(x.Rows), x.Total, x.Table)
+}
+
+func (x *PartialInsertError) Unwrap() error {
+	return x.Rows
+}
+
+// Indexes returns indexes of failed rows in data given to Insert in ascending order.
+func (x *PartialInsertError) Indexes() []int {
+	indexes := make([]int, len(x.Rows))
+	for i, row := range x.Rows {
+		indexes[i] = row.RowIndex
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// IsPartialInsert returns true if err is caused by PartialInsertError.
+func IsPartialInsert(err error) bool {
+	var partial *PartialInsertError
+	return errors.As(err, &partial)
+}
@@ -1,5 +1,7 @@
 package types
 
+import "github.com/m-mizutani/goerr"
+
 type FeedID string
 
 func (x FeedID) String() string { return string(x) }
@@ -8,3 +10,140 @@ const (
 	FeedOTXSubscribed FeedID = "otx-subscribed"
 	FeedAbuseChFeodo  FeedID = "abuse.ch-feodo"
 )
+
+// FeedIDs returns all feed IDs supported by drone.
+func FeedIDs() []FeedID {
+	return []FeedID{
+		FeedOTXSubscribed,
+		FeedAbuseChFeodo,
+	}
+}
+
+func (x FeedID) Validate() error {
+	for _, id := range FeedIDs() {
+		if x == id {
+			return nil
+		}
+	}
+	return goerr.Wrap(ErrInvalidOption, "unknown feed ID").With("feed", x)
+}
+
+// DedupMode specifies how to prevent duplicated records in import.
+type DedupMode string
+
+const (
+	// DedupWatermark imports only records that are newer than latest record time of the previous import.
+	DedupWatermark DedupMode = "watermark"
+	// DedupHash imports new or changed records by comparing content hash with the previous import.
+	DedupHash DedupMode = "hash"
+	// DedupChanges emits change rows (added, updated and removed) instead of full records.
+	DedupChanges DedupMode = "changes"
+)
+
+func (x DedupMode) Validate() error {
+	switch x {
+	case DedupWatermark, DedupHash, DedupChanges:
+		return nil
+	default:
+		return goerr.Wrap(ErrInvalidOption, "unknown dedup mode").With("mode", x)
+	}
+}
+
+// ParseErrorPolicy specifies how to handle feed records that can not be parsed.
+type ParseErrorPolicy string
+
+const (
+	// ParseErrorFail aborts import at the first record that can not be parsed.
+	ParseErrorFail ParseErrorPolicy = "fail"
+	// ParseErrorSkip skips records that can not be parsed and continues import.
+	ParseErrorSkip ParseErrorPolicy = "skip"
+	// ParseErrorDeadLetter writes records that can not be parsed into dead letter table with raw payload and continues import.
+	ParseErrorDeadLetter ParseErrorPolicy = "dead-letter"
+)
+
+func (x ParseErrorPolicy) Validate() error {
+	switch x {
+	case ParseErrorFail, ParseErrorSkip, ParseErrorDeadLetter:
+		return nil
+	default:
+		return goerr.Wrap(ErrInvalidOption, "unknown parse error policy").With("policy", x)
+	}
+}
+
+// ImportStatus is a result of import of a feed.
+type ImportStatus string
+
+const (
+	ImportSucceeded ImportStatus = "succeeded"
+	// ImportPartial means that import completed but some rows failed to be inserted, or some feeds failed in a run of multiple feeds.
+	ImportPartial ImportStatus = "partial"
+	ImportFailed  ImportStatus = "failed"
+	// ImportSkipped means that the feed was not imported, e.g. it was imported within its interval.
+	ImportSkipped ImportStatus = "skipped"
+)
+
+// ChangeType is a type of record change detected by content hash.
+type ChangeType string
+
+const (
+	ChangeAdded   ChangeType = "added"
+	ChangeUpdated ChangeType = "updated"
+	ChangeRemoved ChangeType = "removed"
+)
+
+// IndicatorType is a kind of indicator that is matched with logs.
+type IndicatorType string
+
+const (
+	IndicatorIP     IndicatorType = "ip"
+	IndicatorDomain IndicatorType = "domain"
+	IndicatorURL    IndicatorType = "url"
+	IndicatorHash   IndicatorType = "hash"
+)
+
+func IndicatorTypes() []IndicatorType {
+	return []IndicatorType{
+		IndicatorIP,
+		IndicatorDomain,
+		IndicatorURL,
+		IndicatorHash,
+	}
+}
+
+func (x IndicatorType) Validate() error {
+	for _, t := range IndicatorTypes() {
+		if x == t {
+			return nil
+		}
+	}
+	return goerr.Wrap(ErrInvalidOption, "unknown indicator type").With("type", x)
+}
+
+// AlertType is a kind of event that is notified.
+type AlertType string
+
+const (
+	// AlertMatch is a new hit of indicator in logs.
+	AlertMatch AlertType = "match"
+	// AlertImportFailure is a failure of feed import.
+	AlertImportFailure AlertType = "import_failure"
+	// AlertFeedEvent is a notable change in feed, e.g. a new C2 server in Feodo blocklist.
+	AlertFeedEvent AlertType = "feed_event"
+)
+
+func AlertTypes() []AlertType {
+	return []AlertType{
+		AlertMatch,
+		AlertImportFailure,
+		AlertFeedEvent,
+	}
+}
+
+func (x AlertType) Validate() error {
+	for _, t := range AlertTypes() {
+		if x == t {
+			return nil
+		}
+	}
+	return goerr.Wrap(ErrInvalidOption, "unknown alert type").With("type", x)
+}
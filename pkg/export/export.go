@@ -0,0 +1,204 @@
+// Package export selects indicators imported by drone from BigQuery, and writes them as blocklists for firewalls, DNS resolvers and IDS.
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/aging"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/goerr"
+)
+
+// Indicator is an active indicator of a feed to be exported. LastSeen is the latest value in rows of the same indicator, and Confidence is the highest value decayed by aging policy.
+type Indicator struct {
+	Feed       types.FeedID
+	Type       types.IndicatorType
+	Value      string
+	LastSeen   time.Time
+	Confidence int64
+}
+
+// Filter selects indicators to be exported. Zero value selects all indicators.
+type Filter struct {
+	// Feeds and Types select indicator sources. Empty means all.
+	Feeds []types.FeedID
+	Types []types.IndicatorType
+	// MaxAge excludes indicators that are not seen in the duration. Zero means no limit.
+	MaxAge time.Duration
+	// MinConfidence excludes indicators that have lower confidence.
+	MinConfidence int64
+}
+
+func (x *Filter) Validate() error {
+	for _, id := range x.Feeds {
+		if err := id.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, t := range x.Types {
+		if err := t.Validate(); err != nil {
+			return err
+		}
+	}
+	if x.MaxAge < 0 {
+		return goerr.Wrap(types.ErrInvalidOption, "max age must not be negative").With("max_age", x.MaxAge)
+	}
+	if x.MinConfidence < 0 || 100 < x.MinConfidence {
+		return goerr.Wrap(types.ErrInvalidOption, "min confidence must be in 0-100").With("min_confidence", x.MinConfidence)
+	}
+	return nil
+}
+
+// selects returns true if the source is selected by Feeds and Types.
+func (x *Filter) selects(src *model.IndicatorSource) bool {
+	return contains(x.Feeds, src.Feed) && contains(x.Types, src.Type)
+}
+
+func contains[T comparable](set []T, v T) bool {
+	if len(set) == 0 {
+		return true
+	}
+	for _, s := range set {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Query selects indicators matched with the filter from active_indicators view. Only indicators of the sources are selected. Result is ordered by type, value and feed.
+func Query(ctx context.Context, client interfaces.BigQuery, sources []*model.IndicatorSource, filter Filter) ([]*Indicator, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	feeds, indicatorTypes := selectSources(sources, &filter)
+	if len(feeds) == 0 {
+		return nil, nil
+	}
+
+	params := []bigquery.QueryParameter{
+		{Name: "feeds", Value: feeds},
+		{Name: "types", Value: indicatorTypes},
+		{Name: "min_confidence", Value: filter.MinConfidence},
+	}
+	if filter.MaxAge > 0 {
+		params = append(params, bigquery.QueryParameter{Name: "since", Value: time.Now().UTC().Add(-filter.MaxAge)})
+	}
+
+	query := buildQuery(&filter)
+	rows, err := client.Query(ctx, query, params)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to query indicators")
+	}
+
+	indicators := make([]*Indicator, 0, len(rows))
+	for _, row := range rows {
+		ind, err := toIndicator(row)
+		if err != nil {
+			return nil, err
+		}
+		indicators = append(indicators, ind)
+	}
+
+	return indicators, nil
+}
+
+// Export queries indicators matched with the filter and writes them in the format. Indicator types of the filter are limited to types written in the format.
+func Export(ctx context.Context, w io.Writer, client interfaces.BigQuery, sources []*model.IndicatorSource, format Format, filter Filter) error {
+	if err := format.Validate(); err != nil {
+		return err
+	}
+
+	var indicatorTypes []types.IndicatorType
+	for _, t := range format.Types() {
+		if contains(filter.Types, t) {
+			indicatorTypes = append(indicatorTypes, t)
+		}
+	}
+	if len(indicatorTypes) == 0 {
+		return goerr.Wrap(types.ErrInvalidOption, "no indicator type is written in the format").With("format", format).With("types", filter.Types)
+	}
+	filter.Types = indicatorTypes
+
+	indicators, err := Query(ctx, client, sources, filter)
+	if err != nil {
+		return err
+	}
+
+	return Write(w, format, indicators)
+}
+
+// selectSources returns feeds and types of sources selected by the filter. They are empty if no source is selected.
+func selectSources(sources []*model.IndicatorSource, filter *Filter) (feeds, indicatorTypes []string) {
+	feedSet := map[types.FeedID]struct{}{}
+	typeSet := map[types.IndicatorType]struct{}{}
+	for _, src := range sources {
+		if !filter.selects(src) {
+			continue
+		}
+		if _, ok := feedSet[src.Feed]; !ok {
+			feedSet[src.Feed] = struct{}{}
+			feeds = append(feeds, src.Feed.String())
+		}
+		if _, ok := typeSet[src.Type]; !ok {
+			typeSet[src.Type] = struct{}{}
+			indicatorTypes = append(indicatorTypes, string(src.Type))
+		}
+	}
+	return feeds, indicatorTypes
+}
+
+// buildQuery returns SQL to select indicators of @feeds and @types from active_indicators view. Confidence in the view is decayed by aging policy of the source.
+func buildQuery(filter *Filter) string {
+	var since string
+	if filter.MaxAge > 0 {
+		since = " AND LastSeen >= @since"
+	}
+
+	return fmt.Sprintf(`SELECT
+  Feed,
+  Type,
+  Indicator,
+  LastSeen,
+  Confidence
+FROM %s
+WHERE Feed IN UNNEST(@feeds) AND Type IN UNNEST(@types) AND Confidence >= @min_confidence%s
+ORDER BY Type, Indicator, Feed`, aging.ViewName, since)
+}
+
+func toIndicator(row map[string]bigquery.Value) (*Indicator, error) {
+	var ind Indicator
+
+	feed, ok := row["Feed"].(string)
+	if !ok {
+		return nil, goerr.New("invalid Feed in export result").With("row", row)
+	}
+	typ, ok := row["Type"].(string)
+	if !ok {
+		return nil, goerr.New("invalid Type in export result").With("row", row)
+	}
+	if ind.Value, ok = row["Indicator"].(string); !ok {
+		return nil, goerr.New("invalid Indicator in export result").With("row", row)
+	}
+	// LastSeen can be NULL if the source has no time of the indicator
+	switch v := row["LastSeen"].(type) {
+	case time.Time:
+		ind.LastSeen = v
+	case nil:
+	default:
+		return nil, goerr.New("invalid LastSeen in export result").With("row", row)
+	}
+	if ind.Confidence, ok = row["Confidence"].(int64); !ok {
+		return nil, goerr.New("invalid Confidence in export result").With("row", row)
+	}
+	ind.Feed, ind.Type = types.FeedID(feed), types.IndicatorType(typ)
+
+	return &ind, nil
+}
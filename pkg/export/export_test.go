@@ -0,0 +1,164 @@
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/export"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/gt"
+)
+
+var lastSeen = time.Date(2024, 1, 15, 6, 40, 12, 0, time.UTC)
+
+func testIndicators() []*export.Indicator {
+	return []*export.Indicator{
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorDomain, Value: "Phish.Example.COM.", LastSeen: lastSeen, Confidence: 70},
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorIP, Value: "198.51.100.23", LastSeen: lastSeen.Add(-time.Hour), Confidence: 70},
+		{Feed: types.FeedAbuseChFeodo, Type: types.IndicatorIP, Value: "198.51.100.23", LastSeen: lastSeen.Add(-time.Hour), Confidence: 60},
+		{Feed: types.FeedAbuseChFeodo, Type: types.IndicatorIP, Value: "192.0.2.10", LastSeen: lastSeen.Add(-2 * time.Hour), Confidence: 90},
+		{Feed: types.FeedAbuseChFeodo, Type: types.IndicatorIP, Value: "20.0.0.1", LastSeen: lastSeen.Add(-3 * time.Hour), Confidence: 90},
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorIP, Value: "2001:db8::1", LastSeen: lastSeen, Confidence: 30},
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorIP, Value: "203.0.113.0/24", LastSeen: lastSeen, Confidence: 70},
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorIP, Value: "not an ip", LastSeen: lastSeen, Confidence: 70},
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorDomain, Value: `evil.example"; sid:1;`, LastSeen: lastSeen, Confidence: 70},
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorDomain, Value: "c2.example.net", LastSeen: lastSeen, Confidence: 70},
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorURL, Value: "https://phish.example.com/login", LastSeen: lastSeen, Confidence: 70},
+	}
+}
+
+func write(t *testing.T, format export.Format, indicators []*export.Indicator) string {
+	var buf bytes.Buffer
+	gt.NoError(t, export.Write(&buf, format, indicators))
+	return buf.String()
+}
+
+func TestWriteList(t *testing.T) {
+	gt.V(t, write(t, export.FormatIP, testIndicators())).Equal(`20.0.0.1
+192.0.2.10
+198.51.100.23
+203.0.113.0/24
+2001:db8::1
+`)
+	gt.V(t, write(t, export.FormatCIDR, testIndicators())).Equal(`20.0.0.1/32
+192.0.2.10/32
+198.51.100.23/32
+203.0.113.0/24
+2001:db8::1/128
+`)
+	gt.V(t, write(t, export.FormatDomain, testIndicators())).Equal(`c2.example.net
+phish.example.com
+`)
+}
+
+func TestWriteStableOrder(t *testing.T) {
+	indicators := testIndicators()
+	reversed := make([]*export.Indicator, len(indicators))
+	for i, ind := range indicators {
+		reversed[len(indicators)-1-i] = ind
+	}
+
+	for _, format := range export.Formats() {
+		gt.V(t, write(t, format, reversed)).Equal(write(t, format, indicators))
+	}
+}
+
+func TestWriteRPZ(t *testing.T) {
+	out := write(t, export.FormatRPZ, testIndicators())
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+
+	gt.A(t, lines).Length(12)
+	gt.V(t, lines[0]).Equal("$TTL 300")
+	gt.S(t, lines[1]).HasPrefix("@ IN SOA localhost. hostmaster.localhost. (")
+	gt.V(t, lines[3]).Equal("c2.example.net CNAME .")
+	gt.V(t, lines[4]).Equal("*.c2.example.net CNAME .")
+	gt.V(t, lines[7]).Equal("32.1.0.0.20.rpz-ip CNAME .")
+	gt.V(t, lines[10]).Equal("24.0.113.0.203.rpz-ip CNAME .")
+	gt.V(t, lines[11]).Equal("128.1.0.0.0.0.0.db8.2001.rpz-ip CNAME .")
+
+	// Serial changes when an indicator is removed
+	removed := strings.Split(write(t, export.FormatRPZ, testIndicators()[1:]), "\n")
+	gt.V(t, removed[1]).NotEqual(lines[1])
+}
+
+func TestWriteRules(t *testing.T) {
+	suricata := strings.Split(strings.TrimSpace(write(t, export.FormatSuricata, testIndicators())), "\n")
+	gt.A(t, suricata).Length(7)
+	gt.S(t, suricata[0]).HasPrefix(`alert dns $HOME_NET any -> any any (msg:"drone otx-subscribed domain c2.example.net"; dns.query; dotprefix; content:".c2.example.net";`)
+	gt.S(t, suricata[4]).HasPrefix(`alert ip $HOME_NET any -> 198.51.100.23 any (msg:"drone abuse.ch-feodo,otx-subscribed ip 198.51.100.23";`)
+
+	snort := strings.Split(strings.TrimSpace(write(t, export.FormatSnort, testIndicators())), "\n")
+	gt.A(t, snort).Length(7)
+	gt.S(t, snort[0]).Contains(`content:"|02|c2|07|example|03|net|00|"`)
+
+	// SID of an indicator doesn't change when other indicators are removed
+	sid := func(rule string) string {
+		_, v, _ := strings.Cut(rule, "sid:")
+		return v
+	}
+	partial := strings.Split(strings.TrimSpace(write(t, export.FormatSuricata, testIndicators()[:3])), "\n")
+	gt.A(t, partial).Length(2)
+	gt.V(t, sid(partial[1])).Equal(sid(suricata[4]))
+}
+
+func TestWriteRulesTooMany(t *testing.T) {
+	// Indicators more than the local SID range can not have unique SIDs
+	indicators := make([]*export.Indicator, 1000001)
+	for i := range indicators {
+		indicators[i] = &export.Indicator{
+			Feed:  types.FeedAbuseChFeodo,
+			Type:  types.IndicatorIP,
+			Value: fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff),
+		}
+	}
+	gt.Error(t, export.Write(io.Discard, export.FormatSnort, indicators))
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	sources := gt.R1(feed.Indicators()).NoError(t)
+
+	mock := bq.NewMock()
+	var queryParams []bigquery.QueryParameter
+	mock.QueryFunc = func(query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+		queryParams = params
+		return []map[string]bigquery.Value{
+			{"Feed": "abuse.ch-feodo", "Type": "ip", "Indicator": "192.0.2.10", "LastSeen": lastSeen, "Confidence": int64(90)},
+			{"Feed": "abuse.ch-feodo", "Type": "ip", "Indicator": "198.51.100.23", "LastSeen": nil, "Confidence": int64(60)},
+		}, nil
+	}
+
+	var buf bytes.Buffer
+	gt.NoError(t, export.Export(ctx, &buf, mock, sources, export.FormatIP, export.Filter{
+		Feeds:         []types.FeedID{types.FeedAbuseChFeodo},
+		MaxAge:        24 * time.Hour,
+		MinConfidence: 50,
+	}))
+	gt.V(t, buf.String()).Equal("192.0.2.10\n198.51.100.23\n")
+
+	// Indicators are read from active_indicators view that drops expired ones
+	gt.A(t, mock.Queries).Length(1)
+	gt.S(t, mock.Queries[0]).Contains("FROM active_indicators")
+	gt.S(t, mock.Queries[0]).Contains("AND LastSeen >= @since")
+	params := map[string]any{}
+	for _, p := range queryParams {
+		params[p.Name] = p.Value
+	}
+	gt.V(t, params["feeds"]).Equal([]string{"abuse.ch-feodo"})
+	gt.V(t, params["types"]).Equal([]string{"ip"})
+
+	// IP format doesn't have domain indicators
+	gt.Error(t, export.Export(ctx, &buf, mock, sources, export.FormatIP, export.Filter{
+		Types: []types.IndicatorType{types.IndicatorDomain},
+	}))
+	gt.Error(t, export.Export(ctx, &buf, mock, sources, export.FormatRPZ, export.Filter{MinConfidence: 101}))
+	gt.Error(t, export.Export(ctx, &buf, mock, sources, export.Format("csv"), export.Filter{}))
+}
@@ -0,0 +1,331 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/netip"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/goerr"
+)
+
+// Format is an output format of export.
+type Format string
+
+const (
+	// FormatIP is a list of IP addresses, one per line.
+	FormatIP Format = "ip"
+	// FormatCIDR is a list of IP prefixes, one per line. Addresses are written as /32 or /128.
+	FormatCIDR Format = "cidr"
+	// FormatDomain is a list of domain names, one per line.
+	FormatDomain Format = "domain"
+	// FormatRPZ is a DNS response policy zone file that answers NXDOMAIN for domains and their subdomains, and responses with the IP addresses.
+	FormatRPZ Format = "rpz"
+	// FormatSuricata is a Suricata rule set that alerts traffic to IP addresses and DNS queries of domains.
+	FormatSuricata Format = "suricata"
+	// FormatSnort is a Snort 2 rule set that alerts traffic to IP addresses and DNS queries of domains.
+	FormatSnort Format = "snort"
+)
+
+// Formats returns all output formats.
+func Formats() []Format {
+	return []Format{
+		FormatIP,
+		FormatCIDR,
+		FormatDomain,
+		FormatRPZ,
+		FormatSuricata,
+		FormatSnort,
+	}
+}
+
+func (x Format) Validate() error {
+	for _, f := range Formats() {
+		if x == f {
+			return nil
+		}
+	}
+	return goerr.Wrap(types.ErrInvalidOption, "unknown export format").With("format", x)
+}
+
+// Types returns indicator types written in the format. Indicators of other types are ignored.
+func (x Format) Types() []types.IndicatorType {
+	switch x {
+	case FormatIP, FormatCIDR:
+		return []types.IndicatorType{types.IndicatorIP}
+	case FormatDomain:
+		return []types.IndicatorType{types.IndicatorDomain}
+	default:
+		return []types.IndicatorType{types.IndicatorIP, types.IndicatorDomain}
+	}
+}
+
+const (
+	// LocalSIDBase is the first SID of generated rules. SIDs from 1000000 to 1999999 are reserved for local rules.
+	LocalSIDBase = 1000000
+	localSIDSize = 1000000
+
+	rpzTTL = 300
+)
+
+// hostnamePattern accepts domain names that have two or more labels. It also prevents injection into zone file and rules.
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9_]([a-z0-9_\-]{0,61}[a-z0-9_])?\.)+[a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?$`)
+
+// entry is a normalized indicator value. Feeds have all feeds of the value.
+type entry struct {
+	Type   types.IndicatorType
+	Value  string
+	Prefix netip.Prefix
+	Feeds  []types.FeedID
+}
+
+// address returns IP address if the entry is a single address, otherwise CIDR.
+func (x *entry) address() string {
+	if x.Prefix.IsSingleIP() {
+		return x.Prefix.Addr().String()
+	}
+	return x.Value
+}
+
+// normalize converts indicators of the types into entries. Invalid values are skipped, and the same values from multiple feeds are merged. Entries are sorted by type and value, in numerical order for IP.
+func normalize(indicators []*Indicator, indicatorTypes []types.IndicatorType) []*entry {
+	index := map[string]*entry{}
+	var entries []*entry
+
+	for _, ind := range indicators {
+		if !contains(indicatorTypes, ind.Type) {
+			continue
+		}
+
+		e := &entry{Type: ind.Type}
+		switch ind.Type {
+		case types.IndicatorIP:
+			prefix, ok := parsePrefix(ind.Value)
+			if !ok {
+				continue
+			}
+			e.Prefix, e.Value = prefix, prefix.String()
+
+		case types.IndicatorDomain:
+			e.Value = strings.TrimSuffix(strings.ToLower(ind.Value), ".")
+			if !hostnamePattern.MatchString(e.Value) {
+				continue
+			}
+
+		default:
+			continue
+		}
+
+		key := string(e.Type) + "/" + e.Value
+		if found, ok := index[key]; ok {
+			e = found
+		} else {
+			index[key] = e
+			entries = append(entries, e)
+		}
+		if !slices.Contains(e.Feeds, ind.Feed) {
+			e.Feeds = append(e.Feeds, ind.Feed)
+		}
+	}
+
+	for _, e := range entries {
+		sort.Slice(e.Feeds, func(i, j int) bool { return e.Feeds[i] < e.Feeds[j] })
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Type == types.IndicatorIP {
+			if c := a.Prefix.Addr().Compare(b.Prefix.Addr()); c != 0 {
+				return c < 0
+			}
+			return a.Prefix.Bits() < b.Prefix.Bits()
+		}
+		return a.Value < b.Value
+	})
+
+	return entries
+}
+
+// parsePrefix parses IP address or CIDR. Address is converted into single address prefix.
+func parsePrefix(v string) (netip.Prefix, bool) {
+	if prefix, err := netip.ParsePrefix(v); err == nil {
+		return prefix.Masked(), true
+	}
+	addr, err := netip.ParseAddr(v)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap().WithZone("")
+	return netip.PrefixFrom(addr, addr.BitLen()), true
+}
+
+// Write writes indicators in the format. Output is sorted and deduplicated, then it's the same for the same indicators.
+func Write(w io.Writer, format Format, indicators []*Indicator) error {
+	if err := format.Validate(); err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriter(w)
+	entries := normalize(indicators, format.Types())
+
+	switch format {
+	case FormatIP:
+		writeIPList(buf, entries)
+	case FormatCIDR:
+		writeCIDRList(buf, entries)
+	case FormatDomain:
+		writeDomainList(buf, entries)
+	case FormatRPZ:
+		writeRPZ(buf, entries)
+	case FormatSuricata:
+		if err := writeRules(buf, entries, suricataRule); err != nil {
+			return err
+		}
+	case FormatSnort:
+		if err := writeRules(buf, entries, snortRule); err != nil {
+			return err
+		}
+	}
+
+	if err := buf.Flush(); err != nil {
+		return goerr.Wrap(err, "Fail to write exported indicators").With("format", format)
+	}
+	return nil
+}
+
+// writeIPList writes IP addresses. CIDR is written as it is because appliances that accept IP list usually accept CIDR too.
+func writeIPList(w io.Writer, entries []*entry) {
+	for _, e := range entries {
+		fmt.Fprintln(w, e.address())
+	}
+}
+
+func writeCIDRList(w io.Writer, entries []*entry) {
+	for _, e := range entries {
+		fmt.Fprintln(w, e.Value)
+	}
+}
+
+func writeDomainList(w io.Writer, entries []*entry) {
+	for _, e := range entries {
+		fmt.Fprintln(w, e.Value)
+	}
+}
+
+// writeRPZ writes a zone file of entries. SOA serial is a hash of the records, then it changes when entries are added or removed and the zone is the same for the same entries.
+func writeRPZ(w io.Writer, entries []*entry) {
+	var records bytes.Buffer
+	for _, e := range entries {
+		switch e.Type {
+		case types.IndicatorIP:
+			fmt.Fprintf(&records, "%s.rpz-ip CNAME .\n", rpzIP(e.Prefix))
+		case types.IndicatorDomain:
+			fmt.Fprintf(&records, "%s CNAME .\n", e.Value)
+			fmt.Fprintf(&records, "*.%s CNAME .\n", e.Value)
+		}
+	}
+
+	h := fnv.New32a()
+	h.Write(records.Bytes())
+	serial := h.Sum32()
+	if serial == 0 {
+		// Serial 0 is avoided because some servers handle it as unset
+		serial = 1
+	}
+
+	fmt.Fprintf(w, "$TTL %d\n", rpzTTL)
+	fmt.Fprintf(w, "@ IN SOA localhost. hostmaster.localhost. ( %d 3600 600 86400 %d )\n", serial, rpzTTL)
+	fmt.Fprintln(w, "@ IN NS localhost.")
+	_, _ = records.WriteTo(w)
+}
+
+// rpzIP returns owner name of IP trigger, e.g. "32.10.2.0.192" for 192.0.2.10/32.
+func rpzIP(prefix netip.Prefix) string {
+	labels := []string{fmt.Sprint(prefix.Bits())}
+	addr := prefix.Addr()
+
+	if addr.Is4() {
+		b := addr.As4()
+		for i := len(b) - 1; i >= 0; i-- {
+			labels = append(labels, fmt.Sprint(b[i]))
+		}
+	} else {
+		b := addr.As16()
+		for i := len(b) - 2; i >= 0; i -= 2 {
+			labels = append(labels, fmt.Sprintf("%x", uint16(b[i])<<8|uint16(b[i+1])))
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
+
+type ruleFunc func(e *entry, sid int) string
+
+// writeRules writes a rule for each entry. SID is calculated from type and value so that it doesn't change when other indicators are added or removed. Colliding SID is moved to the next free one. It fails if entries exceed the local SID range.
+func writeRules(w io.Writer, entries []*entry, rule ruleFunc) error {
+	if len(entries) > localSIDSize {
+		return goerr.New("too many indicators for local SID range").With("entries", len(entries)).With("max", localSIDSize)
+	}
+
+	used := map[int]struct{}{}
+	for _, e := range entries {
+		h := fnv.New32a()
+		h.Write([]byte(string(e.Type) + "/" + e.Value))
+		offset := int(h.Sum32() % localSIDSize)
+
+		sid := LocalSIDBase + offset
+		for {
+			if _, ok := used[sid]; !ok {
+				break
+			}
+			offset = (offset + 1) % localSIDSize
+			sid = LocalSIDBase + offset
+		}
+		used[sid] = struct{}{}
+
+		fmt.Fprintln(w, rule(e, sid))
+	}
+	return nil
+}
+
+func ruleMessage(e *entry) string {
+	feeds := make([]string, len(e.Feeds))
+	for i, f := range e.Feeds {
+		feeds[i] = string(f)
+	}
+	return fmt.Sprintf("drone %s %s %s", strings.Join(feeds, ","), e.Type, e.address())
+}
+
+func suricataRule(e *entry, sid int) string {
+	if e.Type == types.IndicatorIP {
+		return fmt.Sprintf(`alert ip $HOME_NET any -> %s any (msg:"%s"; classtype:trojan-activity; sid:%d; rev:1;)`, e.address(), ruleMessage(e), sid)
+	}
+	return fmt.Sprintf(`alert dns $HOME_NET any -> any any (msg:"%s"; dns.query; dotprefix; content:".%s"; nocase; endswith; classtype:trojan-activity; sid:%d; rev:1;)`, ruleMessage(e), e.Value, sid)
+}
+
+// snortRule returns a rule that matches the domain and its subdomains as Suricata rule does. Content is not anchored, then wire format of the domain also matches the tail of its subdomains, e.g. "|03|www|07|example|03|com|00|" contains "|07|example|03|com|00|".
+func snortRule(e *entry, sid int) string {
+	if e.Type == types.IndicatorIP {
+		return fmt.Sprintf(`alert ip $HOME_NET any -> %s any (msg:"%s"; classtype:trojan-activity; sid:%d; rev:1;)`, e.address(), ruleMessage(e), sid)
+	}
+	return fmt.Sprintf(`alert udp $HOME_NET any -> any 53 (msg:"%s"; content:"%s"; nocase; classtype:trojan-activity; sid:%d; rev:1;)`, ruleMessage(e), dnsWireName(e.Value), sid)
+}
+
+// dnsWireName returns domain name in DNS wire format for Snort content, e.g. "|07|example|03|com|00|".
+func dnsWireName(domain string) string {
+	var b strings.Builder
+	for _, label := range strings.Split(domain, ".") {
+		fmt.Fprintf(&b, "|%02x|%s", len(label), label)
+	}
+	b.WriteString("|00|")
+	return b.String()
+}
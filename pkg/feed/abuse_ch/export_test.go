@@ -0,0 +1,7 @@
+package abuse_ch
+
+var (
+	DiffFeodo      = diffFeodo
+	FeodoAlerts    = feodoAlerts
+	CarryOverFeodo = carryOverFeodo
+)
@@ -3,28 +3,156 @@ package abuse_ch
 import (
 	"context"
 	"encoding/json"
-	"net/http"
+	"fmt"
 	"time"
 
+	"cloud.google.com/go/bigquery"
 	"github.com/m-mizutani/bqs"
+	"github.com/m-mizutani/drone/pkg/deadletter"
+	"github.com/m-mizutani/drone/pkg/dedup"
 	"github.com/m-mizutani/drone/pkg/domain/model"
 	"github.com/m-mizutani/drone/pkg/domain/types"
 	"github.com/m-mizutani/drone/pkg/infra"
+	"github.com/m-mizutani/drone/pkg/infra/httpfetch"
 	"github.com/m-mizutani/drone/pkg/utils"
 	"github.com/m-mizutani/goerr"
 )
 
 type Feodo struct {
+	url              string
+	since            *time.Time
+	dedupMode        types.DedupMode
+	parseErrorPolicy types.ParseErrorPolicy
 }
 
-func NewFeodo() *Feodo {
-	return &Feodo{}
+type Option func(*Feodo)
+
+// WithSince overrides the latest record time stored in the database. Records that are first seen after since will be imported.
+func WithSince(since time.Time) Option {
+	return func(x *Feodo) {
+		x.since = &since
+	}
+}
+
+// WithDedupMode sets deduplication mode. Default is types.DedupWatermark.
+func WithDedupMode(mode types.DedupMode) Option {
+	return func(x *Feodo) {
+		x.dedupMode = mode
+	}
+}
+
+// WithParseErrorPolicy sets how to handle records that can not be parsed. Default is types.ParseErrorFail.
+func WithParseErrorPolicy(policy types.ParseErrorPolicy) Option {
+	return func(x *Feodo) {
+		x.parseErrorPolicy = policy
+	}
+}
+
+// WithURL overrides URL of Feodo blocklist, e.g. for mirror server.
+func WithURL(url string) Option {
+	return func(x *Feodo) {
+		x.url = url
+	}
+}
+
+func NewFeodo(options ...Option) *Feodo {
+	f := &Feodo{
+		url:              DefaultFeodoURL,
+		dedupMode:        types.DedupWatermark,
+		parseErrorPolicy: types.ParseErrorFail,
+	}
+	for _, opt := range options {
+		opt(f)
+	}
+	return f
 }
 
 const (
-	feodoURL = "https://feodotracker.abuse.ch/downloads/ipblocklist.json"
+	DefaultFeodoURL = "https://feodotracker.abuse.ch/downloads/ipblocklist.json"
+
+	feodoTableName      = "abusech_feodo"
+	feodoEventTableName = "abusech_feodo_events"
 )
 
+// FeodoTables returns BigQuery tables written by Feodo import. Change table of dedup mode is not included because it's used only in the mode.
+func FeodoTables() ([]*model.Table, error) {
+	recordSchema, err := bqs.Infer(&FeodoRecord{})
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to infer schema").With("table", feodoTableName)
+	}
+	eventSchema, err := bqs.Infer(&FeodoEvent{})
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to infer schema").With("table", feodoEventTableName)
+	}
+
+	return []*model.Table{
+		{Name: feodoTableName, Schema: recordSchema, Spec: feodoTableSpec},
+		{Name: feodoEventTableName, Schema: eventSchema, Spec: feodoEventTableSpec},
+	}, nil
+}
+
+// feodoTableSpec is a layout of abusech_feodo table. Feodo blocklist is small, then it's partitioned by month.
+var feodoTableSpec = &model.TableSpec{
+	PartitionField:   "FirstSeen",
+	PartitionType:    bigquery.MonthPartitioningType,
+	ClusteringFields: []string{"Malware", "IPAddress"},
+}
+
+// FeodoViews returns BigQuery views over tables of Feodo import.
+func FeodoViews() []*model.View {
+	return []*model.View{
+		{
+			Name:        "abusech_feodo_active",
+			Description: "C2 servers that are online in the latest Feodo blocklist",
+			Query: `SELECT
+  Key,
+  Record.IPAddress,
+  Record.Port,
+  Record.Malware,
+  Record.Status,
+  Record.Hostname,
+  Record.AsNumber,
+  Record.AsName,
+  Record.Country,
+  Record.FirstSeen,
+  Record.LastOnline,
+  DetectedAt AS UpdatedAt
+FROM {{ table "` + feodoEventTableName + `" }}
+WHERE TRUE
+QUALIFY ROW_NUMBER() OVER (PARTITION BY Key ORDER BY DetectedAt DESC) = 1
+  AND Event != '` + string(FeodoEventRemoved) + `'
+  AND Record.Status = 'online'`,
+		},
+	}
+}
+
+// FeodoAgingPolicy is a default aging policy of Feodo indicators. Feodo has no expiry and C2 servers move quickly, then indicators that are not online for a month are expired.
+var FeodoAgingPolicy = model.AgingPolicy{
+	TTL:      30 * 24 * time.Hour,
+	HalfLife: 7 * 24 * time.Hour,
+}
+
+// FeodoIndicators returns queries of indicators in Feodo blocklist. Feodo has only IP address of C2 servers, and online servers have higher confidence. Malware family is given as a tag and a malware family.
+func FeodoIndicators() []*model.IndicatorSource {
+	return []*model.IndicatorSource{
+		{
+			Feed: types.FeedAbuseChFeodo,
+			Type: types.IndicatorIP,
+			Query: `SELECT
+  IPAddress AS Indicator,
+  CONCAT(IPAddress, ':', CAST(Port AS STRING)) AS SightingKey,
+  FirstSeen,
+  GREATEST(FirstSeen, LastOnline) AS LastSeen,
+  CAST(NULL AS TIMESTAMP) AS Expiration,
+  IF(Status = 'online', 90, 60) AS Confidence,
+  IF(COALESCE(Malware, '') = '', ARRAY<STRING>[], [Malware]) AS Tags,
+  IF(COALESCE(Malware, '') = '', ARRAY<STRING>[], [Malware]) AS MalwareFamilies
+FROM {{ table "` + feodoTableName + `" }}`,
+			Aging: FeodoAgingPolicy,
+		},
+	}
+}
+
 type FeodoResponse struct {
 	AsName     string `json:"as_name"`
 	AsNumber   int64  `json:"as_number"`
@@ -42,83 +170,269 @@ type FeodoRecord struct {
 	FeodoResponse
 	FirstSeen  time.Time
 	LastOnline time.Time
+	// ImportedAt is time when the record was fetched. It's excluded from JSON not to change content hash of the record.
+	ImportedAt time.Time `json:"-"`
 }
 
-func (f *Feodo) Import(ctx context.Context, clients *infra.Clients) error {
-	const tableName = "abusech_feodo"
+// feodoKey returns a key of Feodo record. A C2 server is identified by IP address and port.
+func feodoKey(record *FeodoRecord) string {
+	return fmt.Sprintf("%s:%d", record.IPAddress, record.Port)
+}
+
+// Import imports Feodo blocklist. The returned summary is not nil even if import fails, and it has counts until the failure.
+func (f *Feodo) Import(ctx context.Context, clients *infra.Clients) (*model.ImportSummary, error) {
+	const tableName = feodoTableName
+	summary := model.NewImportSummary(types.FeedAbuseChFeodo)
 
 	schema, err := bqs.Infer(&FeodoRecord{})
 	if err != nil {
-		return goerr.Wrap(err, "Fail to infer schema")
+		return summary, goerr.Wrap(err, "Fail to infer schema")
+	}
+
+	if err := clients.BigQuery().CreateOrUpdateSchema(ctx, tableName, schema, feodoTableSpec); err != nil {
+		return summary, goerr.Wrap(err, "Fail to migrate feodo table")
+	}
+
+	req := &httpfetch.Request{
+		Provider: httpfetch.ProviderAbuseCh,
+		URL:      f.url,
+	}
+	// Skip unchanged blocklist by conditional request, but always download it if since is overridden
+	if f.since == nil {
+		req.CacheKey = types.FeedAbuseChFeodo.String()
+	}
+
+	resp, err := clients.HTTP().Fetch(ctx, req)
+	if err != nil {
+		return summary, goerr.Wrap(err, "Fail to get response").With("url", f.url)
 	}
+	if resp.NotModified {
+		utils.Logger().InfoContext(ctx, "Feodo blocklist is not modified, skip import")
+		return summary, nil
+	}
+	summary.PagesFetched++
 
-	if err := clients.BigQuery().CreateOrUpdateSchema(ctx, tableName, schema); err != nil {
-		return goerr.Wrap(err, "Fail to migrate feodo table")
+	// Archive is a copy for reprocessing, then failure of archive does not stop import
+	if err := clients.Archive().Put(ctx, model.NewArchiveKey(summary, summary.PagesFetched), resp.Body); err != nil {
+		summary.Warn("failed to archive response: %s", err.Error())
 	}
 
-	req, err := http.NewRequest("GET", feodoURL, nil)
+	since := f.since
+	var inserted []string
+	if since == nil {
+		log, err := clients.Database().GetLatestImportLog(ctx, types.FeedAbuseChFeodo)
+		if err != nil {
+			return summary, goerr.Wrap(err, "Fail to get latest import log").With("feed", types.FeedAbuseChFeodo)
+		}
+		if log != nil {
+			since = &log.LatestRecord
+			inserted = log.Inserted
+		}
+	}
+	summary.PreviousWatermark = since
+	summary.NewWatermark = since
+
+	deadLetters := deadletter.New(types.FeedAbuseChFeodo, f.parseErrorPolicy, summary)
+	allRecords, newRecords, latest, err := parseFeodo(ctx, resp.Body, since, deadLetters)
 	if err != nil {
-		return goerr.Wrap(err, "Fail to create request").With("url", feodoURL)
+		return summary, goerr.Wrap(err, "Fail to parse response").With("url", f.url)
 	}
+	if err := deadLetters.Flush(ctx, clients.BigQuery()); err != nil {
+		return summary, err
+	}
+	summary.RecordsParsed = len(allRecords)
 
-	resp, err := http.DefaultClient.Do(req)
+	failed, err := insertFeodo(ctx, clients, summary, f.dedupMode, allRecords, excludeFeodoKeys(newRecords, inserted), summary.RecordsMalformed == 0)
 	if err != nil {
-		return goerr.Wrap(err, "Fail to get response").With("url", feodoURL)
+		return summary, err
+	}
+
+	if err := importEvents(ctx, clients, summary, allRecords, summary.RecordsMalformed == 0); err != nil {
+		return summary, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return goerr.Wrap(err, "Fail to get response").With("url", feodoURL).With("status", resp.StatusCode)
+	watermark, err := putFeodoWatermark(ctx, clients, latest, newRecords, failed)
+	if err != nil {
+		return summary, err
+	}
+	if watermark != nil && (since == nil || watermark.After(*since)) {
+		summary.NewWatermark = watermark
 	}
 
-	var data []FeodoResponse
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return goerr.Wrap(err, "Fail to decode response").With("url", feodoURL)
+	if err := clients.HTTP().Commit(ctx, resp); err != nil {
+		return summary, err
 	}
 
+	return summary, nil
+}
+
+// ReplayFeodo transforms an archived Feodo blocklist by the current transform and inserts records in the same way as Import by dedup mode, then a replayed blocklist inserts only records that are new to the previous replayed one. Watermark and record hashes are stored into clients.Database(), then the database must be scoped to the replay. Events are not changed.
+func ReplayFeodo(ctx context.Context, clients *infra.Clients, summary *model.ImportSummary, deadLetters *deadletter.Handler, mode types.DedupMode, body []byte) error {
+	var since *time.Time
+	var inserted []string
 	log, err := clients.Database().GetLatestImportLog(ctx, types.FeedAbuseChFeodo)
 	if err != nil {
 		return goerr.Wrap(err, "Fail to get latest import log").With("feed", types.FeedAbuseChFeodo)
 	}
+	if log != nil {
+		since = &log.LatestRecord
+		inserted = log.Inserted
+	}
+
+	malformed := summary.RecordsMalformed
+	allRecords, newRecords, latest, err := parseFeodo(ctx, body, since, deadLetters)
+	if err != nil {
+		return goerr.Wrap(err, "Fail to parse archived blocklist")
+	}
+	if err := deadLetters.Flush(ctx, clients.BigQuery()); err != nil {
+		return err
+	}
+	summary.RecordsParsed += len(allRecords)
+
+	failed, err := insertFeodo(ctx, clients, summary, mode, allRecords, excludeFeodoKeys(newRecords, inserted), summary.RecordsMalformed == malformed)
+	if err != nil {
+		return err
+	}
+
+	if _, err := putFeodoWatermark(ctx, clients, latest, newRecords, failed); err != nil {
+		return err
+	}
+	return nil
+}
 
-	var latest *time.Time
-	var newRecords []FeodoRecord
-	for _, rec := range data {
-		firstSeen, err := time.Parse("2006-01-02 15:04:05", rec.FirstSeen)
+// insertFeodo inserts records of a blocklist by dedup mode. In watermark mode, newRecords are inserted and it returns records that failed to be inserted. Hash based modes select records from allRecords by hashes, and hashes of failed records are not committed. complete must be false if some records of the blocklist are malformed because they may still exist and must not be detected as removed.
+func insertFeodo(ctx context.Context, clients *infra.Clients, summary *model.ImportSummary, mode types.DedupMode, allRecords, newRecords []FeodoRecord, complete bool) ([]FeodoRecord, error) {
+	if mode != types.DedupWatermark {
+		// Feodo blocklist is a full snapshot, then records that disappeared from the list are detected as removed
+		inserted, _, err := dedup.Insert(ctx, clients, summary, types.FeedAbuseChFeodo, mode, feodoTableName, allRecords, feodoKey, complete)
 		if err != nil {
-			return goerr.Wrap(err, "Fail to parse first_seen").With("first_seen", rec.FirstSeen)
+			return nil, err
 		}
-		lastOnline, err := time.Parse("2006-01-02", rec.LastOnline)
+		utils.Logger().InfoContext(ctx, "Imported Feodo", "inserted", inserted, "mode", mode)
+		return nil, nil
+	}
+
+	utils.Logger().InfoContext(ctx, "Imported Feodo", "new_records", len(newRecords))
+
+	var failedRecords []FeodoRecord
+	if len(newRecords) > 0 {
+		failed, err := summary.CheckInsert(clients.BigQuery().Insert(ctx, feodoTableName, newRecords))
 		if err != nil {
-			return goerr.Wrap(err, "Fail to parse last_online").With("last_online", rec.LastOnline)
+			return nil, goerr.Wrap(err, "Fail to insert data").With("table", feodoTableName)
 		}
-		if log == nil || log.LatestRecord.Before(firstSeen) {
-			newRecords = append(newRecords, FeodoRecord{
-				FeodoResponse: rec,
-				FirstSeen:     firstSeen,
-				LastOnline:    lastOnline,
-			})
+		for _, idx := range failed {
+			failedRecords = append(failedRecords, newRecords[idx])
 		}
-		if latest == nil || latest.Before(firstSeen) {
-			latest = &firstSeen
+		summary.RecordsInserted += len(newRecords) - len(failed)
+	}
+	summary.RecordsSkipped += len(allRecords) - len(newRecords)
+
+	return failedRecords, nil
+}
+
+// excludeFeodoKeys returns records whose keys are not in keys.
+func excludeFeodoKeys(records []FeodoRecord, keys []string) []FeodoRecord {
+	if len(keys) == 0 {
+		return records
+	}
+	skip := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		skip[key] = struct{}{}
+	}
+
+	var result []FeodoRecord
+	for i := range records {
+		if _, ok := skip[feodoKey(&records[i])]; !ok {
+			result = append(result, records[i])
 		}
 	}
+	return result
+}
 
-	utils.Logger().Info("Imported Feodo", "new_records", len(newRecords))
+// putFeodoWatermark stores the latest first seen time as watermark and returns it. The watermark stays before the earliest failed record to insert failed records again, and keys of newRecords inserted after the watermark are stored not to insert them twice in next import. It returns nil if the blocklist has no record.
+func putFeodoWatermark(ctx context.Context, clients *infra.Clients, latest *time.Time, newRecords, failed []FeodoRecord) (*time.Time, error) {
+	if latest == nil {
+		return nil, nil
+	}
 
-	if len(newRecords) > 0 {
-		if err := clients.BigQuery().Insert(ctx, tableName, newRecords); err != nil {
-			return goerr.Wrap(err, "Fail to insert data").With("table", tableName)
+	var earliestFailed *time.Time
+	failedKeys := make(map[string]struct{}, len(failed))
+	for i := range failed {
+		earliestFailed = model.EarliestTime(earliestFailed, &failed[i].FirstSeen)
+		failedKeys[feodoKey(&failed[i])] = struct{}{}
+	}
+	watermark := model.WatermarkBefore(*latest, earliestFailed)
+
+	var inserted []string
+	for i := range newRecords {
+		key := feodoKey(&newRecords[i])
+		if _, ok := failedKeys[key]; !ok && newRecords[i].FirstSeen.After(watermark) {
+			inserted = append(inserted, key)
 		}
 	}
 
-	if latest != nil {
-		if err := clients.Database().PutImportLog(ctx, types.FeedAbuseChFeodo, &model.ImportLog{
-			LatestRecord: *latest,
-			CheckedAt:    time.Now(),
-		}); err != nil {
-			return goerr.Wrap(err, "Fail to put import log").With("table", tableName)
+	if err := clients.Database().PutImportLog(ctx, types.FeedAbuseChFeodo, &model.ImportLog{
+		LatestRecord: watermark,
+		Inserted:     inserted,
+		CheckedAt:    time.Now(),
+	}); err != nil {
+		return nil, goerr.Wrap(err, "Fail to put import log").With("feed", types.FeedAbuseChFeodo)
+	}
+	return &watermark, nil
+}
+
+// parseFeodo decodes Feodo blocklist. A record that can not be parsed is handled by deadLetters. newRecords are records first seen after since, and latest is the latest first seen time of all records.
+func parseFeodo(ctx context.Context, body []byte, since *time.Time, deadLetters *deadletter.Handler) (allRecords, newRecords []FeodoRecord, latest *time.Time, err error) {
+	_, span := utils.StartSpan(ctx, "abuse_ch.feodo.transform")
+	defer func() { utils.EndSpan(span, err) }()
+
+	// Each record is decoded one by one, then a malformed record does not fail the whole list
+	var data []json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, nil, nil, goerr.Wrap(err, "Fail to decode response")
+	}
+
+	for _, raw := range data {
+		record, err := parseFeodoRecord(raw)
+		if err != nil {
+			if err := deadLetters.Handle(ctx, raw, err); err != nil {
+				return nil, nil, nil, err
+			}
+			continue
+		}
+
+		allRecords = append(allRecords, *record)
+		if since == nil || since.Before(record.FirstSeen) {
+			newRecords = append(newRecords, *record)
+		}
+		if latest == nil || latest.Before(record.FirstSeen) {
+			latest = &record.FirstSeen
 		}
 	}
+	span.SetAttributes(utils.AttrRows.Int(len(allRecords)))
 
-	return nil
+	return allRecords, newRecords, latest, nil
+}
+
+func parseFeodoRecord(raw json.RawMessage) (*FeodoRecord, error) {
+	var rec FeodoResponse
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return nil, goerr.Wrap(err, "Fail to decode record")
+	}
+
+	firstSeen, err := time.Parse("2006-01-02 15:04:05", rec.FirstSeen)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to parse first_seen").With("first_seen", rec.FirstSeen)
+	}
+	lastOnline, err := time.Parse("2006-01-02", rec.LastOnline)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to parse last_online").With("last_online", rec.LastOnline)
+	}
+
+	return &FeodoRecord{
+		FeodoResponse: rec,
+		FirstSeen:     firstSeen,
+		LastOnline:    lastOnline,
+		ImportedAt:    time.Now().UTC(),
+	}, nil
 }
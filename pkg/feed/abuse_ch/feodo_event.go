@@ -0,0 +1,268 @@
+package abuse_ch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/bqs"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+type FeodoEventType string
+
+const (
+	FeodoEventAdded             FeodoEventType = "added"
+	FeodoEventRemoved           FeodoEventType = "removed"
+	FeodoEventStatusChanged     FeodoEventType = "status_changed"
+	FeodoEventLastOnlineUpdated FeodoEventType = "last_online_updated"
+)
+
+// feodoEventTableSpec is a layout of abusech_feodo_events table.
+var feodoEventTableSpec = &model.TableSpec{
+	PartitionField:   "DetectedAt",
+	PartitionType:    bigquery.DayPartitioningType,
+	ClusteringFields: []string{"Event", "Key"},
+}
+
+// FeodoEvent is a lifecycle change of a C2 server in Feodo blocklist between two imports. Record is the current entry, or the previous entry if the event is removed.
+type FeodoEvent struct {
+	Event          FeodoEventType
+	DetectedAt     time.Time
+	Key            string
+	PrevStatus     string
+	Status         string
+	PrevLastOnline time.Time
+	LastOnline     time.Time
+	Record         FeodoRecord
+}
+
+// diffFeodo compares the previous and current snapshot of Feodo blocklist and returns events. Events are sorted by key for stable output.
+func diffFeodo(prev, curr []FeodoRecord, detectedAt time.Time) []FeodoEvent {
+	prevMap := make(map[string]*FeodoRecord, len(prev))
+	for i := range prev {
+		prevMap[feodoKey(&prev[i])] = &prev[i]
+	}
+	currMap := make(map[string]*FeodoRecord, len(curr))
+	for i := range curr {
+		currMap[feodoKey(&curr[i])] = &curr[i]
+	}
+
+	var events []FeodoEvent
+	for key, c := range currMap {
+		p, ok := prevMap[key]
+		if !ok {
+			events = append(events, FeodoEvent{
+				Event:      FeodoEventAdded,
+				DetectedAt: detectedAt,
+				Key:        key,
+				Status:     c.Status,
+				LastOnline: c.LastOnline,
+				Record:     *c,
+			})
+			continue
+		}
+
+		if p.Status != c.Status {
+			events = append(events, FeodoEvent{
+				Event:          FeodoEventStatusChanged,
+				DetectedAt:     detectedAt,
+				Key:            key,
+				PrevStatus:     p.Status,
+				Status:         c.Status,
+				PrevLastOnline: p.LastOnline,
+				LastOnline:     c.LastOnline,
+				Record:         *c,
+			})
+		}
+		if !p.LastOnline.Equal(c.LastOnline) {
+			events = append(events, FeodoEvent{
+				Event:          FeodoEventLastOnlineUpdated,
+				DetectedAt:     detectedAt,
+				Key:            key,
+				PrevStatus:     p.Status,
+				Status:         c.Status,
+				PrevLastOnline: p.LastOnline,
+				LastOnline:     c.LastOnline,
+				Record:         *c,
+			})
+		}
+	}
+
+	for key, p := range prevMap {
+		if _, ok := currMap[key]; !ok {
+			events = append(events, FeodoEvent{
+				Event:          FeodoEventRemoved,
+				DetectedAt:     detectedAt,
+				Key:            key,
+				PrevStatus:     p.Status,
+				PrevLastOnline: p.LastOnline,
+				Record:         *p,
+			})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Key != events[j].Key {
+			return events[i].Key < events[j].Key
+		}
+		return events[i].Event < events[j].Event
+	})
+
+	return events
+}
+
+// carryOverFeodo returns curr with records of prev that are missing in curr.
+func carryOverFeodo(prev, curr []FeodoRecord) []FeodoRecord {
+	keys := make(map[string]struct{}, len(curr))
+	for i := range curr {
+		keys[feodoKey(&curr[i])] = struct{}{}
+	}
+
+	merged := append([]FeodoRecord{}, curr...)
+	for i := range prev {
+		if _, ok := keys[feodoKey(&prev[i])]; !ok {
+			merged = append(merged, prev[i])
+		}
+	}
+	return merged
+}
+
+// importEvents compares records with the previous snapshot stored in the database, saves records as a new snapshot and inserts lifecycle events. If complete is false (some records are malformed), records of the previous snapshot that are missing in records are carried over instead of being detected as removed.
+//
+// The snapshot is saved before events are inserted, then a failure of saving snapshot does not emit the same events again in next import. If events can not be inserted, the previous snapshot is restored to detect the events again.
+func importEvents(ctx context.Context, clients *infra.Clients, summary *model.ImportSummary, records []FeodoRecord, complete bool) error {
+	const eventTableName = feodoEventTableName
+
+	schema, err := bqs.Infer(&FeodoEvent{})
+	if err != nil {
+		return goerr.Wrap(err, "Fail to infer schema")
+	}
+	if err := clients.BigQuery().CreateOrUpdateSchema(ctx, eventTableName, schema, feodoEventTableSpec); err != nil {
+		return goerr.Wrap(err, "Fail to migrate feodo event table")
+	}
+
+	snapshot, err := clients.Database().GetSnapshot(ctx, types.FeedAbuseChFeodo)
+	if err != nil {
+		return goerr.Wrap(err, "Fail to get snapshot").With("feed", types.FeedAbuseChFeodo)
+	}
+	// Snapshot without data is stored when the first snapshot is restored
+	if snapshot != nil && len(snapshot.Data) == 0 {
+		snapshot = nil
+	}
+
+	var prev []FeodoRecord
+	if snapshot != nil {
+		if err := json.Unmarshal(snapshot.Data, &prev); err != nil {
+			return goerr.Wrap(err, "Fail to decode snapshot").With("feed", types.FeedAbuseChFeodo)
+		}
+	}
+
+	if !complete {
+		records = carryOverFeodo(prev, records)
+	}
+
+	now := time.Now()
+	events := diffFeodo(prev, records, now)
+	utils.Logger().InfoContext(ctx, "Feodo events", "events", len(events), "prev", len(prev), "curr", len(records))
+
+	if err := putFeodoSnapshot(ctx, clients, records, now); err != nil {
+		return err
+	}
+
+	if len(events) > 0 {
+		failed, err := summary.CheckInsert(clients.BigQuery().Insert(ctx, eventTableName, events))
+		if err != nil {
+			restoreSnapshot(ctx, clients, snapshot)
+			return goerr.Wrap(err, "Fail to insert feodo events").With("table", eventTableName)
+		}
+
+		// Records of failed events are reverted in the snapshot to detect the events again
+		if len(failed) > 0 {
+			keys := make(map[string]struct{}, len(failed))
+			for _, idx := range failed {
+				keys[events[idx].Key] = struct{}{}
+			}
+			if err := putFeodoSnapshot(ctx, clients, revertFeodo(prev, records, keys), now); err != nil {
+				return err
+			}
+		}
+	}
+
+	// All records are new in the first import, then they are not notified
+	if snapshot != nil {
+		// Notification failure should not stop import because events have been stored already
+		if err := clients.Notifier().Notify(ctx, feodoAlerts(events)...); err != nil {
+			utils.HandleError(ctx, "Fail to notify feodo events", err)
+			summary.Warn("failed to notify feodo events: %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+func putFeodoSnapshot(ctx context.Context, clients *infra.Clients, records []FeodoRecord, createdAt time.Time) error {
+	raw, err := json.Marshal(records)
+	if err != nil {
+		return goerr.Wrap(err, "Fail to encode snapshot")
+	}
+	if err := clients.Database().PutSnapshot(ctx, types.FeedAbuseChFeodo, &model.Snapshot{
+		Data:      raw,
+		CreatedAt: createdAt,
+	}); err != nil {
+		return goerr.Wrap(err, "Fail to put snapshot").With("feed", types.FeedAbuseChFeodo)
+	}
+	return nil
+}
+
+// revertFeodo returns curr with records of the keys reverted to prev. A key that is not in prev is dropped, and a key that is only in prev is added back.
+func revertFeodo(prev, curr []FeodoRecord, keys map[string]struct{}) []FeodoRecord {
+	var reverted []FeodoRecord
+	for i := range curr {
+		if _, ok := keys[feodoKey(&curr[i])]; !ok {
+			reverted = append(reverted, curr[i])
+		}
+	}
+	for i := range prev {
+		if _, ok := keys[feodoKey(&prev[i])]; ok {
+			reverted = append(reverted, prev[i])
+		}
+	}
+	return reverted
+}
+
+// restoreSnapshot puts back the previous snapshot. If there was no snapshot, a snapshot without data is stored and it's handled as no snapshot.
+func restoreSnapshot(ctx context.Context, clients *infra.Clients, prev *model.Snapshot) {
+	if prev == nil {
+		prev = &model.Snapshot{}
+	}
+	if err := clients.Database().PutSnapshot(ctx, types.FeedAbuseChFeodo, prev); err != nil {
+		utils.HandleError(ctx, "Fail to restore feodo snapshot", err)
+	}
+}
+
+// feodoAlerts returns alerts of C2 servers added to Feodo blocklist.
+func feodoAlerts(events []FeodoEvent) []*model.Alert {
+	var alerts []*model.Alert
+	for _, ev := range events {
+		if ev.Event != FeodoEventAdded {
+			continue
+		}
+
+		alerts = append(alerts, &model.Alert{
+			Type:      types.AlertFeedEvent,
+			Key:       string(types.FeedAbuseChFeodo) + "/added/" + ev.Key + "/" + ev.Record.FirstSeen.Format(time.RFC3339),
+			Title:     fmt.Sprintf("New %s C2 server %s in Feodo blocklist (%s)", ev.Record.Malware, ev.Key, ev.Status),
+			CreatedAt: ev.DetectedAt,
+			Data:      ev,
+		})
+	}
+	return alerts
+}
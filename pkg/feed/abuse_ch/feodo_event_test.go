@@ -0,0 +1,104 @@
+package abuse_ch_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed/abuse_ch"
+	"github.com/m-mizutani/gt"
+)
+
+func newFeodoRecord(ip, status string, lastOnline time.Time) abuse_ch.FeodoRecord {
+	return abuse_ch.FeodoRecord{
+		FeodoResponse: abuse_ch.FeodoResponse{
+			IPAddress: ip,
+			Port:      443,
+			Status:    status,
+		},
+		LastOnline: lastOnline,
+	}
+}
+
+func TestDiffFeodo(t *testing.T) {
+	day1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	now := time.Now()
+
+	prev := []abuse_ch.FeodoRecord{
+		newFeodoRecord("192.0.2.1", "online", day1),
+		newFeodoRecord("192.0.2.2", "online", day1),
+		newFeodoRecord("192.0.2.3", "online", day1),
+	}
+	curr := []abuse_ch.FeodoRecord{
+		newFeodoRecord("192.0.2.1", "online", day1),
+		newFeodoRecord("192.0.2.2", "offline", day2),
+		newFeodoRecord("192.0.2.4", "online", day2),
+	}
+
+	events := abuse_ch.DiffFeodo(prev, curr, now)
+	gt.A(t, events).Length(4).
+		At(0, func(t testing.TB, v abuse_ch.FeodoEvent) {
+			gt.Equal(t, v.Key, "192.0.2.2:443")
+			gt.Equal(t, v.Event, abuse_ch.FeodoEventLastOnlineUpdated)
+			gt.Equal(t, v.PrevLastOnline, day1)
+			gt.Equal(t, v.LastOnline, day2)
+		}).
+		At(1, func(t testing.TB, v abuse_ch.FeodoEvent) {
+			gt.Equal(t, v.Key, "192.0.2.2:443")
+			gt.Equal(t, v.Event, abuse_ch.FeodoEventStatusChanged)
+			gt.Equal(t, v.PrevStatus, "online")
+			gt.Equal(t, v.Status, "offline")
+		}).
+		At(2, func(t testing.TB, v abuse_ch.FeodoEvent) {
+			gt.Equal(t, v.Key, "192.0.2.3:443")
+			gt.Equal(t, v.Event, abuse_ch.FeodoEventRemoved)
+		}).
+		At(3, func(t testing.TB, v abuse_ch.FeodoEvent) {
+			gt.Equal(t, v.Key, "192.0.2.4:443")
+			gt.Equal(t, v.Event, abuse_ch.FeodoEventAdded)
+		})
+
+	// No change
+	gt.A(t, abuse_ch.DiffFeodo(curr, curr, now)).Length(0)
+}
+
+func TestFeodoAlerts(t *testing.T) {
+	day1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := []abuse_ch.FeodoRecord{
+		newFeodoRecord("192.0.2.1", "online", day1),
+	}
+	curr := []abuse_ch.FeodoRecord{
+		newFeodoRecord("192.0.2.1", "offline", day1),
+		newFeodoRecord("192.0.2.4", "online", day1),
+	}
+
+	// Only added C2 servers are notified
+	alerts := abuse_ch.FeodoAlerts(abuse_ch.DiffFeodo(prev, curr, time.Now()))
+	gt.A(t, alerts).Length(1).At(0, func(t testing.TB, v *model.Alert) {
+		gt.V(t, v.Type).Equal(types.AlertFeedEvent)
+		gt.S(t, v.Key).HasPrefix("abuse.ch-feodo/added/192.0.2.4:443/")
+	})
+}
+
+func TestCarryOverFeodo(t *testing.T) {
+	day1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := []abuse_ch.FeodoRecord{
+		newFeodoRecord("192.0.2.1", "online", day1),
+		newFeodoRecord("192.0.2.2", "online", day1),
+	}
+	curr := []abuse_ch.FeodoRecord{
+		newFeodoRecord("192.0.2.1", "offline", day1),
+	}
+
+	// Record missing in curr is not detected as removed
+	merged := abuse_ch.CarryOverFeodo(prev, curr)
+	gt.A(t, merged).Length(2).At(0, func(t testing.TB, v abuse_ch.FeodoRecord) {
+		gt.V(t, v.Status).Equal("offline")
+	})
+	events := abuse_ch.DiffFeodo(prev, merged, time.Now())
+	gt.A(t, events).Length(1).At(0, func(t testing.TB, v abuse_ch.FeodoEvent) {
+		gt.V(t, v.Event).Equal(abuse_ch.FeodoEventStatusChanged)
+	})
+}
@@ -0,0 +1,131 @@
+package abuse_ch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/stix"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+const feodoSTIXSourceName = "abuse.ch Feodo Tracker"
+
+// feodoSTIXQuery selects the latest entry of each C2 server.
+const feodoSTIXQuery = "SELECT IPAddress, Port, Malware, Status, FirstSeen, LastOnline, ImportedAt FROM " + feodoTableName + `
+WHERE TRUE
+QUALIFY ROW_NUMBER() OVER (PARTITION BY IPAddress, Port ORDER BY LastOnline DESC, FirstSeen DESC) = 1
+ORDER BY IPAddress, Port`
+
+// FeodoSTIX converts C2 servers in Feodo blocklist into STIX indicators of network traffic, with malware families that the indicators indicate. Feodo Tracker data is public, then objects are marked as TLP:WHITE.
+func FeodoSTIX(ctx context.Context, client interfaces.BigQuery) ([]stix.Object, error) {
+	rows, err := client.Query(ctx, feodoSTIXQuery, nil)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to query Feodo records for STIX")
+	}
+
+	identity := stix.NewIdentity(feodoSTIXSourceName)
+	objects := []stix.Object{identity}
+	markings := []string{stix.TLPWhite}
+
+	type family struct {
+		created, modified, added time.Time
+		indicators               []*stix.Indicator
+	}
+	families := map[string]*family{}
+	var names []string
+
+	for _, row := range rows {
+		record, err := toFeodoSTIXRecord(row)
+		if err != nil {
+			return nil, err
+		}
+
+		pattern, err := stix.NetworkTrafficPattern(record.IPAddress, record.Port)
+		if err != nil {
+			utils.Logger().Debug("Skip Feodo record that can not be converted to STIX", "ip", record.IPAddress, "port", record.Port, "err", err)
+			continue
+		}
+
+		modified := record.FirstSeen
+		if record.LastOnline.After(modified) {
+			modified = record.LastOnline
+		}
+
+		key := feodoKey(record)
+		ind := stix.NewIndicator(stix.NewID("indicator", string(types.FeedAbuseChFeodo), key), key, pattern, record.FirstSeen, modified, time.Time{})
+		ind.Description = fmt.Sprintf("%s C2 server (status: %s)", record.Malware, record.Status)
+		ind.CreatedByRef = identity.ID
+		ind.ObjectMarkingRefs = markings
+		ind.DateAdded = record.ImportedAt
+		ind.ExternalReferences = []stix.ExternalReference{
+			{SourceName: feodoSTIXSourceName, URL: "https://feodotracker.abuse.ch/browse/host/" + record.IPAddress + "/"},
+		}
+		objects = append(objects, ind)
+
+		if record.Malware == "" {
+			continue
+		}
+		f, ok := families[record.Malware]
+		if !ok {
+			f = &family{created: record.FirstSeen, modified: modified}
+			families[record.Malware] = f
+			names = append(names, record.Malware)
+		}
+		if record.FirstSeen.Before(f.created) {
+			f.created = record.FirstSeen
+		}
+		if modified.After(f.modified) {
+			f.modified = modified
+		}
+		if record.ImportedAt.After(f.added) {
+			f.added = record.ImportedAt
+		}
+		f.indicators = append(f.indicators, ind)
+	}
+
+	for _, name := range names {
+		f := families[name]
+		malware := stix.NewMalware(name, f.created, f.modified)
+		malware.ObjectMarkingRefs = markings
+		malware.DateAdded = f.added
+		objects = append(objects, malware)
+
+		for _, ind := range f.indicators {
+			rel := stix.NewRelationship("indicates", ind.ID, malware.ID, time.Time(ind.Created), time.Time(ind.Modified))
+			rel.CreatedByRef = identity.ID
+			rel.ObjectMarkingRefs = markings
+			rel.DateAdded = ind.DateAdded
+			objects = append(objects, rel)
+		}
+	}
+
+	return objects, nil
+}
+
+func toFeodoSTIXRecord(row map[string]bigquery.Value) (*FeodoRecord, error) {
+	var record FeodoRecord
+	var ok bool
+
+	if record.IPAddress, ok = row["IPAddress"].(string); !ok {
+		return nil, goerr.New("invalid IPAddress in Feodo record").With("row", row)
+	}
+	if record.Port, ok = row["Port"].(int64); !ok {
+		return nil, goerr.New("invalid Port in Feodo record").With("row", row)
+	}
+	if record.FirstSeen, ok = row["FirstSeen"].(time.Time); !ok {
+		return nil, goerr.New("invalid FirstSeen in Feodo record").With("row", row)
+	}
+	// Malware, Status and LastOnline can be NULL
+	record.Malware, _ = row["Malware"].(string)
+	record.Status, _ = row["Status"].(string)
+	record.LastOnline, _ = row["LastOnline"].(time.Time)
+	// ImportedAt is NULL in rows imported before the column was added
+	record.ImportedAt, _ = row["ImportedAt"].(time.Time)
+
+	return &record, nil
+}
@@ -0,0 +1,45 @@
+package abuse_ch_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/feed/abuse_ch"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/stix"
+	"github.com/m-mizutani/gt"
+)
+
+func TestFeodoSTIX(t *testing.T) {
+	firstSeen := time.Date(2023, 11, 2, 10, 14, 3, 0, time.UTC)
+	mock := bq.NewMock()
+	mock.QueryFunc = func(query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+		return []map[string]bigquery.Value{
+			{"IPAddress": "192.0.2.10", "Port": int64(443), "Malware": "Pikabot", "Status": "online", "FirstSeen": firstSeen, "LastOnline": firstSeen.Add(48 * time.Hour)},
+			{"IPAddress": "198.51.100.23", "Port": int64(8080), "Malware": "Pikabot", "Status": "offline", "FirstSeen": firstSeen.Add(time.Hour), "LastOnline": nil},
+			{"IPAddress": "not-an-ip", "Port": int64(443), "Malware": "QakBot", "Status": "online", "FirstSeen": firstSeen},
+		}, nil
+	}
+
+	objects := gt.R1(abuse_ch.FeodoSTIX(context.Background(), mock)).NoError(t)
+	// identity, 2 indicators, malware and 2 relationships
+	gt.A(t, objects).Length(6)
+
+	ind := gt.Cast[*stix.Indicator](t, objects[1])
+	gt.V(t, ind.Name).Equal("192.0.2.10:443")
+	gt.V(t, ind.Pattern).Equal("[network-traffic:dst_ref.type = 'ipv4-addr' AND network-traffic:dst_ref.value = '192.0.2.10' AND network-traffic:dst_port = 443]")
+	gt.V(t, ind.ObjectMarkingRefs).Equal([]string{stix.TLPWhite})
+	gt.V(t, time.Time(ind.ValidFrom)).Equal(firstSeen)
+	gt.V(t, time.Time(ind.Modified)).Equal(firstSeen.Add(48 * time.Hour))
+
+	malware := gt.Cast[*stix.Malware](t, objects[3])
+	gt.V(t, malware.Name).Equal("Pikabot")
+	gt.V(t, time.Time(malware.Created)).Equal(firstSeen)
+
+	rel := gt.Cast[*stix.Relationship](t, objects[4])
+	gt.V(t, rel.RelationshipType).Equal("indicates")
+	gt.V(t, rel.SourceRef).Equal(ind.ID)
+	gt.V(t, rel.TargetRef).Equal(malware.ID)
+}
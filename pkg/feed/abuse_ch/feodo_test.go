@@ -2,31 +2,258 @@ package abuse_ch_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/deadletter"
+	"github.com/m-mizutani/drone/pkg/domain/types"
 	"github.com/m-mizutani/drone/pkg/feed/abuse_ch"
 	"github.com/m-mizutani/drone/pkg/infra"
+	"github.com/m-mizutani/drone/pkg/infra/archive"
 	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/infra/cassette"
+	"github.com/m-mizutani/drone/pkg/infra/httpfetch"
 	"github.com/m-mizutani/drone/pkg/utils"
 	"github.com/m-mizutani/gt"
 )
 
+var record = flag.Bool("record", false, "record fixtures from live Feodo Tracker")
+
+// feodoCassette is a hand-written fixture in the format of Feodo Tracker blocklist with documentation addresses. It's replaced with a live response by -record.
+const feodoCassette = "testdata/feodo.json"
+
+// maxFeodoEntries is a number of blocklist entries kept when a live response is recorded.
+const maxFeodoEntries = 5
+
+func trimFeodo(body []byte) []byte {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(body, &entries); err != nil || len(entries) <= maxFeodoEntries {
+		return body
+	}
+	return utils.Must1(json.MarshalIndent(entries[:maxFeodoEntries], "", "    "))
+}
+
+func TestRecordFeodo(t *testing.T) {
+	if !*record {
+		t.Skip("Run with -record to refresh fixture")
+	}
+
+	recorder := cassette.NewRecorder(nil, cassette.WithSanitizer(trimFeodo))
+	clients := infra.New(
+		infra.WithBigQuery(bq.NewMock()),
+		infra.WithHTTP(httpfetch.New(httpfetch.WithTransport(recorder))),
+	)
+
+	gt.R1(abuse_ch.NewFeodo().Import(context.Background(), clients)).NoError(t)
+	gt.NoError(t, recorder.Save(feodoCassette))
+}
+
 func TestFeodo(t *testing.T) {
+	srv := cassette.NewServer(t, feodoCassette)
 	mock := bq.NewMock()
 	clients := infra.New(infra.WithBigQuery(mock))
 	ctx := context.Background()
+	feodo := abuse_ch.NewFeodo(abuse_ch.WithURL(srv.URL + "/downloads/ipblocklist.json"))
 
 	// first time
-	gt.NoError(t, abuse_ch.NewFeodo().Import(ctx, clients))
+	summary := gt.R1(feodo.Import(ctx, clients)).NoError(t)
+	gt.V(t, summary.Feed).Equal(types.FeedAbuseChFeodo)
+	gt.V(t, summary.PagesFetched).Equal(1)
+	gt.V(t, summary.RecordsParsed).Equal(3)
+	gt.V(t, summary.RecordsInserted).Equal(3)
+	gt.V(t, summary.RecordsSkipped).Equal(0)
+	gt.V(t, summary.PreviousWatermark).Nil()
+	gt.V(t, summary.NewWatermark).NotNil()
 
-	gt.A(t, mock.InsertedData).Length(1)
-	firstRecords := gt.Cast[[]abuse_ch.FeodoRecord](t, mock.InsertedData[0])
-	gt.A(t, firstRecords).Longer(1)
+	gt.A(t, mock.InsertedTable["abusech_feodo"]).Length(1)
+	firstRecords := gt.Cast[[]abuse_ch.FeodoRecord](t, mock.InsertedTable["abusech_feodo"][0])
+	gt.A(t, firstRecords).Length(3).At(0, func(t testing.TB, v abuse_ch.FeodoRecord) {
+		gt.V(t, v.IPAddress).Equal("192.0.2.10")
+		gt.V(t, v.Port).Equal(443)
+		gt.V(t, v.FirstSeen.Format("2006-01-02 15:04:05")).Equal("2023-11-02 10:14:03")
+	})
+	gt.A(t, mock.InsertedTable["abusech_feodo_events"]).Length(1)
 
 	// second time
-	gt.NoError(t, abuse_ch.NewFeodo().Import(ctx, clients))
-	// The second import result should not have new data
-	gt.A(t, mock.InsertedData).Length(1)
+	summary = gt.R1(feodo.Import(ctx, clients)).NoError(t)
+	gt.V(t, summary.PagesFetched).Equal(0)
+	gt.V(t, summary.RecordsParsed).Equal(0)
+	// The second import result should not have new data because blocklist is not modified
+	gt.A(t, mock.InsertedTable["abusech_feodo"]).Length(1)
+	gt.A(t, mock.InsertedTable["abusech_feodo_events"]).Length(1)
+}
+
+func TestFeodoParseError(t *testing.T) {
+	body := `[
+		{"ip_address": "192.0.2.10", "port": 443, "status": "online", "first_seen": "2024-01-02 10:14:03", "last_online": "2024-01-15"},
+		{"ip_address": "192.0.2.11", "port": 443, "status": "online", "first_seen": "broken", "last_online": "2024-01-15"}
+	]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+
+	t.Run("fail policy aborts import", func(t *testing.T) {
+		clients := infra.New(infra.WithBigQuery(bq.NewMock()))
+		feodo := abuse_ch.NewFeodo(abuse_ch.WithURL(srv.URL))
+		summary, err := feodo.Import(ctx, clients)
+		gt.Error(t, err)
+		gt.V(t, summary.RecordsMalformed).Equal(0)
+	})
+
+	t.Run("dead-letter policy continues import", func(t *testing.T) {
+		mock := bq.NewMock()
+		clients := infra.New(infra.WithBigQuery(mock))
+		feodo := abuse_ch.NewFeodo(
+			abuse_ch.WithURL(srv.URL),
+			abuse_ch.WithParseErrorPolicy(types.ParseErrorDeadLetter),
+		)
+		summary := gt.R1(feodo.Import(ctx, clients)).NoError(t)
+		gt.V(t, summary.RecordsParsed).Equal(1)
+		gt.V(t, summary.RecordsInserted).Equal(1)
+		gt.V(t, summary.RecordsMalformed).Equal(1)
+		gt.V(t, summary.DeadLetters).Equal(1)
+
+		letters := gt.Cast[[]*deadletter.Letter](t, mock.InsertedTable[deadletter.TableName][0])
+		gt.A(t, letters).Length(1).At(0, func(t testing.TB, v *deadletter.Letter) {
+			gt.V(t, v.Feed).Equal(types.FeedAbuseChFeodo)
+			gt.V(t, v.RunID).Equal(summary.RunID)
+			gt.S(t, v.Payload).Contains("192.0.2.11")
+		})
+	})
+}
+
+func TestFeodoEventInsertFailure(t *testing.T) {
+	body := `[{"ip_address": "192.0.2.10", "port": 443, "status": "online", "first_seen": "2024-01-02 10:14:03", "last_online": "2024-01-15"}]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	mock := bq.NewMock()
+	clients := infra.New(infra.WithBigQuery(mock))
+	feodo := abuse_ch.NewFeodo(abuse_ch.WithURL(srv.URL), abuse_ch.WithDedupMode(types.DedupHash))
+	gt.R1(feodo.Import(ctx, clients)).NoError(t)
+
+	// Events of the new record can not be inserted, then the snapshot is restored
+	body = `[
+		{"ip_address": "192.0.2.10", "port": 443, "status": "online", "first_seen": "2024-01-02 10:14:03", "last_online": "2024-01-15"},
+		{"ip_address": "192.0.2.11", "port": 443, "status": "online", "first_seen": "2024-01-03 10:14:03", "last_online": "2024-01-15"}
+	]`
+	mock.InsertFunc = func(tableName string, data any) error {
+		if tableName == "abusech_feodo_events" {
+			return errors.New("insert failed")
+		}
+		return nil
+	}
+	gt.R1(feodo.Import(ctx, clients)).Error(t)
+
+	// The event is detected again in the next import
+	mock.InsertFunc = nil
+	gt.R1(feodo.Import(ctx, clients)).NoError(t)
+	events := mock.InsertedTable["abusech_feodo_events"]
+	gt.A(t, events).Length(2)
+	gt.A(t, gt.Cast[[]abuse_ch.FeodoEvent](t, events[1])).Length(1).At(0, func(t testing.TB, v abuse_ch.FeodoEvent) {
+		gt.V(t, v.Key).Equal("192.0.2.11:443")
+		gt.V(t, v.Event).Equal(abuse_ch.FeodoEventAdded)
+	})
+}
+
+func TestFeodoLastOnline(t *testing.T) {
+	body := `[{"ip_address": "192.0.2.10", "port": 443, "status": "online", "first_seen": "2024-01-02 10:14:03", "last_online": "2024-01-15"}]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	mock := bq.NewMock()
+	clients := infra.New(infra.WithBigQuery(mock))
+	feodo := abuse_ch.NewFeodo(abuse_ch.WithURL(srv.URL), abuse_ch.WithDedupMode(types.DedupHash))
+	gt.R1(feodo.Import(ctx, clients)).NoError(t)
+
+	// Updated last online time is inserted in hash mode not to expire the C2 server that is still online
+	body = `[{"ip_address": "192.0.2.10", "port": 443, "status": "online", "first_seen": "2024-01-02 10:14:03", "last_online": "2024-01-16"}]`
+	summary := gt.R1(feodo.Import(ctx, clients)).NoError(t)
+	gt.V(t, summary.RecordsInserted).Equal(1)
+	inserted := mock.InsertedTable["abusech_feodo"]
+	gt.A(t, inserted).Length(2)
+	gt.A(t, gt.Cast[[]abuse_ch.FeodoRecord](t, inserted[1])).Length(1).At(0, func(t testing.TB, v abuse_ch.FeodoRecord) {
+		gt.V(t, v.LastOnline).Equal(time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC))
+	})
+}
+
+func TestFeodoArchiveFailure(t *testing.T) {
+	body := `[{"ip_address": "192.0.2.10", "port": 443, "status": "online", "first_seen": "2024-01-02 10:14:03", "last_online": "2024-01-15"}]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	// Archive root is a file, then the body can not be archived
+	root := filepath.Join(t.TempDir(), "archive")
+	gt.NoError(t, os.WriteFile(root, nil, 0o644))
+
+	ctx := context.Background()
+	mock := bq.NewMock()
+	clients := infra.New(infra.WithBigQuery(mock), infra.WithArchive(archive.NewDir(root)))
+	summary := gt.R1(abuse_ch.NewFeodo(abuse_ch.WithURL(srv.URL)).Import(ctx, clients)).NoError(t)
+	gt.V(t, summary.RecordsInserted).Equal(1)
+	gt.A(t, summary.Warnings).Length(1).At(0, func(t testing.TB, v string) {
+		gt.S(t, v).Contains("failed to archive response")
+	})
+}
+
+func TestFeodoPartialInsert(t *testing.T) {
+	body := `[
+		{"ip_address": "192.0.2.10", "port": 443, "status": "online", "first_seen": "2024-01-02 10:14:03", "last_online": "2024-01-15"},
+		{"ip_address": "192.0.2.11", "port": 443, "status": "online", "first_seen": "2024-01-03 10:14:03", "last_online": "2024-01-15"}
+	]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	mock := bq.NewMock()
+	clients := infra.New(infra.WithBigQuery(mock))
+	feodo := abuse_ch.NewFeodo(abuse_ch.WithURL(srv.URL))
+
+	// The record first seen earlier is rejected by BigQuery
+	mock.InsertFunc = func(tableName string, data any) error {
+		if tableName == "abusech_feodo" {
+			return &types.PartialInsertError{Table: tableName, Total: 2, Rows: bigquery.PutMultiError{{RowIndex: 0}}}
+		}
+		return nil
+	}
+	summary := gt.R1(feodo.Import(ctx, clients)).NoError(t)
+	gt.V(t, summary.RowsFailed).Equal(1)
+	gt.V(t, summary.RecordsInserted).Equal(1)
+
+	// Watermark does not pass the rejected record
+	firstSeen := time.Date(2024, 1, 2, 10, 14, 3, 0, time.UTC)
+	log := gt.R1(clients.Database().GetLatestImportLog(ctx, types.FeedAbuseChFeodo)).NoError(t)
+	gt.True(t, log.LatestRecord.Before(firstSeen))
+
+	// Only the rejected record is inserted in the next import
+	mock.InsertFunc = nil
+	summary = gt.R1(feodo.Import(ctx, clients)).NoError(t)
+	gt.V(t, summary.RecordsSkipped).Equal(1)
+	gt.A(t, gt.Cast[[]abuse_ch.FeodoRecord](t, mock.InsertedTable["abusech_feodo"][0])).Length(1).At(0, func(t testing.TB, v abuse_ch.FeodoRecord) {
+		gt.V(t, v.IPAddress).Equal("192.0.2.10")
+	})
+	log = gt.R1(clients.Database().GetLatestImportLog(ctx, types.FeedAbuseChFeodo)).NoError(t)
+	gt.V(t, log.LatestRecord).Equal(time.Date(2024, 1, 3, 10, 14, 3, 0, time.UTC))
 }
 
 func TestFeodoIntegration(t *testing.T) {
@@ -39,5 +266,5 @@ func TestFeodoIntegration(t *testing.T) {
 		infra.WithBigQuery(bqClient),
 	)
 
-	gt.NoError(t, abuse_ch.NewFeodo().Import(ctx, clients))
+	gt.R1(abuse_ch.NewFeodo().Import(ctx, clients)).NoError(t)
 }
@@ -0,0 +1,184 @@
+// Package feed is a registry of feeds. It provides BigQuery tables, views, indicator sources and STIX sources declared by each feed.
+package feed
+
+import (
+	"context"
+
+	"github.com/m-mizutani/drone/pkg/deadletter"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed/abuse_ch"
+	"github.com/m-mizutani/drone/pkg/feed/otx"
+	"github.com/m-mizutani/drone/pkg/infra"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/stix"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+var tables = map[types.FeedID]func() ([]*model.Table, error){
+	types.FeedOTXSubscribed: otx.SubscribedTables,
+	types.FeedAbuseChFeodo:  abuse_ch.FeodoTables,
+}
+
+// Tables returns BigQuery tables declared by the feeds. If no feed ID is given, tables of all feeds are returned.
+func Tables(ids ...types.FeedID) ([]*model.Table, error) {
+	if len(ids) == 0 {
+		ids = types.FeedIDs()
+	}
+
+	var result []*model.Table
+	for _, id := range ids {
+		f, ok := tables[id]
+		if !ok {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "unknown feed ID").With("feed", id)
+		}
+		t, err := f()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t...)
+	}
+
+	return result, nil
+}
+
+var views = map[types.FeedID]func() []*model.View{
+	types.FeedOTXSubscribed: otx.SubscribedViews,
+	types.FeedAbuseChFeodo:  abuse_ch.FeodoViews,
+}
+
+// Views returns BigQuery views declared by the feeds. If no feed ID is given, views of all feeds are returned.
+func Views(ids ...types.FeedID) ([]*model.View, error) {
+	if len(ids) == 0 {
+		ids = types.FeedIDs()
+	}
+
+	var result []*model.View
+	for _, id := range ids {
+		f, ok := views[id]
+		if !ok {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "unknown feed ID").With("feed", id)
+		}
+		result = append(result, f()...)
+	}
+
+	return result, nil
+}
+
+var indicators = map[types.FeedID]func() []*model.IndicatorSource{
+	types.FeedOTXSubscribed: otx.SubscribedIndicators,
+	types.FeedAbuseChFeodo:  abuse_ch.FeodoIndicators,
+}
+
+// Indicators returns indicator sources declared by the feeds. If no feed ID is given, sources of all feeds are returned.
+func Indicators(ids ...types.FeedID) ([]*model.IndicatorSource, error) {
+	if len(ids) == 0 {
+		ids = types.FeedIDs()
+	}
+
+	var result []*model.IndicatorSource
+	for _, id := range ids {
+		f, ok := indicators[id]
+		if !ok {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "unknown feed ID").With("feed", id)
+		}
+		result = append(result, f()...)
+	}
+
+	return result, nil
+}
+
+var stixSources = map[types.FeedID]stix.Source{
+	types.FeedOTXSubscribed: otx.SubscribedSTIX,
+	types.FeedAbuseChFeodo:  abuse_ch.FeodoSTIX,
+}
+
+// STIX returns STIX sources of the feeds. If no feed ID is given, sources of all feeds are returned.
+func STIX(ids ...types.FeedID) ([]stix.Source, error) {
+	if len(ids) == 0 {
+		ids = types.FeedIDs()
+	}
+
+	var result []stix.Source
+	for _, id := range ids {
+		src, ok := stixSources[id]
+		if !ok {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "unknown feed ID").With("feed", id)
+		}
+		result = append(result, src)
+	}
+
+	return result, nil
+}
+
+// Replayer transforms an archived response body of the feed by the current transform and inserts records into BigQuery by the dedup mode. Replay state such as watermark and record hashes is stored into clients.Database(), then the database must be scoped to the replay.
+type Replayer func(ctx context.Context, clients *infra.Clients, summary *model.ImportSummary, deadLetters *deadletter.Handler, mode types.DedupMode, body []byte) error
+
+var replayers = map[types.FeedID]Replayer{
+	types.FeedOTXSubscribed: otx.ReplaySubscribed,
+	types.FeedAbuseChFeodo:  abuse_ch.ReplayFeodo,
+}
+
+// Reprocess replays archived bodies of keys in order by Replayer of the feed with the dedup mode. Records are inserted into tables of the feed with the suffix, e.g. abusech_feodo_reprocess, not to append a second copy of archived records to tables of the import. The tables are created with the current schema, and reprocess fails if any of them already exists. Replay state is kept in a memory database of the reprocess, then records are deduplicated across the replayed bodies and import state of the feed is not changed. The returned summary is not nil even if reprocess fails.
+func Reprocess(ctx context.Context, clients *infra.Clients, id types.FeedID, keys []*model.ArchiveKey, policy types.ParseErrorPolicy, mode types.DedupMode, suffix string) (summary *model.ImportSummary, err error) {
+	ctx, span := utils.StartSpan(ctx, "reprocess", utils.AttrFeedID.String(id.String()))
+	defer func() { utils.EndSpan(span, err) }()
+
+	summary = model.NewImportSummary(id)
+	replay, err := Replay(id)
+	if err != nil {
+		return summary, err
+	}
+
+	if suffix == "" {
+		return summary, goerr.Wrap(types.ErrInvalidOption, "table suffix of reprocess is required")
+	}
+	bqClient := bq.WithTableSuffix(clients.BigQuery(), suffix)
+
+	tables, err := Tables(id)
+	if err != nil {
+		return summary, err
+	}
+	for _, table := range tables {
+		current, err := bqClient.GetSchema(ctx, table.Name)
+		if err != nil {
+			return summary, goerr.Wrap(err, "Fail to get table schema").With("table", table.Name+suffix)
+		}
+		if current != nil {
+			return summary, goerr.Wrap(types.ErrInvalidOption, "destination table of reprocess already exists").With("table", table.Name+suffix)
+		}
+		if err := bqClient.CreateOrUpdateSchema(ctx, table.Name, table.Schema, table.Spec); err != nil {
+			return summary, goerr.Wrap(err, "Fail to create table").With("table", table.Name+suffix)
+		}
+	}
+
+	replayClients := infra.New(
+		infra.WithBigQuery(bqClient),
+		infra.WithArchive(clients.Archive()),
+	)
+	deadLetters := deadletter.New(id, policy, summary)
+	for _, key := range keys {
+		body, err := clients.Archive().Get(ctx, key)
+		if err != nil {
+			return summary, err
+		}
+		summary.PagesFetched++
+
+		if err := replay(ctx, replayClients, summary, deadLetters, mode, body); err != nil {
+			return summary, goerr.Wrap(err, "Fail to replay archived body").With("run_id", key.RunID).With("page", key.Page)
+		}
+		utils.Logger().InfoContext(ctx, "Reprocessed archived body", "feed", id, "run_id", key.RunID, "page", key.Page)
+	}
+
+	return summary, nil
+}
+
+// Replay returns Replayer of the feed.
+func Replay(id types.FeedID) (Replayer, error) {
+	f, ok := replayers[id]
+	if !ok {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "unknown feed ID").With("feed", id)
+	}
+	return f, nil
+}
@@ -0,0 +1,179 @@
+package feed_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/feed/abuse_ch"
+	"github.com/m-mizutani/drone/pkg/infra"
+	"github.com/m-mizutani/drone/pkg/infra/archive"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/gt"
+)
+
+func TestTables(t *testing.T) {
+	tables := gt.R1(feed.Tables()).NoError(t)
+	names := map[string]*model.Table{}
+	for _, table := range tables {
+		names[table.Name] = table
+	}
+	gt.M(t, names).HaveKey("otx_pulses").HaveKey("abusech_feodo").HaveKey("abusech_feodo_events")
+
+	// Repeated fields must be declared even if they are empty in zero value
+	var indicators bool
+	for _, field := range names["otx_pulses"].Schema {
+		if field.Name == "Indicators" {
+			indicators = field.Repeated
+		}
+	}
+	gt.True(t, indicators)
+
+	_, err := feed.Tables(types.FeedID("unknown"))
+	gt.Error(t, err)
+}
+
+func TestViews(t *testing.T) {
+	ctx := context.Background()
+	mock := bq.NewMock()
+
+	tables := map[string]struct{}{}
+	for _, table := range gt.R1(feed.Tables()).NoError(t) {
+		tables[table.Name] = struct{}{}
+	}
+
+	views := gt.R1(feed.Views()).NoError(t)
+	gt.A(t, views).Longer(1)
+
+	tableRef := regexp.MustCompile("`" + bq.MockProjectID + `\.` + bq.MockDatasetID + `\.([a-z0-9_]+)` + "`")
+	for _, view := range views {
+		gt.NoError(t, mock.CreateOrUpdateView(ctx, view))
+		query := mock.Views[view.Name]
+
+		// Views must refer only tables declared by feeds
+		refs := tableRef.FindAllStringSubmatch(query, -1)
+		gt.A(t, refs).Longer(0)
+		for _, ref := range refs {
+			gt.M(t, tables).HaveKey(ref[1])
+		}
+	}
+}
+
+func TestViewRender(t *testing.T) {
+	view := &model.View{
+		Name:  "test",
+		Query: `SELECT * FROM {{ table "t1" }} WHERE project = "{{ .ProjectID }}"`,
+	}
+	query := gt.R1(view.Render("p1", "d1")).NoError(t)
+	gt.V(t, query).Equal("SELECT * FROM `p1.d1.t1` WHERE project = \"p1\"")
+
+	_, err := (&model.View{Name: "bad", Query: "{{ .Unknown }}"}).Render("p1", "d1")
+	gt.Error(t, err)
+}
+
+func TestReprocess(t *testing.T) {
+	ctx := context.Background()
+	arc := archive.NewDir(t.TempDir())
+	body := `[
+		{"ip_address": "192.0.2.10", "port": 443, "status": "online", "first_seen": "2024-01-02 10:14:03", "last_online": "2024-01-15"},
+		{"ip_address": "192.0.2.11", "port": 443, "status": "online", "first_seen": "broken", "last_online": "2024-01-15"}
+	]`
+	key := &model.ArchiveKey{Feed: types.FeedAbuseChFeodo, RunID: "run-1", RunAt: time.Now(), Page: 1}
+	gt.NoError(t, arc.Put(ctx, key, []byte(body)))
+	keys := gt.R1(arc.List(ctx, types.FeedAbuseChFeodo)).NoError(t)
+
+	t.Run("fail policy stops reprocess", func(t *testing.T) {
+		clients := infra.New(infra.WithBigQuery(bq.NewMock()), infra.WithArchive(arc))
+		summary, err := feed.Reprocess(ctx, clients, types.FeedAbuseChFeodo, keys, types.ParseErrorFail, types.DedupWatermark, "_reprocess")
+		gt.Error(t, err)
+		gt.V(t, summary.PagesFetched).Equal(1)
+	})
+
+	t.Run("records are inserted by current transform", func(t *testing.T) {
+		mock := bq.NewMock()
+		clients := infra.New(infra.WithBigQuery(mock), infra.WithArchive(arc))
+		summary := gt.R1(feed.Reprocess(ctx, clients, types.FeedAbuseChFeodo, keys, types.ParseErrorSkip, types.DedupWatermark, "_reprocess")).NoError(t)
+		gt.V(t, summary.PagesFetched).Equal(1)
+		gt.V(t, summary.RecordsInserted).Equal(1)
+		gt.V(t, summary.RecordsMalformed).Equal(1)
+
+		// Tables are migrated before replay, and import state is not changed
+		gt.V(t, mock.Schemas["abusech_feodo_reprocess"]).NotNil()
+		records := gt.Cast[[]abuse_ch.FeodoRecord](t, mock.InsertedTable["abusech_feodo_reprocess"][0])
+		gt.A(t, records).Length(1).At(0, func(t testing.TB, v abuse_ch.FeodoRecord) {
+			gt.V(t, v.IPAddress).Equal("192.0.2.10")
+		})
+		gt.V(t, gt.R1(clients.Database().GetLatestImportLog(ctx, types.FeedAbuseChFeodo)).NoError(t)).Nil()
+		gt.V(t, gt.R1(clients.Database().GetSnapshot(ctx, types.FeedAbuseChFeodo)).NoError(t)).Nil()
+
+		// Records are not appended to the table of the import
+		gt.A(t, mock.InsertedTable["abusech_feodo"]).Length(0)
+	})
+
+	t.Run("existing destination table is not appended", func(t *testing.T) {
+		mock := bq.NewMock()
+		mock.Schemas["abusech_feodo_reprocess"] = bigquery.Schema{}
+		clients := infra.New(infra.WithBigQuery(mock), infra.WithArchive(arc))
+		_, err := feed.Reprocess(ctx, clients, types.FeedAbuseChFeodo, keys, types.ParseErrorSkip, types.DedupWatermark, "_reprocess")
+		gt.Error(t, err)
+		gt.A(t, mock.InsertedData).Length(0)
+	})
+
+	t.Run("table suffix is required", func(t *testing.T) {
+		clients := infra.New(infra.WithBigQuery(bq.NewMock()), infra.WithArchive(arc))
+		_, err := feed.Reprocess(ctx, clients, types.FeedAbuseChFeodo, keys, types.ParseErrorSkip, types.DedupWatermark, "")
+		gt.Error(t, err)
+	})
+}
+
+func TestReprocessDedup(t *testing.T) {
+	ctx := context.Background()
+	arc := archive.NewDir(t.TempDir())
+	bodies := []string{
+		`[{"ip_address": "192.0.2.10", "port": 443, "status": "online", "first_seen": "2024-01-02 10:14:03", "last_online": "2024-01-15"}]`,
+		`[
+			{"ip_address": "192.0.2.10", "port": 443, "status": "online", "first_seen": "2024-01-02 10:14:03", "last_online": "2024-01-15"},
+			{"ip_address": "192.0.2.11", "port": 443, "status": "online", "first_seen": "2024-01-03 10:14:03", "last_online": "2024-01-16"}
+		]`,
+	}
+	runAt := time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)
+	for i, body := range bodies {
+		key := &model.ArchiveKey{Feed: types.FeedAbuseChFeodo, RunID: fmt.Sprintf("run-%d", i), RunAt: runAt.Add(time.Duration(i) * time.Hour), Page: 1}
+		gt.NoError(t, arc.Put(ctx, key, []byte(body)))
+	}
+	keys := gt.R1(arc.List(ctx, types.FeedAbuseChFeodo)).NoError(t)
+
+	t.Run("watermark mode inserts only records new to the previous run", func(t *testing.T) {
+		mock := bq.NewMock()
+		clients := infra.New(infra.WithBigQuery(mock), infra.WithArchive(arc))
+		summary := gt.R1(feed.Reprocess(ctx, clients, types.FeedAbuseChFeodo, keys, types.ParseErrorFail, types.DedupWatermark, "_reprocess")).NoError(t)
+		gt.V(t, summary.RecordsInserted).Equal(2)
+		gt.V(t, summary.RecordsSkipped).Equal(1)
+
+		inserted := mock.InsertedTable["abusech_feodo_reprocess"]
+		gt.A(t, inserted).Length(2)
+		gt.A(t, gt.Cast[[]abuse_ch.FeodoRecord](t, inserted[1])).Length(1).At(0, func(t testing.TB, v abuse_ch.FeodoRecord) {
+			gt.V(t, v.IPAddress).Equal("192.0.2.11")
+		})
+
+		// Replay state is not stored into database of the feed
+		gt.V(t, gt.R1(clients.Database().GetLatestImportLog(ctx, types.FeedAbuseChFeodo)).NoError(t)).Nil()
+	})
+
+	t.Run("changes mode inserts change rows into change table", func(t *testing.T) {
+		mock := bq.NewMock()
+		clients := infra.New(infra.WithBigQuery(mock), infra.WithArchive(arc))
+		summary := gt.R1(feed.Reprocess(ctx, clients, types.FeedAbuseChFeodo, keys, types.ParseErrorFail, types.DedupChanges, "_reprocess")).NoError(t)
+		gt.V(t, summary.RecordsInserted).Equal(2)
+
+		gt.A(t, mock.InsertedTable["abusech_feodo_reprocess"]).Length(0)
+		gt.A(t, mock.InsertedTable["abusech_feodo_changes_reprocess"]).Length(2)
+		gt.M(t, gt.R1(clients.Database().GetRecordHashes(ctx, types.FeedAbuseChFeodo, []string{"192.0.2.10:443"})).NoError(t)).Length(0)
+	})
+}
@@ -0,0 +1,198 @@
+package otx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/stix"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+const stixSourceName = "AlienVault OTX"
+
+// stixPulseQuery selects the latest revision of each pulse. Indicators are serialized as JSON because nested records in query result have no field names.
+const stixPulseQuery = "SELECT ID, Name, Description, Tlp, AuthorName, Created, Modified, ImportedAt, Tags, TO_JSON_STRING(Indicators) AS Indicators FROM " + pulseTable + `
+WHERE TRUE
+QUALIFY ROW_NUMBER() OVER (PARTITION BY ID ORDER BY Modified DESC) = 1
+ORDER BY ID`
+
+// stixIndicator is an indicator in JSON of query result. Keys are column names of pulse table.
+type stixIndicator struct {
+	ID          int64
+	Indicator   string
+	Type        string
+	Title       string
+	Description string
+	Created     string
+	Expiration  string
+	IsActive    int64
+}
+
+// SubscribedSTIX converts subscribed pulses into STIX reports with indicators. Indicator types that have no STIX pattern are skipped, and a pulse without indicators is skipped. Markings are given by TLP of the pulse.
+func SubscribedSTIX(ctx context.Context, client interfaces.BigQuery) ([]stix.Object, error) {
+	rows, err := client.Query(ctx, stixPulseQuery, nil)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to query pulses for STIX")
+	}
+
+	identity := stix.NewIdentity(stixSourceName)
+	objects := []stix.Object{identity}
+
+	for _, row := range rows {
+		pulse, err := toSTIXPulse(row)
+		if err != nil {
+			return nil, err
+		}
+
+		marking, ok := stix.TLPMarking(pulse.Tlp)
+		if !ok {
+			// Unknown TLP is handled as amber not to share the pulse widely
+			utils.Logger().Warn("Unknown TLP of pulse, mark as amber", "pulse", pulse.ID, "tlp", pulse.Tlp)
+			marking = stix.TLPAmber
+		}
+
+		var refs []string
+		for _, ind := range pulse.indicators {
+			obj, err := stixIndicatorOf(pulse, ind)
+			if err != nil {
+				utils.Logger().Debug("Skip indicator that can not be converted to STIX", "pulse", pulse.ID, "indicator", ind.Indicator, "type", ind.Type, "err", err)
+				continue
+			}
+			obj.CreatedByRef = identity.ID
+			obj.ObjectMarkingRefs = []string{marking}
+			obj.DateAdded = pulse.ImportedAt
+			objects = append(objects, obj)
+			refs = append(refs, obj.ID)
+		}
+		if len(refs) == 0 {
+			continue
+		}
+
+		id := stix.NewID("report", string(types.FeedOTXSubscribed), pulse.ID)
+		report := stix.NewReport(id, pulse.Name, pulse.Created, pulse.Modified, refs)
+		report.Description = pulse.Description
+		report.CreatedByRef = identity.ID
+		report.Labels = pulse.Tags
+		report.ObjectMarkingRefs = []string{marking}
+		report.DateAdded = pulse.ImportedAt
+		report.ExternalReferences = []stix.ExternalReference{
+			{
+				SourceName:  stixSourceName,
+				URL:         "https://otx.alienvault.com/pulse/" + pulse.ID,
+				ExternalID:  pulse.ID,
+				Description: "Pulse by " + pulse.AuthorName,
+			},
+		}
+		objects = append(objects, report)
+	}
+
+	return objects, nil
+}
+
+type stixPulse struct {
+	ID          string
+	Name        string
+	Description string
+	Tlp         string
+	AuthorName  string
+	Created     time.Time
+	Modified    time.Time
+	ImportedAt  time.Time
+	Tags        []string
+	indicators  []*stixIndicator
+}
+
+func toSTIXPulse(row map[string]bigquery.Value) (*stixPulse, error) {
+	var pulse stixPulse
+	for key, dst := range map[string]*string{
+		"ID":          &pulse.ID,
+		"Name":        &pulse.Name,
+		"Description": &pulse.Description,
+		"Tlp":         &pulse.Tlp,
+		"AuthorName":  &pulse.AuthorName,
+	} {
+		// NULL is handled as empty string
+		if v, ok := row[key].(string); ok {
+			*dst = v
+		} else if row[key] != nil {
+			return nil, goerr.New("invalid "+key+" in pulse").With("row", row)
+		}
+	}
+
+	var ok bool
+	if pulse.Created, ok = row["Created"].(time.Time); !ok {
+		return nil, goerr.New("invalid Created in pulse").With("row", row)
+	}
+	if pulse.Modified, ok = row["Modified"].(time.Time); !ok {
+		return nil, goerr.New("invalid Modified in pulse").With("row", row)
+	}
+	// ImportedAt is NULL in rows imported before the column was added
+	pulse.ImportedAt, _ = row["ImportedAt"].(time.Time)
+
+	tags, _ := row["Tags"].([]bigquery.Value)
+	for _, tag := range tags {
+		if s, ok := tag.(string); ok && s != "" {
+			pulse.Tags = append(pulse.Tags, s)
+		}
+	}
+
+	if v, ok := row["Indicators"].(string); ok {
+		if err := json.Unmarshal([]byte(v), &pulse.indicators); err != nil {
+			return nil, goerr.Wrap(err, "Fail to parse indicators of pulse").With("pulse", pulse.ID)
+		}
+	}
+
+	return &pulse, nil
+}
+
+// stixIndicatorOf converts OTX indicator into STIX indicator. Indicator that is deactivated by the author is valid until the pulse is modified.
+func stixIndicatorOf(pulse *stixPulse, ind *stixIndicator) (*stix.Indicator, error) {
+	var pattern string
+	var err error
+
+	switch ind.Type {
+	case "IPv4", "IPv6", "CIDR":
+		pattern, err = stix.IPPattern(ind.Indicator)
+	case "domain", "hostname":
+		pattern, err = stix.DomainPattern(ind.Indicator)
+	case "URL", "URI":
+		pattern, err = stix.URLPattern(ind.Indicator)
+	case "email":
+		pattern, err = stix.EmailPattern(ind.Indicator)
+	case "FileHash-MD5":
+		pattern, err = stix.FileHashPattern(stix.HashMD5, ind.Indicator)
+	case "FileHash-SHA1":
+		pattern, err = stix.FileHashPattern(stix.HashSHA1, ind.Indicator)
+	case "FileHash-SHA256":
+		pattern, err = stix.FileHashPattern(stix.HashSHA256, ind.Indicator)
+	default:
+		return nil, goerr.Wrap(types.ErrInvalidOption, "unsupported indicator type").With("type", ind.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	created := pulse.Created
+	if t, err := time.Parse("2006-01-02T15:04:05", ind.Created); err == nil {
+		created = t
+	}
+	validUntil, _ := time.Parse("2006-01-02T15:04:05", ind.Expiration)
+	if ind.IsActive == 0 && (validUntil.IsZero() || pulse.Modified.Before(validUntil)) {
+		validUntil = pulse.Modified
+	}
+
+	id := stix.NewID("indicator", string(types.FeedOTXSubscribed), pulse.ID, fmt.Sprint(ind.ID))
+	obj := stix.NewIndicator(id, ind.Indicator, pattern, created, pulse.Modified, validUntil)
+	obj.Description = ind.Title
+	if obj.Description == "" {
+		obj.Description = ind.Description
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,72 @@
+package otx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/feed/otx"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/stix"
+	"github.com/m-mizutani/gt"
+)
+
+func TestSubscribedSTIX(t *testing.T) {
+	mock := bq.NewMock()
+	mock.QueryFunc = func(query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+		return []map[string]bigquery.Value{
+			{
+				"ID":          "65a3b1c2d4e5f60718293a4b",
+				"Name":        "Pikabot C2 infrastructure",
+				"Description": "Sanitized pulse for test",
+				"Tlp":         "green",
+				"AuthorName":  "example-author",
+				"Created":     time.Date(2024, 1, 14, 8, 12, 40, 0, time.UTC),
+				"Modified":    time.Date(2024, 1, 14, 9, 30, 2, 0, time.UTC),
+				"Tags":        []bigquery.Value{"pikabot"},
+				"Indicators": `[
+					{"ID": 3610001, "Indicator": "192.0.2.10", "Type": "IPv4", "Created": "2024-01-14T08:12:40", "Expiration": null, "IsActive": 1},
+					{"ID": 3610002, "Indicator": "c2.example.net", "Type": "domain", "Created": "2024-01-14T08:12:40", "Expiration": null, "IsActive": 0},
+					{"ID": 3610003, "Indicator": "CVE-2023-0001", "Type": "CVE", "Created": "2024-01-14T08:12:40", "IsActive": 1}
+				]`,
+			},
+			{
+				"ID":         "65a3b1c2d4e5f60718293a4c",
+				"Name":       "No STIX indicator",
+				"Tlp":        "white",
+				"Created":    time.Date(2024, 1, 14, 8, 12, 40, 0, time.UTC),
+				"Modified":   time.Date(2024, 1, 14, 9, 30, 2, 0, time.UTC),
+				"Indicators": `[{"ID": 3610004, "Indicator": "CVE-2023-0002", "Type": "CVE", "IsActive": 1}]`,
+			},
+		}, nil
+	}
+
+	objects := gt.R1(otx.SubscribedSTIX(context.Background(), mock)).NoError(t)
+	// identity, 2 indicators and a report
+	gt.A(t, objects).Length(4)
+
+	identity := gt.Cast[*stix.Identity](t, objects[0])
+	gt.V(t, identity.Name).Equal("AlienVault OTX")
+
+	ip := gt.Cast[*stix.Indicator](t, objects[1])
+	gt.V(t, ip.Pattern).Equal("[ipv4-addr:value = '192.0.2.10']")
+	gt.V(t, ip.ObjectMarkingRefs).Equal([]string{stix.TLPGreen})
+	gt.V(t, ip.CreatedByRef).Equal(identity.ID)
+	gt.V(t, ip.ValidUntil).Nil()
+
+	// Deactivated indicator is valid until the pulse is modified
+	domain := gt.Cast[*stix.Indicator](t, objects[2])
+	gt.V(t, domain.Pattern).Equal("[domain-name:value = 'c2.example.net']")
+	gt.V(t, time.Time(*domain.ValidUntil)).Equal(time.Date(2024, 1, 14, 9, 30, 2, 0, time.UTC))
+
+	report := gt.Cast[*stix.Report](t, objects[3])
+	gt.V(t, report.Name).Equal("Pikabot C2 infrastructure")
+	gt.V(t, report.ObjectRefs).Equal([]string{ip.ID, domain.ID})
+	gt.V(t, report.Labels).Equal([]string{"pikabot"})
+	gt.V(t, report.ObjectMarkingRefs).Equal([]string{stix.TLPGreen})
+
+	// IDs are deterministic
+	again := gt.R1(otx.SubscribedSTIX(context.Background(), mock)).NoError(t)
+	gt.V(t, stix.NewBundle(again...)).Equal(stix.NewBundle(objects...))
+}
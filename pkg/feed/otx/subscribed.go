@@ -3,14 +3,20 @@ package otx
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
+	"path"
 	"time"
 
+	"cloud.google.com/go/bigquery"
 	"github.com/m-mizutani/bqs"
+	"github.com/m-mizutani/drone/pkg/deadletter"
+	"github.com/m-mizutani/drone/pkg/dedup"
 	"github.com/m-mizutani/drone/pkg/domain/model"
 	"github.com/m-mizutani/drone/pkg/domain/types"
 	"github.com/m-mizutani/drone/pkg/infra"
+	"github.com/m-mizutani/drone/pkg/infra/httpfetch"
 	"github.com/m-mizutani/drone/pkg/utils"
 	"github.com/m-mizutani/goerr"
 )
@@ -18,136 +24,448 @@ import (
 type Subscribed struct {
 	apiKey  string
 	baseURL *url.URL
+	since   *time.Time
+
+	dedupMode        types.DedupMode
+	parseErrorPolicy types.ParseErrorPolicy
+	checkpointMaxAge time.Duration
+}
+
+type Option func(*Subscribed)
+
+// DefaultCheckpointMaxAge is max age of checkpoint to be resumed. Pagination cursor of OTX API is not guaranteed to be valid for a long time.
+const DefaultCheckpointMaxAge = 24 * time.Hour
+
+// WithCheckpointMaxAge sets max age of checkpoint from its last update. An older checkpoint is not resumed from the next page, and the run restarts from the start time of the checkpoint with a fresh cursor. Latest record time seen in the run is kept. Zero or negative value means the checkpoint never expires.
+func WithCheckpointMaxAge(maxAge time.Duration) Option {
+	return func(x *Subscribed) {
+		x.checkpointMaxAge = maxAge
+	}
 }
 
-func NewSubscribed(apiKey string) *Subscribed {
-	return &Subscribed{
-		apiKey:  apiKey,
-		baseURL: utils.Must1(url.Parse("https://otx.alienvault.com")),
+// WithSince overrides the latest record time stored in the database. It is used as modified_since parameter of the API.
+func WithSince(since time.Time) Option {
+	return func(x *Subscribed) {
+		x.since = &since
+	}
+}
+
+// WithDedupMode sets deduplication mode. Default is types.DedupWatermark. In hash based modes, a pulse is identified by its ID and re-inserted only when its content is changed.
+func WithDedupMode(mode types.DedupMode) Option {
+	return func(x *Subscribed) {
+		x.dedupMode = mode
+	}
+}
+
+// WithParseErrorPolicy sets how to handle pulses that can not be parsed. Default is types.ParseErrorFail.
+func WithParseErrorPolicy(policy types.ParseErrorPolicy) Option {
+	return func(x *Subscribed) {
+		x.parseErrorPolicy = policy
+	}
+}
+
+// WithBaseURL overrides base URL of OTX API, e.g. for API gateway.
+func WithBaseURL(baseURL *url.URL) Option {
+	return func(x *Subscribed) {
+		x.baseURL = baseURL
+	}
+}
+
+func NewSubscribed(apiKey string, options ...Option) *Subscribed {
+	x := &Subscribed{
+		apiKey:           apiKey,
+		baseURL:          utils.Must1(url.Parse(DefaultBaseURL)),
+		dedupMode:        types.DedupWatermark,
+		parseErrorPolicy: types.ParseErrorFail,
+		checkpointMaxAge: DefaultCheckpointMaxAge,
+	}
+	for _, opt := range options {
+		opt(x)
 	}
+	return x
 }
 
 const (
+	DefaultBaseURL = "https://otx.alienvault.com"
+
 	initialPeriod = 24 * time.Hour * 30
+
+	pulseTable = "otx_pulses"
 )
 
-func (x *Subscribed) Import(ctx context.Context, clients *infra.Clients) error {
-	const (
-		pulseTable = "otx_pulses"
-	)
+// pulseSchemaSample is a sample to infer schema of otx_pulses table. Each slice has one element because bqs.Infer can not infer type of empty slice.
+var pulseSchemaSample = &PulseLog{
+	Pulse: Pulse{
+		AttackIds:         []string{""},
+		Indicators:        []Indicator{{}},
+		Industries:        []string{""},
+		MalwareFamilies:   []string{""},
+		References:        []string{""},
+		Tags:              []string{""},
+		TargetedCountries: []string{""},
+	},
+}
 
-	schema, err := bqs.Infer(&PulseLog{})
+// SubscribedTables returns BigQuery tables written by Subscribed import. Change table of dedup mode is not included because it's used only in the mode.
+func SubscribedTables() ([]*model.Table, error) {
+	schema, err := bqs.Infer(pulseSchemaSample)
 	if err != nil {
-		return goerr.Wrap(err, "Fail to infer schema")
+		return nil, goerr.Wrap(err, "Fail to infer schema").With("table", pulseTable)
 	}
 
-	if err := clients.BigQuery().CreateOrUpdateSchema(ctx, pulseTable, schema); err != nil {
-		return goerr.Wrap(err, "Fail to migrate pulse table")
+	return []*model.Table{
+		{Name: pulseTable, Schema: schema, Spec: pulseTableSpec},
+	}, nil
+}
+
+// pulseTableSpec is a layout of otx_pulses table. Pulses are partitioned by modified time because a pulse is inserted again when it is modified.
+var pulseTableSpec = &model.TableSpec{
+	PartitionField:   "Modified",
+	PartitionType:    bigquery.DayPartitioningType,
+	ClusteringFields: []string{"ID"},
+}
+
+// Import imports pulses modified since the latest record time. Pagination cursor is checkpointed after each page, and an interrupted run is resumed from the checkpoint unless since is overridden. The latest record time is committed when all pages are imported. The returned summary is not nil even if import fails, and it has counts until the failure.
+func (x *Subscribed) Import(ctx context.Context, clients *infra.Clients) (*model.ImportSummary, error) {
+	summary := model.NewImportSummary(types.FeedOTXSubscribed)
+
+	schema, err := bqs.Infer(pulseSchemaSample)
+	if err != nil {
+		return summary, goerr.Wrap(err, "Fail to infer schema")
 	}
 
-	var since time.Time
-	if log, err := clients.Database().GetLatestImportLog(ctx, types.FeedOTXSubscribed); err != nil {
-		return goerr.Wrap(err, "Fail to get latest time of pulse table")
-	} else if log != nil {
-		since = log.LatestRecord
-	} else {
-		since = time.Now().Add(-initialPeriod)
+	if err := clients.BigQuery().CreateOrUpdateSchema(ctx, pulseTable, schema, pulseTableSpec); err != nil {
+		return summary, goerr.Wrap(err, "Fail to migrate pulse table")
 	}
 
-	utils.Logger().Info("Start to import Subscribed", "since", since)
+	var checkpoint *model.ImportCheckpoint
+	if x.since == nil {
+		// Overridden since starts a new run, then the stored checkpoint is overwritten
+		cp, err := clients.Database().GetImportCheckpoint(ctx, types.FeedOTXSubscribed)
+		if err != nil {
+			return summary, goerr.Wrap(err, "Fail to get import checkpoint")
+		}
+		checkpoint = cp
+	}
 
-	sinceText := since.Format("2006-01-02T15:04:05.999+00:00")
-	target := *x.baseURL
-	target.Path = "/api/v1/pulses/subscribed"
-	queryParam := url.Values{}
-	queryParam.Add("limit", "50")
-	queryParam.Add("modified_since", sinceText)
-	target.RawQuery = queryParam.Encode()
+	if checkpoint != nil && x.checkpointMaxAge > 0 && time.Now().Sub(checkpoint.UpdatedAt) > x.checkpointMaxAge {
+		utils.Logger().WarnContext(ctx, "Checkpoint is expired, restart the run with a fresh cursor",
+			"since", checkpoint.Since,
+			"page", checkpoint.Page,
+			"checkpointed_at", checkpoint.UpdatedAt,
+			"max_age", x.checkpointMaxAge,
+		)
+		checkpoint = &model.ImportCheckpoint{
+			Since:          checkpoint.Since,
+			NextURL:        x.firstPageURL(checkpoint.Since),
+			LatestRecord:   checkpoint.LatestRecord,
+			EarliestFailed: checkpoint.EarliestFailed,
+		}
+	}
 
-	var latest *time.Time
+	if checkpoint != nil {
+		summary.PreviousWatermark = &checkpoint.Since
+		utils.Logger().InfoContext(ctx, "Resume interrupted import of Subscribed",
+			"since", checkpoint.Since,
+			"page", checkpoint.Page,
+			"checkpointed_at", checkpoint.UpdatedAt,
+		)
+	} else {
+		var since time.Time
+		if x.since != nil {
+			since = *x.since
+			summary.PreviousWatermark = x.since
+		} else if log, err := clients.Database().GetLatestImportLog(ctx, types.FeedOTXSubscribed); err != nil {
+			return summary, goerr.Wrap(err, "Fail to get latest time of pulse table")
+		} else if log != nil {
+			since = log.LatestRecord
+			summary.PreviousWatermark = &log.LatestRecord
+		} else {
+			since = time.Now().Add(-initialPeriod)
+		}
+
+		utils.Logger().InfoContext(ctx, "Start to import Subscribed", "since", since)
 
+		checkpoint = &model.ImportCheckpoint{
+			Since:   since,
+			NextURL: x.firstPageURL(since),
+		}
+	}
+	summary.NewWatermark = summary.PreviousWatermark
+	deadLetters := deadletter.New(types.FeedOTXSubscribed, x.parseErrorPolicy, summary)
+
+	var inserted map[string]struct{}
+	if x.dedupMode == types.DedupWatermark && x.since == nil {
+		// Watermark stays before a pulse that failed to be inserted, then pulses after it may already be in the table
+		if inserted, err = insertedPulses(ctx, clients, checkpoint.Since); err != nil {
+			return summary, err
+		}
+	}
+
+	// Pages are not ordered by modified time, then watermark is committed only when all pages are imported. Otherwise, pulses in unseen pages older than the watermark would be skipped permanently after a crash.
 	for {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+		apiResp, pageLatest, pageFailed, err := x.importPage(ctx, clients, summary, deadLetters, inserted, checkpoint.NextURL, checkpoint.Page+1)
 		if err != nil {
-			return goerr.Wrap(err, "Fail to create request")
+			return summary, err
+		}
+		checkpoint.Page++
+		if pageLatest != nil && checkpoint.LatestRecord.Before(*pageLatest) {
+			checkpoint.LatestRecord = *pageLatest
 		}
+		checkpoint.EarliestFailed = model.EarliestTime(checkpoint.EarliestFailed, pageFailed)
 
-		req.Header.Set("X-OTX-API-KEY", x.apiKey)
+		if apiResp.Next == "" {
+			break
+		}
+		if _, err := url.Parse(apiResp.Next); err != nil {
+			return summary, goerr.Wrap(err, "Fail to parse next URL").With("url", apiResp.Next)
+		}
 
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return goerr.Wrap(err, "Fail to get Subscribed")
+		checkpoint.NextURL = apiResp.Next
+		checkpoint.UpdatedAt = time.Now()
+		if err := clients.Database().PutImportCheckpoint(ctx, types.FeedOTXSubscribed, checkpoint); err != nil {
+			return summary, goerr.Wrap(err, "Fail to put import checkpoint").With("page", checkpoint.Page)
 		}
-		defer resp.Body.Close()
+	}
 
-		var apiResp SubscribedResponse
-		if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-			return goerr.Wrap(err, "Fail to decode response body")
+	if !checkpoint.LatestRecord.IsZero() {
+		// Pulses that failed to be inserted are fetched again by modified_since in next import
+		latest := model.WatermarkBefore(checkpoint.LatestRecord, checkpoint.EarliestFailed)
+		log := model.ImportLog{
+			CheckedAt:    time.Now(),
+			LatestRecord: latest,
+		}
+		if err := clients.Database().PutImportLog(ctx, types.FeedOTXSubscribed, &log); err != nil {
+			return summary, goerr.Wrap(err, "Fail to put latest time")
 		}
+		if summary.PreviousWatermark == nil || latest.After(*summary.PreviousWatermark) {
+			summary.NewWatermark = &latest
+		}
+	}
 
-		var pulseLogs []PulseLog
-		for _, pulse := range apiResp.Results {
-			created, err := time.Parse("2006-01-02T15:04:05.999999", pulse.Created)
-			if err != nil {
-				return goerr.Wrap(err, "Fail to parse created time").With("time", pulse.Created)
-			}
+	if err := clients.Database().DeleteImportCheckpoint(ctx, types.FeedOTXSubscribed); err != nil {
+		return summary, goerr.Wrap(err, "Fail to delete import checkpoint")
+	}
 
-			// 2023-12-30T15:02:44.778000
-			modified, err := time.Parse("2006-01-02T15:04:05.999999", pulse.Modified)
-			if err != nil {
-				return goerr.Wrap(err, "Fail to parse modified time").With("time", pulse.Modified)
-			}
-			if latest == nil || latest.Before(modified) {
-				latest = &modified
-			}
+	return summary, nil
+}
 
-			pulseLogs = append(pulseLogs, PulseLog{
-				Pulse:    pulse,
-				Created:  created,
-				Modified: modified,
-			})
-		}
-		utils.Logger().Info("Subscribed",
-			"count", apiResp.Count,
-			"next", apiResp.Next,
-			"len(results)", len(apiResp.Results),
-			"len(pulseLogs)", len(pulseLogs),
-		)
+// firstPageURL returns URL of the first page of pulses modified since the time.
+func (x *Subscribed) firstPageURL(since time.Time) string {
+	target := *x.baseURL
+	target.Path = path.Join(x.baseURL.Path, "/api/v1/pulses/subscribed")
+	queryParam := url.Values{}
+	queryParam.Add("limit", "50")
+	queryParam.Add("modified_since", since.Format("2006-01-02T15:04:05.999+00:00"))
+	target.RawQuery = queryParam.Encode()
+	return target.String()
+}
 
-		if err := clients.BigQuery().Insert(ctx, pulseTable, pulseLogs); err != nil {
-			return goerr.Wrap(err, "Fail to insert pulse logs")
+// insertedPulsesQuery selects revisions of pulses modified after the time.
+const insertedPulsesQuery = "SELECT ID, Modified FROM " + pulseTable + `
+WHERE Modified > @since`
+
+// insertedPulses returns keys of pulse revisions modified after since that are already in pulse table.
+func insertedPulses(ctx context.Context, clients *infra.Clients, since time.Time) (map[string]struct{}, error) {
+	rows, err := clients.BigQuery().Query(ctx, insertedPulsesQuery, []bigquery.QueryParameter{
+		{Name: "since", Value: since},
+	})
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to query inserted pulses").With("since", since)
+	}
+
+	inserted := make(map[string]struct{}, len(rows))
+	for _, row := range rows {
+		id, _ := row["ID"].(string)
+		modified, _ := row["Modified"].(time.Time)
+		inserted[pulseRevisionKey(id, modified)] = struct{}{}
+	}
+	return inserted, nil
+}
+
+// pulseRevisionKey identifies a revision of a pulse by ID and modified time.
+func pulseRevisionKey(id string, modified time.Time) string {
+	return fmt.Sprintf("%s@%d", id, modified.UnixMicro())
+}
+
+// importPage fetches a page of subscribed pulses and inserts them in a span of the page. In watermark mode, pulses in inserted are skipped. It returns the response, the latest modified time of pulses in the page and the earliest modified time of pulses that failed to be inserted.
+func (x *Subscribed) importPage(ctx context.Context, clients *infra.Clients, summary *model.ImportSummary, deadLetters *deadletter.Handler, inserted map[string]struct{}, pageURL string, page int) (_ *SubscribedResponse, latest, earliestFailed *time.Time, err error) {
+	ctx, span := utils.StartSpan(ctx, "otx.subscribed.page",
+		utils.AttrFeedID.String(types.FeedOTXSubscribed.String()),
+		utils.AttrPage.Int(page),
+	)
+	defer func() { utils.EndSpan(span, err) }()
+
+	resp, err := clients.HTTP().Fetch(ctx, &httpfetch.Request{
+		Provider: httpfetch.ProviderOTX,
+		URL:      pageURL,
+		Header: http.Header{
+			"X-OTX-API-KEY": []string{x.apiKey},
+		},
+	})
+	if err != nil {
+		return nil, nil, nil, goerr.Wrap(err, "Fail to get Subscribed")
+	}
+	summary.PagesFetched++
+
+	// Archive is a copy for reprocessing, then failure of archive does not stop import
+	if err := clients.Archive().Put(ctx, model.NewArchiveKey(summary, page), resp.Body); err != nil {
+		summary.Warn("failed to archive response of page %d: %s", page, err.Error())
+	}
+
+	apiResp, pulseLogs, latest, err := parsePulses(ctx, resp.Body, deadLetters)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := deadLetters.Flush(ctx, clients.BigQuery()); err != nil {
+		return nil, nil, nil, err
+	}
+	summary.RecordsParsed += len(pulseLogs)
+	span.SetAttributes(utils.AttrRows.Int(len(pulseLogs)))
+	utils.Logger().InfoContext(ctx, "Subscribed",
+		"page", page,
+		"count", apiResp.Count,
+		"next", apiResp.Next,
+		"len(results)", len(apiResp.Results),
+		"len(pulseLogs)", len(pulseLogs),
+	)
+
+	if x.dedupMode == types.DedupWatermark {
+		var newLogs []PulseLog
+		for i := range pulseLogs {
+			if _, ok := inserted[pulseRevisionKey(pulseLogs[i].ID, pulseLogs[i].Modified)]; !ok {
+				newLogs = append(newLogs, pulseLogs[i])
+			}
 		}
+		summary.RecordsSkipped += len(pulseLogs) - len(newLogs)
 
-		nextURL, err := url.Parse(apiResp.Next)
+		failed, err := summary.CheckInsert(clients.BigQuery().Insert(ctx, pulseTable, newLogs))
 		if err != nil {
-			return goerr.Wrap(err, "Fail to parse next URL")
+			return nil, nil, nil, goerr.Wrap(err, "Fail to insert pulse logs")
 		}
-		target = *nextURL
-
-		if latest != nil {
-			log := model.ImportLog{
-				CheckedAt:    time.Now(),
-				LatestRecord: *latest,
+		for _, idx := range failed {
+			earliestFailed = model.EarliestTime(earliestFailed, &newLogs[idx].Modified)
+		}
+		summary.RecordsInserted += len(newLogs) - len(failed)
+	} else if len(pulseLogs) > 0 {
+		// Subscribed API returns only modified pulses, so removed pulses can not be detected.
+		_, failedKeys, err := dedup.Insert(ctx, clients, summary, types.FeedOTXSubscribed, x.dedupMode, pulseTable, pulseLogs, pulseKey, false)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		// Failed pulses are not returned by the API in next import unless watermark stays before them
+		failedPulses := make(map[string]struct{}, len(failedKeys))
+		for _, key := range failedKeys {
+			failedPulses[key] = struct{}{}
+		}
+		for i := range pulseLogs {
+			if _, ok := failedPulses[pulseKey(&pulseLogs[i])]; ok {
+				earliestFailed = model.EarliestTime(earliestFailed, &pulseLogs[i].Modified)
 			}
-			if err := clients.Database().PutImportLog(ctx, types.FeedOTXSubscribed, &log); err != nil {
-				return goerr.Wrap(err, "Fail to put latest time")
+		}
+	}
+
+	return apiResp, latest, earliestFailed, nil
+}
+
+// parsePulses decodes a response of Subscribed API and converts pulses to pulse logs. A pulse that can not be parsed is handled by deadLetters. It returns the latest modified time of the pulses.
+func parsePulses(ctx context.Context, body []byte, deadLetters *deadletter.Handler) (_ *SubscribedResponse, _ []PulseLog, _ *time.Time, err error) {
+	_, span := utils.StartSpan(ctx, "otx.subscribed.transform")
+	defer func() { utils.EndSpan(span, err) }()
+
+	var apiResp SubscribedResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, nil, nil, goerr.Wrap(err, "Fail to decode response body")
+	}
+
+	var latest *time.Time
+	var pulseLogs []PulseLog
+	for _, raw := range apiResp.Results {
+		pulseLog, err := parsePulse(raw)
+		if err != nil {
+			if err := deadLetters.Handle(ctx, raw, err); err != nil {
+				return nil, nil, nil, err
 			}
+			continue
 		}
 
-		if apiResp.Next == "" {
-			break
+		if latest == nil || latest.Before(pulseLog.Modified) {
+			latest = &pulseLog.Modified
 		}
+		pulseLogs = append(pulseLogs, *pulseLog)
 	}
+	span.SetAttributes(utils.AttrRows.Int(len(pulseLogs)))
+
+	return &apiResp, pulseLogs, latest, nil
+}
+
+func parsePulse(raw json.RawMessage) (*PulseLog, error) {
+	var pulse Pulse
+	if err := json.Unmarshal(raw, &pulse); err != nil {
+		return nil, goerr.Wrap(err, "Fail to decode pulse")
+	}
+
+	created, err := time.Parse("2006-01-02T15:04:05.999999", pulse.Created)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to parse created time").With("pulse", pulse.ID).With("time", pulse.Created)
+	}
+
+	// 2023-12-30T15:02:44.778000
+	modified, err := time.Parse("2006-01-02T15:04:05.999999", pulse.Modified)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to parse modified time").With("pulse", pulse.ID).With("time", pulse.Modified)
+	}
+
+	return &PulseLog{
+		Pulse:      pulse,
+		Created:    created,
+		Modified:   modified,
+		ImportedAt: time.Now().UTC(),
+	}, nil
+}
+
+// ReplaySubscribed transforms an archived response body of Subscribed API by the current transform and inserts pulse logs in the same way as Import by dedup mode. Record hashes of hash based modes are stored into clients.Database(), then the database must be scoped to the replay. Import state such as watermark and checkpoint is not changed.
+func ReplaySubscribed(ctx context.Context, clients *infra.Clients, summary *model.ImportSummary, deadLetters *deadletter.Handler, mode types.DedupMode, body []byte) error {
+	_, pulseLogs, _, err := parsePulses(ctx, body, deadLetters)
+	if err != nil {
+		return err
+	}
+	if err := deadLetters.Flush(ctx, clients.BigQuery()); err != nil {
+		return err
+	}
+	summary.RecordsParsed += len(pulseLogs)
+	if len(pulseLogs) == 0 {
+		return nil
+	}
+
+	if mode != types.DedupWatermark {
+		if _, _, err := dedup.Insert(ctx, clients, summary, types.FeedOTXSubscribed, mode, pulseTable, pulseLogs, pulseKey, false); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	failed, err := summary.CheckInsert(clients.BigQuery().Insert(ctx, pulseTable, pulseLogs))
+	if err != nil {
+		return goerr.Wrap(err, "Fail to insert pulse logs")
+	}
+	summary.RecordsInserted += len(pulseLogs) - len(failed)
 
 	return nil
 }
 
+// pulseKey returns a key of pulse log. A pulse is identified by pulse ID.
+func pulseKey(pulse *PulseLog) string {
+	return pulse.ID
+}
+
 type SubscribedResponse struct {
 	Count            int64       `json:"count" bigquery:"count"`
 	Next             string      `json:"next" bigquery:"next"`
 	PrefetchPulseIds bool        `json:"prefetch_pulse_ids" bigquery:"prefetch_pulse_ids"`
 	Previous         interface{} `json:"previous" bigquery:"previous"`
-	Results          []Pulse     `json:"results" bigquery:"results"`
+	// Results are decoded into Pulse one by one, then a malformed pulse does not fail the whole page.
+	Results []json.RawMessage `json:"results" bigquery:"-"`
 }
 
 type Pulse struct {
@@ -176,6 +494,8 @@ type PulseLog struct {
 	Pulse
 	Created  time.Time `bigquery:"created"`
 	Modified time.Time `bigquery:"modified"`
+	// ImportedAt is time when the pulse was fetched. It's excluded from JSON not to change content hash of the pulse.
+	ImportedAt time.Time `json:"-"`
 }
 
 type Indicator struct {
@@ -190,3 +510,68 @@ type Indicator struct {
 	Title       string `json:"title" bigquery:"title"`
 	Type        string `json:"type" bigquery:"type"`
 }
+
+// latestPulses is a subquery of the latest revision of each pulse. Indicators are unnested from it because an indicator removed from a modified pulse remains in older revisions.
+const latestPulses = `(
+  SELECT * FROM {{ table "` + pulseTable + `" }}
+  WHERE TRUE
+  QUALIFY ROW_NUMBER() OVER (PARTITION BY ID ORDER BY Modified DESC) = 1
+)`
+
+// SubscribedViews returns BigQuery views over tables of Subscribed import.
+func SubscribedViews() []*model.View {
+	return []*model.View{
+		{
+			Name:        "otx_indicators",
+			Description: "Indicators of OTX subscribed pulses, one row per indicator of the latest revision of each pulse",
+			Query: `SELECT
+  p.ID AS PulseID,
+  p.Name AS PulseName,
+  p.AuthorName,
+  p.Tlp,
+  p.Tags,
+  p.MalwareFamilies,
+  p.Modified AS PulseModified,
+  i.ID AS IndicatorID,
+  i.Type,
+  i.Indicator,
+  i.Title,
+  i.Role,
+  i.IsActive = 1 AS IsActive,
+  SAFE.PARSE_TIMESTAMP('%Y-%m-%dT%H:%M:%S', i.Created) AS Created,
+  SAFE.PARSE_TIMESTAMP('%Y-%m-%dT%H:%M:%S', i.Expiration) AS Expiration
+FROM ` + latestPulses + ` AS p, UNNEST(p.Indicators) AS i
+`,
+		},
+	}
+}
+
+// SubscribedAgingPolicy is a default aging policy of OTX indicators. It's applied to indicators that have no expiration in the pulse.
+var SubscribedAgingPolicy = model.AgingPolicy{
+	TTL:      90 * 24 * time.Hour,
+	HalfLife: 30 * 24 * time.Hour,
+}
+
+// SubscribedIndicators returns queries of indicators in OTX subscribed pulses for each indicator type. An indicator is selected from the latest revision of the pulse because a modified pulse is inserted again. LastSeen is modified time of the pulse, Tags are tags and malware families of the pulse, MalwareFamilies are malware families of the pulse, and indicators deactivated by the author have low confidence. Expiration is given by the author, and a deactivated indicator is expired at modified time of the pulse.
+func SubscribedIndicators() []*model.IndicatorSource {
+	query := func(otxTypes string) string {
+		return `SELECT
+  i.Indicator,
+  p.ID AS SightingKey,
+  COALESCE(SAFE.PARSE_TIMESTAMP('%Y-%m-%dT%H:%M:%S', i.Created), p.Created) AS FirstSeen,
+  p.Modified AS LastSeen,
+  IF(i.IsActive = 1, SAFE.PARSE_TIMESTAMP('%Y-%m-%dT%H:%M:%S', i.Expiration), p.Modified) AS Expiration,
+  IF(i.IsActive = 1, 70, 30) AS Confidence,
+  ARRAY_CONCAT(p.Tags, p.MalwareFamilies) AS Tags,
+  p.MalwareFamilies
+FROM ` + latestPulses + ` AS p, UNNEST(p.Indicators) AS i
+WHERE i.Type IN (` + otxTypes + ")"
+	}
+
+	return []*model.IndicatorSource{
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorIP, Query: query(`'IPv4', 'IPv6'`), Aging: SubscribedAgingPolicy},
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorDomain, Query: query(`'domain', 'hostname'`), Aging: SubscribedAgingPolicy},
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorURL, Query: query(`'URL'`), Aging: SubscribedAgingPolicy},
+		{Feed: types.FeedOTXSubscribed, Type: types.IndicatorHash, Query: query(`'FileHash-MD5', 'FileHash-SHA1', 'FileHash-SHA256'`), Aging: SubscribedAgingPolicy},
+	}
+}
@@ -2,15 +2,237 @@ package otx_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/url"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/deadletter"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
 	"github.com/m-mizutani/drone/pkg/feed/otx"
 	"github.com/m-mizutani/drone/pkg/infra"
+	"github.com/m-mizutani/drone/pkg/infra/archive"
 	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/infra/cassette"
+	"github.com/m-mizutani/drone/pkg/infra/httpfetch"
 	"github.com/m-mizutani/drone/pkg/utils"
 	"github.com/m-mizutani/gt"
 )
 
+var record = flag.Bool("record", false, "record fixtures from live OTX API (TEST_OTX_API_KEY is required)")
+
+// subscribedCassette is a hand-written fixture in the format of Subscribed API with documentation addresses. It's replaced with a live response by -record.
+const subscribedCassette = "testdata/subscribed.json"
+
+// modified_since depends on current time, then it's ignored in matching
+var cassetteOptions = []cassette.Option{
+	cassette.WithIgnoreQuery("modified_since"),
+}
+
+// maxPulses is a number of pulses per page kept when a live response is recorded.
+const maxPulses = 3
+
+func trimPulses(body []byte) []byte {
+	var resp map[string]any
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return body
+	}
+	if results, ok := resp["results"].([]any); ok && len(results) > maxPulses {
+		resp["results"] = results[:maxPulses]
+	}
+	return utils.Must1(json.Marshal(resp))
+}
+
+func TestRecordSubscribed(t *testing.T) {
+	if !*record {
+		t.Skip("Run with -record to refresh fixture")
+	}
+	apiKey := utils.LookupEnv(t, "TEST_OTX_API_KEY")
+
+	recorder := cassette.NewRecorder(nil, append(cassetteOptions, cassette.WithSanitizer(trimPulses))...)
+	clients := infra.New(
+		infra.WithBigQuery(bq.NewMock()),
+		infra.WithHTTP(httpfetch.New(httpfetch.WithTransport(recorder))),
+	)
+
+	gt.R1(otx.NewSubscribed(apiKey).Import(context.Background(), clients)).NoError(t)
+	gt.NoError(t, recorder.Save(subscribedCassette))
+}
+
+func TestSubscribed(t *testing.T) {
+	srv := cassette.NewServer(t, subscribedCassette, cassetteOptions...)
+	mock := bq.NewMock()
+	clients := infra.New(infra.WithBigQuery(mock))
+	ctx := context.Background()
+
+	baseURL := gt.R1(url.Parse(srv.URL)).NoError(t)
+	summary := gt.R1(otx.NewSubscribed("dummy-api-key", otx.WithBaseURL(baseURL)).Import(ctx, clients)).NoError(t)
+	gt.V(t, summary.PagesFetched).Equal(2)
+	gt.V(t, summary.RecordsParsed).Equal(3)
+	gt.V(t, summary.RecordsInserted).Equal(3)
+	gt.V(t, summary.PreviousWatermark).Nil()
+	gt.V(t, summary.NewWatermark).NotNil()
+
+	// Two pages are inserted separately
+	gt.A(t, mock.InsertedTable["otx_pulses"]).Length(2).
+		At(0, func(t testing.TB, v any) {
+			pulses := gt.Cast[[]otx.PulseLog](t, v)
+			gt.A(t, pulses).Length(2).At(0, func(t testing.TB, v otx.PulseLog) {
+				gt.V(t, v.ID).Equal("65a3b1c2d4e5f60718293a4b")
+				gt.A(t, v.Indicators).Length(2)
+			})
+		}).
+		At(1, func(t testing.TB, v any) {
+			gt.A(t, gt.Cast[[]otx.PulseLog](t, v)).Length(1)
+		})
+
+	log := gt.R1(clients.Database().GetLatestImportLog(ctx, types.FeedOTXSubscribed)).NoError(t)
+	gt.V(t, log.LatestRecord.Format("2006-01-02T15:04:05")).Equal("2024-01-15T06:40:12")
+}
+
+func TestSubscribedResume(t *testing.T) {
+	srv := cassette.NewServer(t, subscribedCassette, cassetteOptions...)
+	mock := bq.NewMock()
+	clients := infra.New(infra.WithBigQuery(mock))
+	ctx := context.Background()
+	baseURL := gt.R1(url.Parse(srv.URL)).NoError(t)
+
+	// Crash at insert of the second page
+	mock.InsertFunc = func(tableName string, data any) error {
+		if len(mock.InsertedTable[tableName]) == 1 {
+			return errors.New("crashed")
+		}
+		return nil
+	}
+	summary, err := otx.NewSubscribed("dummy-api-key", otx.WithBaseURL(baseURL)).Import(ctx, clients)
+	gt.Error(t, err)
+	gt.V(t, summary.PagesFetched).Equal(2)
+	gt.V(t, summary.NewWatermark).Nil()
+
+	// Watermark is not committed until all pages are imported
+	gt.V(t, gt.R1(clients.Database().GetLatestImportLog(ctx, types.FeedOTXSubscribed)).NoError(t)).Nil()
+	checkpoint := gt.R1(clients.Database().GetImportCheckpoint(ctx, types.FeedOTXSubscribed)).NoError(t)
+	gt.V(t, checkpoint).NotNil()
+	gt.V(t, checkpoint.Page).Equal(1)
+	gt.V(t, checkpoint.NextURL).NotEqual("")
+
+	// Resume from the second page
+	mock.InsertFunc = nil
+	summary = gt.R1(otx.NewSubscribed("dummy-api-key", otx.WithBaseURL(baseURL)).Import(ctx, clients)).NoError(t)
+	gt.V(t, summary.PagesFetched).Equal(1)
+	gt.V(t, summary.RecordsInserted).Equal(1)
+	gt.True(t, summary.PreviousWatermark.Equal(checkpoint.Since))
+	gt.A(t, mock.InsertedTable["otx_pulses"]).Length(2)
+
+	log := gt.R1(clients.Database().GetLatestImportLog(ctx, types.FeedOTXSubscribed)).NoError(t)
+	gt.V(t, log.LatestRecord.Format("2006-01-02T15:04:05")).Equal("2024-01-15T06:40:12")
+	gt.V(t, gt.R1(clients.Database().GetImportCheckpoint(ctx, types.FeedOTXSubscribed)).NoError(t)).Nil()
+}
+
+func TestSubscribedCheckpointExpired(t *testing.T) {
+	srv := cassette.NewServer(t, subscribedCassette, cassetteOptions...)
+	mock := bq.NewMock()
+	clients := infra.New(infra.WithBigQuery(mock))
+	ctx := context.Background()
+	baseURL := gt.R1(url.Parse(srv.URL)).NoError(t)
+
+	// Checkpoint of a run interrupted long ago
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	seen := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	gt.NoError(t, clients.Database().PutImportCheckpoint(ctx, types.FeedOTXSubscribed, &model.ImportCheckpoint{
+		Since:        since,
+		NextURL:      srv.URL + "/api/v1/pulses/subscribed?page=99",
+		Page:         98,
+		LatestRecord: seen,
+		UpdatedAt:    time.Now().Add(-48 * time.Hour),
+	}))
+
+	// The run restarts from the first page, and the latest record seen in the run is kept
+	summary := gt.R1(otx.NewSubscribed("dummy-api-key", otx.WithBaseURL(baseURL), otx.WithCheckpointMaxAge(time.Hour)).Import(ctx, clients)).NoError(t)
+	gt.V(t, summary.PagesFetched).Equal(2)
+	gt.V(t, summary.RecordsInserted).Equal(3)
+	gt.True(t, summary.PreviousWatermark.Equal(since))
+
+	log := gt.R1(clients.Database().GetLatestImportLog(ctx, types.FeedOTXSubscribed)).NoError(t)
+	gt.True(t, log.LatestRecord.Equal(seen))
+	gt.V(t, gt.R1(clients.Database().GetImportCheckpoint(ctx, types.FeedOTXSubscribed)).NoError(t)).Nil()
+}
+
+func TestSubscribedPartialInsert(t *testing.T) {
+	srv := cassette.NewServer(t, subscribedCassette, cassetteOptions...)
+	mock := bq.NewMock()
+	clients := infra.New(infra.WithBigQuery(mock))
+	ctx := context.Background()
+	baseURL := gt.R1(url.Parse(srv.URL)).NoError(t)
+
+	// The second pulse of the first page is rejected by BigQuery
+	var rejected *otx.PulseLog
+	var rows []map[string]bigquery.Value
+	mock.InsertFunc = func(tableName string, data any) error {
+		pulses := data.([]otx.PulseLog)
+		if rejected == nil {
+			rejected = &pulses[1]
+			pulses = pulses[:1]
+		}
+		for _, pulse := range pulses {
+			rows = append(rows, map[string]bigquery.Value{"ID": pulse.ID, "Modified": pulse.Modified})
+		}
+		if len(pulses) < len(data.([]otx.PulseLog)) {
+			return &types.PartialInsertError{Table: tableName, Total: 2, Rows: bigquery.PutMultiError{{RowIndex: 1}}}
+		}
+		return nil
+	}
+	mock.QueryFunc = func(query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+		return rows, nil
+	}
+
+	subscribed := otx.NewSubscribed("dummy-api-key", otx.WithBaseURL(baseURL))
+	summary := gt.R1(subscribed.Import(ctx, clients)).NoError(t)
+	gt.V(t, summary.RowsFailed).Equal(1)
+	gt.V(t, summary.RecordsInserted).Equal(2)
+
+	// Watermark stays before the rejected pulse to fetch it again
+	log := gt.R1(clients.Database().GetLatestImportLog(ctx, types.FeedOTXSubscribed)).NoError(t)
+	gt.True(t, log.LatestRecord.Before(rejected.Modified))
+	gt.True(t, summary.NewWatermark.Equal(log.LatestRecord))
+
+	// Only the rejected pulse is inserted in the next import, and pulses already in the table are skipped
+	summary = gt.R1(subscribed.Import(ctx, clients)).NoError(t)
+	gt.V(t, summary.RecordsInserted).Equal(1)
+	gt.V(t, summary.RecordsSkipped).Equal(2)
+}
+
+func TestSubscribedArchive(t *testing.T) {
+	srv := cassette.NewServer(t, subscribedCassette, cassetteOptions...)
+	arc := archive.NewDir(t.TempDir())
+	clients := infra.New(infra.WithBigQuery(bq.NewMock()), infra.WithArchive(arc))
+	ctx := context.Background()
+	baseURL := gt.R1(url.Parse(srv.URL)).NoError(t)
+
+	summary := gt.R1(otx.NewSubscribed("dummy-api-key", otx.WithBaseURL(baseURL)).Import(ctx, clients)).NoError(t)
+
+	// Each page is archived with run ID of the import
+	keys := gt.R1(arc.List(ctx, types.FeedOTXSubscribed)).NoError(t)
+	gt.A(t, keys).Length(2).At(1, func(t testing.TB, v *model.ArchiveKey) {
+		gt.V(t, v.RunID).Equal(summary.RunID)
+		gt.V(t, v.Page).Equal(2)
+	})
+
+	mock := bq.NewMock()
+	replayed := model.NewImportSummary(types.FeedOTXSubscribed)
+	deadLetters := deadletter.New(types.FeedOTXSubscribed, types.ParseErrorFail, replayed)
+	for _, key := range keys {
+		body := gt.R1(arc.Get(ctx, key)).NoError(t)
+		gt.NoError(t, otx.ReplaySubscribed(ctx, infra.New(infra.WithBigQuery(mock)), replayed, deadLetters, types.DedupWatermark, body))
+	}
+	gt.V(t, replayed.RecordsInserted).Equal(summary.RecordsInserted)
+	gt.A(t, mock.InsertedTable["otx_pulses"]).Length(2)
+}
+
 func TestSubscribedIntegration(t *testing.T) {
 	var (
 		bqProjectID string
@@ -30,5 +252,5 @@ func TestSubscribedIntegration(t *testing.T) {
 	bqClient := gt.R1(bq.New(ctx, bqProjectID, bqDatasetID)).NoError(t)
 	clients := infra.New(infra.WithBigQuery(bqClient))
 
-	gt.NoError(t, otx.NewSubscribed(apiKey).Import(ctx, clients))
+	gt.R1(otx.NewSubscribed(apiKey).Import(ctx, clients)).NoError(t)
 }
@@ -0,0 +1,196 @@
+// Package archive stores raw response bodies of feeds into a local directory or Google Cloud Storage. A body is compressed by gzip and stored as <feed>/<run time>_<run ID>/<page>.json.gz, then archived runs can be listed in order of time.
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+// store is a backend of archive that reads and writes objects by slash separated name.
+type store interface {
+	write(ctx context.Context, name string, data []byte) error
+	read(ctx context.Context, name string) ([]byte, error)
+	// list returns names of all objects under prefix. prefix is a directory name ending with slash.
+	list(ctx context.Context, prefix string) ([]string, error)
+}
+
+type Archive struct {
+	store store
+}
+
+var _ interfaces.Archive = &Archive{}
+
+// New returns Archive by URI. gs://bucket/prefix means Google Cloud Storage, and file:///path or a plain path means local directory. Cloud Storage client uses Application Default Credentials, and STORAGE_EMULATOR_HOST for compatible object stores.
+func New(ctx context.Context, uri string) (*Archive, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "invalid archive URI").With("uri", uri)
+	}
+
+	switch u.Scheme {
+	case "gs":
+		if u.Host == "" {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "bucket is required in archive URI").With("uri", uri)
+		}
+		return NewGCS(ctx, u.Host, strings.Trim(u.Path, "/"))
+	case "file":
+		return NewDir(u.Path), nil
+	case "":
+		return NewDir(uri), nil
+	default:
+		return nil, goerr.Wrap(types.ErrInvalidOption, "unsupported scheme of archive URI").With("uri", uri)
+	}
+}
+
+const (
+	runTimeFormat = "20060102T150405Z"
+	objectSuffix  = ".json.gz"
+)
+
+// objectName returns name of the object for key, e.g. otx-subscribed/20240101T000000Z_<run ID>/000001.json.gz
+func objectName(key *model.ArchiveKey) string {
+	run := key.RunAt.UTC().Format(runTimeFormat) + "_" + key.RunID
+	return path.Join(key.Feed.String(), run, fmt.Sprintf("%06d", key.Page)+objectSuffix)
+}
+
+// parseObjectName parses name created by objectName. It returns nil if name is not an archived body.
+func parseObjectName(name string) *model.ArchiveKey {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || !strings.HasSuffix(parts[2], objectSuffix) {
+		return nil
+	}
+
+	runAt, runID, ok := strings.Cut(parts[1], "_")
+	if !ok {
+		return nil
+	}
+	t, err := time.Parse(runTimeFormat, runAt)
+	if err != nil {
+		return nil
+	}
+	page, err := strconv.Atoi(strings.TrimSuffix(parts[2], objectSuffix))
+	if err != nil {
+		return nil
+	}
+
+	return &model.ArchiveKey{
+		Feed:  types.FeedID(parts[0]),
+		RunID: runID,
+		RunAt: t,
+		Page:  page,
+	}
+}
+
+// Put compresses body and stores it.
+func (x *Archive) Put(ctx context.Context, key *model.ArchiveKey, body []byte) (err error) {
+	name := objectName(key)
+	ctx, span := utils.StartSpan(ctx, "archive.Put", utils.AttrFeedID.String(key.Feed.String()), utils.AttrPage.Int(key.Page))
+	defer func() { utils.EndSpan(span, err) }()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(body); err != nil {
+		return goerr.Wrap(err, "Fail to compress body").With("name", name)
+	}
+	if err := w.Close(); err != nil {
+		return goerr.Wrap(err, "Fail to compress body").With("name", name)
+	}
+
+	if err := x.store.write(ctx, name, buf.Bytes()); err != nil {
+		return goerr.Wrap(err, "Fail to write archive").With("name", name)
+	}
+	return nil
+}
+
+// Close closes client of the backend if it has, e.g. Cloud Storage client.
+func (x *Archive) Close() error {
+	if c, ok := x.store.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return goerr.Wrap(err, "Fail to close archive")
+		}
+	}
+	return nil
+}
+
+// Get returns decompressed body of key.
+func (x *Archive) Get(ctx context.Context, key *model.ArchiveKey) (_ []byte, err error) {
+	name := objectName(key)
+	ctx, span := utils.StartSpan(ctx, "archive.Get", utils.AttrFeedID.String(key.Feed.String()), utils.AttrPage.Int(key.Page))
+	defer func() { utils.EndSpan(span, err) }()
+
+	data, err := x.store.read(ctx, name)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to read archive").With("name", name)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to decompress archive").With("name", name)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to decompress archive").With("name", name)
+	}
+	return body, nil
+}
+
+// List returns keys of the feed in order of run start time and page. Objects that are not created by Put are ignored.
+func (x *Archive) List(ctx context.Context, id types.FeedID) (_ []*model.ArchiveKey, err error) {
+	ctx, span := utils.StartSpan(ctx, "archive.List", utils.AttrFeedID.String(id.String()))
+	defer func() { utils.EndSpan(span, err) }()
+
+	names, err := x.store.list(ctx, id.String()+"/")
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to list archive").With("feed", id)
+	}
+
+	var keys []*model.ArchiveKey
+	for _, name := range names {
+		if key := parseObjectName(name); key != nil && key.Feed == id {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].RunAt.Equal(keys[j].RunAt) {
+			return keys[i].RunAt.Before(keys[j].RunAt)
+		}
+		if keys[i].RunID != keys[j].RunID {
+			return keys[i].RunID < keys[j].RunID
+		}
+		return keys[i].Page < keys[j].Page
+	})
+	span.SetAttributes(utils.AttrRows.Int(len(keys)))
+
+	return keys, nil
+}
+
+type discard struct{}
+
+func (discard) Put(ctx context.Context, key *model.ArchiveKey, body []byte) error { return nil }
+
+func (discard) Get(ctx context.Context, key *model.ArchiveKey) ([]byte, error) {
+	return nil, goerr.Wrap(types.ErrInvalidOption, "archive is not configured")
+}
+
+func (discard) List(ctx context.Context, id types.FeedID) ([]*model.ArchiveKey, error) {
+	return nil, nil
+}
+
+// Discard is an Archive that stores nothing. It's used if archive is not configured.
+var Discard interfaces.Archive = discard{}
@@ -0,0 +1,80 @@
+package archive_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/archive"
+	"github.com/m-mizutani/gt"
+)
+
+func TestDir(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	arc := archive.NewDir(root)
+
+	day1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	keys := []*model.ArchiveKey{
+		{Feed: types.FeedOTXSubscribed, RunID: "run-b", RunAt: day2, Page: 1},
+		{Feed: types.FeedOTXSubscribed, RunID: "run-a", RunAt: day1, Page: 2},
+		{Feed: types.FeedOTXSubscribed, RunID: "run-a", RunAt: day1, Page: 1},
+		{Feed: types.FeedAbuseChFeodo, RunID: "run-c", RunAt: day1, Page: 1},
+	}
+	for _, key := range keys {
+		gt.NoError(t, arc.Put(ctx, key, []byte(`{"run":"`+key.RunID+`"}`)))
+	}
+	// Files not created by Put are ignored
+	gt.NoError(t, os.WriteFile(filepath.Join(root, "otx-subscribed", "README"), []byte("x"), 0o600))
+
+	t.Run("body is compressed", func(t *testing.T) {
+		data := gt.R1(os.ReadFile(filepath.Join(root, "otx-subscribed", "20240101T000000Z_run-a", "000001.json.gz"))).NoError(t)
+		gt.A(t, data).Longer(2)
+		gt.V(t, data[0]).Equal(0x1f)
+		gt.V(t, data[1]).Equal(0x8b)
+	})
+
+	t.Run("keys are listed in order of run and page", func(t *testing.T) {
+		listed := gt.R1(arc.List(ctx, types.FeedOTXSubscribed)).NoError(t)
+		gt.A(t, listed).Length(3).
+			At(0, func(t testing.TB, v *model.ArchiveKey) {
+				gt.V(t, v.RunID).Equal("run-a")
+				gt.V(t, v.Page).Equal(1)
+				gt.V(t, v.RunAt.UTC()).Equal(day1)
+			}).
+			At(1, func(t testing.TB, v *model.ArchiveKey) {
+				gt.V(t, v.RunID).Equal("run-a")
+				gt.V(t, v.Page).Equal(2)
+			}).
+			At(2, func(t testing.TB, v *model.ArchiveKey) {
+				gt.V(t, v.RunID).Equal("run-b")
+			})
+
+		body := gt.R1(arc.Get(ctx, listed[2])).NoError(t)
+		gt.V(t, string(body)).Equal(`{"run":"run-b"}`)
+	})
+
+	t.Run("no archive of the feed", func(t *testing.T) {
+		listed := gt.R1(archive.NewDir(t.TempDir()).List(ctx, types.FeedOTXSubscribed)).NoError(t)
+		gt.A(t, listed).Length(0)
+	})
+}
+
+func TestNew(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := archive.New(ctx, "file://"+t.TempDir())
+	gt.NoError(t, err)
+	_, err = archive.New(ctx, t.TempDir())
+	gt.NoError(t, err)
+
+	_, err = archive.New(ctx, "gs:///prefix")
+	gt.Error(t, err)
+	_, err = archive.New(ctx, "s3://bucket/prefix")
+	gt.Error(t, err)
+}
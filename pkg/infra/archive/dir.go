@@ -0,0 +1,83 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/m-mizutani/goerr"
+)
+
+// dir is a store of local directory. It's also a stand-in of object store for development and tests.
+type dir struct {
+	root string
+}
+
+// NewDir returns Archive that stores bodies under root directory.
+func NewDir(root string) *Archive {
+	return &Archive{store: &dir{root: filepath.Clean(root)}}
+}
+
+func (x *dir) write(ctx context.Context, name string, data []byte) error {
+	fpath := filepath.Join(x.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fpath), 0o755); err != nil {
+		return goerr.Wrap(err, "Fail to create directory").With("path", fpath)
+	}
+
+	// Write into temporary file and rename it to avoid a partially written file
+	tmp, err := os.CreateTemp(filepath.Dir(fpath), ".tmp-*")
+	if err != nil {
+		return goerr.Wrap(err, "Fail to create temporary file").With("path", fpath)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return goerr.Wrap(err, "Fail to write file").With("path", fpath)
+	}
+	if err := tmp.Close(); err != nil {
+		return goerr.Wrap(err, "Fail to close file").With("path", fpath)
+	}
+	if err := os.Rename(tmp.Name(), fpath); err != nil {
+		return goerr.Wrap(err, "Fail to rename file").With("path", fpath)
+	}
+	return nil
+}
+
+func (x *dir) read(ctx context.Context, name string) ([]byte, error) {
+	fpath := filepath.Join(x.root, filepath.FromSlash(name))
+	data, err := os.ReadFile(filepath.Clean(fpath))
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to read file").With("path", fpath)
+	}
+	return data, nil
+}
+
+func (x *dir) list(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(filepath.Join(x.root, filepath.FromSlash(prefix)), func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(x.root, fpath)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to walk directory").With("root", x.root)
+	}
+
+	return names, nil
+}
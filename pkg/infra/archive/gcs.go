@@ -0,0 +1,94 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"google.golang.org/api/iterator"
+)
+
+// gcs is a store of Google Cloud Storage bucket. Objects are stored under prefix.
+type gcs struct {
+	client *storage.Client
+	bucket *storage.BucketHandle
+	prefix string
+}
+
+// NewGCS returns Archive that stores bodies into the bucket under prefix. prefix can be empty.
+func NewGCS(ctx context.Context, bucket, prefix string) (*Archive, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to create Cloud Storage client")
+	}
+
+	return &Archive{store: &gcs{
+		client: client,
+		bucket: client.Bucket(bucket),
+		prefix: prefix,
+	}}, nil
+}
+
+// Close closes Cloud Storage client.
+func (x *gcs) Close() error {
+	return x.client.Close()
+}
+
+func (x *gcs) objectName(name string) string {
+	return path.Join(x.prefix, name)
+}
+
+func (x *gcs) write(ctx context.Context, name string, data []byte) error {
+	w := x.bucket.Object(x.objectName(name)).NewWriter(ctx)
+	w.ContentType = "application/gzip"
+
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return goerr.Wrap(err, "Fail to write object").With("name", name)
+	}
+	if err := w.Close(); err != nil {
+		return goerr.Wrap(err, "Fail to write object").With("name", name)
+	}
+	return nil
+}
+
+func (x *gcs) read(ctx context.Context, name string) ([]byte, error) {
+	r, err := x.bucket.Object(x.objectName(name)).NewReader(ctx)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to open object").With("name", name)
+	}
+	defer utils.SafeClose(r)
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to read object").With("name", name)
+	}
+	return data, nil
+}
+
+func (x *gcs) list(ctx context.Context, prefix string) ([]string, error) {
+	it := x.bucket.Objects(ctx, &storage.Query{Prefix: x.objectName(prefix) + "/"})
+
+	var names []string
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, goerr.Wrap(err, "Fail to list objects").With("prefix", prefix)
+		}
+
+		name := attrs.Name
+		if x.prefix != "" {
+			name = strings.TrimPrefix(name, x.prefix+"/")
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
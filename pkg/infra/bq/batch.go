@@ -0,0 +1,109 @@
+package bq
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxRetries is maximum number of attempts for one batch.
+	maxRetries = 12
+	// initialRetryDelay is doubled on each retry.
+	initialRetryDelay = 100 * time.Millisecond
+)
+
+// toRows converts data given to Insert into a slice of rows. data must be a slice or a single row.
+func toRows(data any) ([]any, error) {
+	v := reflect.ValueOf(data)
+	if !v.IsValid() {
+		return nil, goerr.New("data is nil")
+	}
+
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []any{data}, nil
+	}
+
+	rows := make([]any, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		rows[i] = v.Index(i).Interface()
+	}
+	return rows, nil
+}
+
+// makeBatches splits row indexes into batches. Each batch has rows up to maxRows and total size up to maxBytes. A row larger than maxBytes makes a batch by itself.
+func makeBatches(indexes []int, sizes []int, maxRows, maxBytes int) [][]int {
+	var batches [][]int
+	var current []int
+	var currentBytes int
+
+	for i, idx := range indexes {
+		size := sizes[i]
+		if len(current) > 0 && (len(current) >= maxRows || currentBytes+size > maxBytes) {
+			batches = append(batches, current)
+			current, currentBytes = nil, 0
+		}
+		current = append(current, idx)
+		currentBytes += size
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+
+	return batches
+}
+
+// rowError creates a row error of PutMultiError.
+func rowError(rowIndex int, err error) bigquery.RowInsertionError {
+	return bigquery.RowInsertionError{
+		RowIndex: rowIndex,
+		Errors:   bigquery.MultiError{err},
+	}
+}
+
+// isRetryable returns true if err is a transient error of BigQuery API. Not found is also retryable because a table may not be ready just after creation.
+func isRetryable(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch gerr.Code {
+		case http.StatusNotFound, http.StatusTooManyRequests,
+			http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.NotFound, codes.Unavailable, codes.ResourceExhausted,
+			codes.Aborted, codes.Internal, codes.DeadlineExceeded:
+			return true
+		}
+	}
+
+	return false
+}
+
+// sleepRetry waits before the attempt with exponential backoff. It returns error if ctx is canceled.
+func sleepRetry(ctx context.Context, attempt int) error {
+	if attempt == 0 {
+		return nil
+	}
+
+	delay := initialRetryDelay << (attempt - 1)
+	select {
+	case <-ctx.Done():
+		return goerr.Wrap(ctx.Err(), "canceled while waiting retry")
+	case <-time.After(delay):
+		return nil
+	}
+}
@@ -2,47 +2,164 @@ package bq
 
 import (
 	"context"
-	"errors"
-	"time"
+	"strings"
+	"sync"
 
 	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
 	"github.com/m-mizutani/bqs"
 	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
 	"github.com/m-mizutani/drone/pkg/utils"
 	"github.com/m-mizutani/goerr"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
 type client struct {
-	dataSet *bigquery.Dataset
-	client  *bigquery.Client
+	projectID string
+	datasetID string
+	dataSet   *bigquery.Dataset
+	client    *bigquery.Client
+
+	clientOptions []option.ClientOption
+	writeMode     WriteMode
+	batchRows     int
+	batchBytes    int
+
+	writer     *managedwriter.Client
+	writerOnce sync.Once
+	writerErr  error
+
+	// resolved is a cache of physical table name for each table name
+	resolved sync.Map
 }
 
-func New(ctx context.Context, projectID, datasetID string, options ...option.ClientOption) (interfaces.BigQuery, error) {
-	c, err := bigquery.NewClient(ctx, projectID, options...)
+// WriteMode is a method to insert rows into BigQuery table.
+type WriteMode string
+
+const (
+	// WriteModeCommitted uses committed stream of Storage Write API. Rows are available immediately after each batch is appended.
+	WriteModeCommitted WriteMode = "committed"
+	// WriteModePending uses pending stream of Storage Write API. All batches of one Insert call are committed at once.
+	WriteModePending WriteMode = "pending"
+	// WriteModeStreaming uses legacy streaming insert (tabledata.insertAll).
+	WriteModeStreaming WriteMode = "streaming"
+)
+
+func (x WriteMode) Validate() error {
+	switch x {
+	case WriteModeCommitted, WriteModePending, WriteModeStreaming:
+		return nil
+	default:
+		return goerr.Wrap(types.ErrInvalidOption, "unknown write mode").With("mode", x)
+	}
+}
+
+const (
+	defaultBatchRows  = 500
+	defaultBatchBytes = 5 * 1024 * 1024
+)
+
+type Option func(*client)
+
+// WithClientOptions sets options for BigQuery and Storage Write API clients such as credentials.
+func WithClientOptions(options ...option.ClientOption) Option {
+	return func(x *client) {
+		x.clientOptions = append(x.clientOptions, options...)
+	}
+}
+
+// WithWriteMode sets write mode of Insert. Default is WriteModeCommitted.
+func WithWriteMode(mode WriteMode) Option {
+	return func(x *client) {
+		x.writeMode = mode
+	}
+}
+
+// WithBatchSize sets maximum number of rows and bytes in one batch of Insert. Zero or negative value means default.
+func WithBatchSize(rows, bytes int) Option {
+	return func(x *client) {
+		if rows > 0 {
+			x.batchRows = rows
+		}
+		if bytes > 0 {
+			x.batchBytes = bytes
+		}
+	}
+}
+
+func New(ctx context.Context, projectID, datasetID string, options ...Option) (interfaces.BigQuery, error) {
+	x := &client{
+		projectID:  projectID,
+		datasetID:  datasetID,
+		writeMode:  WriteModeCommitted,
+		batchRows:  defaultBatchRows,
+		batchBytes: defaultBatchBytes,
+	}
+	for _, opt := range options {
+		opt(x)
+	}
+	if err := x.writeMode.Validate(); err != nil {
+		return nil, err
+	}
+
+	c, err := bigquery.NewClient(ctx, projectID, x.clientOptions...)
 	if err != nil {
 		return nil, goerr.Wrap(err, "Fail to create BigQuery client")
 	}
 
-	dataSet := c.Dataset(datasetID)
+	x.client = c
+	x.dataSet = c.Dataset(datasetID)
 
-	return &client{
-		client:  c,
-		dataSet: dataSet,
-	}, nil
+	return x, nil
 }
 
-func (x *client) CreateOrUpdateSchema(ctx context.Context, tableName string, schema bigquery.Schema) error {
-	table := x.dataSet.Table(tableName)
-	md, err := table.Metadata(ctx)
-	if err != nil {
-		if gerr, ok := err.(*googleapi.Error); !ok || gerr.Code != 404 {
-			return goerr.Wrap(err, "failed to get metadata").With("table", tableName)
+// managedWriter returns Storage Write API client. It's created at the first call because it's not required in streaming mode.
+func (x *client) managedWriter(ctx context.Context) (*managedwriter.Client, error) {
+	x.writerOnce.Do(func() {
+		w, err := managedwriter.NewClient(ctx, x.projectID, x.clientOptions...)
+		if err != nil {
+			x.writerErr = goerr.Wrap(err, "Fail to create Storage Write API client")
+			return
+		}
+		x.writer = w
+	})
+
+	return x.writer, x.writerErr
+}
+
+// Close closes Storage Write API client if it has been created, and BigQuery client.
+func (x *client) Close() error {
+	if x.writer != nil {
+		if err := x.writer.Close(); err != nil {
+			return goerr.Wrap(err, "Fail to close Storage Write API client")
 		}
+	}
+	if err := x.client.Close(); err != nil {
+		return goerr.Wrap(err, "Fail to close BigQuery client")
+	}
+	return nil
+}
+
+// CreateOrUpdateSchema creates the table, or merges schema into the existing table. If the table is a view created by MigrateTable, the physical table is updated. Incompatible changes are not applied and types.ErrIncompatibleSchema is returned.
+func (x *client) CreateOrUpdateSchema(ctx context.Context, tableName string, schema bigquery.Schema, spec *model.TableSpec) (err error) {
+	ctx, span := utils.StartSpan(ctx, "bq.CreateOrUpdateSchema", utils.AttrTable.String(tableName))
+	defer func() { utils.EndSpan(span, err) }()
+
+	name, md, err := x.resolveTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	table := x.dataSet.Table(name)
 
+	if md == nil {
 		meta := &bigquery.TableMetadata{
-			Schema: schema,
+			Schema:           schema,
+			TimePartitioning: spec.TimePartitioning(),
+			Clustering:       spec.Clustering(),
 		}
 		if err := table.Create(ctx, meta); err != nil {
 			if gerr, ok := err.(*googleapi.Error); !ok || gerr.Code != 409 {
@@ -53,6 +170,18 @@ func (x *client) CreateOrUpdateSchema(ctx context.Context, tableName string, sch
 		return nil
 	}
 
+	validateTableSpec(tableName, md, spec)
+
+	var conflicts []string
+	for _, c := range DiffSchema(md.Schema, schema) {
+		if c.Kind == model.SchemaConflict {
+			conflicts = append(conflicts, c.String())
+		}
+	}
+	if len(conflicts) > 0 {
+		return goerr.Wrap(types.ErrIncompatibleSchema, "run `drone schema apply --migrate` to migrate the table").With("table", tableName).With("conflicts", conflicts)
+	}
+
 	merged, err := bqs.Merge(md.Schema, schema)
 	if err != nil {
 		return goerr.Wrap(err, "failed to merge schema").With("table", tableName)
@@ -68,44 +197,126 @@ func (x *client) CreateOrUpdateSchema(ctx context.Context, tableName string, sch
 	return nil
 }
 
-func (x *client) Insert(ctx context.Context, tableName string, data any) error {
-	if err := insertWithRetry(ctx, x.dataSet.Table(tableName), data); err != nil {
-		return goerr.Wrap(err, "Fail to insert data").With("table", tableName)
+// GetSchema returns schema of the physical table. If the table is a view created by MigrateTable, schema of the table referred by the view is returned.
+func (x *client) GetSchema(ctx context.Context, tableName string) (_ bigquery.Schema, err error) {
+	ctx, span := utils.StartSpan(ctx, "bq.GetSchema", utils.AttrTable.String(tableName))
+	defer func() { utils.EndSpan(span, err) }()
+
+	_, md, err := x.resolveTable(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if md == nil {
+		return nil, nil
 	}
 
-	return nil
+	return md.Schema, nil
 }
 
-func insertWithRetry(ctx context.Context, table *bigquery.Table, data any) error {
-	// Define the maximum number of retries and the initial delay.
-	const maxRetries = 12
-	initialDelay := time.Millisecond * 100
-
-	// Attempt to insert data with exponential backoff retry logic.
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		if attempt > 0 {
-			// Wait for the delay period before retrying.
-			time.Sleep(initialDelay)
-			// Increase the delay for the next retry.
-			initialDelay *= 2
+// Insert inserts data (a slice of struct or bigquery.ValueSaver) into the table. Rows are split into batches by number of rows and bytes. If some rows are failed to insert, other rows are still inserted and *types.PartialInsertError is returned.
+func (x *client) Insert(ctx context.Context, tableName string, data any) (err error) {
+	ctx, span := utils.StartSpan(ctx, "bq.Insert",
+		utils.AttrTable.String(tableName),
+		attribute.String("drone.write_mode", string(x.writeMode)),
+	)
+	defer func() { utils.EndSpan(span, err) }()
+
+	rows, err := toRows(data)
+	if err != nil {
+		return goerr.Wrap(err, "Fail to convert data to rows").With("table", tableName)
+	}
+	span.SetAttributes(utils.AttrRows.Int(len(rows)))
+	if len(rows) == 0 {
+		return nil
+	}
+
+	physical, err := x.physicalTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	var failed bigquery.PutMultiError
+	switch x.writeMode {
+	case WriteModeStreaming:
+		failed, err = x.insertStreaming(ctx, physical, rows)
+	default:
+		failed, err = x.insertStorageWrite(ctx, physical, rows)
+	}
+	if err != nil {
+		return goerr.Wrap(err, "Fail to insert data").With("table", tableName)
+	}
+
+	if len(failed) > 0 {
+		span.SetAttributes(attribute.Int("drone.rows_failed", len(failed)))
+		for _, rowErr := range failed {
+			utils.Logger().WarnContext(ctx, "Fail to insert row",
+				"table", tableName,
+				"row_index", rowErr.RowIndex,
+				"error", rowErr.Errors.Error(),
+			)
 		}
 
-		inserter := table.Inserter()
-		err := inserter.Put(ctx, data)
-		if err == nil {
-			// Data inserted successfully, no need to retry.
-			return nil
+		if len(failed) == len(rows) {
+			return goerr.Wrap(failed, "All rows are failed to insert").With("table", tableName)
 		}
+		return &types.PartialInsertError{
+			Table: tableName,
+			Total: len(rows),
+			Rows:  failed,
+		}
+	}
+
+	return nil
+}
 
-		if e, ok := err.(*googleapi.Error); ok && e.Code == 404 {
-			utils.Logger().Warn("Table not found, retrying", "table", table.FullyQualifiedName())
-			continue
+// validateTableSpec compares partitioning and clustering of the existing table with spec. Partitioning can not be changed after creation, then it only warns the difference.
+func validateTableSpec(tableName string, md *bigquery.TableMetadata, spec *model.TableSpec) {
+	logger := utils.Logger().With("table", tableName)
+
+	expected := spec.TimePartitioning()
+	actual := md.TimePartitioning
+	switch {
+	case expected == nil && actual != nil:
+		logger.Warn("Table is partitioned, but partitioning is not declared", "field", actual.Field, "type", actual.Type)
+	case expected != nil && actual == nil:
+		logger.Warn("Table is not partitioned, but partitioning is declared", "field", expected.Field, "type", expected.Type)
+	case expected != nil && actual != nil:
+		if !strings.EqualFold(expected.Field, actual.Field) || expected.Type != actual.Type {
+			logger.Warn("Partitioning of table differs from declaration",
+				"expected.field", expected.Field,
+				"expected.type", expected.Type,
+				"actual.field", actual.Field,
+				"actual.type", actual.Type,
+			)
+		}
+		if expected.Expiration != actual.Expiration {
+			logger.Warn("Partition expiration of table differs from declaration",
+				"expected", expected.Expiration,
+				"actual", actual.Expiration,
+			)
 		}
+	}
 
-		// If the error is not a 404, return it immediately without retrying.
-		return err
+	var expectedFields, actualFields []string
+	if c := spec.Clustering(); c != nil {
+		expectedFields = c.Fields
+	}
+	if md.Clustering != nil {
+		actualFields = md.Clustering.Fields
 	}
+	if !equalFoldSlice(expectedFields, actualFields) {
+		logger.Warn("Clustering of table differs from declaration", "expected", expectedFields, "actual", actualFields)
+	}
+}
 
-	// Data insertion failed after all retries.
-	return errors.New("insert failed: exceeded retry limit")
+func equalFoldSlice(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
 }
@@ -8,6 +8,7 @@ import (
 
 	"cloud.google.com/go/bigquery"
 	"github.com/m-mizutani/bqs"
+	"github.com/m-mizutani/drone/pkg/domain/model"
 	"github.com/m-mizutani/drone/pkg/infra/bq"
 	"github.com/m-mizutani/gt"
 )
@@ -41,8 +42,8 @@ func TestBigQuerySchemaUpdate(t *testing.T) {
 
 	s1 := gt.R1(bqs.Infer(&TestData1{})).NoError(t)
 	s2 := gt.R1(bqs.Infer(&TestData2{})).NoError(t)
-	gt.NoError(t, client.CreateOrUpdateSchema(ctx, tableID, s1))
-	gt.NoError(t, client.CreateOrUpdateSchema(ctx, tableID, s2))
+	gt.NoError(t, client.CreateOrUpdateSchema(ctx, tableID, s1, nil))
+	gt.NoError(t, client.CreateOrUpdateSchema(ctx, tableID, s2, nil))
 
 	md := gt.R1(table.Metadata(ctx)).NoError(t)
 	gt.A(t, md.Schema).Length(2).
@@ -57,3 +58,42 @@ func TestBigQuerySchemaUpdate(t *testing.T) {
 			gt.Equal(t, v.Type, bigquery.NumericFieldType)
 		})
 }
+
+func TestBigQueryTableSpec(t *testing.T) {
+	projectID, ok := os.LookupEnv("TEST_BIGQUERY_PROJECT_ID")
+	if !ok {
+		t.Skip("TEST_BIGQUERY_PROJECT_ID is not set")
+	}
+
+	datasetID, ok := os.LookupEnv("TEST_BIGQUERY_DATASET_ID")
+	if !ok {
+		t.Skip("TEST_BIGQUERY_DATASET_ID is not set")
+	}
+
+	ctx := context.Background()
+	client := gt.R1(bq.New(ctx, projectID, datasetID)).NoError(t)
+	bqClient := gt.R1(bigquery.NewClient(ctx, projectID)).NoError(t)
+
+	type TestData struct {
+		Name      string
+		CreatedAt time.Time
+	}
+
+	tableID := time.Now().Format("test_table_spec_20060102150405")
+	schema := gt.R1(bqs.Infer(&TestData{})).NoError(t)
+	spec := &model.TableSpec{
+		PartitionField:      "CreatedAt",
+		PartitionType:       bigquery.MonthPartitioningType,
+		PartitionExpiration: 24 * time.Hour * 365,
+		ClusteringFields:    []string{"Name"},
+	}
+	gt.NoError(t, client.CreateOrUpdateSchema(ctx, tableID, schema, spec))
+	// second call validates spec of existing table
+	gt.NoError(t, client.CreateOrUpdateSchema(ctx, tableID, schema, spec))
+
+	md := gt.R1(bqClient.Dataset(datasetID).Table(tableID).Metadata(ctx)).NoError(t)
+	gt.Equal(t, md.TimePartitioning.Field, "CreatedAt")
+	gt.Equal(t, md.TimePartitioning.Type, bigquery.MonthPartitioningType)
+	gt.Equal(t, md.TimePartitioning.Expiration, 24*time.Hour*365)
+	gt.Equal(t, md.Clustering.Fields, []string{"Name"})
+}
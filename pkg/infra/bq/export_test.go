@@ -0,0 +1,9 @@
+package bq
+
+var (
+	MakeBatches      = makeBatches
+	EncodeRow        = encodeRow
+	SchemaDescriptor = schemaDescriptor
+	EncodeNumeric    = encodeNumeric
+	CopyColumns      = copyColumns
+)
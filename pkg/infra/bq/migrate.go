@@ -0,0 +1,302 @@
+package bq
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"google.golang.org/api/googleapi"
+)
+
+// viewTargetLabel is a label of view created by MigrateTable. The value is name of the physical table that the view refers.
+const viewTargetLabel = "drone_table"
+
+var versionSuffix = regexp.MustCompile(`_v(\d+)$`)
+
+// resolveTable returns name and metadata of the physical table. If the table is a view created by MigrateTable, the table referred by the view is returned. Metadata is nil if the table does not exist.
+func (x *client) resolveTable(ctx context.Context, tableName string) (string, *bigquery.TableMetadata, error) {
+	md, err := x.dataSet.Table(tableName).Metadata(ctx)
+	if err != nil {
+		if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == 404 {
+			return tableName, nil, nil
+		}
+		return "", nil, goerr.Wrap(err, "failed to get metadata").With("table", tableName)
+	}
+
+	target, ok := md.Labels[viewTargetLabel]
+	if md.Type != bigquery.ViewTable || !ok {
+		return tableName, md, nil
+	}
+
+	targetMD, err := x.dataSet.Table(target).Metadata(ctx)
+	if err != nil {
+		return "", nil, goerr.Wrap(err, "failed to get metadata of view target").With("table", tableName).With("target", target)
+	}
+	return target, targetMD, nil
+}
+
+// physicalTable returns name of the physical table to insert rows. Resolved name is cached.
+func (x *client) physicalTable(ctx context.Context, tableName string) (string, error) {
+	if v, ok := x.resolved.Load(tableName); ok {
+		return v.(string), nil
+	}
+
+	name, _, err := x.resolveTable(ctx, tableName)
+	if err != nil {
+		return "", err
+	}
+	x.resolved.Store(tableName, name)
+	return name, nil
+}
+
+// MigrateTable creates a new version of the table with schema and spec, copies rows from the current version and swaps the view to the new version. If the table is not a view yet, the original table is kept as <table>_v1 and replaced with a view. The original table is deleted only after the view has been created under a temporary name, and it's restored from <table>_v1 if the view can not be created. The migration fails if the table or its current version has been modified during the migration. It returns name of the new physical table.
+func (x *client) MigrateTable(ctx context.Context, tableName string, schema bigquery.Schema, spec *model.TableSpec) (_ string, err error) {
+	ctx, span := utils.StartSpan(ctx, "bq.MigrateTable", utils.AttrTable.String(tableName))
+	defer func() { utils.EndSpan(span, err) }()
+
+	current, md, err := x.resolveTable(ctx, tableName)
+	if err != nil {
+		return "", err
+	}
+	if md == nil {
+		return "", goerr.New("table to migrate does not exist").With("table", tableName)
+	}
+	logger := utils.Logger().With("table", tableName)
+
+	version := 1
+	if m := versionSuffix.FindStringSubmatch(current); current != tableName && m != nil {
+		version, _ = strconv.Atoi(m[1])
+	}
+	newTable := fmt.Sprintf("%s_v%d", tableName, version+1)
+
+	// Keep the original table as the first version before any change, and copy rows from the snapshot
+	source := current
+	backup := tableName + "_v1"
+	if current == tableName {
+		copier := x.dataSet.Table(backup).CopierFrom(x.dataSet.Table(tableName))
+		copier.WriteDisposition = bigquery.WriteEmpty
+		if err := x.runJob(ctx, copier); err != nil {
+			return "", goerr.Wrap(err, "failed to back up original table").With("table", tableName).With("backup", backup)
+		}
+		logger.Info("Backed up original table", "backup", backup)
+		source = backup
+	}
+
+	newSchema := migratedSchema(md.Schema, schema)
+	if err := x.dataSet.Table(newTable).Create(ctx, &bigquery.TableMetadata{
+		Schema:           newSchema,
+		TimePartitioning: spec.TimePartitioning(),
+		Clustering:       spec.Clustering(),
+	}); err != nil {
+		return "", goerr.Wrap(err, "failed to create new version of table").With("table", newTable)
+	}
+	logger.Info("Created new version of table", "new_table", newTable)
+
+	columns, exprs := copyColumns(md.Schema, newSchema)
+	if len(columns) > 0 {
+		sql := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s",
+			x.tableRef(newTable), strings.Join(columns, ", "), strings.Join(exprs, ", "), x.tableRef(source))
+		if err := x.runJob(ctx, x.client.Query(sql)); err != nil {
+			return "", goerr.Wrap(err, "failed to copy rows").With("from", source).With("to", newTable)
+		}
+		logger.Info("Copied rows", "from", source, "to", newTable)
+	}
+
+	view := &bigquery.TableMetadata{
+		ViewQuery: "SELECT * FROM " + x.tableRef(newTable),
+		Labels:    map[string]string{viewTargetLabel: newTable},
+	}
+
+	if current == tableName {
+		if err := x.replaceWithView(ctx, tableName, backup, newTable, md, view); err != nil {
+			return "", err
+		}
+		logger.Info("Replaced table with view", "backup", backup, "target", newTable)
+	} else {
+		if err := x.swapView(ctx, tableName, current, newTable, md, view); err != nil {
+			return "", err
+		}
+		logger.Info("Swapped view", "prev", current, "target", newTable)
+	}
+
+	x.resolved.Delete(tableName)
+	return newTable, nil
+}
+
+// replaceWithView replaces the original table with the view. BigQuery can not swap a table and a view at once, then the view is created under a temporary name first to make sure it can be created. The migration fails closed if the original table has been modified since md was taken, and the original table is restored from the backup if the view can not be created after deleting it. Tables created by the migration are deleted when the original table is kept, then the migration can be run again.
+func (x *client) replaceWithView(ctx context.Context, tableName, backup, newTable string, md *bigquery.TableMetadata, view *bigquery.TableMetadata) error {
+	discard := func(names ...string) { x.discardTables(ctx, names...) }
+
+	tmpName := tableName + "_migrating"
+	if err := x.dataSet.Table(tmpName).Create(ctx, view); err != nil {
+		discard(newTable, backup)
+		return goerr.Wrap(err, "failed to create view under temporary name").With("table", tableName).With("view", tmpName)
+	}
+	defer discard(tmpName)
+
+	latest, err := x.dataSet.Table(tableName).Metadata(ctx)
+	if err != nil {
+		return goerr.Wrap(err, "failed to get metadata of original table").With("table", tableName)
+	}
+	if !latest.LastModifiedTime.Equal(md.LastModifiedTime) {
+		discard(newTable, backup)
+		return goerr.New("original table has been modified during migration, migrate again").
+			With("table", tableName).
+			With("last_modified", latest.LastModifiedTime)
+	}
+
+	if err := x.dataSet.Table(tableName).Delete(ctx); err != nil {
+		return goerr.Wrap(err, "failed to delete original table").With("table", tableName)
+	}
+	if err := x.dataSet.Table(tableName).Create(ctx, view); err != nil {
+		copier := x.dataSet.Table(tableName).CopierFrom(x.dataSet.Table(backup))
+		copier.WriteDisposition = bigquery.WriteEmpty
+		if restoreErr := x.runJob(ctx, copier); restoreErr != nil {
+			return goerr.Wrap(err, "failed to create view and restore original table").
+				With("table", tableName).
+				With("backup", backup).
+				With("restore_error", restoreErr.Error())
+		}
+		discard(newTable, backup)
+		return goerr.Wrap(err, "failed to create view, original table is restored").With("table", tableName).With("backup", backup)
+	}
+
+	return nil
+}
+
+// swapView swaps the view to the new version. The migration fails closed if the current version has been modified since md was taken, because rows written after copy would be lost by the swap. The new version is deleted if the view is not swapped, then the migration can be run again.
+func (x *client) swapView(ctx context.Context, tableName, current, newTable string, md *bigquery.TableMetadata, view *bigquery.TableMetadata) error {
+	latest, err := x.dataSet.Table(current).Metadata(ctx)
+	if err != nil {
+		x.discardTables(ctx, newTable)
+		return goerr.Wrap(err, "failed to get metadata of current version").With("table", tableName).With("current", current)
+	}
+	if !latest.LastModifiedTime.Equal(md.LastModifiedTime) {
+		x.discardTables(ctx, newTable)
+		return goerr.New("current version of table has been modified during migration, migrate again").
+			With("table", tableName).
+			With("current", current).
+			With("last_modified", latest.LastModifiedTime)
+	}
+
+	update := bigquery.TableMetadataToUpdate{ViewQuery: view.ViewQuery}
+	update.SetLabel(viewTargetLabel, newTable)
+	if _, err := x.dataSet.Table(tableName).Update(ctx, update, ""); err != nil {
+		x.discardTables(ctx, newTable)
+		return goerr.Wrap(err, "failed to swap view").With("table", tableName)
+	}
+
+	return nil
+}
+
+// discardTables deletes tables created by a migration that is not completed. Failure is reported and ignored.
+func (x *client) discardTables(ctx context.Context, names ...string) {
+	for _, name := range names {
+		if err := x.dataSet.Table(name).Delete(context.Background()); err != nil {
+			utils.HandleError(ctx, "failed to delete table of migration", goerr.Wrap(err).With("table", name))
+		}
+	}
+}
+
+// runJob runs query or copy job and waits for completion.
+func (x *client) runJob(ctx context.Context, runner interface {
+	Run(context.Context) (*bigquery.Job, error)
+}) error {
+	job, err := runner.Run(ctx)
+	if err != nil {
+		return err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+func (x *client) tableRef(tableName string) string {
+	return fmt.Sprintf("`%s.%s.%s`", x.projectID, x.datasetID, tableName)
+}
+
+// migratedSchema returns schema of the new version. Columns that exist only in the old schema are kept as well as CreateOrUpdateSchema.
+func migratedSchema(old, new bigquery.Schema) bigquery.Schema {
+	result := append(bigquery.Schema{}, new...)
+	for _, field := range old {
+		if lookupField(new, field.Name) == nil {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// copyColumns returns column names and SELECT expressions to copy rows from old schema into new schema. Incompatible scalar columns are converted by SAFE_CAST. Other incompatible columns are not copied.
+func copyColumns(old, new bigquery.Schema) (columns, exprs []string) {
+	for _, field := range new {
+		prev := lookupField(old, field.Name)
+		if prev == nil {
+			continue
+		}
+
+		name := "`" + field.Name + "`"
+		switch {
+		case len(diffSchema("", bigquery.Schema{prev}, bigquery.Schema{field})) == 0:
+			columns = append(columns, name)
+			exprs = append(exprs, name)
+
+		case castable(prev, field):
+			columns = append(columns, name)
+			exprs = append(exprs, fmt.Sprintf("SAFE_CAST(%s AS %s)", name, sqlType(field.Type)))
+		}
+	}
+
+	return columns, exprs
+}
+
+// DroppedColumns returns top-level columns whose data is not copied by MigrateTable.
+func DroppedColumns(old, new bigquery.Schema) []string {
+	columns, _ := copyColumns(old, migratedSchema(old, new))
+	copied := make(map[string]struct{}, len(columns))
+	for _, c := range columns {
+		copied[strings.Trim(c, "`")] = struct{}{}
+	}
+
+	var dropped []string
+	for _, field := range old {
+		if _, ok := copied[field.Name]; !ok {
+			dropped = append(dropped, field.Name)
+		}
+	}
+	return dropped
+}
+
+func castable(old, new *bigquery.FieldSchema) bool {
+	return !old.Repeated && !new.Repeated &&
+		old.Type != bigquery.RecordFieldType && new.Type != bigquery.RecordFieldType
+}
+
+func sqlType(t bigquery.FieldType) string {
+	switch t {
+	case bigquery.IntegerFieldType:
+		return "INT64"
+	case bigquery.FloatFieldType:
+		return "FLOAT64"
+	case bigquery.BooleanFieldType:
+		return "BOOL"
+	default:
+		return string(t)
+	}
+}
+
+func lookupField(s bigquery.Schema, name string) *bigquery.FieldSchema {
+	for _, f := range s {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
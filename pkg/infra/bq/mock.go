@@ -2,26 +2,90 @@ package bq
 
 import (
 	"context"
+	"fmt"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
 )
 
 type Mock struct {
 	InsertedData []any
+	// InsertedTable has inserted data for each table name
+	InsertedTable map[string][]any
+	// Schemas has the last schema given by CreateOrUpdateSchema for each table name
+	Schemas map[string]bigquery.Schema
+	// Migrated has number of migrations for each table name
+	Migrated map[string]int
+	// Views has SQL of views rendered with MockProjectID and MockDatasetID
+	Views map[string]string
+	// Queries has queries given by Query
+	Queries []string
+	// QueryFunc returns result of Query. If it's nil, Query returns no rows.
+	QueryFunc func(query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error)
+	// InsertFunc is called before Insert records data. If it returns error, Insert returns it without recording data.
+	InsertFunc func(tableName string, data any) error
 }
 
+const (
+	MockProjectID = "mock-project"
+	MockDatasetID = "mock-dataset"
+)
+
 var _ interfaces.BigQuery = &Mock{}
 
 func NewMock() *Mock {
-	return &Mock{}
+	return &Mock{
+		InsertedTable: map[string][]any{},
+		Schemas:       map[string]bigquery.Schema{},
+		Migrated:      map[string]int{},
+		Views:         map[string]string{},
+	}
+}
+
+func (x *Mock) CreateOrUpdateSchema(ctx context.Context, tableName string, schema bigquery.Schema, spec *model.TableSpec) error {
+	x.Schemas[tableName] = schema
+	return nil
+}
+
+func (x *Mock) GetSchema(ctx context.Context, tableName string) (bigquery.Schema, error) {
+	return x.Schemas[tableName], nil
+}
+
+func (x *Mock) MigrateTable(ctx context.Context, tableName string, schema bigquery.Schema, spec *model.TableSpec) (string, error) {
+	x.Migrated[tableName]++
+	x.Schemas[tableName] = migratedSchema(x.Schemas[tableName], schema)
+	return fmt.Sprintf("%s_v%d", tableName, x.Migrated[tableName]+1), nil
+}
+
+func (x *Mock) CreateOrUpdateView(ctx context.Context, view *model.View) error {
+	query, err := view.Render(MockProjectID, MockDatasetID)
+	if err != nil {
+		return err
+	}
+	x.Views[view.Name] = query
+	return nil
+}
+
+func (x *Mock) Query(ctx context.Context, query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+	x.Queries = append(x.Queries, query)
+	if x.QueryFunc == nil {
+		return nil, nil
+	}
+	return x.QueryFunc(query, params)
 }
 
-func (x *Mock) CreateOrUpdateSchema(ctx context.Context, tableName string, schema bigquery.Schema) error {
+func (x *Mock) Close() error {
 	return nil
 }
 
 func (x *Mock) Insert(ctx context.Context, tableName string, data any) error {
+	if x.InsertFunc != nil {
+		if err := x.InsertFunc(tableName, data); err != nil {
+			return err
+		}
+	}
 	x.InsertedData = append(x.InsertedData, data)
+	x.InsertedTable[tableName] = append(x.InsertedTable[tableName], data)
 	return nil
 }
@@ -0,0 +1,243 @@
+package bq
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/m-mizutani/goerr"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// encodeRow converts a row into serialized proto message of the descriptor. The row is converted to values by bigquery.ValueSaver or bigquery.StructSaver with the table schema, so struct fields are matched to columns in the same way as legacy streaming insert.
+func encodeRow(row any, schema bigquery.Schema, md protoreflect.MessageDescriptor) ([]byte, error) {
+	values, err := rowValues(row, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := setMessage(msg, schema, values); err != nil {
+		return nil, err
+	}
+
+	raw, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to marshal row")
+	}
+	return raw, nil
+}
+
+func rowValues(row any, schema bigquery.Schema) (map[string]bigquery.Value, error) {
+	saver, ok := row.(bigquery.ValueSaver)
+	if !ok {
+		saver = &bigquery.StructSaver{Struct: row, Schema: schema}
+	}
+
+	values, _, err := saver.Save()
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to convert row to values")
+	}
+	return values, nil
+}
+
+// setMessage sets values to the message. Fields of descriptor are numbered in order of schema fields.
+func setMessage(msg *dynamicpb.Message, schema bigquery.Schema, values map[string]bigquery.Value) error {
+	fields := msg.Descriptor().Fields()
+	for i, fs := range schema {
+		v, ok := values[fs.Name]
+		if !ok || v == nil {
+			continue
+		}
+
+		fd := fields.ByNumber(protoreflect.FieldNumber(i + 1))
+		if fd == nil {
+			return goerr.New("field not found in descriptor").With("field", fs.Name)
+		}
+
+		if fs.Repeated {
+			rv := reflect.ValueOf(v)
+			if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+				return goerr.New("repeated field requires slice").With("field", fs.Name)
+			}
+
+			list := msg.Mutable(fd).List()
+			for j := 0; j < rv.Len(); j++ {
+				pv, err := protoValue(msg, fd, fs, rv.Index(j).Interface())
+				if err != nil {
+					return err
+				}
+				list.Append(pv)
+			}
+			continue
+		}
+
+		pv, err := protoValue(msg, fd, fs, v)
+		if err != nil {
+			return err
+		}
+		msg.Set(fd, pv)
+	}
+
+	return nil
+}
+
+// protoValue converts a single value of the column into proto value.
+func protoValue(msg *dynamicpb.Message, fd protoreflect.FieldDescriptor, fs *bigquery.FieldSchema, v any) (protoreflect.Value, error) {
+	invalid := func() (protoreflect.Value, error) {
+		return protoreflect.Value{}, goerr.New("unsupported value for column").
+			With("field", fs.Name).
+			With("type", fs.Type).
+			With("value_type", fmt.Sprintf("%T", v))
+	}
+
+	switch fs.Type {
+	case bigquery.RecordFieldType:
+		values, ok := v.(map[string]bigquery.Value)
+		if !ok {
+			return invalid()
+		}
+		var child protoreflect.Message
+		if fd.IsList() {
+			child = msg.Mutable(fd).List().NewElement().Message()
+		} else {
+			child = msg.NewField(fd).Message()
+		}
+		dm, ok := child.(*dynamicpb.Message)
+		if !ok {
+			return invalid()
+		}
+		if err := setMessage(dm, fs.Schema, values); err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfMessage(dm), nil
+
+	case bigquery.TimestampFieldType:
+		t, ok := v.(time.Time)
+		if !ok {
+			return invalid()
+		}
+		return protoreflect.ValueOfInt64(t.UnixMicro()), nil
+
+	case bigquery.DateFieldType:
+		var d civil.Date
+		switch tv := v.(type) {
+		case civil.Date:
+			d = tv
+		case time.Time:
+			d = civil.DateOf(tv)
+		default:
+			return invalid()
+		}
+		epoch := civil.Date{Year: 1970, Month: time.January, Day: 1}
+		return protoreflect.ValueOfInt32(int32(d.DaysSince(epoch))), nil
+
+	case bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		scale := 9
+		if fs.Type == bigquery.BigNumericFieldType {
+			scale = 38
+		}
+		r, ok := toRat(v)
+		if !ok {
+			return invalid()
+		}
+		return protoreflect.ValueOfBytes(encodeNumeric(r, scale)), nil
+
+	case bigquery.TimeFieldType, bigquery.DateTimeFieldType, bigquery.IntervalFieldType, bigquery.JSONFieldType, bigquery.GeographyFieldType:
+		// These types are not generated by schema inference of drone.
+		return invalid()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		if rv.Kind() != reflect.String {
+			return invalid()
+		}
+		return protoreflect.ValueOfString(rv.String()), nil
+
+	case protoreflect.Int64Kind:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return protoreflect.ValueOfInt64(rv.Int()), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return protoreflect.ValueOfInt64(int64(rv.Uint())), nil
+		}
+
+	case protoreflect.DoubleKind:
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return protoreflect.ValueOfFloat64(rv.Float()), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return protoreflect.ValueOfFloat64(float64(rv.Int())), nil
+		}
+
+	case protoreflect.BoolKind:
+		if rv.Kind() == reflect.Bool {
+			return protoreflect.ValueOfBool(rv.Bool()), nil
+		}
+
+	case protoreflect.BytesKind:
+		if b, ok := v.([]byte); ok {
+			return protoreflect.ValueOfBytes(b), nil
+		}
+	}
+
+	return invalid()
+}
+
+func toRat(v any) (*big.Rat, bool) {
+	switch tv := v.(type) {
+	case *big.Rat:
+		return tv, tv != nil
+	case string:
+		return new(big.Rat).SetString(tv)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Rat).SetInt64(rv.Int()), true
+	case reflect.Float32, reflect.Float64:
+		r := new(big.Rat).SetFloat64(rv.Float())
+		return r, r != nil
+	}
+
+	return nil, false
+}
+
+// encodeNumeric encodes NUMERIC or BIGNUMERIC value as little endian two's complement of the value scaled by 10^scale.
+func encodeNumeric(r *big.Rat, scale int) []byte {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	n := new(big.Int).Quo(scaled.Num(), scaled.Denom())
+
+	// two's complement in big endian
+	var be []byte
+	if n.Sign() >= 0 {
+		be = n.Bytes()
+		if len(be) == 0 || be[0]&0x80 != 0 {
+			be = append([]byte{0}, be...)
+		}
+	} else {
+		// -n = ^(n-1) for positive n-1
+		abs := new(big.Int).Sub(new(big.Int).Neg(n), big.NewInt(1))
+		be = abs.Bytes()
+		if len(be) == 0 || be[0]&0x80 != 0 {
+			be = append([]byte{0}, be...)
+		}
+		for i := range be {
+			be[i] = ^be[i]
+		}
+	}
+
+	le := make([]byte, len(be))
+	for i := range be {
+		le[i] = be[len(be)-1-i]
+	}
+	return le
+}
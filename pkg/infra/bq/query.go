@@ -0,0 +1,40 @@
+package bq
+
+import (
+	"context"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"google.golang.org/api/iterator"
+)
+
+func (x *client) Query(ctx context.Context, query string, params []bigquery.QueryParameter) (_ []map[string]bigquery.Value, err error) {
+	ctx, span := utils.StartSpan(ctx, "bq.Query")
+	defer func() { utils.EndSpan(span, err) }()
+
+	q := x.client.Query(query)
+	q.DefaultProjectID = x.projectID
+	q.DefaultDatasetID = x.datasetID
+	q.Parameters = params
+
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to run query").With("query", query)
+	}
+
+	var rows []map[string]bigquery.Value
+	for {
+		var row map[string]bigquery.Value
+		if err := it.Next(&row); err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, goerr.Wrap(err, "failed to read query result").With("query", query)
+		}
+		rows = append(rows, row)
+	}
+
+	span.SetAttributes(utils.AttrRows.Int(len(rows)))
+	return rows, nil
+}
@@ -0,0 +1,55 @@
+package bq
+
+import (
+	"fmt"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+)
+
+// DiffSchema returns changes that CreateOrUpdateSchema applies to the existing schema. Columns that exist only in the old schema are kept by merge, then they are not reported.
+func DiffSchema(old, new bigquery.Schema) []model.SchemaChange {
+	return diffSchema("", old, new)
+}
+
+func diffSchema(prefix string, old, new bigquery.Schema) []model.SchemaChange {
+	var changes []model.SchemaChange
+
+	for _, field := range new {
+		name := prefix + field.Name
+
+		exist := lookupField(old, field.Name)
+
+		switch {
+		case exist == nil:
+			changes = append(changes, model.SchemaChange{
+				Kind:   model.SchemaAddField,
+				Field:  name,
+				Detail: fieldType(field),
+			})
+
+		case exist.Type != field.Type || exist.Repeated != field.Repeated || exist.Required != field.Required:
+			changes = append(changes, model.SchemaChange{
+				Kind:   model.SchemaConflict,
+				Field:  name,
+				Detail: fmt.Sprintf("%s -> %s", fieldType(exist), fieldType(field)),
+			})
+
+		case field.Type == bigquery.RecordFieldType:
+			changes = append(changes, diffSchema(name+".", exist.Schema, field.Schema)...)
+		}
+	}
+
+	return changes
+}
+
+func fieldType(field *bigquery.FieldSchema) string {
+	switch {
+	case field.Repeated:
+		return "REPEATED " + string(field.Type)
+	case field.Required:
+		return "REQUIRED " + string(field.Type)
+	default:
+		return string(field.Type)
+	}
+}
@@ -0,0 +1,68 @@
+package bq_test
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/gt"
+)
+
+func TestDiffSchema(t *testing.T) {
+	old := bigquery.Schema{
+		{Name: "ID", Type: bigquery.StringFieldType},
+		{Name: "Count", Type: bigquery.IntegerFieldType},
+		{Name: "Legacy", Type: bigquery.StringFieldType},
+		{Name: "Nested", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "A", Type: bigquery.StringFieldType},
+		}},
+	}
+	new := bigquery.Schema{
+		{Name: "ID", Type: bigquery.StringFieldType},
+		{Name: "Count", Type: bigquery.FloatFieldType},
+		{Name: "Tags", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "Nested", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "A", Type: bigquery.StringFieldType},
+			{Name: "B", Type: bigquery.TimestampFieldType},
+		}},
+	}
+
+	changes := bq.DiffSchema(old, new)
+	gt.A(t, changes).Length(3).
+		At(0, func(t testing.TB, v model.SchemaChange) {
+			gt.V(t, v.Kind).Equal(model.SchemaConflict)
+			gt.V(t, v.Field).Equal("Count")
+			gt.V(t, v.Detail).Equal("INTEGER -> FLOAT")
+		}).
+		At(1, func(t testing.TB, v model.SchemaChange) {
+			gt.V(t, v.Kind).Equal(model.SchemaAddField)
+			gt.V(t, v.Field).Equal("Tags")
+			gt.V(t, v.Detail).Equal("REPEATED STRING")
+		}).
+		At(2, func(t testing.TB, v model.SchemaChange) {
+			gt.V(t, v.Kind).Equal(model.SchemaAddField)
+			gt.V(t, v.Field).Equal("Nested.B")
+		})
+
+	gt.A(t, bq.DiffSchema(new, new)).Length(0)
+}
+
+func TestCopyColumns(t *testing.T) {
+	old := bigquery.Schema{
+		{Name: "ID", Type: bigquery.StringFieldType},
+		{Name: "Port", Type: bigquery.StringFieldType},
+		{Name: "Tags", Type: bigquery.StringFieldType},
+	}
+	new := bigquery.Schema{
+		{Name: "ID", Type: bigquery.StringFieldType},
+		{Name: "Port", Type: bigquery.IntegerFieldType},
+		{Name: "Tags", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "Name", Type: bigquery.StringFieldType},
+	}
+
+	columns, exprs := bq.CopyColumns(old, new)
+	gt.A(t, columns).Equal([]string{"`ID`", "`Port`"})
+	gt.A(t, exprs).Equal([]string{"`ID`", "SAFE_CAST(`Port` AS INT64)"})
+	gt.A(t, bq.DroppedColumns(old, new)).Equal([]string{"Tags"})
+}
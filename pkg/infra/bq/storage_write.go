@@ -0,0 +1,196 @@
+package bq
+
+import (
+	"context"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// insertStorageWrite inserts rows by Storage Write API. Rows that can not be encoded or are rejected by BigQuery are returned as failed rows.
+func (x *client) insertStorageWrite(ctx context.Context, tableName string, rows []any) (bigquery.PutMultiError, error) {
+	md, err := tableMetadataWithRetry(ctx, x.dataSet.Table(tableName))
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor, err := schemaDescriptor(md.Schema)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := adapt.NormalizeDescriptor(descriptor)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to normalize descriptor").With("table", tableName)
+	}
+
+	var failed bigquery.PutMultiError
+	encoded := make([][]byte, len(rows))
+	var indexes, sizes []int
+	for i, row := range rows {
+		raw, err := encodeRow(row, md.Schema, descriptor)
+		if err != nil {
+			failed = append(failed, rowError(i, err))
+			continue
+		}
+		encoded[i] = raw
+		indexes = append(indexes, i)
+		sizes = append(sizes, len(raw))
+	}
+	if len(indexes) == 0 {
+		return failed, nil
+	}
+
+	writer, err := x.managedWriter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	streamType := managedwriter.CommittedStream
+	if x.writeMode == WriteModePending {
+		streamType = managedwriter.PendingStream
+	}
+
+	stream, err := writer.NewManagedStream(ctx,
+		managedwriter.WithDestinationTable(managedwriter.TableParentFromParts(x.projectID, x.datasetID, tableName)),
+		managedwriter.WithType(streamType),
+		managedwriter.WithSchemaDescriptor(normalized),
+		managedwriter.EnableWriteRetries(true),
+	)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to create managed stream").With("table", tableName)
+	}
+	defer utils.SafeClose(stream)
+
+	for _, batch := range makeBatches(indexes, sizes, x.batchRows, x.batchBytes) {
+		failed = append(failed, appendBatch(ctx, stream, batch, encoded)...)
+	}
+
+	if _, err := stream.Finalize(ctx); err != nil {
+		return nil, goerr.Wrap(err, "Fail to finalize stream").With("table", tableName)
+	}
+
+	if streamType == managedwriter.PendingStream {
+		resp, err := writer.BatchCommitWriteStreams(ctx, &storagepb.BatchCommitWriteStreamsRequest{
+			Parent:       managedwriter.TableParentFromStreamName(stream.StreamName()),
+			WriteStreams: []string{stream.StreamName()},
+		})
+		if err != nil {
+			return nil, goerr.Wrap(err, "Fail to commit stream").With("table", tableName)
+		}
+		if len(resp.GetStreamErrors()) > 0 {
+			return nil, goerr.New("Fail to commit stream").With("table", tableName).With("errors", resp.GetStreamErrors())
+		}
+	}
+
+	return failed, nil
+}
+
+// appendBatch appends a batch of encoded rows with retry. Rows rejected by BigQuery are removed from the batch and the rest are appended again. If retry limit is exceeded, all remaining rows of the batch are returned as failed.
+func appendBatch(ctx context.Context, stream *managedwriter.ManagedStream, batch []int, encoded [][]byte) bigquery.PutMultiError {
+	var failed bigquery.PutMultiError
+	remaining := batch
+
+	var lastErr error
+	for attempt := 0; attempt < maxRetries && len(remaining) > 0; attempt++ {
+		if err := sleepRetry(ctx, attempt); err != nil {
+			lastErr = err
+			break
+		}
+
+		data := make([][]byte, len(remaining))
+		for i, idx := range remaining {
+			data[i] = encoded[idx]
+		}
+
+		result, err := stream.AppendRows(ctx, data)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		resp, err := result.FullResponse(ctx)
+		if rowErrs := resp.GetRowErrors(); len(rowErrs) > 0 {
+			// The whole request is rejected if any row is invalid. Remove invalid rows and append the rest again.
+			invalid := map[int]struct{}{}
+			for _, rowErr := range rowErrs {
+				idx := remaining[rowErr.GetIndex()]
+				invalid[idx] = struct{}{}
+				failed = append(failed, rowError(idx, goerr.New("row is rejected").With("message", rowErr.GetMessage()).With("code", rowErr.GetCode().String())))
+			}
+
+			var next []int
+			for _, idx := range remaining {
+				if _, ok := invalid[idx]; !ok {
+					next = append(next, idx)
+				}
+			}
+			remaining = next
+			attempt = -1 // valid rows have not been rejected, then restart retry count
+			continue
+		}
+		if err != nil {
+			if !isRetryable(err) {
+				lastErr = err
+				break
+			}
+			lastErr = err
+			continue
+		}
+
+		remaining = nil
+	}
+
+	for _, idx := range remaining {
+		failed = append(failed, rowError(idx, goerr.Wrap(lastErr, "Fail to append rows")))
+	}
+
+	return failed
+}
+
+// schemaDescriptor converts table schema to proto message descriptor for Storage Write API.
+func schemaDescriptor(schema bigquery.Schema) (protoreflect.MessageDescriptor, error) {
+	tableSchema, err := adapt.BQSchemaToStorageTableSchema(schema)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to convert schema")
+	}
+
+	descriptor, err := adapt.StorageSchemaToProto2Descriptor(tableSchema, "root")
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to build descriptor")
+	}
+
+	md, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, goerr.New("descriptor is not a message descriptor")
+	}
+
+	return md, nil
+}
+
+// tableMetadataWithRetry gets table metadata. A table may not be found just after creation, then it retries.
+func tableMetadataWithRetry(ctx context.Context, table *bigquery.Table) (*bigquery.TableMetadata, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if err := sleepRetry(ctx, attempt); err != nil {
+			return nil, err
+		}
+
+		md, err := table.Metadata(ctx)
+		if err == nil {
+			return md, nil
+		}
+		if !isRetryable(err) {
+			return nil, goerr.Wrap(err, "Fail to get table metadata").With("table", table.TableID)
+		}
+
+		utils.Logger().Warn("Fail to get table metadata, retrying", "table", table.FullyQualifiedName(), utils.ErrLog(err))
+		lastErr = err
+	}
+
+	return nil, goerr.Wrap(lastErr, "Fail to get table metadata: exceeded retry limit").With("table", table.TableID)
+}
@@ -0,0 +1,81 @@
+package bq
+
+import (
+	"context"
+	"encoding/json"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+// insertStreaming inserts rows by legacy streaming insert. Invalid rows are skipped and returned as failed rows.
+func (x *client) insertStreaming(ctx context.Context, tableName string, rows []any) (bigquery.PutMultiError, error) {
+	table := x.dataSet.Table(tableName)
+
+	indexes := make([]int, len(rows))
+	sizes := make([]int, len(rows))
+	for i, row := range rows {
+		indexes[i] = i
+		// JSON size is an estimation of request size of the row
+		if raw, err := json.Marshal(row); err == nil {
+			sizes[i] = len(raw)
+		}
+	}
+
+	var failed bigquery.PutMultiError
+	for _, batch := range makeBatches(indexes, sizes, x.batchRows, x.batchBytes) {
+		batchRows := make([]any, len(batch))
+		for i, idx := range batch {
+			batchRows[i] = rows[idx]
+		}
+
+		rowErrs, err := insertWithRetry(ctx, table, batchRows)
+		if err != nil {
+			utils.Logger().Warn("Fail to insert batch", "table", tableName, "rows", len(batch), utils.ErrLog(err))
+			for _, idx := range batch {
+				failed = append(failed, rowError(idx, err))
+			}
+			continue
+		}
+
+		for _, rowErr := range rowErrs {
+			rowErr.RowIndex = batch[rowErr.RowIndex]
+			failed = append(failed, rowErr)
+		}
+	}
+
+	return failed, nil
+}
+
+// insertWithRetry puts a batch with exponential backoff retry. It returns row errors if some rows are invalid.
+func insertWithRetry(ctx context.Context, table *bigquery.Table, rows []any) (bigquery.PutMultiError, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if err := sleepRetry(ctx, attempt); err != nil {
+			return nil, err
+		}
+
+		inserter := table.Inserter()
+		inserter.SkipInvalidRows = true
+		err := inserter.Put(ctx, rows)
+		if err == nil {
+			// Data inserted successfully, no need to retry.
+			return nil, nil
+		}
+
+		if multiErr, ok := err.(bigquery.PutMultiError); ok {
+			return multiErr, nil
+		}
+
+		if !isRetryable(err) {
+			return nil, goerr.Wrap(err, "Fail to insert rows").With("table", table.TableID)
+		}
+
+		utils.Logger().Warn("Fail to insert rows, retrying", "table", table.FullyQualifiedName(), "attempt", attempt, utils.ErrLog(err))
+		lastErr = err
+	}
+
+	// Data insertion failed after all retries.
+	return nil, goerr.Wrap(lastErr, "insert failed: exceeded retry limit").With("table", table.TableID)
+}
@@ -0,0 +1,47 @@
+package bq
+
+import (
+	"context"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+)
+
+type suffixClient struct {
+	base   interfaces.BigQuery
+	suffix string
+}
+
+// WithTableSuffix returns BigQuery client that reads and writes tables of base client with the suffix, e.g. abusech_feodo_reprocess for abusech_feodo. Views and queries are not changed.
+func WithTableSuffix(base interfaces.BigQuery, suffix string) interfaces.BigQuery {
+	return &suffixClient{base: base, suffix: suffix}
+}
+
+func (x *suffixClient) CreateOrUpdateSchema(ctx context.Context, tableName string, schema bigquery.Schema, spec *model.TableSpec) error {
+	return x.base.CreateOrUpdateSchema(ctx, tableName+x.suffix, schema, spec)
+}
+
+func (x *suffixClient) Insert(ctx context.Context, tableName string, data any) error {
+	return x.base.Insert(ctx, tableName+x.suffix, data)
+}
+
+func (x *suffixClient) GetSchema(ctx context.Context, tableName string) (bigquery.Schema, error) {
+	return x.base.GetSchema(ctx, tableName+x.suffix)
+}
+
+func (x *suffixClient) MigrateTable(ctx context.Context, tableName string, schema bigquery.Schema, spec *model.TableSpec) (string, error) {
+	return x.base.MigrateTable(ctx, tableName+x.suffix, schema, spec)
+}
+
+func (x *suffixClient) CreateOrUpdateView(ctx context.Context, view *model.View) error {
+	return x.base.CreateOrUpdateView(ctx, view)
+}
+
+func (x *suffixClient) Query(ctx context.Context, query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+	return x.base.Query(ctx, query, params)
+}
+
+func (x *suffixClient) Close() error {
+	return x.base.Close()
+}
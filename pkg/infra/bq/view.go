@@ -0,0 +1,57 @@
+package bq
+
+import (
+	"context"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"google.golang.org/api/googleapi"
+)
+
+// viewLabel is a label of views created by CreateOrUpdateView. A table without the label is not replaced.
+const viewLabel = "drone_view"
+
+func (x *client) CreateOrUpdateView(ctx context.Context, view *model.View) error {
+	query, err := view.Render(x.projectID, x.datasetID)
+	if err != nil {
+		return err
+	}
+
+	table := x.dataSet.Table(view.Name)
+	md, err := table.Metadata(ctx)
+	if err != nil {
+		if gerr, ok := err.(*googleapi.Error); !ok || gerr.Code != 404 {
+			return goerr.Wrap(err, "failed to get metadata").With("view", view.Name)
+		}
+
+		if err := table.Create(ctx, &bigquery.TableMetadata{
+			ViewQuery:   query,
+			Description: view.Description,
+			Labels:      map[string]string{viewLabel: "true"},
+		}); err != nil {
+			return goerr.Wrap(err, "failed to create view").With("view", view.Name)
+		}
+		utils.Logger().Info("Created view", "view", view.Name)
+		return nil
+	}
+
+	if _, ok := md.Labels[viewLabel]; md.Type != bigquery.ViewTable || !ok {
+		return goerr.New("table exists and is not a view managed by drone").With("view", view.Name)
+	}
+	if md.ViewQuery == query && md.Description == view.Description {
+		return nil
+	}
+
+	update := bigquery.TableMetadataToUpdate{
+		ViewQuery:   query,
+		Description: view.Description,
+	}
+	if _, err := table.Update(ctx, update, md.ETag); err != nil {
+		return goerr.Wrap(err, "failed to update view").With("view", view.Name)
+	}
+	utils.Logger().Info("Updated view", "view", view.Name)
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package bq_test
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/bqs"
+	"github.com/m-mizutani/drone/pkg/feed/otx"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/gt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestMakeBatches(t *testing.T) {
+	indexes := []int{0, 1, 2, 3, 4}
+
+	t.Run("split by rows", func(t *testing.T) {
+		batches := bq.MakeBatches(indexes, []int{1, 1, 1, 1, 1}, 2, 100)
+		gt.Equal(t, batches, [][]int{{0, 1}, {2, 3}, {4}})
+	})
+
+	t.Run("split by bytes", func(t *testing.T) {
+		batches := bq.MakeBatches(indexes, []int{40, 40, 40, 200, 10}, 100, 100)
+		gt.Equal(t, batches, [][]int{{0, 1}, {2}, {3}, {4}})
+	})
+}
+
+func TestEncodeRow(t *testing.T) {
+	type child struct {
+		Name string
+	}
+	type record struct {
+		Name     string
+		Count    int64
+		Score    float64
+		Active   bool
+		Tags     []string
+		Created  time.Time
+		Children []child
+	}
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	row := record{
+		Name:     "blue",
+		Count:    5,
+		Score:    0.5,
+		Active:   true,
+		Tags:     []string{"a", "b"},
+		Created:  ts,
+		Children: []child{{Name: "x"}},
+	}
+	schema := gt.R1(bqs.Infer(&row)).NoError(t)
+	md := gt.R1(bq.SchemaDescriptor(schema)).NoError(t)
+	raw := gt.R1(bq.EncodeRow(row, schema, md)).NoError(t)
+
+	msg := dynamicpb.NewMessage(md)
+	gt.NoError(t, proto.Unmarshal(raw, msg))
+
+	get := func(name string) protoreflect.Value {
+		return msg.Get(md.Fields().ByName(protoreflect.Name(name)))
+	}
+	gt.Equal(t, get("Name").String(), "blue")
+	gt.Equal(t, get("Count").Int(), 5)
+	gt.Equal(t, get("Score").Float(), 0.5)
+	gt.True(t, get("Active").Bool())
+	gt.Equal(t, get("Tags").List().Len(), 2)
+	gt.Equal(t, get("Created").Int(), ts.UnixMicro())
+	gt.Equal(t, get("Children").List().Len(), 1)
+}
+
+func TestEncodeRowPulseLog(t *testing.T) {
+	tables := gt.R1(otx.SubscribedTables()).NoError(t)
+	schema := tables[0].Schema
+	md := gt.R1(bq.SchemaDescriptor(schema)).NoError(t)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	row := &otx.PulseLog{
+		Pulse:      otx.Pulse{ID: "p1", Name: "blue"},
+		Modified:   ts,
+		ImportedAt: ts.Add(time.Hour),
+	}
+	raw := gt.R1(bq.EncodeRow(row, schema, md)).NoError(t)
+
+	msg := dynamicpb.NewMessage(md)
+	gt.NoError(t, proto.Unmarshal(raw, msg))
+
+	get := func(name string) protoreflect.Value {
+		return msg.Get(md.Fields().ByName(protoreflect.Name(name)))
+	}
+	gt.Equal(t, get("ID").String(), "p1")
+	gt.Equal(t, get("Modified").Int(), ts.UnixMicro())
+	gt.Equal(t, get("ImportedAt").Int(), ts.Add(time.Hour).UnixMicro())
+}
+
+func TestEncodeNumeric(t *testing.T) {
+	// 1.5 * 10^9 = 1500000000 = 0x59682F00
+	gt.Equal(t, bq.EncodeNumeric(big.NewRat(3, 2), 9), []byte{0x00, 0x2F, 0x68, 0x59})
+	// -1 * 10^9 = -1000000000 = 0xC4653600 (two's complement)
+	gt.Equal(t, bq.EncodeNumeric(big.NewRat(-1, 1), 9), []byte{0x00, 0x36, 0x65, 0xC4})
+}
@@ -0,0 +1,241 @@
+// Package cassette records HTTP responses of feed providers into fixture files and replays them by a local HTTP server, so that feed tests can run without internet access.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/m-mizutani/goerr"
+)
+
+// BaseURLPlaceholder is replaced with URL of replay server in response body. Recorder replaces origin of provider with it.
+const BaseURLPlaceholder = "{{BASE_URL}}"
+
+// Cassette is a set of recorded interactions.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a sanitized request. Headers are not recorded because they may have credentials.
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+}
+
+type Response struct {
+	StatusCode int               `json:"status_code"`
+	Header     map[string]string `json:"header,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// recordedHeaders are response headers saved into cassette. Other headers (e.g. Set-Cookie) are dropped.
+var recordedHeaders = []string{"Content-Type", "ETag", "Last-Modified"}
+
+// Load reads a cassette file.
+func Load(path string) (*Cassette, error) {
+	raw, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to read cassette").With("path", path)
+	}
+
+	var c Cassette
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, goerr.Wrap(err, "Fail to decode cassette").With("path", path)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette file.
+func (x *Cassette) Save(path string) error {
+	raw, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return goerr.Wrap(err, "Fail to encode cassette")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return goerr.Wrap(err, "Fail to create cassette directory").With("path", path)
+	}
+	if err := os.WriteFile(path, append(raw, '\n'), 0600); err != nil {
+		return goerr.Wrap(err, "Fail to write cassette").With("path", path)
+	}
+
+	return nil
+}
+
+// Option configures Recorder and replay server.
+type Option func(*config)
+
+type config struct {
+	ignoreQuery map[string]struct{}
+	sanitizers  []func(body []byte) []byte
+}
+
+// WithIgnoreQuery ignores query parameters when matching request, e.g. parameters depending on current time.
+func WithIgnoreQuery(keys ...string) Option {
+	return func(x *config) {
+		for _, key := range keys {
+			x.ignoreQuery[key] = struct{}{}
+		}
+	}
+}
+
+// WithSanitizer modifies response body before recording, e.g. to reduce data or remove private information.
+func WithSanitizer(f func(body []byte) []byte) Option {
+	return func(x *config) {
+		x.sanitizers = append(x.sanitizers, f)
+	}
+}
+
+func newConfig(options []Option) *config {
+	cfg := &config{
+		ignoreQuery: map[string]struct{}{},
+	}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// normalizeQuery removes ignored parameters and sorts the rest.
+func (x *config) normalizeQuery(query url.Values) string {
+	q := url.Values{}
+	for k, vs := range query {
+		if _, ok := x.ignoreQuery[k]; ok {
+			continue
+		}
+		q[k] = vs
+	}
+	return q.Encode()
+}
+
+// Recorder is a http.RoundTripper that sends requests by base transport and records sanitized responses.
+type Recorder struct {
+	base     http.RoundTripper
+	cfg      *config
+	cassette Cassette
+	mutex    sync.Mutex
+}
+
+func NewRecorder(base http.RoundTripper, options ...Option) *Recorder {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Recorder{
+		base: base,
+		cfg:  newConfig(options),
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (x *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := x.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to read response body").With("url", req.URL.String())
+	}
+
+	recorded := bytes.ReplaceAll(body, []byte(origin(req.URL)), []byte(BaseURLPlaceholder))
+	// JSON encoder of some providers escapes '/' in URL
+	recorded = bytes.ReplaceAll(recorded, []byte(strings.ReplaceAll(origin(req.URL), "/", `\/`)), []byte(BaseURLPlaceholder))
+	for _, sanitize := range x.cfg.sanitizers {
+		recorded = sanitize(recorded)
+	}
+
+	header := map[string]string{}
+	for _, key := range recordedHeaders {
+		if v := resp.Header.Get(key); v != "" {
+			header[key] = v
+		}
+	}
+
+	x.mutex.Lock()
+	x.cassette.Interactions = append(x.cassette.Interactions, &Interaction{
+		Request: Request{
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Query:  x.cfg.normalizeQuery(req.URL.Query()),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       string(recorded),
+		},
+	})
+	x.mutex.Unlock()
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+// Save writes recorded interactions into the cassette file.
+func (x *Recorder) Save(path string) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.cassette.Save(path)
+}
+
+func origin(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// NewServer starts a HTTP server that replays the cassette file. A request is matched by method, path and query except ignored parameters. If a recorded response has ETag and the request has the same If-None-Match, it returns 304. The server is closed at the end of the test.
+func NewServer(t testing.TB, path string, options ...Option) *httptest.Server {
+	t.Helper()
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("fail to load cassette: %v", err)
+	}
+	cfg := newConfig(options)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := cfg.normalizeQuery(r.URL.Query())
+		for _, i := range c.Interactions {
+			if i.Request.Method != r.Method || i.Request.Path != r.URL.Path || i.Request.Query != query {
+				continue
+			}
+
+			etag := i.Response.Header["ETag"]
+			if etag != "" && r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			for k, v := range i.Response.Header {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(i.Response.StatusCode)
+			_, _ = w.Write([]byte(strings.ReplaceAll(i.Response.Body, BaseURLPlaceholder, srv.URL)))
+			return
+		}
+
+		t.Errorf("no recorded interaction: %s %s", r.Method, r.URL.String())
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
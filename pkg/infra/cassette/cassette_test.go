@@ -0,0 +1,71 @@
+package cassette_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/drone/pkg/infra/cassette"
+	"github.com/m-mizutani/gt"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var origin *httptest.Server
+	origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Set-Cookie", "session=secret")
+		_, _ = w.Write([]byte(`{"next":"` + origin.URL + `/items?page=2","token":"secret"}`))
+	}))
+	defer origin.Close()
+
+	recorder := cassette.NewRecorder(nil,
+		cassette.WithIgnoreQuery("since"),
+		cassette.WithSanitizer(func(body []byte) []byte {
+			return []byte(strings.ReplaceAll(string(body), "secret", "xxx"))
+		}),
+	)
+	client := &http.Client{Transport: recorder}
+
+	req := gt.R1(http.NewRequest(http.MethodGet, origin.URL+"/items?since=2024-01-01&page=1", nil)).NoError(t)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp := gt.R1(client.Do(req)).NoError(t)
+	body := gt.R1(io.ReadAll(resp.Body)).NoError(t)
+	gt.NoError(t, resp.Body.Close())
+	// Response for caller is not sanitized
+	gt.S(t, string(body)).Contains(`"token":"secret"`)
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	gt.NoError(t, recorder.Save(path))
+
+	c := gt.R1(cassette.Load(path)).NoError(t)
+	gt.A(t, c.Interactions).Length(1).At(0, func(t testing.TB, v *cassette.Interaction) {
+		gt.V(t, v.Request.Path).Equal("/items")
+		gt.V(t, v.Request.Query).Equal("page=1")
+		gt.V(t, v.Response.Header["ETag"]).Equal(`"v1"`)
+		gt.M(t, v.Response.Header).NotHaveKey("Set-Cookie")
+		gt.V(t, v.Response.Body).Equal(`{"next":"{{BASE_URL}}/items?page=2","token":"xxx"}`)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		srv := cassette.NewServer(t, path, cassette.WithIgnoreQuery("since"))
+
+		resp := gt.R1(http.Get(srv.URL + "/items?page=1&since=2024-02-01")).NoError(t)
+		body := gt.R1(io.ReadAll(resp.Body)).NoError(t)
+		gt.NoError(t, resp.Body.Close())
+		gt.V(t, resp.StatusCode).Equal(http.StatusOK)
+		gt.V(t, string(body)).Equal(`{"next":"` + srv.URL + `/items?page=2","token":"xxx"}`)
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		srv := cassette.NewServer(t, path)
+
+		req := gt.R1(http.NewRequest(http.MethodGet, srv.URL+"/items?page=1", nil)).NoError(t)
+		req.Header.Set("If-None-Match", `"v1"`)
+		resp := gt.R1(http.DefaultClient.Do(req)).NoError(t)
+		gt.NoError(t, resp.Body.Close())
+		gt.V(t, resp.StatusCode).Equal(http.StatusNotModified)
+	})
+}
@@ -1,23 +1,42 @@
 package infra
 
 import (
+	"errors"
+	"io"
+
 	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/infra/archive"
+	"github.com/m-mizutani/drone/pkg/infra/httpfetch"
 	"github.com/m-mizutani/drone/pkg/infra/memdb"
+	"github.com/m-mizutani/drone/pkg/infra/notify"
+	"github.com/m-mizutani/drone/pkg/infra/tracing"
 )
 
 type Clients struct {
-	db interfaces.Database
-	bq interfaces.BigQuery
+	db   interfaces.Database
+	bq   interfaces.BigQuery
+	http *httpfetch.Client
+
+	notifier interfaces.Notifier
+	archive  interfaces.Archive
 }
 
 func New(options ...Option) *Clients {
 	clients := &Clients{
-		db: memdb.New(),
+		db:       memdb.New(),
+		http:     httpfetch.New(),
+		notifier: notify.Discard,
+		archive:  archive.Discard,
 	}
 	for _, opt := range options {
 		opt(clients)
 	}
 
+	clients.db = tracing.NewDatabase(clients.db)
+
+	// Validators of HTTP responses are stored in the state database
+	clients.http = clients.http.With(httpfetch.WithCacheStore(clients.db))
+
 	return clients
 }
 
@@ -29,6 +48,31 @@ func (x *Clients) BigQuery() interfaces.BigQuery {
 	return x.bq
 }
 
+func (x *Clients) HTTP() *httpfetch.Client {
+	return x.http
+}
+
+func (x *Clients) Notifier() interfaces.Notifier {
+	return x.notifier
+}
+
+// Close closes BigQuery client and archive.
+func (x *Clients) Close() error {
+	var errs []error
+	if x.bq != nil {
+		errs = append(errs, x.bq.Close())
+	}
+	if c, ok := x.archive.(io.Closer); ok {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Archive returns archive of raw response bodies. It stores nothing if archive is not configured.
+func (x *Clients) Archive() interfaces.Archive {
+	return x.archive
+}
+
 type Option func(*Clients)
 
 func WithDatabase(db interfaces.Database) Option {
@@ -42,3 +86,21 @@ func WithBigQuery(bq interfaces.BigQuery) Option {
 		x.bq = bq
 	}
 }
+
+func WithHTTP(http *httpfetch.Client) Option {
+	return func(x *Clients) {
+		x.http = http
+	}
+}
+
+func WithNotifier(notifier interfaces.Notifier) Option {
+	return func(x *Clients) {
+		x.notifier = notifier
+	}
+}
+
+func WithArchive(archive interfaces.Archive) Option {
+	return func(x *Clients) {
+		x.archive = archive
+	}
+}
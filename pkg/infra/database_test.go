@@ -13,6 +13,7 @@ import (
 	"github.com/m-mizutani/drone/pkg/domain/types"
 	"github.com/m-mizutani/drone/pkg/infra/firestore"
 	"github.com/m-mizutani/drone/pkg/infra/memdb"
+	"github.com/m-mizutani/drone/pkg/infra/tracing"
 	"github.com/m-mizutani/drone/pkg/utils"
 	"github.com/m-mizutani/gt"
 )
@@ -39,6 +40,10 @@ func TestMemDB(t *testing.T) {
 	testDB(t, memdb.New())
 }
 
+func TestTracingDatabase(t *testing.T) {
+	testDB(t, tracing.NewDatabase(memdb.New()))
+}
+
 func testDB(t *testing.T, db interfaces.Database) {
 	t.Run("basic", func(t *testing.T) {
 		testBasic(t, db)
@@ -47,6 +52,26 @@ func testDB(t *testing.T, db interfaces.Database) {
 	t.Run("random test", func(t *testing.T) {
 		testRandomPut(t, db)
 	})
+
+	t.Run("set and delete", func(t *testing.T) {
+		testSetAndDelete(t, db)
+	})
+
+	t.Run("record hashes", func(t *testing.T) {
+		testRecordHashes(t, db)
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		testSnapshot(t, db)
+	})
+
+	t.Run("import checkpoint", func(t *testing.T) {
+		testImportCheckpoint(t, db)
+	})
+
+	t.Run("alert log", func(t *testing.T) {
+		testAlertLog(t, db)
+	})
 }
 
 func testBasic(t testing.TB, db interfaces.Database) {
@@ -128,3 +153,115 @@ func testRandomPut(t *testing.T, db interfaces.Database) {
 	log := gt.R1(db.GetLatestImportLog(ctx, feedID)).NoError(t)
 	gt.Equal(t, log.LatestRecord.Unix(), maxTS.Unix())
 }
+
+func testSetAndDelete(t *testing.T, db interfaces.Database) {
+	var (
+		feedID = types.FeedID(uuid.NewString())
+		now    = time.Now()
+		ctx    = context.Background()
+	)
+
+	gt.NoError(t, db.PutImportLog(ctx, feedID, &model.ImportLog{
+		LatestRecord: now,
+		CheckedAt:    now,
+	}))
+
+	// SetImportLog can move LatestRecord backward
+	gt.NoError(t, db.SetImportLog(ctx, feedID, &model.ImportLog{
+		LatestRecord: now.Add(-time.Hour),
+		CheckedAt:    now,
+	}))
+	log := gt.R1(db.GetLatestImportLog(ctx, feedID)).NoError(t)
+	gt.Equal(t, log.LatestRecord.Unix(), now.Add(-time.Hour).Unix())
+
+	gt.NoError(t, db.DeleteImportLog(ctx, feedID))
+	log = gt.R1(db.GetLatestImportLog(ctx, feedID)).NoError(t)
+	gt.V(t, log).Nil()
+}
+
+func testRecordHashes(t *testing.T, db interfaces.Database) {
+	var (
+		feedID = types.FeedID(uuid.NewString())
+		now    = time.Now()
+		ctx    = context.Background()
+	)
+
+	gt.NoError(t, db.PutRecordHashes(ctx, feedID, []*model.RecordHash{
+		{Key: "192.0.2.1:443", Hash: "h1", UpdatedAt: now},
+		{Key: "a/b", Hash: "h2", UpdatedAt: now},
+	}))
+
+	hashes := gt.R1(db.GetRecordHashes(ctx, feedID, []string{"192.0.2.1:443", "a/b", "missing"})).NoError(t)
+	gt.M(t, hashes).Length(2)
+	gt.Equal(t, hashes["a/b"].Hash, "h2")
+
+	gt.NoError(t, db.DeleteRecordHashes(ctx, feedID, []string{"a/b"}))
+	list := gt.R1(db.ListRecordHashes(ctx, feedID)).NoError(t)
+	gt.A(t, list).Length(1).At(0, func(t testing.TB, v *model.RecordHash) {
+		gt.Equal(t, v.Key, "192.0.2.1:443")
+	})
+}
+
+func testSnapshot(t *testing.T, db interfaces.Database) {
+	var (
+		feedID = types.FeedID(uuid.NewString())
+		ctx    = context.Background()
+	)
+
+	gt.V(t, gt.R1(db.GetSnapshot(ctx, feedID)).NoError(t)).Nil()
+
+	gt.NoError(t, db.PutSnapshot(ctx, feedID, &model.Snapshot{Data: []byte("v1"), CreatedAt: time.Now()}))
+	gt.NoError(t, db.PutSnapshot(ctx, feedID, &model.Snapshot{Data: []byte("v2"), CreatedAt: time.Now()}))
+
+	snapshot := gt.R1(db.GetSnapshot(ctx, feedID)).NoError(t)
+	gt.Equal(t, string(snapshot.Data), "v2")
+
+	// Snapshot larger than 1 MiB document limit of Firestore
+	large := make([]byte, 3*1024*1024+1)
+	for i := range large {
+		large[i] = byte(i % 251)
+	}
+	gt.NoError(t, db.PutSnapshot(ctx, feedID, &model.Snapshot{Data: large, CreatedAt: time.Now()}))
+	snapshot = gt.R1(db.GetSnapshot(ctx, feedID)).NoError(t)
+	gt.Equal(t, snapshot.Data, large)
+
+	gt.NoError(t, db.DeleteSnapshot(ctx, feedID))
+	gt.V(t, gt.R1(db.GetSnapshot(ctx, feedID)).NoError(t)).Nil()
+}
+
+func testImportCheckpoint(t *testing.T, db interfaces.Database) {
+	var (
+		feedID = types.FeedID(uuid.NewString())
+		ctx    = context.Background()
+		since  = time.Now().Add(-time.Hour)
+	)
+
+	gt.V(t, gt.R1(db.GetImportCheckpoint(ctx, feedID)).NoError(t)).Nil()
+
+	gt.NoError(t, db.PutImportCheckpoint(ctx, feedID, &model.ImportCheckpoint{Since: since, NextURL: "https://example.com/?page=2", Page: 1}))
+	gt.NoError(t, db.PutImportCheckpoint(ctx, feedID, &model.ImportCheckpoint{Since: since, NextURL: "https://example.com/?page=3", Page: 2}))
+
+	checkpoint := gt.R1(db.GetImportCheckpoint(ctx, feedID)).NoError(t)
+	gt.V(t, checkpoint.NextURL).Equal("https://example.com/?page=3")
+	gt.V(t, checkpoint.Page).Equal(2)
+	gt.V(t, checkpoint.Since.Unix()).Equal(since.Unix())
+
+	gt.NoError(t, db.DeleteImportCheckpoint(ctx, feedID))
+	gt.V(t, gt.R1(db.GetImportCheckpoint(ctx, feedID)).NoError(t)).Nil()
+}
+
+func testAlertLog(t *testing.T, db interfaces.Database) {
+	var (
+		// Key can have characters that are not allowed in document ID
+		key = "match/" + uuid.NewString()
+		ctx = context.Background()
+	)
+
+	gt.V(t, gt.R1(db.GetAlertLog(ctx, key)).NoError(t)).Nil()
+
+	gt.NoError(t, db.PutAlertLog(ctx, &model.AlertLog{Key: key, Type: "match", SentAt: time.Now()}))
+
+	log := gt.R1(db.GetAlertLog(ctx, key)).NoError(t)
+	gt.Equal(t, log.Key, key)
+	gt.Equal(t, log.Type, "match")
+}
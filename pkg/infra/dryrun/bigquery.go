@@ -0,0 +1,115 @@
+package dryrun
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/goerr"
+)
+
+type bigQuery struct {
+	base   interfaces.BigQuery
+	report *Report
+	dump   io.Writer
+}
+
+type Option func(*bigQuery)
+
+// WithDump writes inserted records as JSON lines, e.g. {"table":"abusech_feodo","record":{...}}.
+func WithDump(w io.Writer) Option {
+	return func(x *bigQuery) {
+		x.dump = w
+	}
+}
+
+// NewBigQuery returns BigQuery client that computes schema changes against base client and counts inserted rows instead of writing.
+func NewBigQuery(base interfaces.BigQuery, report *Report, options ...Option) interfaces.BigQuery {
+	x := &bigQuery{
+		base:   base,
+		report: report,
+	}
+	for _, opt := range options {
+		opt(x)
+	}
+	return x
+}
+
+func (x *bigQuery) CreateOrUpdateSchema(ctx context.Context, tableName string, schema bigquery.Schema, spec *model.TableSpec) error {
+	current, err := x.base.GetSchema(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	x.report.mutex.Lock()
+	defer x.report.mutex.Unlock()
+
+	t := x.report.table(tableName)
+	if current != nil {
+		t.Exists = true
+		t.Changes = bq.DiffSchema(current, schema)
+	}
+
+	return nil
+}
+
+func (x *bigQuery) GetSchema(ctx context.Context, tableName string) (bigquery.Schema, error) {
+	return x.base.GetSchema(ctx, tableName)
+}
+
+func (x *bigQuery) MigrateTable(ctx context.Context, tableName string, schema bigquery.Schema, spec *model.TableSpec) (string, error) {
+	return "", goerr.New("table migration is not available in dry run").With("table", tableName)
+}
+
+func (x *bigQuery) CreateOrUpdateView(ctx context.Context, view *model.View) error {
+	return nil
+}
+
+func (x *bigQuery) Query(ctx context.Context, query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+	return x.base.Query(ctx, query, params)
+}
+
+func (x *bigQuery) Close() error {
+	return x.base.Close()
+}
+
+func (x *bigQuery) Insert(ctx context.Context, tableName string, data any) error {
+	if data == nil {
+		return nil
+	}
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice {
+		return goerr.New("data must be slice").With("table", tableName).With("type", v.Type().String())
+	}
+	if v.Len() == 0 {
+		return nil
+	}
+
+	x.report.mutex.Lock()
+	defer x.report.mutex.Unlock()
+
+	x.report.table(tableName).Rows += v.Len()
+
+	if x.dump != nil {
+		encoder := json.NewEncoder(x.dump)
+		for i := 0; i < v.Len(); i++ {
+			line := struct {
+				Table  string `json:"table"`
+				Record any    `json:"record"`
+			}{
+				Table:  tableName,
+				Record: v.Index(i).Interface(),
+			}
+			if err := encoder.Encode(line); err != nil {
+				return goerr.Wrap(err, "Fail to dump record").With("table", tableName)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package dryrun
+
+import (
+	"context"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+)
+
+type database struct {
+	base   interfaces.Database
+	report *Report
+}
+
+// NewDatabase returns Database client that forwards reads to base client and records writes into report. Import log written in the run (e.g. by rewind) is visible to following reads. HTTP cache is never returned, then the full response is always fetched.
+func NewDatabase(base interfaces.Database, report *Report) interfaces.Database {
+	return &database{
+		base:   base,
+		report: report,
+	}
+}
+
+// PutImportLog keeps the same rule as base client that import log never moves backward.
+func (x *database) PutImportLog(ctx context.Context, id types.FeedID, log *model.ImportLog) error {
+	return x.setImportLog(ctx, id, log, false)
+}
+
+func (x *database) SetImportLog(ctx context.Context, id types.FeedID, log *model.ImportLog) error {
+	return x.setImportLog(ctx, id, log, true)
+}
+
+func (x *database) setImportLog(ctx context.Context, id types.FeedID, log *model.ImportLog, force bool) error {
+	x.report.mutex.Lock()
+	r, ok := x.report.ImportLogs[id]
+	x.report.mutex.Unlock()
+
+	if !ok {
+		current, err := x.base.GetLatestImportLog(ctx, id)
+		if err != nil {
+			return err
+		}
+		r = &ImportLogReport{Current: current, Next: current}
+	}
+	if !force && r.Next.IsNewerThan(log) {
+		return nil
+	}
+	r.Next = log
+
+	x.report.mutex.Lock()
+	x.report.ImportLogs[id] = r
+	x.report.mutex.Unlock()
+
+	return nil
+}
+
+func (x *database) GetLatestImportLog(ctx context.Context, id types.FeedID) (*model.ImportLog, error) {
+	x.report.mutex.Lock()
+	r, ok := x.report.ImportLogs[id]
+	x.report.mutex.Unlock()
+
+	if ok {
+		return r.Next, nil
+	}
+	return x.base.GetLatestImportLog(ctx, id)
+}
+
+func (x *database) DeleteImportLog(ctx context.Context, id types.FeedID) error {
+	return nil
+}
+
+func (x *database) GetImportCheckpoint(ctx context.Context, id types.FeedID) (*model.ImportCheckpoint, error) {
+	return x.base.GetImportCheckpoint(ctx, id)
+}
+
+func (x *database) PutImportCheckpoint(ctx context.Context, id types.FeedID, checkpoint *model.ImportCheckpoint) error {
+	return nil
+}
+
+func (x *database) DeleteImportCheckpoint(ctx context.Context, id types.FeedID) error {
+	return nil
+}
+
+func (x *database) GetRecordHashes(ctx context.Context, id types.FeedID, keys []string) (map[string]*model.RecordHash, error) {
+	return x.base.GetRecordHashes(ctx, id, keys)
+}
+
+func (x *database) ListRecordHashes(ctx context.Context, id types.FeedID) ([]*model.RecordHash, error) {
+	return x.base.ListRecordHashes(ctx, id)
+}
+
+func (x *database) PutRecordHashes(ctx context.Context, id types.FeedID, hashes []*model.RecordHash) error {
+	x.report.mutex.Lock()
+	defer x.report.mutex.Unlock()
+	x.report.hash(id).Put += len(hashes)
+	return nil
+}
+
+func (x *database) DeleteRecordHashes(ctx context.Context, id types.FeedID, keys []string) error {
+	x.report.mutex.Lock()
+	defer x.report.mutex.Unlock()
+	x.report.hash(id).Delete += len(keys)
+	return nil
+}
+
+func (x *database) GetSnapshot(ctx context.Context, id types.FeedID) (*model.Snapshot, error) {
+	return x.base.GetSnapshot(ctx, id)
+}
+
+func (x *database) PutSnapshot(ctx context.Context, id types.FeedID, snapshot *model.Snapshot) error {
+	x.report.mutex.Lock()
+	defer x.report.mutex.Unlock()
+	x.report.Snapshots[id] = len(snapshot.Data)
+	return nil
+}
+
+func (x *database) DeleteSnapshot(ctx context.Context, id types.FeedID) error {
+	return nil
+}
+
+func (x *database) GetHTTPCache(ctx context.Context, key string) (*model.HTTPCache, error) {
+	return nil, nil
+}
+
+func (x *database) PutHTTPCache(ctx context.Context, key string, cache *model.HTTPCache) error {
+	return nil
+}
+
+func (x *database) GetAlertLog(ctx context.Context, key string) (*model.AlertLog, error) {
+	return x.base.GetAlertLog(ctx, key)
+}
+
+func (x *database) PutAlertLog(ctx context.Context, log *model.AlertLog) error {
+	return nil
+}
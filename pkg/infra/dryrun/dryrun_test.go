@@ -0,0 +1,99 @@
+package dryrun_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/infra/dryrun"
+	"github.com/m-mizutani/drone/pkg/infra/memdb"
+	"github.com/m-mizutani/gt"
+)
+
+type record struct {
+	ID   string
+	Name string
+}
+
+func TestBigQuery(t *testing.T) {
+	ctx := context.Background()
+	mock := bq.NewMock()
+	gt.NoError(t, mock.CreateOrUpdateSchema(ctx, "existing", bigquery.Schema{
+		{Name: "ID", Type: bigquery.StringFieldType},
+	}, nil))
+
+	report := dryrun.NewReport()
+	var dump bytes.Buffer
+	client := dryrun.NewBigQuery(mock, report, dryrun.WithDump(&dump))
+
+	schema := bigquery.Schema{
+		{Name: "ID", Type: bigquery.StringFieldType},
+		{Name: "Name", Type: bigquery.StringFieldType},
+	}
+	gt.NoError(t, client.CreateOrUpdateSchema(ctx, "existing", schema, nil))
+	gt.NoError(t, client.CreateOrUpdateSchema(ctx, "new_table", schema, nil))
+	gt.NoError(t, client.Insert(ctx, "existing", []record{{ID: "a", Name: "x"}, {ID: "b", Name: "y"}}))
+
+	// Nothing is written to base client
+	gt.A(t, mock.InsertedData).Length(0)
+	gt.A(t, mock.Schemas["existing"]).Length(1)
+	gt.M(t, mock.Schemas).NotHaveKey("new_table")
+
+	gt.True(t, report.Tables["existing"].Exists)
+	gt.A(t, report.Tables["existing"].Changes).Length(1).At(0, func(t testing.TB, v model.SchemaChange) {
+		gt.V(t, v.Field).Equal("Name")
+	})
+	gt.V(t, report.Tables["existing"].Rows).Equal(2)
+	gt.False(t, report.Tables["new_table"].Exists)
+
+	// Nil and empty data are ignored
+	gt.NoError(t, client.Insert(ctx, "existing", nil))
+	gt.NoError(t, client.Insert(ctx, "existing", []record{}))
+	gt.V(t, report.Tables["existing"].Rows).Equal(2)
+
+	gt.V(t, dump.String()).Equal(`{"table":"existing","record":{"ID":"a","Name":"x"}}` + "\n" +
+		`{"table":"existing","record":{"ID":"b","Name":"y"}}` + "\n")
+}
+
+func TestDatabase(t *testing.T) {
+	ctx := context.Background()
+	base := memdb.New()
+	current := &model.ImportLog{LatestRecord: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	gt.NoError(t, base.PutImportLog(ctx, types.FeedAbuseChFeodo, current))
+	gt.NoError(t, base.PutHTTPCache(ctx, "feed", &model.HTTPCache{ETag: `"v1"`}))
+
+	report := dryrun.NewReport()
+	db := dryrun.NewDatabase(base, report)
+
+	next := &model.ImportLog{LatestRecord: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}
+	gt.NoError(t, db.PutImportLog(ctx, types.FeedAbuseChFeodo, next))
+	gt.NoError(t, db.PutRecordHashes(ctx, types.FeedAbuseChFeodo, []*model.RecordHash{{Key: "a"}, {Key: "b"}}))
+	gt.NoError(t, db.PutSnapshot(ctx, types.FeedAbuseChFeodo, &model.Snapshot{Data: []byte("[]")}))
+
+	// Written import log is visible in dry run, but not stored in base
+	gt.V(t, gt.R1(db.GetLatestImportLog(ctx, types.FeedAbuseChFeodo)).NoError(t).LatestRecord).Equal(next.LatestRecord)
+	gt.V(t, gt.R1(base.GetLatestImportLog(ctx, types.FeedAbuseChFeodo)).NoError(t).LatestRecord).Equal(current.LatestRecord)
+	gt.V(t, gt.R1(base.ListRecordHashes(ctx, types.FeedAbuseChFeodo)).NoError(t)).Nil()
+	gt.V(t, gt.R1(db.GetHTTPCache(ctx, "feed")).NoError(t)).Nil()
+
+	// Import log never moves backward by PutImportLog, but SetImportLog (rewind) can
+	gt.NoError(t, db.PutImportLog(ctx, types.FeedAbuseChFeodo, current))
+	gt.V(t, gt.R1(db.GetLatestImportLog(ctx, types.FeedAbuseChFeodo)).NoError(t).LatestRecord).Equal(next.LatestRecord)
+	gt.NoError(t, db.PutImportLog(ctx, types.FeedOTXSubscribed, current))
+	gt.NoError(t, db.PutImportLog(ctx, types.FeedOTXSubscribed, &model.ImportLog{}))
+	gt.V(t, gt.R1(db.GetLatestImportLog(ctx, types.FeedOTXSubscribed)).NoError(t).LatestRecord).Equal(current.LatestRecord)
+	gt.NoError(t, db.SetImportLog(ctx, types.FeedOTXSubscribed, &model.ImportLog{}))
+	gt.V(t, gt.R1(db.GetLatestImportLog(ctx, types.FeedOTXSubscribed)).NoError(t).LatestRecord).Equal(time.Time{})
+
+	var out bytes.Buffer
+	gt.NoError(t, report.Print(&out))
+	gt.S(t, out.String()).Contains("current: 2024-01-01T00:00:00Z")
+	gt.S(t, out.String()).Contains("next:    2024-02-01T00:00:00Z")
+	gt.S(t, out.String()).Contains("put: 2, delete: 0")
+	gt.S(t, out.String()).Contains("size: 2 bytes")
+}
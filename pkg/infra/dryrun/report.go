@@ -0,0 +1,132 @@
+// Package dryrun provides BigQuery and Database clients that run import pipeline without writing. Reads are forwarded to the actual clients and writes are recorded into Report.
+package dryrun
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+)
+
+// Report is a summary of writes that are skipped by dry run.
+type Report struct {
+	mutex sync.Mutex
+
+	Tables     map[string]*TableReport
+	ImportLogs map[types.FeedID]*ImportLogReport
+	Hashes     map[types.FeedID]*HashReport
+	Snapshots  map[types.FeedID]int
+}
+
+type TableReport struct {
+	// Exists is false if the table would be created.
+	Exists  bool
+	Changes []model.SchemaChange
+	Rows    int
+}
+
+type ImportLogReport struct {
+	Current *model.ImportLog
+	Next    *model.ImportLog
+}
+
+type HashReport struct {
+	Put    int
+	Delete int
+}
+
+func NewReport() *Report {
+	return &Report{
+		Tables:     map[string]*TableReport{},
+		ImportLogs: map[types.FeedID]*ImportLogReport{},
+		Hashes:     map[types.FeedID]*HashReport{},
+		Snapshots:  map[types.FeedID]int{},
+	}
+}
+
+func (x *Report) table(name string) *TableReport {
+	if _, ok := x.Tables[name]; !ok {
+		x.Tables[name] = &TableReport{}
+	}
+	return x.Tables[name]
+}
+
+func (x *Report) hash(id types.FeedID) *HashReport {
+	if _, ok := x.Hashes[id]; !ok {
+		x.Hashes[id] = &HashReport{}
+	}
+	return x.Hashes[id]
+}
+
+// Print writes human readable summary of the report.
+func (x *Report) Print(w io.Writer) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	p := &printer{w: w}
+	p.printf("Dry run summary (nothing is written)\n")
+
+	for _, name := range sortedKeys(x.Tables) {
+		t := x.Tables[name]
+		p.printf("\nTable %s\n", name)
+		switch {
+		case !t.Exists:
+			p.printf("  schema: table will be created\n")
+		case len(t.Changes) == 0:
+			p.printf("  schema: no change\n")
+		default:
+			p.printf("  schema:\n")
+			for _, c := range t.Changes {
+				p.printf("    %s\n", c.String())
+			}
+		}
+		p.printf("  rows:   %d\n", t.Rows)
+	}
+
+	for _, id := range sortedKeys(x.ImportLogs) {
+		l := x.ImportLogs[id]
+		p.printf("\nImport log %s\n", id)
+		if l.Current != nil {
+			p.printf("  current: %s\n", l.Current.LatestRecord.Format(time.RFC3339))
+		} else {
+			p.printf("  current: (none)\n")
+		}
+		p.printf("  next:    %s\n", l.Next.LatestRecord.Format(time.RFC3339))
+	}
+
+	for _, id := range sortedKeys(x.Hashes) {
+		h := x.Hashes[id]
+		p.printf("\nRecord hashes %s\n  put: %d, delete: %d\n", id, h.Put, h.Delete)
+	}
+
+	for _, id := range sortedKeys(x.Snapshots) {
+		p.printf("\nSnapshot %s\n  size: %d bytes\n", id, x.Snapshots[id])
+	}
+
+	return p.err
+}
+
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (x *printer) printf(format string, args ...any) {
+	if x.err != nil {
+		return
+	}
+	_, x.err = fmt.Fprintf(x.w, format, args...)
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -2,14 +2,21 @@ package firestore
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"github.com/m-mizutani/drone/pkg/domain/interfaces"
 	"github.com/m-mizutani/drone/pkg/domain/model"
 	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/utils"
 	"github.com/m-mizutani/goerr"
 )
 
@@ -20,7 +27,19 @@ type Client struct {
 }
 
 const (
-	importLogTable = "import_logs"
+	importLogTable    = "import_logs"
+	checkpointTable   = "import_checkpoints"
+	recordHashTable   = "record_hashes"
+	recordHashRecords = "records"
+	snapshotTable     = "snapshots"
+	snapshotChunks    = "chunks"
+	httpCacheTable    = "http_caches"
+	alertLogTable     = "alert_logs"
+
+	// firestoreBatchSize is maximum number of documents in one GetAll call.
+	firestoreBatchSize = 500
+	// snapshotChunkSize is maximum bytes of snapshot data in a chunk document. A document must be smaller than 1 MiB.
+	snapshotChunkSize = 512 * 1024
 )
 
 func New(ctx context.Context, projectID, databaseID string) (*Client, error) {
@@ -74,7 +93,7 @@ func (x *Client) PutImportLog(ctx context.Context, id types.FeedID, log *model.I
 				return goerr.Wrap(err, "failed to convert import log").With("id", id)
 			}
 
-			if oldLog.LatestRecord.After(log.LatestRecord) {
+			if oldLog.IsNewerThan(log) {
 				return nil
 			}
 		}
@@ -91,6 +110,364 @@ func (x *Client) PutImportLog(ctx context.Context, id types.FeedID, log *model.I
 	return nil
 }
 
+// SetImportLog implements interfaces.Database.
+func (x *Client) SetImportLog(ctx context.Context, id types.FeedID, log *model.ImportLog) error {
+	doc := x.client.Collection(importLogTable).Doc(id.String())
+	if _, err := doc.Set(ctx, log); err != nil {
+		return goerr.Wrap(err, "failed to set import log").With("id", id)
+	}
+
+	return nil
+}
+
+// DeleteImportLog implements interfaces.Database.
+func (x *Client) DeleteImportLog(ctx context.Context, id types.FeedID) error {
+	doc := x.client.Collection(importLogTable).Doc(id.String())
+	if _, err := doc.Delete(ctx); err != nil {
+		return goerr.Wrap(err, "failed to delete import log").With("id", id)
+	}
+
+	return nil
+}
+
+// GetImportCheckpoint implements interfaces.Database.
+func (x *Client) GetImportCheckpoint(ctx context.Context, id types.FeedID) (*model.ImportCheckpoint, error) {
+	doc, err := x.client.Collection(checkpointTable).Doc(id.String()).Get(ctx)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			return nil, goerr.Wrap(err, "failed to get import checkpoint").With("id", id)
+		}
+
+		return nil, nil
+	}
+
+	var checkpoint model.ImportCheckpoint
+	if err := doc.DataTo(&checkpoint); err != nil {
+		return nil, goerr.Wrap(err, "failed to convert import checkpoint").With("id", id)
+	}
+
+	return &checkpoint, nil
+}
+
+// PutImportCheckpoint implements interfaces.Database.
+func (x *Client) PutImportCheckpoint(ctx context.Context, id types.FeedID, checkpoint *model.ImportCheckpoint) error {
+	if _, err := x.client.Collection(checkpointTable).Doc(id.String()).Set(ctx, checkpoint); err != nil {
+		return goerr.Wrap(err, "failed to put import checkpoint").With("id", id)
+	}
+
+	return nil
+}
+
+// DeleteImportCheckpoint implements interfaces.Database.
+func (x *Client) DeleteImportCheckpoint(ctx context.Context, id types.FeedID) error {
+	if _, err := x.client.Collection(checkpointTable).Doc(id.String()).Delete(ctx); err != nil {
+		return goerr.Wrap(err, "failed to delete import checkpoint").With("id", id)
+	}
+
+	return nil
+}
+
+// recordHashDoc returns document reference of the record hash. Key is escaped because document ID must not contain '/'.
+func (x *Client) recordHashDoc(id types.FeedID, key string) *firestore.DocumentRef {
+	return x.client.Collection(recordHashTable).Doc(id.String()).Collection(recordHashRecords).Doc(url.PathEscape(key))
+}
+
+// GetRecordHashes implements interfaces.Database.
+func (x *Client) GetRecordHashes(ctx context.Context, id types.FeedID, keys []string) (map[string]*model.RecordHash, error) {
+	resp := map[string]*model.RecordHash{}
+
+	for s := 0; s < len(keys); s += firestoreBatchSize {
+		e := min(s+firestoreBatchSize, len(keys))
+
+		var refs []*firestore.DocumentRef
+		for _, key := range keys[s:e] {
+			refs = append(refs, x.recordHashDoc(id, key))
+		}
+
+		snapshots, err := x.client.GetAll(ctx, refs)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to get record hashes").With("id", id)
+		}
+
+		for _, snapshot := range snapshots {
+			if !snapshot.Exists() {
+				continue
+			}
+
+			var hash model.RecordHash
+			if err := snapshot.DataTo(&hash); err != nil {
+				return nil, goerr.Wrap(err, "failed to convert record hash").With("id", id)
+			}
+			resp[hash.Key] = &hash
+		}
+	}
+
+	return resp, nil
+}
+
+// ListRecordHashes implements interfaces.Database.
+func (x *Client) ListRecordHashes(ctx context.Context, id types.FeedID) ([]*model.RecordHash, error) {
+	iter := x.client.Collection(recordHashTable).Doc(id.String()).Collection(recordHashRecords).Documents(ctx)
+	defer iter.Stop()
+
+	var resp []*model.RecordHash
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to list record hashes").With("id", id)
+		}
+
+		var hash model.RecordHash
+		if err := doc.DataTo(&hash); err != nil {
+			return nil, goerr.Wrap(err, "failed to convert record hash").With("id", id)
+		}
+		resp = append(resp, &hash)
+	}
+
+	return resp, nil
+}
+
+// PutRecordHashes implements interfaces.Database.
+func (x *Client) PutRecordHashes(ctx context.Context, id types.FeedID, hashes []*model.RecordHash) error {
+	writer := x.client.BulkWriter(ctx)
+
+	var jobs []*firestore.BulkWriterJob
+	for _, hash := range hashes {
+		job, err := writer.Set(x.recordHashDoc(id, hash.Key), hash)
+		if err != nil {
+			writer.End()
+			return goerr.Wrap(err, "failed to put record hash").With("id", id).With("key", hash.Key)
+		}
+		jobs = append(jobs, job)
+	}
+	writer.End()
+
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return goerr.Wrap(err, "failed to put record hash").With("id", id)
+		}
+	}
+
+	return nil
+}
+
+// DeleteRecordHashes implements interfaces.Database.
+func (x *Client) DeleteRecordHashes(ctx context.Context, id types.FeedID, keys []string) error {
+	writer := x.client.BulkWriter(ctx)
+
+	var jobs []*firestore.BulkWriterJob
+	for _, key := range keys {
+		job, err := writer.Delete(x.recordHashDoc(id, key))
+		if err != nil {
+			writer.End()
+			return goerr.Wrap(err, "failed to delete record hash").With("id", id).With("key", key)
+		}
+		jobs = append(jobs, job)
+	}
+	writer.End()
+
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return goerr.Wrap(err, "failed to delete record hash").With("id", id)
+		}
+	}
+
+	return nil
+}
+
+// snapshotHead is a document of the latest snapshot. Data of snapshot is split into chunk documents because a document must be smaller than 1 MiB. Chunks are written with a new generation before the head refers to them, then a reader never sees a partially written snapshot.
+type snapshotHead struct {
+	Generation string
+	Chunks     int
+	CreatedAt  time.Time
+	// Data is snapshot data stored in the head document by older versions.
+	Data []byte
+}
+
+type snapshotChunk struct {
+	Data []byte
+}
+
+// snapshotChunkDoc returns document reference of n-th chunk of the snapshot generation.
+func (x *Client) snapshotChunkDoc(id types.FeedID, generation string, n int) *firestore.DocumentRef {
+	return x.client.Collection(snapshotTable).Doc(id.String()).Collection(snapshotChunks).Doc(fmt.Sprintf("%s-%06d", generation, n))
+}
+
+// GetSnapshot implements interfaces.Database.
+func (x *Client) GetSnapshot(ctx context.Context, id types.FeedID) (*model.Snapshot, error) {
+	doc, err := x.client.Collection(snapshotTable).Doc(id.String()).Get(ctx)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			return nil, goerr.Wrap(err, "failed to get snapshot").With("id", id)
+		}
+
+		return nil, nil
+	}
+
+	var head snapshotHead
+	if err := doc.DataTo(&head); err != nil {
+		return nil, goerr.Wrap(err, "failed to convert snapshot").With("id", id)
+	}
+	if head.Generation == "" {
+		return &model.Snapshot{Data: head.Data, CreatedAt: head.CreatedAt}, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, head.Chunks)
+	for i := range refs {
+		refs[i] = x.snapshotChunkDoc(id, head.Generation, i)
+	}
+
+	var data []byte
+	for s := 0; s < len(refs); s += firestoreBatchSize {
+		e := min(s+firestoreBatchSize, len(refs))
+		docs, err := x.client.GetAll(ctx, refs[s:e])
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to get snapshot chunks").With("id", id)
+		}
+		for _, doc := range docs {
+			if !doc.Exists() {
+				return nil, goerr.New("snapshot chunk is missing").With("id", id).With("chunk", doc.Ref.ID)
+			}
+			var chunk snapshotChunk
+			if err := doc.DataTo(&chunk); err != nil {
+				return nil, goerr.Wrap(err, "failed to convert snapshot chunk").With("id", id)
+			}
+			data = append(data, chunk.Data...)
+		}
+	}
+
+	return &model.Snapshot{Data: data, CreatedAt: head.CreatedAt}, nil
+}
+
+// PutSnapshot implements interfaces.Database. Chunks of the previous generation are deleted after the head refers to the new generation.
+func (x *Client) PutSnapshot(ctx context.Context, id types.FeedID, snapshot *model.Snapshot) error {
+	head := &snapshotHead{
+		Generation: uuid.NewString(),
+		Chunks:     (len(snapshot.Data) + snapshotChunkSize - 1) / snapshotChunkSize,
+		CreatedAt:  snapshot.CreatedAt,
+	}
+
+	writer := x.client.BulkWriter(ctx)
+	var jobs []*firestore.BulkWriterJob
+	for i := 0; i < head.Chunks; i++ {
+		chunk := &snapshotChunk{Data: snapshot.Data[i*snapshotChunkSize : min((i+1)*snapshotChunkSize, len(snapshot.Data))]}
+		job, err := writer.Set(x.snapshotChunkDoc(id, head.Generation, i), chunk)
+		if err != nil {
+			writer.End()
+			return goerr.Wrap(err, "failed to put snapshot chunk").With("id", id).With("chunk", i)
+		}
+		jobs = append(jobs, job)
+	}
+	writer.End()
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return goerr.Wrap(err, "failed to put snapshot chunk").With("id", id)
+		}
+	}
+
+	if _, err := x.client.Collection(snapshotTable).Doc(id.String()).Set(ctx, head); err != nil {
+		return goerr.Wrap(err, "failed to put snapshot").With("id", id)
+	}
+
+	x.deleteSnapshotChunks(ctx, id, head.Generation)
+	return nil
+}
+
+// DeleteSnapshot implements interfaces.Database. Chunks are deleted after the head because chunks without the head are never read.
+func (x *Client) DeleteSnapshot(ctx context.Context, id types.FeedID) error {
+	if _, err := x.client.Collection(snapshotTable).Doc(id.String()).Delete(ctx); err != nil {
+		return goerr.Wrap(err, "failed to delete snapshot").With("id", id)
+	}
+
+	x.deleteSnapshotChunks(ctx, id, "")
+	return nil
+}
+
+// deleteSnapshotChunks deletes chunks of generations other than the current one. Failure is only logged because stale chunks are never read.
+func (x *Client) deleteSnapshotChunks(ctx context.Context, id types.FeedID, current string) {
+	iter := x.client.Collection(snapshotTable).Doc(id.String()).Collection(snapshotChunks).Documents(ctx)
+	defer iter.Stop()
+
+	writer := x.client.BulkWriter(ctx)
+	defer writer.End()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			utils.HandleError(ctx, "failed to list snapshot chunks", goerr.Wrap(err).With("id", id))
+			return
+		}
+		if strings.HasPrefix(doc.Ref.ID, current+"-") {
+			continue
+		}
+		if _, err := writer.Delete(doc.Ref); err != nil {
+			utils.HandleError(ctx, "failed to delete stale snapshot chunk", goerr.Wrap(err).With("id", id))
+			return
+		}
+	}
+}
+
+// GetHTTPCache implements interfaces.Database.
+func (x *Client) GetHTTPCache(ctx context.Context, key string) (*model.HTTPCache, error) {
+	doc, err := x.client.Collection(httpCacheTable).Doc(url.PathEscape(key)).Get(ctx)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			return nil, goerr.Wrap(err, "failed to get http cache").With("key", key)
+		}
+
+		return nil, nil
+	}
+
+	var cache model.HTTPCache
+	if err := doc.DataTo(&cache); err != nil {
+		return nil, goerr.Wrap(err, "failed to convert http cache").With("key", key)
+	}
+
+	return &cache, nil
+}
+
+// PutHTTPCache implements interfaces.Database.
+func (x *Client) PutHTTPCache(ctx context.Context, key string, cache *model.HTTPCache) error {
+	if _, err := x.client.Collection(httpCacheTable).Doc(url.PathEscape(key)).Set(ctx, cache); err != nil {
+		return goerr.Wrap(err, "failed to put http cache").With("key", key)
+	}
+
+	return nil
+}
+
+// GetAlertLog implements interfaces.Database.
+func (x *Client) GetAlertLog(ctx context.Context, key string) (*model.AlertLog, error) {
+	doc, err := x.client.Collection(alertLogTable).Doc(url.PathEscape(key)).Get(ctx)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			return nil, goerr.Wrap(err, "failed to get alert log").With("key", key)
+		}
+
+		return nil, nil
+	}
+
+	var log model.AlertLog
+	if err := doc.DataTo(&log); err != nil {
+		return nil, goerr.Wrap(err, "failed to convert alert log").With("key", key)
+	}
+
+	return &log, nil
+}
+
+// PutAlertLog implements interfaces.Database.
+func (x *Client) PutAlertLog(ctx context.Context, log *model.AlertLog) error {
+	if _, err := x.client.Collection(alertLogTable).Doc(url.PathEscape(log.Key)).Set(ctx, log); err != nil {
+		return goerr.Wrap(err, "failed to put alert log").With("key", log.Key)
+	}
+
+	return nil
+}
+
 // func hashNamespace(input types.Namespace) string {
 // 	hash := sha512.New()
 // 	hash.Write([]byte(input))
@@ -0,0 +1,411 @@
+package httpfetch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// Provider is a setting of HTTP access for each feed provider.
+type Provider struct {
+	// Timeout is a timeout of one HTTP request including reading response body.
+	Timeout time.Duration
+	// MaxRetries is a maximum number of retries on network error, 429 and 5xx responses.
+	MaxRetries int
+	// RateLimit is a number of requests per second. Zero means unlimited.
+	RateLimit float64
+	// Burst is a bucket size of rate limit. It's at least 1.
+	Burst int
+}
+
+const (
+	ProviderOTX     = "otx"
+	ProviderAbuseCh = "abuse.ch"
+
+	defaultUserAgent = "drone (+https://github.com/m-mizutani/drone)"
+
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+)
+
+// DefaultProvider is a setting used for providers that are not configured.
+var DefaultProvider = Provider{
+	Timeout:    time.Minute,
+	MaxRetries: 5,
+}
+
+// CacheStore saves validators of responses. interfaces.Database satisfies it.
+type CacheStore interface {
+	GetHTTPCache(ctx context.Context, key string) (*model.HTTPCache, error)
+	PutHTTPCache(ctx context.Context, key string, cache *model.HTTPCache) error
+}
+
+// Client is a HTTP client shared by all feeds. It applies per provider timeout, retry and rate limit, and sends conditional requests with validators in CacheStore.
+type Client struct {
+	httpClient *http.Client
+	userAgent  string
+	providers  map[string]Provider
+	cache      CacheStore
+
+	limiters *limiters
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+type limiters struct {
+	mutex sync.Mutex
+	m     map[string]*rate.Limiter
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces underlying http.Client. Timeout of the client is ignored because timeout is applied per provider.
+func WithHTTPClient(client *http.Client) Option {
+	return func(x *Client) {
+		x.httpClient = client
+	}
+}
+
+// WithTransport replaces transport of underlying http.Client, e.g. to record or replay responses in test.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(x *Client) {
+		x.httpClient = &http.Client{Transport: transport}
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(x *Client) {
+		x.userAgent = userAgent
+	}
+}
+
+// WithProvider sets HTTP access setting of the provider.
+func WithProvider(name string, provider Provider) Option {
+	return func(x *Client) {
+		x.providers[name] = provider
+	}
+}
+
+// WithCacheStore sets a store of response validators. Without it, conditional requests are not sent.
+func WithCacheStore(cache CacheStore) Option {
+	return func(x *Client) {
+		x.cache = cache
+	}
+}
+
+func New(options ...Option) *Client {
+	x := &Client{
+		httpClient: &http.Client{},
+		userAgent:  defaultUserAgent,
+		providers: map[string]Provider{
+			// OTX API has rate limit per API key
+			ProviderOTX: {
+				Timeout:    2 * time.Minute,
+				MaxRetries: 5,
+				RateLimit:  1,
+				Burst:      1,
+			},
+			ProviderAbuseCh: {
+				Timeout:    time.Minute,
+				MaxRetries: 5,
+			},
+		},
+		limiters: &limiters{m: map[string]*rate.Limiter{}},
+		sleep:    sleepContext,
+	}
+
+	for _, opt := range options {
+		opt(x)
+	}
+
+	return x
+}
+
+// With returns a copy of the client with additional options. Rate limiters are shared with the original client.
+func (x *Client) With(options ...Option) *Client {
+	c := *x
+	c.providers = make(map[string]Provider, len(x.providers))
+	for k, v := range x.providers {
+		c.providers[k] = v
+	}
+
+	for _, opt := range options {
+		opt(&c)
+	}
+	return &c
+}
+
+// Request is a GET request to a provider.
+type Request struct {
+	Provider string
+	URL      string
+	Header   http.Header
+	// CacheKey enables conditional request. Validators of the last committed response of the key are sent as If-None-Match and If-Modified-Since.
+	CacheKey string
+}
+
+// Response is a fetched response. Body is fully read.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// NotModified is true if the server returns 304 for conditional request. Body is empty.
+	NotModified bool
+
+	cacheKey string
+	url      string
+}
+
+// Provider returns HTTP access setting of the provider. It returns DefaultProvider if the provider is not configured.
+func (x *Client) Provider(name string) Provider {
+	if p, ok := x.providers[name]; ok {
+		return p
+	}
+	return DefaultProvider
+}
+
+func (x *Client) limiter(name string, p Provider) *rate.Limiter {
+	if p.RateLimit <= 0 {
+		return nil
+	}
+
+	x.limiters.mutex.Lock()
+	defer x.limiters.mutex.Unlock()
+
+	if l, ok := x.limiters.m[name]; ok {
+		return l
+	}
+	l := rate.NewLimiter(rate.Limit(p.RateLimit), max(p.Burst, 1))
+	x.limiters.m[name] = l
+	return l
+}
+
+// Fetch sends GET request. It retries on network error, 429 and 5xx with backoff honoring Retry-After header. A response other than 2xx and 304 is returned as error.
+func (x *Client) Fetch(ctx context.Context, req *Request) (resp *Response, err error) {
+	ctx, span := utils.StartSpan(ctx, "httpfetch.Fetch",
+		attribute.String("drone.provider", req.Provider),
+		attribute.String("url.full", req.URL),
+	)
+	defer func() {
+		if resp != nil {
+			span.SetAttributes(
+				attribute.Int("http.response.status_code", resp.StatusCode),
+				attribute.Int("http.response.body.size", len(resp.Body)),
+			)
+		}
+		utils.EndSpan(span, err)
+	}()
+
+	p := x.Provider(req.Provider)
+	limiter := x.limiter(req.Provider, p)
+
+	var cache *model.HTTPCache
+	if req.CacheKey != "" && x.cache != nil {
+		c, err := x.cache.GetHTTPCache(ctx, req.CacheKey)
+		if err != nil {
+			return nil, goerr.Wrap(err, "Fail to get http cache").With("key", req.CacheKey)
+		}
+		if c != nil && c.URL == req.URL {
+			cache = c
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= p.MaxRetries; attempt++ {
+		if limiter != nil {
+			if err := limiter.Wait(ctx); err != nil {
+				return nil, goerr.Wrap(err, "Fail to wait rate limit").With("provider", req.Provider)
+			}
+		}
+
+		resp, retryAfter, err := x.do(ctx, p, req, cache)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+
+		if retryAfter < 0 || attempt == p.MaxRetries {
+			break
+		}
+
+		wait := retryAfter
+		if wait == 0 {
+			wait = min(initialBackoff<<attempt, maxBackoff)
+		}
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt+1),
+			attribute.String("wait", wait.String()),
+			attribute.String("error", err.Error()),
+		))
+		utils.Logger().WarnContext(ctx, "Fail to fetch, retrying",
+			"url", req.URL,
+			"attempt", attempt+1,
+			"wait", wait,
+			utils.ErrLog(err),
+		)
+		if err := x.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, lastErr
+}
+
+// do sends a request once. retryAfter is negative if the error is not retryable, zero if backoff should be used, or positive value given by Retry-After.
+func (x *Client) do(ctx context.Context, p Provider, req *Request, cache *model.HTTPCache) (resp *Response, retryAfter time.Duration, err error) {
+	reqCtx := ctx
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodGet, req.URL, nil)
+	if err != nil {
+		return nil, -1, goerr.Wrap(err, "Fail to create request").With("url", req.URL)
+	}
+	for k, vs := range req.Header {
+		for _, v := range vs {
+			httpReq.Header.Add(k, v)
+		}
+	}
+	httpReq.Header.Set("User-Agent", x.userAgent)
+	if cache != nil {
+		if cache.ETag != "" {
+			httpReq.Header.Set("If-None-Match", cache.ETag)
+		}
+		if cache.LastModified != "" {
+			httpReq.Header.Set("If-Modified-Since", cache.LastModified)
+		}
+	}
+
+	httpResp, err := x.httpClient.Do(httpReq)
+	if err != nil {
+		// parent context is canceled, then no more retry. Timeout of the request is retryable.
+		if ctx.Err() != nil {
+			return nil, -1, goerr.Wrap(err, "Fail to send request").With("url", req.URL)
+		}
+		// Certificate verification error will not be resolved by retry.
+		if isCertificateError(err) {
+			return nil, -1, goerr.Wrap(err, "Fail to verify server certificate").With("url", req.URL)
+		}
+		return nil, 0, goerr.Wrap(err, "Fail to send request").With("url", req.URL)
+	}
+	defer utils.SafeClose(httpResp.Body)
+
+	if httpResp.StatusCode == http.StatusNotModified {
+		return &Response{
+			StatusCode:  httpResp.StatusCode,
+			Header:      httpResp.Header,
+			NotModified: true,
+			cacheKey:    req.CacheKey,
+			url:         req.URL,
+		}, 0, nil
+	}
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, 0, goerr.Wrap(err, "Fail to read response body").With("url", req.URL)
+	}
+
+	if httpResp.StatusCode < 200 || 300 <= httpResp.StatusCode {
+		err := goerr.Wrap(types.ErrUnexpectedStatus, "Fail to get response").
+			With("url", req.URL).
+			With("status", httpResp.StatusCode).
+			With("body", truncate(body, 256))
+
+		if httpResp.StatusCode == http.StatusTooManyRequests || httpResp.StatusCode >= 500 {
+			return nil, parseRetryAfter(httpResp.Header.Get("Retry-After"), time.Now()), err
+		}
+		return nil, -1, err
+	}
+
+	return &Response{
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header,
+		Body:       body,
+		cacheKey:   req.CacheKey,
+		url:        req.URL,
+	}, 0, nil
+}
+
+// Commit saves validators of the response into CacheStore. It should be called after the response is processed successfully, otherwise the response may be skipped in next fetch.
+func (x *Client) Commit(ctx context.Context, resp *Response) error {
+	if x.cache == nil || resp.cacheKey == "" || resp.NotModified {
+		return nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+
+	if err := x.cache.PutHTTPCache(ctx, resp.cacheKey, &model.HTTPCache{
+		URL:          resp.url,
+		ETag:         etag,
+		LastModified: lastModified,
+		UpdatedAt:    time.Now(),
+	}); err != nil {
+		return goerr.Wrap(err, "Fail to put http cache").With("key", resp.cacheKey)
+	}
+
+	return nil
+}
+
+// parseRetryAfter parses Retry-After header. It accepts delay seconds and HTTP date. It returns zero if the header is empty or invalid.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+
+	if sec, err := strconv.Atoi(v); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
+
+func truncate(b []byte, n int) string {
+	if len(b) > n {
+		return string(b[:n]) + "..."
+	}
+	return string(b)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return goerr.Wrap(ctx.Err(), "canceled while waiting retry")
+	case <-time.After(d):
+		return nil
+	}
+}
+
+func isCertificateError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &verifyErr) ||
+		errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr)
+}
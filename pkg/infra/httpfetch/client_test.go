@@ -0,0 +1,114 @@
+package httpfetch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/httpfetch"
+	"github.com/m-mizutani/drone/pkg/infra/memdb"
+	"github.com/m-mizutani/gt"
+)
+
+func TestFetchRetry(t *testing.T) {
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gt.Equal(t, r.Header.Get("User-Agent"), "test-agent")
+		if atomic.AddInt32(&count, 1) < 3 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	var waits []time.Duration
+	client := httpfetch.New(
+		httpfetch.WithUserAgent("test-agent"),
+		httpfetch.WithSleep(func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		}),
+	)
+
+	resp := gt.R1(client.Fetch(context.Background(), &httpfetch.Request{URL: srv.URL})).NoError(t)
+	gt.Equal(t, string(resp.Body), "ok")
+	gt.Equal(t, waits, []time.Duration{7 * time.Second, 7 * time.Second})
+}
+
+func TestFetchNotRetryable(t *testing.T) {
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	client := httpfetch.New()
+	_, err := client.Fetch(context.Background(), &httpfetch.Request{URL: srv.URL})
+	gt.True(t, errors.Is(err, types.ErrUnexpectedStatus))
+	gt.Equal(t, atomic.LoadInt32(&count), 1)
+}
+
+func TestFetchConditional(t *testing.T) {
+	const etag = `"v1"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := httpfetch.New(httpfetch.WithCacheStore(memdb.New()))
+	req := &httpfetch.Request{URL: srv.URL, CacheKey: "test"}
+
+	// Not committed, then the next fetch downloads again
+	resp := gt.R1(client.Fetch(ctx, req)).NoError(t)
+	gt.False(t, resp.NotModified)
+	resp = gt.R1(client.Fetch(ctx, req)).NoError(t)
+	gt.False(t, resp.NotModified)
+
+	gt.NoError(t, client.Commit(ctx, resp))
+	resp = gt.R1(client.Fetch(ctx, req)).NoError(t)
+	gt.True(t, resp.NotModified)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	gt.Equal(t, httpfetch.ParseRetryAfter("", now), 0)
+	gt.Equal(t, httpfetch.ParseRetryAfter("30", now), 30*time.Second)
+	gt.Equal(t, httpfetch.ParseRetryAfter("Mon, 01 Jan 2024 00:01:00 GMT", now), time.Minute)
+	gt.Equal(t, httpfetch.ParseRetryAfter("invalid", now), 0)
+}
+
+func TestFetchCertificateError(t *testing.T) {
+	var count int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+	}))
+	defer srv.Close()
+
+	var waits int
+	client := httpfetch.New(
+		httpfetch.WithSleep(func(ctx context.Context, d time.Duration) error {
+			waits++
+			return nil
+		}),
+	)
+
+	// Certificate of test server is not trusted
+	_, err := client.Fetch(context.Background(), &httpfetch.Request{URL: srv.URL})
+	gt.Error(t, err)
+	gt.Equal(t, waits, 0)
+	gt.Equal(t, atomic.LoadInt32(&count), 0)
+}
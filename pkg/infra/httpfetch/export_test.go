@@ -0,0 +1,15 @@
+package httpfetch
+
+import (
+	"context"
+	"time"
+)
+
+var ParseRetryAfter = parseRetryAfter
+
+// WithSleep replaces sleep function for retry to avoid waiting in test.
+func WithSleep(sleep func(ctx context.Context, d time.Duration) error) Option {
+	return func(x *Client) {
+		x.sleep = sleep
+	}
+}
@@ -0,0 +1,80 @@
+package httpfetch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/goerr"
+)
+
+// TransportConfig is a network setting shared by all feeds.
+type TransportConfig struct {
+	// ProxyURL is a URL of HTTP(S) proxy. Credentials can be set as userinfo of the URL. If empty, proxy is configured by environment variables (HTTP_PROXY, HTTPS_PROXY and NO_PROXY).
+	ProxyURL string
+	// CAFile is a PEM file of CA certificates. They are added to system certificate pool, e.g. for TLS inspection proxy.
+	CAFile string
+	// ClientCertFile and ClientKeyFile are PEM files of client certificate for mTLS.
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// NewTransport builds http.Transport from the config. Other settings are same as http.DefaultTransport.
+func NewTransport(cfg TransportConfig) (*http.Transport, error) {
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, goerr.New("http.DefaultTransport is not *http.Transport")
+	}
+	transport := base.Clone()
+
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil || proxy.Scheme == "" || proxy.Host == "" {
+			// Do not include the URL in error because it may have credentials
+			return nil, goerr.Wrap(types.ErrInvalidOption, "invalid proxy URL")
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := os.ReadFile(filepath.Clean(cfg.CAFile))
+		if err != nil {
+			return nil, goerr.Wrap(err, "Fail to read CA file").With("path", cfg.CAFile)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "no certificate in CA file").With("path", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		if cfg.ClientCertFile == "" || cfg.ClientKeyFile == "" {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "both client certificate and key are required")
+		}
+
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, goerr.Wrap(err, "Fail to load client certificate").
+				With("cert", cfg.ClientCertFile).
+				With("key", cfg.ClientKeyFile)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
@@ -0,0 +1,71 @@
+package httpfetch_test
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/drone/pkg/infra/httpfetch"
+	"github.com/m-mizutani/gt"
+)
+
+func TestTransportCAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	gt.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.Certificate().Raw,
+	}), 0600))
+
+	ctx := context.Background()
+	req := &httpfetch.Request{URL: srv.URL}
+
+	// Without CA file, certificate of test server is not trusted
+	noCA := gt.R1(httpfetch.NewTransport(httpfetch.TransportConfig{})).NoError(t)
+	_, err := httpfetch.New(
+		httpfetch.WithHTTPClient(&http.Client{Transport: noCA}),
+		httpfetch.WithProvider("", httpfetch.Provider{}),
+	).Fetch(ctx, req)
+	gt.Error(t, err)
+
+	withCA := gt.R1(httpfetch.NewTransport(httpfetch.TransportConfig{CAFile: caFile})).NoError(t)
+	resp := gt.R1(httpfetch.New(
+		httpfetch.WithHTTPClient(&http.Client{Transport: withCA}),
+	).Fetch(ctx, req)).NoError(t)
+	gt.Equal(t, string(resp.Body), "ok")
+}
+
+func TestTransportProxy(t *testing.T) {
+	var proxyAuth, requestURI string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxyAuth = r.Header.Get("Proxy-Authorization")
+		requestURI = r.RequestURI
+		_, _ = w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	proxyURL := "http://user:pass@" + proxy.Listener.Addr().String()
+	transport := gt.R1(httpfetch.NewTransport(httpfetch.TransportConfig{ProxyURL: proxyURL})).NoError(t)
+
+	client := httpfetch.New(httpfetch.WithHTTPClient(&http.Client{Transport: transport}))
+	resp := gt.R1(client.Fetch(context.Background(), &httpfetch.Request{
+		URL: "http://feed.example.com/list.json",
+	})).NoError(t)
+
+	gt.Equal(t, string(resp.Body), "proxied")
+	gt.Equal(t, requestURI, "http://feed.example.com/list.json")
+	gt.S(t, proxyAuth).HasPrefix("Basic ")
+}
+
+func TestTransportInvalid(t *testing.T) {
+	gt.R1(httpfetch.NewTransport(httpfetch.TransportConfig{ProxyURL: "://invalid"})).Error(t)
+	gt.R1(httpfetch.NewTransport(httpfetch.TransportConfig{ClientCertFile: "cert.pem"})).Error(t)
+}
@@ -9,13 +9,23 @@ import (
 )
 
 type MemDB struct {
-	latestLogs map[types.FeedID]*model.ImportLog
-	rwLock     sync.RWMutex
+	latestLogs   map[types.FeedID]*model.ImportLog
+	checkpoints  map[types.FeedID]*model.ImportCheckpoint
+	recordHashes map[types.FeedID]map[string]*model.RecordHash
+	snapshots    map[types.FeedID]*model.Snapshot
+	httpCaches   map[string]*model.HTTPCache
+	alertLogs    map[string]*model.AlertLog
+	rwLock       sync.RWMutex
 }
 
 func New() *MemDB {
 	return &MemDB{
-		latestLogs: map[types.FeedID]*model.ImportLog{},
+		latestLogs:   map[types.FeedID]*model.ImportLog{},
+		checkpoints:  map[types.FeedID]*model.ImportCheckpoint{},
+		recordHashes: map[types.FeedID]map[string]*model.RecordHash{},
+		snapshots:    map[types.FeedID]*model.Snapshot{},
+		httpCaches:   map[string]*model.HTTPCache{},
+		alertLogs:    map[string]*model.AlertLog{},
 	}
 }
 
@@ -30,10 +40,149 @@ func (x *MemDB) PutImportLog(ctx context.Context, id types.FeedID, log *model.Im
 	x.rwLock.Lock()
 	defer x.rwLock.Unlock()
 
-	if old, ok := x.latestLogs[id]; ok && old.LatestRecord.After(log.LatestRecord) {
+	if old, ok := x.latestLogs[id]; ok && old.IsNewerThan(log) {
 		return nil
 	}
 
 	x.latestLogs[id] = log
 	return nil
 }
+
+func (x *MemDB) SetImportLog(ctx context.Context, id types.FeedID, log *model.ImportLog) error {
+	x.rwLock.Lock()
+	defer x.rwLock.Unlock()
+
+	x.latestLogs[id] = log
+	return nil
+}
+
+func (x *MemDB) DeleteImportLog(ctx context.Context, id types.FeedID) error {
+	x.rwLock.Lock()
+	defer x.rwLock.Unlock()
+
+	delete(x.latestLogs, id)
+	return nil
+}
+
+func (x *MemDB) GetImportCheckpoint(ctx context.Context, id types.FeedID) (*model.ImportCheckpoint, error) {
+	x.rwLock.RLock()
+	defer x.rwLock.RUnlock()
+
+	return x.checkpoints[id], nil
+}
+
+func (x *MemDB) PutImportCheckpoint(ctx context.Context, id types.FeedID, checkpoint *model.ImportCheckpoint) error {
+	x.rwLock.Lock()
+	defer x.rwLock.Unlock()
+
+	x.checkpoints[id] = checkpoint
+	return nil
+}
+
+func (x *MemDB) DeleteImportCheckpoint(ctx context.Context, id types.FeedID) error {
+	x.rwLock.Lock()
+	defer x.rwLock.Unlock()
+
+	delete(x.checkpoints, id)
+	return nil
+}
+
+func (x *MemDB) GetRecordHashes(ctx context.Context, id types.FeedID, keys []string) (map[string]*model.RecordHash, error) {
+	x.rwLock.RLock()
+	defer x.rwLock.RUnlock()
+
+	resp := map[string]*model.RecordHash{}
+	for _, key := range keys {
+		if hash, ok := x.recordHashes[id][key]; ok {
+			resp[key] = hash
+		}
+	}
+	return resp, nil
+}
+
+func (x *MemDB) ListRecordHashes(ctx context.Context, id types.FeedID) ([]*model.RecordHash, error) {
+	x.rwLock.RLock()
+	defer x.rwLock.RUnlock()
+
+	var resp []*model.RecordHash
+	for _, hash := range x.recordHashes[id] {
+		resp = append(resp, hash)
+	}
+	return resp, nil
+}
+
+func (x *MemDB) PutRecordHashes(ctx context.Context, id types.FeedID, hashes []*model.RecordHash) error {
+	x.rwLock.Lock()
+	defer x.rwLock.Unlock()
+
+	if _, ok := x.recordHashes[id]; !ok {
+		x.recordHashes[id] = map[string]*model.RecordHash{}
+	}
+	for _, hash := range hashes {
+		x.recordHashes[id][hash.Key] = hash
+	}
+	return nil
+}
+
+func (x *MemDB) DeleteRecordHashes(ctx context.Context, id types.FeedID, keys []string) error {
+	x.rwLock.Lock()
+	defer x.rwLock.Unlock()
+
+	for _, key := range keys {
+		delete(x.recordHashes[id], key)
+	}
+	return nil
+}
+
+func (x *MemDB) GetSnapshot(ctx context.Context, id types.FeedID) (*model.Snapshot, error) {
+	x.rwLock.RLock()
+	defer x.rwLock.RUnlock()
+
+	return x.snapshots[id], nil
+}
+
+func (x *MemDB) PutSnapshot(ctx context.Context, id types.FeedID, snapshot *model.Snapshot) error {
+	x.rwLock.Lock()
+	defer x.rwLock.Unlock()
+
+	x.snapshots[id] = snapshot
+	return nil
+}
+
+func (x *MemDB) DeleteSnapshot(ctx context.Context, id types.FeedID) error {
+	x.rwLock.Lock()
+	defer x.rwLock.Unlock()
+
+	delete(x.snapshots, id)
+	return nil
+}
+
+func (x *MemDB) GetHTTPCache(ctx context.Context, key string) (*model.HTTPCache, error) {
+	x.rwLock.RLock()
+	defer x.rwLock.RUnlock()
+
+	return x.httpCaches[key], nil
+}
+
+func (x *MemDB) PutHTTPCache(ctx context.Context, key string, cache *model.HTTPCache) error {
+	x.rwLock.Lock()
+	defer x.rwLock.Unlock()
+
+	x.httpCaches[key] = cache
+	return nil
+}
+
+func (x *MemDB) GetAlertLog(ctx context.Context, key string) (*model.AlertLog, error) {
+	x.rwLock.RLock()
+	defer x.rwLock.RUnlock()
+
+	return x.alertLogs[key], nil
+}
+
+func (x *MemDB) PutAlertLog(ctx context.Context, log *model.AlertLog) error {
+	x.rwLock.Lock()
+	defer x.rwLock.Unlock()
+
+	x.alertLogs[log.Key] = log
+	return nil
+}
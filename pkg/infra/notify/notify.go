@@ -0,0 +1,178 @@
+// Package notify sends alerts to Slack incoming webhook and generic JSON webhook. Sent alerts are recorded in Database to send each alert only once across runs.
+package notify
+
+import (
+	"context"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+// Message is an alert with rendered text.
+type Message struct {
+	Alert *model.Alert
+	Text  string
+}
+
+// Target is a destination of messages.
+type Target interface {
+	// Name identifies the target in alert log, e.g. "slack".
+	Name() string
+	Send(ctx context.Context, msg *Message) error
+}
+
+// defaultTemplates are message templates for each alert type. Template data is model.Alert.
+var defaultTemplates = map[types.AlertType]string{
+	types.AlertMatch: `:rotating_light: {{ .Title }}
+Feed: {{ .Data.Feed }}
+Indicator: {{ .Data.Indicator }} ({{ .Data.IndicatorType }})
+Log: {{ .Data.SourceTable }}.{{ .Data.SourceColumn }} at {{ .Data.LogTimestamp.Format "2006-01-02T15:04:05Z07:00" }}`,
+	types.AlertImportFailure: `:warning: {{ .Title }}
+Error: {{ .Data.Error }}`,
+	types.AlertFeedEvent: `:mag: {{ .Title }}`,
+}
+
+type Notifier struct {
+	db         interfaces.Database
+	targets    []Target
+	alertTypes map[types.AlertType]struct{}
+	templates  map[types.AlertType]string
+	now        func() time.Time
+}
+
+var _ interfaces.Notifier = &Notifier{}
+
+type Option func(*Notifier)
+
+func WithTarget(target Target) Option {
+	return func(x *Notifier) {
+		x.targets = append(x.targets, target)
+	}
+}
+
+// WithAlertTypes enables only given alert types. All types are enabled by default.
+func WithAlertTypes(alertTypes ...types.AlertType) Option {
+	return func(x *Notifier) {
+		x.alertTypes = map[types.AlertType]struct{}{}
+		for _, t := range alertTypes {
+			x.alertTypes[t] = struct{}{}
+		}
+	}
+}
+
+// WithTemplate replaces message template of the alert type. The template is text/template and model.Alert is given as data.
+func WithTemplate(alertType types.AlertType, tmpl string) Option {
+	return func(x *Notifier) {
+		x.templates[alertType] = tmpl
+	}
+}
+
+func New(db interfaces.Database, options ...Option) (*Notifier, error) {
+	x := &Notifier{
+		db:        db,
+		templates: map[types.AlertType]string{},
+		now:       time.Now,
+	}
+	for t, tmpl := range defaultTemplates {
+		x.templates[t] = tmpl
+	}
+	for _, opt := range options {
+		opt(x)
+	}
+
+	// Parse templates in advance to detect error before sending alerts
+	for t, tmpl := range x.templates {
+		if _, err := parseTemplate(t, tmpl); err != nil {
+			return nil, err
+		}
+	}
+
+	return x, nil
+}
+
+func parseTemplate(alertType types.AlertType, tmpl string) (*template.Template, error) {
+	t, err := template.New(string(alertType)).Parse(tmpl)
+	if err != nil {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "invalid alert template").With("type", alertType).With("error", err.Error())
+	}
+	return t, nil
+}
+
+// Notify sends alerts to all targets. Alerts that are disabled or have been sent are skipped. Sent alert is recorded for each target, then an alert that fails to be sent to a target is retried only for the target in the next run.
+func (x *Notifier) Notify(ctx context.Context, alerts ...*model.Alert) error {
+	for _, alert := range alerts {
+		if x.alertTypes != nil {
+			if _, ok := x.alertTypes[alert.Type]; !ok {
+				continue
+			}
+		}
+
+		key := string(alert.Type) + ":" + alert.Key
+		var msg *Message
+		for _, target := range x.targets {
+			targetKey := key + "@" + target.Name()
+			sent, err := x.db.GetAlertLog(ctx, targetKey)
+			if err != nil {
+				return goerr.Wrap(err, "Fail to get alert log").With("key", targetKey)
+			}
+			if sent != nil {
+				utils.Logger().Debug("Alert has been sent to the target, skip", "key", targetKey, "sent_at", sent.SentAt)
+				continue
+			}
+
+			if msg == nil {
+				text, err := x.render(alert)
+				if err != nil {
+					return err
+				}
+				msg = &Message{Alert: alert, Text: text}
+			}
+
+			if err := target.Send(ctx, msg); err != nil {
+				return goerr.Wrap(err, "Fail to send alert").With("key", key).With("target", target.Name())
+			}
+
+			if err := x.db.PutAlertLog(ctx, &model.AlertLog{
+				Key:    targetKey,
+				Type:   string(alert.Type),
+				SentAt: x.now(),
+			}); err != nil {
+				return goerr.Wrap(err, "Fail to put alert log").With("key", targetKey)
+			}
+			utils.Logger().Info("Sent alert", "key", key, "target", target.Name(), "title", alert.Title)
+		}
+	}
+
+	return nil
+}
+
+func (x *Notifier) render(alert *model.Alert) (string, error) {
+	src, ok := x.templates[alert.Type]
+	if !ok {
+		src = "{{ .Title }}"
+	}
+
+	tmpl, err := parseTemplate(alert.Type, src)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, alert); err != nil {
+		return "", goerr.Wrap(err, "Fail to render alert").With("type", alert.Type).With("key", alert.Key)
+	}
+	return buf.String(), nil
+}
+
+type discard struct{}
+
+func (discard) Notify(ctx context.Context, alerts ...*model.Alert) error { return nil }
+
+// Discard is a Notifier that sends nothing. It's used if no target is configured.
+var Discard interfaces.Notifier = discard{}
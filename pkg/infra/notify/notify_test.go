@@ -0,0 +1,147 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/memdb"
+	"github.com/m-mizutani/drone/pkg/infra/notify"
+	"github.com/m-mizutani/gt"
+)
+
+func newServer(t *testing.T, status int) (*httptest.Server, *[]map[string]any) {
+	var bodies []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := gt.R1(io.ReadAll(r.Body)).NoError(t)
+		var body map[string]any
+		gt.NoError(t, json.Unmarshal(raw, &body))
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &bodies
+}
+
+func matchAlert() *model.Alert {
+	return &model.Alert{
+		Type:      types.AlertMatch,
+		Key:       "abuse.ch-feodo/ip/192.0.2.10/vpc_flows/dst_ip",
+		Title:     "Indicator 192.0.2.10 is found",
+		CreatedAt: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		Data: &model.Match{
+			Feed:          "abuse.ch-feodo",
+			IndicatorType: "ip",
+			Indicator:     "192.0.2.10",
+			SourceTable:   "vpc_flows",
+			SourceColumn:  "dst_ip",
+			LogTimestamp:  time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestNotify(t *testing.T) {
+	ctx := context.Background()
+	slack, slackBodies := newServer(t, http.StatusOK)
+	webhook, webhookBodies := newServer(t, http.StatusOK)
+
+	db := memdb.New()
+	notifier := gt.R1(notify.New(db,
+		notify.WithTarget(notify.NewSlack(slack.URL, nil)),
+		notify.WithTarget(notify.NewWebhook(webhook.URL, nil)),
+	)).NoError(t)
+
+	gt.NoError(t, notifier.Notify(ctx, matchAlert()))
+	gt.A(t, *slackBodies).Length(1).At(0, func(t testing.TB, v map[string]any) {
+		gt.V(t, v["text"]).Equal(":rotating_light: Indicator 192.0.2.10 is found\n" +
+			"Feed: abuse.ch-feodo\n" +
+			"Indicator: 192.0.2.10 (ip)\n" +
+			"Log: vpc_flows.dst_ip at 2024-01-15T10:00:00Z")
+	})
+	gt.A(t, *webhookBodies).Length(1).At(0, func(t testing.TB, v map[string]any) {
+		gt.V(t, v["type"]).Equal("match")
+		gt.V(t, v["key"]).Equal("abuse.ch-feodo/ip/192.0.2.10/vpc_flows/dst_ip")
+		gt.V(t, v["data"].(map[string]any)["Indicator"]).Equal("192.0.2.10")
+	})
+
+	// The same alert is not sent again
+	gt.NoError(t, notifier.Notify(ctx, matchAlert()))
+	gt.A(t, *slackBodies).Length(1)
+	gt.A(t, *webhookBodies).Length(1)
+	gt.V(t, gt.R1(db.GetAlertLog(ctx, "match:abuse.ch-feodo/ip/192.0.2.10/vpc_flows/dst_ip@slack")).NoError(t)).NotNil()
+	gt.V(t, gt.R1(db.GetAlertLog(ctx, "match:abuse.ch-feodo/ip/192.0.2.10/vpc_flows/dst_ip@webhook")).NoError(t)).NotNil()
+}
+
+func TestNotifyPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	slack, slackBodies := newServer(t, http.StatusOK)
+
+	var webhookCount int
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookCount++
+		if webhookCount == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(webhook.Close)
+
+	notifier := gt.R1(notify.New(memdb.New(),
+		notify.WithTarget(notify.NewSlack(slack.URL, nil)),
+		notify.WithTarget(notify.NewWebhook(webhook.URL, nil)),
+	)).NoError(t)
+
+	gt.Error(t, notifier.Notify(ctx, matchAlert()))
+	gt.A(t, *slackBodies).Length(1)
+	gt.V(t, webhookCount).Equal(1)
+
+	// Retry sends the alert only to the failed target
+	gt.NoError(t, notifier.Notify(ctx, matchAlert()))
+	gt.A(t, *slackBodies).Length(1)
+	gt.V(t, webhookCount).Equal(2)
+}
+
+func TestNotifyFilterAndTemplate(t *testing.T) {
+	ctx := context.Background()
+	slack, slackBodies := newServer(t, http.StatusOK)
+
+	notifier := gt.R1(notify.New(memdb.New(),
+		notify.WithTarget(notify.NewSlack(slack.URL, nil)),
+		notify.WithAlertTypes(types.AlertImportFailure),
+		notify.WithTemplate(types.AlertImportFailure, "failed: {{ .Data.Error }}"),
+	)).NoError(t)
+
+	gt.NoError(t, notifier.Notify(ctx, matchAlert(), &model.Alert{
+		Type:  types.AlertImportFailure,
+		Key:   "otx-subscribed/2024-01-15",
+		Title: "Import of otx-subscribed failed",
+		Data:  map[string]string{"Error": "timeout"},
+	}))
+
+	gt.A(t, *slackBodies).Length(1).At(0, func(t testing.TB, v map[string]any) {
+		gt.V(t, v["text"]).Equal("failed: timeout")
+	})
+}
+
+func TestNotifyFailure(t *testing.T) {
+	ctx := context.Background()
+	slack, slackBodies := newServer(t, http.StatusInternalServerError)
+
+	db := memdb.New()
+	notifier := gt.R1(notify.New(db, notify.WithTarget(notify.NewSlack(slack.URL, nil)))).NoError(t)
+
+	gt.Error(t, notifier.Notify(ctx, matchAlert()))
+	gt.A(t, *slackBodies).Length(1)
+	// Failed alert is not recorded, then it's retried in the next run
+	gt.V(t, gt.R1(db.GetAlertLog(ctx, "match:abuse.ch-feodo/ip/192.0.2.10/vpc_flows/dst_ip@slack")).NoError(t)).Nil()
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	_, err := notify.New(memdb.New(), notify.WithTemplate(types.AlertMatch, "{{ .Title"))
+	gt.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/goerr"
+)
+
+const sendTimeout = 30 * time.Second
+
+type webhook struct {
+	name       string
+	url        string
+	httpClient *http.Client
+	body       func(msg *Message) any
+}
+
+// NewSlack returns a target of Slack incoming webhook. Rendered text is sent as "text" field.
+func NewSlack(url string, httpClient *http.Client) Target {
+	return &webhook{
+		name:       "slack",
+		url:        url,
+		httpClient: httpClient,
+		body: func(msg *Message) any {
+			return map[string]string{"text": msg.Text}
+		},
+	}
+}
+
+// webhookBody is a JSON body sent by generic webhook target.
+type webhookBody struct {
+	Type      types.AlertType `json:"type"`
+	Key       string          `json:"key"`
+	Title     string          `json:"title"`
+	Text      string          `json:"text"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      any             `json:"data"`
+}
+
+// NewWebhook returns a target of generic JSON webhook. Alert and rendered text are sent as JSON object.
+func NewWebhook(url string, httpClient *http.Client) Target {
+	return &webhook{
+		name:       "webhook",
+		url:        url,
+		httpClient: httpClient,
+		body: func(msg *Message) any {
+			return &webhookBody{
+				Type:      msg.Alert.Type,
+				Key:       msg.Alert.Key,
+				Title:     msg.Alert.Title,
+				Text:      msg.Text,
+				CreatedAt: msg.Alert.CreatedAt,
+				Data:      msg.Alert.Data,
+			}
+		},
+	}
+}
+
+func (x *webhook) Name() string { return x.name }
+
+func (x *webhook) Send(ctx context.Context, msg *Message) error {
+	raw, err := json.Marshal(x.body(msg))
+	if err != nil {
+		return goerr.Wrap(err, "Fail to encode webhook body")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, x.url, bytes.NewReader(raw))
+	if err != nil {
+		return goerr.Wrap(err, "Fail to create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	httpClient := x.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return goerr.Wrap(err, "Fail to send webhook")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return goerr.Wrap(types.ErrUnexpectedStatus, "webhook returned error").
+			With("code", resp.StatusCode).
+			With("body", string(body))
+	}
+
+	return nil
+}
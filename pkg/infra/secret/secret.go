@@ -0,0 +1,146 @@
+// Package secret resolves secret references in configuration values. A reference is one of "env:NAME" (environment variable), "file:PATH" (content of file) or "sm://projects/PROJECT/secrets/SECRET[/versions/VERSION]" (Google Secret Manager). A value without these prefixes is used as it is.
+package secret
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/goerr"
+	"google.golang.org/api/secretmanager/v1"
+)
+
+const (
+	PrefixEnv           = "env:"
+	PrefixFile          = "file:"
+	PrefixSecretManager = "sm://"
+)
+
+// AccessFunc returns payload of Secret Manager secret version. Name is a resource name of secret version.
+type AccessFunc func(ctx context.Context, name string) (string, error)
+
+// Resolver resolves secret references. Resolved values are cached, then each secret is fetched once.
+type Resolver struct {
+	access    AccessFunc
+	lookupEnv func(string) (string, bool)
+
+	mutex sync.Mutex
+	cache map[string]string
+}
+
+type Option func(*Resolver)
+
+// WithSecretManager replaces access to Google Secret Manager. By default, Secret Manager API is called with Application Default Credentials.
+func WithSecretManager(access AccessFunc) Option {
+	return func(x *Resolver) {
+		x.access = access
+	}
+}
+
+// WithLookupEnv replaces lookup of environment variables.
+func WithLookupEnv(lookupEnv func(string) (string, bool)) Option {
+	return func(x *Resolver) {
+		x.lookupEnv = lookupEnv
+	}
+}
+
+func New(options ...Option) *Resolver {
+	x := &Resolver{
+		access:    accessSecretManager,
+		lookupEnv: os.LookupEnv,
+		cache:     map[string]string{},
+	}
+	for _, opt := range options {
+		opt(x)
+	}
+	return x
+}
+
+// IsReference returns true if the value is a secret reference.
+func IsReference(v string) bool {
+	return strings.HasPrefix(v, PrefixEnv) || strings.HasPrefix(v, PrefixFile) || strings.HasPrefix(v, PrefixSecretManager)
+}
+
+// Resolve returns the secret value referred by v. If v is not a reference, v is returned as it is. Trailing newline of file and Secret Manager payload is removed.
+func (x *Resolver) Resolve(ctx context.Context, v string) (string, error) {
+	if !IsReference(v) {
+		return v, nil
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if resolved, ok := x.cache[v]; ok {
+		return resolved, nil
+	}
+
+	var resolved string
+	switch {
+	case strings.HasPrefix(v, PrefixEnv):
+		name := strings.TrimPrefix(v, PrefixEnv)
+		value, ok := x.lookupEnv(name)
+		if !ok {
+			return "", goerr.Wrap(types.ErrInvalidOption, "environment variable of secret is not set").With("name", name)
+		}
+		resolved = value
+
+	case strings.HasPrefix(v, PrefixFile):
+		path := strings.TrimPrefix(v, PrefixFile)
+		raw, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return "", goerr.Wrap(err, "Fail to read secret file").With("path", path)
+		}
+		resolved = strings.TrimRight(string(raw), "\r\n")
+
+	case strings.HasPrefix(v, PrefixSecretManager):
+		name, err := secretVersionName(strings.TrimPrefix(v, PrefixSecretManager))
+		if err != nil {
+			return "", err
+		}
+		value, err := x.access(ctx, name)
+		if err != nil {
+			return "", goerr.Wrap(err, "Fail to access secret").With("name", name)
+		}
+		resolved = strings.TrimRight(value, "\r\n")
+	}
+
+	x.cache[v] = resolved
+	return resolved, nil
+}
+
+// secretVersionName returns resource name of secret version. Latest version is used if version is not specified.
+func secretVersionName(name string) (string, error) {
+	parts := strings.Split(name, "/")
+	switch {
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "secrets" && parts[1] != "" && parts[3] != "":
+		return name + "/versions/latest", nil
+	case len(parts) == 6 && parts[0] == "projects" && parts[2] == "secrets" && parts[4] == "versions" && parts[1] != "" && parts[3] != "" && parts[5] != "":
+		return name, nil
+	default:
+		return "", goerr.Wrap(types.ErrInvalidOption, "invalid Secret Manager resource name").With("name", name)
+	}
+}
+
+func accessSecretManager(ctx context.Context, name string) (string, error) {
+	svc, err := secretmanager.NewService(ctx)
+	if err != nil {
+		return "", goerr.Wrap(err, "Fail to create Secret Manager client")
+	}
+
+	resp, err := svc.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return "", goerr.Wrap(err, "Fail to access secret version").With("name", name)
+	}
+	if resp.Payload == nil {
+		return "", goerr.New("secret version has no payload").With("name", name)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", goerr.Wrap(err, "Fail to decode secret payload").With("name", name)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,63 @@
+package secret_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/secret"
+	"github.com/m-mizutani/gt"
+)
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	gt.NoError(t, os.WriteFile(path, []byte("from-file\n"), 0600))
+
+	var accessed []string
+	resolver := secret.New(
+		secret.WithSecretManager(func(ctx context.Context, name string) (string, error) {
+			accessed = append(accessed, name)
+			return "from-sm\n", nil
+		}),
+		secret.WithLookupEnv(func(name string) (string, bool) {
+			if name == "OTX_KEY" {
+				return "from-env", true
+			}
+			return "", false
+		}),
+	)
+
+	testCases := map[string]string{
+		"plain-value":                          "plain-value",
+		"env:OTX_KEY":                          "from-env",
+		"file:" + path:                         "from-file",
+		"sm://projects/p/secrets/s":            "from-sm",
+		"sm://projects/p/secrets/s/versions/3": "from-sm",
+	}
+	for ref, expected := range testCases {
+		t.Run(ref, func(t *testing.T) {
+			gt.V(t, gt.R1(resolver.Resolve(ctx, ref)).NoError(t)).Equal(expected)
+		})
+	}
+	gt.A(t, accessed).Length(2).
+		Have("projects/p/secrets/s/versions/latest").
+		Have("projects/p/secrets/s/versions/3")
+
+	t.Run("resolved value is cached", func(t *testing.T) {
+		gt.R1(resolver.Resolve(ctx, "sm://projects/p/secrets/s")).NoError(t)
+		gt.A(t, accessed).Length(2)
+	})
+
+	t.Run("invalid reference", func(t *testing.T) {
+		_, err := resolver.Resolve(ctx, "env:NOT_SET")
+		gt.True(t, errors.Is(err, types.ErrInvalidOption))
+		_, err = resolver.Resolve(ctx, "sm://my-secret")
+		gt.True(t, errors.Is(err, types.ErrInvalidOption))
+		_, err = resolver.Resolve(ctx, "file:"+filepath.Join(t.TempDir(), "not-found"))
+		gt.Error(t, err)
+	})
+}
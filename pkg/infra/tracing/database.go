@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type database struct {
+	base interfaces.Database
+}
+
+// NewDatabase returns Database client that forwards all operations to base client in a span of each operation.
+func NewDatabase(base interfaces.Database) interfaces.Database {
+	if _, ok := base.(*database); ok {
+		return base
+	}
+	return &database{base: base}
+}
+
+func startSpan(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return utils.StartSpan(ctx, "db."+op, attrs...)
+}
+
+func feedAttr(id types.FeedID) attribute.KeyValue {
+	return utils.AttrFeedID.String(id.String())
+}
+
+func (x *database) PutImportLog(ctx context.Context, id types.FeedID, log *model.ImportLog) (err error) {
+	ctx, span := startSpan(ctx, "PutImportLog", feedAttr(id))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.PutImportLog(ctx, id, log)
+}
+
+func (x *database) GetLatestImportLog(ctx context.Context, id types.FeedID) (_ *model.ImportLog, err error) {
+	ctx, span := startSpan(ctx, "GetLatestImportLog", feedAttr(id))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.GetLatestImportLog(ctx, id)
+}
+
+func (x *database) SetImportLog(ctx context.Context, id types.FeedID, log *model.ImportLog) (err error) {
+	ctx, span := startSpan(ctx, "SetImportLog", feedAttr(id))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.SetImportLog(ctx, id, log)
+}
+
+func (x *database) DeleteImportLog(ctx context.Context, id types.FeedID) (err error) {
+	ctx, span := startSpan(ctx, "DeleteImportLog", feedAttr(id))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.DeleteImportLog(ctx, id)
+}
+
+func (x *database) GetImportCheckpoint(ctx context.Context, id types.FeedID) (_ *model.ImportCheckpoint, err error) {
+	ctx, span := startSpan(ctx, "GetImportCheckpoint", feedAttr(id))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.GetImportCheckpoint(ctx, id)
+}
+
+func (x *database) PutImportCheckpoint(ctx context.Context, id types.FeedID, checkpoint *model.ImportCheckpoint) (err error) {
+	ctx, span := startSpan(ctx, "PutImportCheckpoint", feedAttr(id), utils.AttrPage.Int(checkpoint.Page))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.PutImportCheckpoint(ctx, id, checkpoint)
+}
+
+func (x *database) DeleteImportCheckpoint(ctx context.Context, id types.FeedID) (err error) {
+	ctx, span := startSpan(ctx, "DeleteImportCheckpoint", feedAttr(id))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.DeleteImportCheckpoint(ctx, id)
+}
+
+func (x *database) GetRecordHashes(ctx context.Context, id types.FeedID, keys []string) (_ map[string]*model.RecordHash, err error) {
+	ctx, span := startSpan(ctx, "GetRecordHashes", feedAttr(id), utils.AttrRows.Int(len(keys)))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.GetRecordHashes(ctx, id, keys)
+}
+
+func (x *database) ListRecordHashes(ctx context.Context, id types.FeedID) (_ []*model.RecordHash, err error) {
+	ctx, span := startSpan(ctx, "ListRecordHashes", feedAttr(id))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.ListRecordHashes(ctx, id)
+}
+
+func (x *database) PutRecordHashes(ctx context.Context, id types.FeedID, hashes []*model.RecordHash) (err error) {
+	ctx, span := startSpan(ctx, "PutRecordHashes", feedAttr(id), utils.AttrRows.Int(len(hashes)))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.PutRecordHashes(ctx, id, hashes)
+}
+
+func (x *database) DeleteRecordHashes(ctx context.Context, id types.FeedID, keys []string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteRecordHashes", feedAttr(id), utils.AttrRows.Int(len(keys)))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.DeleteRecordHashes(ctx, id, keys)
+}
+
+func (x *database) GetSnapshot(ctx context.Context, id types.FeedID) (_ *model.Snapshot, err error) {
+	ctx, span := startSpan(ctx, "GetSnapshot", feedAttr(id))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.GetSnapshot(ctx, id)
+}
+
+func (x *database) PutSnapshot(ctx context.Context, id types.FeedID, snapshot *model.Snapshot) (err error) {
+	ctx, span := startSpan(ctx, "PutSnapshot", feedAttr(id))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.PutSnapshot(ctx, id, snapshot)
+}
+
+func (x *database) DeleteSnapshot(ctx context.Context, id types.FeedID) (err error) {
+	ctx, span := startSpan(ctx, "DeleteSnapshot", feedAttr(id))
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.DeleteSnapshot(ctx, id)
+}
+
+func (x *database) GetHTTPCache(ctx context.Context, key string) (_ *model.HTTPCache, err error) {
+	ctx, span := startSpan(ctx, "GetHTTPCache")
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.GetHTTPCache(ctx, key)
+}
+
+func (x *database) PutHTTPCache(ctx context.Context, key string, cache *model.HTTPCache) (err error) {
+	ctx, span := startSpan(ctx, "PutHTTPCache")
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.PutHTTPCache(ctx, key, cache)
+}
+
+func (x *database) GetAlertLog(ctx context.Context, key string) (_ *model.AlertLog, err error) {
+	ctx, span := startSpan(ctx, "GetAlertLog")
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.GetAlertLog(ctx, key)
+}
+
+func (x *database) PutAlertLog(ctx context.Context, log *model.AlertLog) (err error) {
+	ctx, span := startSpan(ctx, "PutAlertLog")
+	defer func() { utils.EndSpan(span, err) }()
+	return x.base.PutAlertLog(ctx, log)
+}
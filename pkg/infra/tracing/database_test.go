@@ -0,0 +1,56 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/memdb"
+	"github.com/m-mizutani/drone/pkg/infra/tracing"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/gt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type failDB struct {
+	interfaces.Database
+}
+
+func (x *failDB) GetSnapshot(ctx context.Context, id types.FeedID) (*model.Snapshot, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestDatabase(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	orig := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(orig) })
+
+	ctx, parent := utils.StartSpan(context.Background(), "import")
+	db := tracing.NewDatabase(&failDB{Database: memdb.New()})
+	gt.NoError(t, db.PutImportLog(ctx, types.FeedAbuseChFeodo, &model.ImportLog{LatestRecord: time.Now()}))
+	_, err := db.GetSnapshot(ctx, types.FeedAbuseChFeodo)
+	gt.Error(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	gt.A(t, spans).Length(3).
+		At(0, func(t testing.TB, v sdktrace.ReadOnlySpan) {
+			gt.V(t, v.Name()).Equal("db.PutImportLog")
+			gt.V(t, v.Parent().SpanID()).Equal(parent.SpanContext().SpanID())
+			gt.A(t, v.Attributes()).Have(utils.AttrFeedID.String(types.FeedAbuseChFeodo.String()))
+			gt.V(t, v.Status().Code).Equal(codes.Unset)
+		}).
+		At(1, func(t testing.TB, v sdktrace.ReadOnlySpan) {
+			gt.V(t, v.Name()).Equal("db.GetSnapshot")
+			gt.V(t, v.Status().Code).Equal(codes.Error)
+		})
+}
@@ -0,0 +1,289 @@
+package lookup
+
+import (
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+)
+
+// Indicator is an indicator of a feed in the index.
+type Indicator struct {
+	Feed       types.FeedID
+	Type       types.IndicatorType
+	Value      string
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	Confidence int64
+	// ExpiresAt is zero if the indicator never expires.
+	ExpiresAt time.Time
+	Tags      []string
+}
+
+// expired returns true if the indicator has been expired at now.
+func (x *Indicator) expired(now time.Time) bool {
+	return !x.ExpiresAt.IsZero() && !now.Before(x.ExpiresAt)
+}
+
+// MatchKind is how the looked up value matched with an indicator.
+type MatchKind string
+
+const (
+	MatchExact MatchKind = "exact"
+	// MatchCIDR is a match of IP address with CIDR indicator.
+	MatchCIDR MatchKind = "cidr"
+	// MatchSubdomain is a match of domain with indicator of its parent domain.
+	MatchSubdomain MatchKind = "subdomain"
+	// MatchURLHost is a match of host in URL with domain or IP indicator.
+	MatchURLHost MatchKind = "url_host"
+)
+
+// Index is an immutable in-memory index of indicators. It's safe for concurrent lookups.
+type Index struct {
+	// hosts has single IP addresses, and prefixes has CIDRs. IP addresses are the majority of indicators, then they are not stored in radix tree to save memory.
+	hosts    map[netip.Addr][]*Indicator
+	prefixes [2]*radixNode // IPv4 and IPv6
+
+	domains map[string][]*Indicator
+	hashes  map[string][]*Indicator
+	urls    map[string][]*Indicator
+
+	size     int
+	loadedAt time.Time
+}
+
+func newIndex() *Index {
+	return &Index{
+		hosts:    map[netip.Addr][]*Indicator{},
+		prefixes: [2]*radixNode{{}, {}},
+		domains:  map[string][]*Indicator{},
+		hashes:   map[string][]*Indicator{},
+		urls:     map[string][]*Indicator{},
+		loadedAt: time.Now(),
+	}
+}
+
+// Size returns number of indicators in the index.
+func (x *Index) Size() int { return x.size }
+
+// LoadedAt returns time when the index was built.
+func (x *Index) LoadedAt() time.Time { return x.loadedAt }
+
+// add adds the indicator. It returns false if the value is invalid for the type.
+func (x *Index) add(ind *Indicator) bool {
+	switch ind.Type {
+	case types.IndicatorIP:
+		prefix, ok := parsePrefix(ind.Value)
+		if !ok {
+			return false
+		}
+		if prefix.IsSingleIP() {
+			x.hosts[prefix.Addr()] = append(x.hosts[prefix.Addr()], ind)
+		} else {
+			x.prefixes[family(prefix.Addr())].insert(prefix, ind)
+		}
+
+	case types.IndicatorDomain:
+		domain := normalizeDomain(ind.Value)
+		if domain == "" {
+			return false
+		}
+		x.domains[domain] = append(x.domains[domain], ind)
+
+	case types.IndicatorHash:
+		hash := strings.ToLower(ind.Value)
+		if !hashPattern.MatchString(hash) {
+			return false
+		}
+		x.hashes[hash] = append(x.hashes[hash], ind)
+
+	case types.IndicatorURL:
+		x.urls[ind.Value] = append(x.urls[ind.Value], ind)
+
+	default:
+		return false
+	}
+
+	x.size++
+	return true
+}
+
+// Match is an indicator matched with the looked up value.
+type Match struct {
+	*Indicator
+	Kind MatchKind
+}
+
+// Lookup returns type of the value and indicators matched with the value. Type of the value is detected from its format: IP address, hash (MD5, SHA-1 or SHA-256 in hex), URL (having scheme) or domain. Indicators expired after the index was built are not matched.
+func (x *Index) Lookup(value string) (types.IndicatorType, []*Match) {
+	indicatorType, matches := x.lookup(value)
+
+	now := time.Now()
+	active := matches[:0]
+	for _, m := range matches {
+		if !m.expired(now) {
+			active = append(active, m)
+		}
+	}
+	return indicatorType, active
+}
+
+func (x *Index) lookup(value string) (types.IndicatorType, []*Match) {
+	value = strings.TrimSpace(value)
+
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return types.IndicatorIP, x.lookupIP(addr, MatchExact, MatchCIDR)
+	}
+	if hashPattern.MatchString(value) {
+		return types.IndicatorHash, toMatches(x.hashes[strings.ToLower(value)], MatchExact)
+	}
+	if _, rest, ok := strings.Cut(value, "://"); ok {
+		matches := toMatches(x.urls[value], MatchExact)
+
+		host := rest
+		if i := strings.IndexAny(host, "/?#"); i >= 0 {
+			host = host[:i]
+		}
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+		if addrPort, err := netip.ParseAddrPort(host); err == nil {
+			matches = append(matches, x.lookupIP(addrPort.Addr(), MatchURLHost, MatchURLHost)...)
+		} else if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+			matches = append(matches, x.lookupIP(addr, MatchURLHost, MatchURLHost)...)
+		} else {
+			if i := strings.LastIndex(host, ":"); i >= 0 {
+				host = host[:i]
+			}
+			matches = append(matches, x.lookupDomain(host, MatchURLHost, MatchURLHost)...)
+		}
+		return types.IndicatorURL, matches
+	}
+
+	return types.IndicatorDomain, x.lookupDomain(value, MatchExact, MatchSubdomain)
+}
+
+func (x *Index) lookupIP(addr netip.Addr, exact, cidr MatchKind) []*Match {
+	addr = addr.Unmap().WithZone("")
+	matches := toMatches(x.hosts[addr], exact)
+	for _, ind := range x.prefixes[family(addr)].lookup(addr) {
+		matches = append(matches, &Match{Indicator: ind, Kind: cidr})
+	}
+	return matches
+}
+
+// lookupDomain matches the domain and its parent domains, e.g. "a.evil.example" matches indicators of "a.evil.example" and "evil.example". Top level domain is not matched.
+func (x *Index) lookupDomain(domain string, exact, subdomain MatchKind) []*Match {
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return nil
+	}
+
+	matches := toMatches(x.domains[domain], exact)
+	for parent := domain; ; {
+		_, next, ok := strings.Cut(parent, ".")
+		if !ok || !strings.Contains(next, ".") {
+			break
+		}
+		parent = next
+		matches = append(matches, toMatches(x.domains[parent], subdomain)...)
+	}
+	return matches
+}
+
+func toMatches(indicators []*Indicator, kind MatchKind) []*Match {
+	matches := make([]*Match, len(indicators))
+	for i, ind := range indicators {
+		matches[i] = &Match{Indicator: ind, Kind: kind}
+	}
+	return matches
+}
+
+var hashPattern = regexp.MustCompile(`^([0-9a-fA-F]{32}|[0-9a-fA-F]{40}|[0-9a-fA-F]{64})$`)
+
+func normalizeDomain(v string) string {
+	v = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(v)), ".")
+	if v == "" || strings.ContainsAny(v, " /:@") {
+		return ""
+	}
+	return v
+}
+
+// parsePrefix parses IP address or CIDR. Address is converted into single address prefix.
+func parsePrefix(v string) (netip.Prefix, bool) {
+	v = strings.TrimSpace(v)
+	if prefix, err := netip.ParsePrefix(v); err == nil {
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96).Masked(), true
+		}
+		return prefix.Masked(), true
+	}
+	addr, err := netip.ParseAddr(v)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap().WithZone("")
+	return netip.PrefixFrom(addr, addr.BitLen()), true
+}
+
+func family(addr netip.Addr) int {
+	if addr.Is4() {
+		return 0
+	}
+	return 1
+}
+
+// radixNode is a node of binary radix tree of IP prefixes. A prefix of n bits is stored in the node at depth n.
+type radixNode struct {
+	children   [2]*radixNode
+	indicators []*Indicator
+}
+
+func bitAt(b []byte, i int) int {
+	return int(b[i/8]>>(7-uint(i%8))) & 1
+}
+
+func (x *radixNode) insert(prefix netip.Prefix, ind *Indicator) {
+	b := prefix.Addr().AsSlice()
+	node := x
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := bitAt(b, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &radixNode{}
+		}
+		node = node.children[bit]
+	}
+	node.indicators = append(node.indicators, ind)
+}
+
+// lookup returns indicators of all prefixes that contain the address, from the shortest prefix.
+func (x *radixNode) lookup(addr netip.Addr) []*Indicator {
+	b := addr.AsSlice()
+	var result []*Indicator
+	node := x
+	for i := 0; node != nil; i++ {
+		result = append(result, node.indicators...)
+		if i >= len(b)*8 {
+			break
+		}
+		node = node.children[bitAt(b, i)]
+	}
+	return result
+}
+
+// sortMatches sorts matches by feed, type and value to make response stable.
+func sortMatches(matches []*Match) {
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Feed != b.Feed {
+			return a.Feed < b.Feed
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Value < b.Value
+	})
+}
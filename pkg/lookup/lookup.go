@@ -0,0 +1,287 @@
+// Package lookup provides fast lookup of indicators imported by drone. Indicators are loaded from BigQuery into an in-memory index, and the index is rebuilt after each import.
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/aging"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+// Load builds index of indicators of the sources in active_indicators view.
+func Load(ctx context.Context, client interfaces.BigQuery, sources []*model.IndicatorSource) (*Index, error) {
+	index := newIndex()
+	if len(sources) == 0 {
+		return index, nil
+	}
+
+	var feeds []string
+	for _, src := range sources {
+		if !slices.Contains(feeds, src.Feed.String()) {
+			feeds = append(feeds, src.Feed.String())
+		}
+	}
+	params := []bigquery.QueryParameter{
+		{Name: "feeds", Value: feeds},
+	}
+
+	rows, err := client.Query(ctx, buildQuery(), params)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to query indicators for lookup")
+	}
+
+	var invalid int
+	for _, row := range rows {
+		ind, err := toIndicator(row)
+		if err != nil {
+			return nil, err
+		}
+		if !index.add(ind) {
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		utils.Logger().Warn("Skipped invalid indicators in lookup index", "count", invalid)
+	}
+
+	return index, nil
+}
+
+// buildQuery returns SQL to select active indicators of @feeds with aggregated first/last seen, decayed confidence, expiry and tags for each feed from active_indicators view.
+func buildQuery() string {
+	return fmt.Sprintf(`SELECT
+  Feed,
+  Type,
+  Indicator,
+  FirstSeen,
+  LastSeen,
+  Confidence,
+  ExpiresAt,
+  Tags
+FROM %s
+WHERE Feed IN UNNEST(@feeds)`, aging.ViewName)
+}
+
+func toIndicator(row map[string]bigquery.Value) (*Indicator, error) {
+	var ind Indicator
+
+	feed, ok := row["Feed"].(string)
+	if !ok {
+		return nil, goerr.New("invalid Feed in lookup result").With("row", row)
+	}
+	typ, ok := row["Type"].(string)
+	if !ok {
+		return nil, goerr.New("invalid Type in lookup result").With("row", row)
+	}
+	if ind.Value, ok = row["Indicator"].(string); !ok {
+		return nil, goerr.New("invalid Indicator in lookup result").With("row", row)
+	}
+	ind.Feed, ind.Type = types.FeedID(feed), types.IndicatorType(typ)
+
+	// Times, confidence and tags can be NULL if the source doesn't have them. NULL ExpiresAt means the indicator never expires
+	ind.FirstSeen, _ = row["FirstSeen"].(time.Time)
+	ind.LastSeen, _ = row["LastSeen"].(time.Time)
+	ind.ExpiresAt, _ = row["ExpiresAt"].(time.Time)
+	ind.Confidence, _ = row["Confidence"].(int64)
+	tags, _ := row["Tags"].([]bigquery.Value)
+	for _, tag := range tags {
+		if s, ok := tag.(string); ok && s != "" {
+			ind.Tags = append(ind.Tags, s)
+		}
+	}
+	sort.Strings(ind.Tags)
+
+	return &ind, nil
+}
+
+// Result is a lookup result of a value. Feeds, FirstSeen, LastSeen and Tags are summary of all matches.
+type Result struct {
+	Value     string              `json:"value"`
+	Type      types.IndicatorType `json:"type"`
+	Found     bool                `json:"found"`
+	Feeds     []types.FeedID      `json:"feeds"`
+	FirstSeen *time.Time          `json:"first_seen,omitempty"`
+	LastSeen  *time.Time          `json:"last_seen,omitempty"`
+	Tags      []string            `json:"tags"`
+	Matches   []*ResultMatch      `json:"matches"`
+}
+
+// ResultMatch is an indicator matched with the value.
+type ResultMatch struct {
+	Feed       types.FeedID        `json:"feed"`
+	Type       types.IndicatorType `json:"type"`
+	Indicator  string              `json:"indicator"`
+	Kind       MatchKind           `json:"kind"`
+	FirstSeen  *time.Time          `json:"first_seen,omitempty"`
+	LastSeen   *time.Time          `json:"last_seen,omitempty"`
+	Confidence int64               `json:"confidence"`
+	ExpiresAt  *time.Time          `json:"expires_at,omitempty"`
+	Tags       []string            `json:"tags"`
+}
+
+func timeRef(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Result looks up the value and summarizes matches.
+func (x *Index) Result(value string) *Result {
+	indicatorType, matches := x.Lookup(value)
+	sortMatches(matches)
+
+	result := &Result{
+		Value:   value,
+		Type:    indicatorType,
+		Found:   len(matches) > 0,
+		Feeds:   []types.FeedID{},
+		Tags:    []string{},
+		Matches: make([]*ResultMatch, len(matches)),
+	}
+
+	feeds := map[types.FeedID]struct{}{}
+	tags := map[string]struct{}{}
+	for i, m := range matches {
+		result.Matches[i] = &ResultMatch{
+			Feed:       m.Feed,
+			Type:       m.Type,
+			Indicator:  m.Value,
+			Kind:       m.Kind,
+			FirstSeen:  timeRef(m.FirstSeen),
+			LastSeen:   timeRef(m.LastSeen),
+			Confidence: m.Confidence,
+			ExpiresAt:  timeRef(m.ExpiresAt),
+			Tags:       append([]string{}, m.Tags...),
+		}
+
+		if _, ok := feeds[m.Feed]; !ok {
+			feeds[m.Feed] = struct{}{}
+			result.Feeds = append(result.Feeds, m.Feed)
+		}
+		for _, tag := range m.Tags {
+			if _, ok := tags[tag]; !ok {
+				tags[tag] = struct{}{}
+				result.Tags = append(result.Tags, tag)
+			}
+		}
+		if !m.FirstSeen.IsZero() && (result.FirstSeen == nil || m.FirstSeen.Before(*result.FirstSeen)) {
+			result.FirstSeen = timeRef(m.FirstSeen)
+		}
+		if result.LastSeen == nil || m.LastSeen.After(*result.LastSeen) {
+			result.LastSeen = timeRef(m.LastSeen)
+		}
+	}
+	sort.Strings(result.Tags)
+
+	return result
+}
+
+// Service keeps index of indicators and rebuilds it when a feed is imported. Lookups are served by the current index while a new index is being built.
+type Service struct {
+	bq      interfaces.BigQuery
+	db      interfaces.Database
+	sources []*model.IndicatorSource
+
+	index atomic.Pointer[Index]
+
+	// mutex serializes Refresh. logs are import logs of feeds when the current index was built.
+	mutex sync.Mutex
+	logs  map[types.FeedID]time.Time
+}
+
+// NewService returns lookup service. Index is empty until Refresh is called.
+func NewService(bq interfaces.BigQuery, db interfaces.Database, sources []*model.IndicatorSource) *Service {
+	return &Service{
+		bq:      bq,
+		db:      db,
+		sources: sources,
+		logs:    map[types.FeedID]time.Time{},
+	}
+}
+
+// Index returns the current index. It returns nil if index has not been built yet.
+func (x *Service) Index() *Index {
+	return x.index.Load()
+}
+
+// importLogs returns checked time of import logs of the feeds in sources.
+func (x *Service) importLogs(ctx context.Context) (map[types.FeedID]time.Time, error) {
+	logs := map[types.FeedID]time.Time{}
+	for _, src := range x.sources {
+		if _, ok := logs[src.Feed]; ok {
+			continue
+		}
+		log, err := x.db.GetLatestImportLog(ctx, src.Feed)
+		if err != nil {
+			return nil, goerr.Wrap(err, "Fail to get import log").With("feed", src.Feed)
+		}
+		logs[src.Feed] = time.Time{}
+		if log != nil {
+			logs[src.Feed] = log.CheckedAt
+		}
+	}
+	return logs, nil
+}
+
+// Refresh rebuilds the index. If force is false, the index is rebuilt only when any feed has been imported since the last build. It returns true if the index is rebuilt.
+func (x *Service) Refresh(ctx context.Context, force bool) (bool, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	// Import logs are read before loading indicators so that an import during loading triggers the next refresh
+	logs, err := x.importLogs(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if !force && x.index.Load() != nil {
+		changed := false
+		for feed, checkedAt := range logs {
+			if !checkedAt.Equal(x.logs[feed]) {
+				changed = true
+			}
+		}
+		if !changed {
+			return false, nil
+		}
+	}
+
+	index, err := Load(ctx, x.bq, x.sources)
+	if err != nil {
+		return false, err
+	}
+	x.index.Store(index)
+	x.logs = logs
+	utils.Logger().Info("Built lookup index", "size", index.Size())
+
+	return true, nil
+}
+
+// Watch checks import logs of feeds every interval and rebuilds the index after import until ctx is canceled. Errors are reported and retried in the next interval.
+func (x *Service) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := x.Refresh(ctx, false); err != nil {
+				utils.HandleError(ctx, "Fail to refresh lookup index", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package lookup_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/infra/memdb"
+	"github.com/m-mizutani/drone/pkg/lookup"
+	"github.com/m-mizutani/gt"
+)
+
+var (
+	firstSeen = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	lastSeen  = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func row(feed, typ, value string, tags ...string) map[string]bigquery.Value {
+	values := make([]bigquery.Value, len(tags))
+	for i, tag := range tags {
+		values[i] = tag
+	}
+	return map[string]bigquery.Value{
+		"Feed":       feed,
+		"Type":       typ,
+		"Indicator":  value,
+		"FirstSeen":  firstSeen,
+		"LastSeen":   lastSeen,
+		"Confidence": int64(70),
+		"Tags":       values,
+	}
+}
+
+func newMock() *bq.Mock {
+	mock := bq.NewMock()
+	mock.QueryFunc = func(query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+		return []map[string]bigquery.Value{
+			row("abuse.ch-feodo", "ip", "192.0.2.10", "Emotet"),
+			row("otx-subscribed", "ip", "192.0.2.0/24", "scanner"),
+			row("otx-subscribed", "ip", "2001:db8::/32"),
+			row("otx-subscribed", "domain", "Evil.Example."),
+			row("otx-subscribed", "hash", "D41D8CD98F00B204E9800998ECF8427E"),
+			row("otx-subscribed", "url", "http://phish.example/login"),
+			row("otx-subscribed", "ip", "not an address"),
+		}, nil
+	}
+	return mock
+}
+
+var sources = []*model.IndicatorSource{
+	{Feed: types.FeedAbuseChFeodo, Type: types.IndicatorIP, Query: "SELECT * FROM feodo"},
+	{Feed: types.FeedOTXSubscribed, Type: types.IndicatorIP, Query: "SELECT * FROM otx"},
+}
+
+func TestLookup(t *testing.T) {
+	mock := newMock()
+	index := gt.R1(lookup.Load(context.Background(), mock, sources)).NoError(t)
+	gt.V(t, index.Size()).Equal(6)
+	gt.A(t, mock.Queries).Length(1).At(0, func(t testing.TB, v string) {
+		gt.S(t, v).Contains("FROM active_indicators")
+		gt.S(t, v).Contains("WHERE Feed IN UNNEST(@feeds)")
+	})
+
+	testCases := map[string]struct {
+		value string
+		typ   types.IndicatorType
+		kinds []lookup.MatchKind
+	}{
+		"exact IP and CIDR": {
+			value: "192.0.2.10",
+			typ:   types.IndicatorIP,
+			kinds: []lookup.MatchKind{lookup.MatchExact, lookup.MatchCIDR},
+		},
+		"CIDR only": {
+			value: "192.0.2.99",
+			typ:   types.IndicatorIP,
+			kinds: []lookup.MatchKind{lookup.MatchCIDR},
+		},
+		"IPv6 CIDR": {
+			value: "2001:db8::1",
+			typ:   types.IndicatorIP,
+			kinds: []lookup.MatchKind{lookup.MatchCIDR},
+		},
+		"no IP match": {
+			value: "198.51.100.1",
+			typ:   types.IndicatorIP,
+		},
+		"exact domain": {
+			value: "evil.example",
+			typ:   types.IndicatorDomain,
+			kinds: []lookup.MatchKind{lookup.MatchExact},
+		},
+		"subdomain": {
+			value: "a.b.EVIL.example",
+			typ:   types.IndicatorDomain,
+			kinds: []lookup.MatchKind{lookup.MatchSubdomain},
+		},
+		"TLD is not matched": {
+			value: "other.example",
+			typ:   types.IndicatorDomain,
+		},
+		"hash in any case": {
+			value: "d41d8cd98f00b204e9800998ecf8427e",
+			typ:   types.IndicatorHash,
+			kinds: []lookup.MatchKind{lookup.MatchExact},
+		},
+		"exact URL": {
+			value: "http://phish.example/login",
+			typ:   types.IndicatorURL,
+			kinds: []lookup.MatchKind{lookup.MatchExact},
+		},
+		"host of URL": {
+			value: "https://user@www.evil.example:8443/path?q=1",
+			typ:   types.IndicatorURL,
+			kinds: []lookup.MatchKind{lookup.MatchURLHost},
+		},
+		"IP host of URL": {
+			value: "http://192.0.2.10:8080/",
+			typ:   types.IndicatorURL,
+			kinds: []lookup.MatchKind{lookup.MatchURLHost, lookup.MatchURLHost},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			typ, matches := index.Lookup(tc.value)
+			gt.V(t, typ).Equal(tc.typ)
+			gt.A(t, matches).Length(len(tc.kinds))
+			for i, kind := range tc.kinds {
+				gt.V(t, matches[i].Kind).Equal(kind)
+			}
+		})
+	}
+}
+
+func TestResult(t *testing.T) {
+	index := gt.R1(lookup.Load(context.Background(), newMock(), sources)).NoError(t)
+
+	result := index.Result("192.0.2.10")
+	gt.True(t, result.Found)
+	gt.V(t, result.Type).Equal(types.IndicatorIP)
+	gt.V(t, result.Feeds).Equal([]types.FeedID{types.FeedAbuseChFeodo, types.FeedOTXSubscribed})
+	gt.V(t, result.Tags).Equal([]string{"Emotet", "scanner"})
+	gt.V(t, *result.FirstSeen).Equal(firstSeen)
+	gt.V(t, *result.LastSeen).Equal(lastSeen)
+	gt.A(t, result.Matches).Length(2).At(0, func(t testing.TB, v *lookup.ResultMatch) {
+		gt.V(t, v.Feed).Equal(types.FeedAbuseChFeodo)
+		gt.V(t, v.Indicator).Equal("192.0.2.10")
+		gt.V(t, v.Confidence).Equal(int64(70))
+	})
+
+	result = index.Result("198.51.100.1")
+	gt.False(t, result.Found)
+	gt.A(t, result.Feeds).Length(0)
+	gt.A(t, result.Matches).Length(0)
+	gt.V(t, result.FirstSeen).Nil()
+}
+
+func TestLookupExpired(t *testing.T) {
+	mock := bq.NewMock()
+	mock.QueryFunc = func(query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+		expired := row("abuse.ch-feodo", "ip", "192.0.2.10")
+		expired["ExpiresAt"] = time.Now().Add(-time.Minute)
+		active := row("otx-subscribed", "ip", "192.0.2.10")
+		active["ExpiresAt"] = time.Now().Add(time.Hour)
+		return []map[string]bigquery.Value{expired, active, row("otx-subscribed", "ip", "192.0.2.11")}, nil
+	}
+	index := gt.R1(lookup.Load(context.Background(), mock, sources)).NoError(t)
+
+	// Indicator expired after the index was built is not matched
+	result := index.Result("192.0.2.10")
+	gt.A(t, result.Matches).Length(1).At(0, func(t testing.TB, v *lookup.ResultMatch) {
+		gt.V(t, v.Feed).Equal(types.FeedOTXSubscribed)
+		gt.V(t, v.ExpiresAt).NotNil()
+	})
+
+	// Indicator without expiry never expires
+	result = index.Result("192.0.2.11")
+	gt.A(t, result.Matches).Length(1).At(0, func(t testing.TB, v *lookup.ResultMatch) {
+		gt.V(t, v.ExpiresAt).Nil()
+	})
+}
+
+func TestServiceRefresh(t *testing.T) {
+	ctx := context.Background()
+	mock := newMock()
+	db := memdb.New()
+	svc := lookup.NewService(mock, db, sources)
+	gt.V(t, svc.Index()).Nil()
+
+	gt.True(t, gt.R1(svc.Refresh(ctx, false)).NoError(t))
+	gt.V(t, svc.Index().Size()).Equal(6)
+	gt.A(t, mock.Queries).Length(1)
+
+	// Not rebuilt without import
+	gt.False(t, gt.R1(svc.Refresh(ctx, false)).NoError(t))
+	gt.A(t, mock.Queries).Length(1)
+
+	// Rebuilt after import
+	gt.NoError(t, db.PutImportLog(ctx, types.FeedOTXSubscribed, &model.ImportLog{LatestRecord: lastSeen, CheckedAt: time.Now()}))
+	gt.True(t, gt.R1(svc.Refresh(ctx, false)).NoError(t))
+	gt.A(t, mock.Queries).Length(2)
+	gt.False(t, gt.R1(svc.Refresh(ctx, false)).NoError(t))
+
+	// Force rebuild
+	gt.True(t, gt.R1(svc.Refresh(ctx, true)).NoError(t))
+	gt.A(t, mock.Queries).Length(3)
+}
@@ -0,0 +1,295 @@
+// Package match scans log tables in BigQuery with indicators imported by drone, and writes hits into matches table.
+package match
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/bqs"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+const (
+	TableName = "matches"
+
+	// DefaultTimeColumn is a timestamp column of log table used if it's not specified in source.
+	DefaultTimeColumn = "timestamp"
+)
+
+// matchTableSpec is a layout of matches table.
+var matchTableSpec = &model.TableSpec{
+	PartitionField:   "LogTimestamp",
+	PartitionType:    bigquery.DayPartitioningType,
+	ClusteringFields: []string{"Feed", "IndicatorType", "SourceTable"},
+}
+
+var (
+	tablePattern  = regexp.MustCompile(`^[A-Za-z0-9_\-]+(\.[A-Za-z0-9_\-]+){0,2}$`)
+	columnPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Source is a column of log table to be matched with indicators of the type.
+type Source struct {
+	// Table is a log table. It can be "table", "dataset.table" or "project.dataset.table". "table" is resolved in drone dataset.
+	Table  string
+	Column string
+	Type   types.IndicatorType
+	// TimeColumn is a TIMESTAMP, DATETIME or DATE column to select log rows in the time window.
+	TimeColumn string
+}
+
+// ParseSource parses source mapping in "<table>.<column>=<type>[:<time column>]" format, e.g. "dns_logs.query=domain" or "vpc_flows.dst_ip=ip:start_time".
+func ParseSource(v string) (*Source, error) {
+	target, typ, ok := strings.Cut(v, "=")
+	if !ok {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "source must be <table>.<column>=<type>[:<time column>]").With("source", v)
+	}
+
+	idx := strings.LastIndex(target, ".")
+	if idx < 0 {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "source must have table and column").With("source", v)
+	}
+
+	src := &Source{
+		Table:      target[:idx],
+		Column:     target[idx+1:],
+		TimeColumn: DefaultTimeColumn,
+	}
+	if t, timeColumn, ok := strings.Cut(typ, ":"); ok {
+		typ, src.TimeColumn = t, timeColumn
+	}
+	src.Type = types.IndicatorType(typ)
+
+	if err := src.Validate(); err != nil {
+		return nil, goerr.Wrap(err).With("source", v)
+	}
+	return src, nil
+}
+
+func (x *Source) Validate() error {
+	if !tablePattern.MatchString(x.Table) {
+		return goerr.Wrap(types.ErrInvalidOption, "invalid table name").With("table", x.Table)
+	}
+	if !columnPattern.MatchString(x.Column) {
+		return goerr.Wrap(types.ErrInvalidOption, "invalid column name").With("column", x.Column)
+	}
+	if !columnPattern.MatchString(x.TimeColumn) {
+		return goerr.Wrap(types.ErrInvalidOption, "invalid time column name").With("column", x.TimeColumn)
+	}
+	return x.Type.Validate()
+}
+
+// Run matches log rows in [since, until) of each source with indicators, and inserts hits into matches table. Matches of the source in the window by earlier runs are deleted after the insert has succeeded, then running over the same window again replaces matches instead of duplicating them. If some hits fail to be inserted, they are logged, matches of earlier runs in the window are kept, and types.ErrPartialFailure is returned with inserted hits after all sources are processed. It returns inserted hits.
+func Run(ctx context.Context, client interfaces.BigQuery, indicators []*model.IndicatorSource, sources []*Source, since, until time.Time) ([]model.Match, error) {
+	schema, err := bqs.Infer(&model.Match{})
+	if err != nil {
+		return nil, goerr.Wrap(err, "Fail to infer schema")
+	}
+	if err := client.CreateOrUpdateSchema(ctx, TableName, schema, matchTableSpec); err != nil {
+		return nil, goerr.Wrap(err, "Fail to migrate matches table")
+	}
+
+	params := []bigquery.QueryParameter{
+		{Name: "since", Value: since},
+		{Name: "until", Value: until},
+	}
+	matchedAt := time.Now().UTC()
+
+	var total []model.Match
+	var failed int
+	for _, src := range sources {
+		query := buildQuery(src, indicators)
+		if query == "" {
+			utils.Logger().Warn("No indicator source for the type, skip", "table", src.Table, "type", src.Type)
+			continue
+		}
+		query, err := model.RenderQuery(query)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := client.Query(ctx, query, params)
+		if err != nil {
+			return nil, goerr.Wrap(err, "Fail to match indicators").With("table", src.Table).With("column", src.Column)
+		}
+
+		matches := make([]model.Match, 0, len(rows))
+		for _, row := range rows {
+			m, err := toMatch(row)
+			if err != nil {
+				return nil, err
+			}
+			m.MatchedAt = matchedAt
+			m.IndicatorType = string(src.Type)
+			m.SourceTable = src.Table
+			m.SourceColumn = src.Column
+			matches = append(matches, *m)
+		}
+		utils.Logger().Info("Matched indicators", "table", src.Table, "column", src.Column, "type", src.Type, "hits", len(matches))
+
+		inserted, err := insertMatches(ctx, client, matches)
+		if err != nil {
+			return total, err
+		}
+		total = append(total, inserted...)
+		if len(inserted) < len(matches) {
+			failed += len(matches) - len(inserted)
+			continue
+		}
+
+		if _, err := client.Query(ctx, deleteQuery, sourceParams(src, since, until, matchedAt)); err != nil {
+			return total, goerr.Wrap(err, "Fail to delete matches of earlier runs in the window").With("table", src.Table).With("column", src.Column)
+		}
+	}
+
+	if failed > 0 {
+		return total, goerr.Wrap(types.ErrPartialFailure, "some matches are failed to insert").With("failed", failed)
+	}
+	return total, nil
+}
+
+// insertMatches inserts matches into matches table and returns inserted ones. Rows failed to be inserted are logged and excluded from the result. Error is returned only if the insert fails entirely.
+func insertMatches(ctx context.Context, client interfaces.BigQuery, matches []model.Match) ([]model.Match, error) {
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	err := client.Insert(ctx, TableName, matches)
+	if err == nil {
+		return matches, nil
+	}
+	var partial *types.PartialInsertError
+	if !errors.As(err, &partial) {
+		return nil, goerr.Wrap(err, "Fail to insert matches").With("table", TableName)
+	}
+
+	failed := map[int]struct{}{}
+	for _, row := range partial.Rows {
+		failed[row.RowIndex] = struct{}{}
+		if row.RowIndex >= 0 && row.RowIndex < len(matches) {
+			m := &matches[row.RowIndex]
+			utils.Logger().WarnContext(ctx, "Fail to insert match",
+				"feed", m.Feed,
+				"indicator", m.Indicator,
+				"source_table", m.SourceTable,
+				"source_column", m.SourceColumn,
+				"log_timestamp", m.LogTimestamp,
+				"log_row_hash", m.LogRowHash,
+				"error", row.Error(),
+			)
+		}
+	}
+
+	inserted := make([]model.Match, 0, len(matches)-len(failed))
+	for i := range matches {
+		if _, ok := failed[i]; !ok {
+			inserted = append(inserted, matches[i])
+		}
+	}
+	return inserted, nil
+}
+
+// Alerts returns alerts of matches. Matches of the same indicator in the same log column are notified once, even across runs.
+func Alerts(matches []model.Match) []*model.Alert {
+	var alerts []*model.Alert
+	seen := map[string]struct{}{}
+
+	for i := range matches {
+		m := &matches[i]
+		key := strings.Join([]string{m.Feed, m.IndicatorType, m.Indicator, m.SourceTable, m.SourceColumn}, "/")
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		alerts = append(alerts, &model.Alert{
+			Type:      types.AlertMatch,
+			Key:       key,
+			Title:     fmt.Sprintf("Indicator %s of %s is found in %s.%s", m.Indicator, m.Feed, m.SourceTable, m.SourceColumn),
+			CreatedAt: m.MatchedAt,
+			Data:      m,
+		})
+	}
+
+	return alerts
+}
+
+// deleteQuery deletes matches of a source in the time window inserted by earlier runs than matched_at. Parameters are given by sourceParams.
+var deleteQuery = "DELETE FROM `" + TableName + "`" + ` WHERE SourceTable = @source_table AND SourceColumn = @source_column AND IndicatorType = @indicator_type AND LogTimestamp >= @since AND LogTimestamp < @until AND MatchedAt < @matched_at`
+
+func sourceParams(src *Source, since, until, matchedAt time.Time) []bigquery.QueryParameter {
+	return []bigquery.QueryParameter{
+		{Name: "source_table", Value: src.Table},
+		{Name: "source_column", Value: src.Column},
+		{Name: "indicator_type", Value: string(src.Type)},
+		{Name: "since", Value: since},
+		{Name: "until", Value: until},
+		{Name: "matched_at", Value: matchedAt},
+	}
+}
+
+// buildQuery returns SQL to match the source with indicators of the same type. Values are compared in lower case. It returns empty string if no indicator source has the type.
+func buildQuery(src *Source, indicators []*model.IndicatorSource) string {
+	var unions []string
+	for _, ind := range indicators {
+		if ind.Type != src.Type {
+			continue
+		}
+		unions = append(unions, fmt.Sprintf("  SELECT '%s' AS Feed, LOWER(Indicator) AS Indicator FROM (%s)", ind.Feed, ind.Query))
+	}
+	if len(unions) == 0 {
+		return ""
+	}
+
+	column := "l.`" + src.Column + "`"
+	timeColumn := "TIMESTAMP(l.`" + src.TimeColumn + "`)"
+
+	return fmt.Sprintf(`WITH indicators AS (
+  SELECT DISTINCT Feed, Indicator FROM (
+%s
+  )
+)
+SELECT
+  ind.Feed,
+  ind.Indicator,
+  CAST(%s AS STRING) AS Value,
+  %s AS LogTimestamp,
+  CAST(FARM_FINGERPRINT(TO_JSON_STRING(l)) AS STRING) AS LogRowHash
+FROM `+"`%s`"+` AS l
+JOIN indicators AS ind ON LOWER(CAST(%s AS STRING)) = ind.Indicator
+WHERE %s >= @since AND %s < @until`,
+		strings.Join(unions, "\n  UNION ALL\n"),
+		column, timeColumn, src.Table, column, timeColumn, timeColumn)
+}
+
+func toMatch(row map[string]bigquery.Value) (*model.Match, error) {
+	var m model.Match
+	var ok bool
+
+	if m.Feed, ok = row["Feed"].(string); !ok {
+		return nil, goerr.New("invalid Feed in match result").With("row", row)
+	}
+	if m.Indicator, ok = row["Indicator"].(string); !ok {
+		return nil, goerr.New("invalid Indicator in match result").With("row", row)
+	}
+	if m.Value, ok = row["Value"].(string); !ok {
+		return nil, goerr.New("invalid Value in match result").With("row", row)
+	}
+	if m.LogTimestamp, ok = row["LogTimestamp"].(time.Time); !ok {
+		return nil, goerr.New("invalid LogTimestamp in match result").With("row", row)
+	}
+	if m.LogRowHash, ok = row["LogRowHash"].(string); !ok {
+		return nil, goerr.New("invalid LogRowHash in match result").With("row", row)
+	}
+
+	return &m, nil
+}
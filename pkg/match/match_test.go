@@ -0,0 +1,175 @@
+package match_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/match"
+	"github.com/m-mizutani/gt"
+)
+
+func TestParseSource(t *testing.T) {
+	testCases := map[string]struct {
+		input string
+		want  *match.Source
+		err   bool
+	}{
+		"default time column": {
+			input: "dns_logs.query=domain",
+			want:  &match.Source{Table: "dns_logs", Column: "query", Type: types.IndicatorDomain, TimeColumn: "timestamp"},
+		},
+		"qualified table and time column": {
+			input: "my-project.logs.vpc_flows.dst_ip=ip:start_time",
+			want:  &match.Source{Table: "my-project.logs.vpc_flows", Column: "dst_ip", Type: types.IndicatorIP, TimeColumn: "start_time"},
+		},
+		"no type":         {input: "dns_logs.query", err: true},
+		"no column":       {input: "dns_logs=domain", err: true},
+		"unknown type":    {input: "dns_logs.query=email", err: true},
+		"injected table":  {input: "logs` WHERE 1=1 --.query=domain", err: true},
+		"injected column": {input: "dns_logs.query`=domain", err: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			src, err := match.ParseSource(tc.input)
+			if tc.err {
+				gt.Error(t, err)
+				return
+			}
+			gt.NoError(t, err)
+			gt.V(t, src).Equal(tc.want)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	logTime := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	mock := bq.NewMock()
+	mock.QueryFunc = func(query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+		if !strings.Contains(query, "`vpc_flows`") {
+			return nil, nil
+		}
+		return []map[string]bigquery.Value{
+			{
+				"Feed":         "abuse.ch-feodo",
+				"Indicator":    "192.0.2.10",
+				"Value":        "192.0.2.10",
+				"LogTimestamp": logTime,
+				"LogRowHash":   "-1234567890",
+			},
+		}, nil
+	}
+
+	indicators := gt.R1(feed.Indicators()).NoError(t)
+	sources := []*match.Source{
+		gt.R1(match.ParseSource("vpc_flows.dst_ip=ip")).NoError(t),
+		gt.R1(match.ParseSource("dns_logs.query=domain:event_time")).NoError(t),
+	}
+	until := logTime.Add(time.Hour)
+	since := until.Add(-24 * time.Hour)
+
+	hits := gt.R1(match.Run(ctx, mock, indicators, sources, since, until)).NoError(t)
+	gt.A(t, hits).Length(1)
+
+	gt.A(t, mock.Queries).Length(4)
+	// ip source is matched with both of OTX and Feodo indicators
+	gt.S(t, mock.Queries[0]).Contains("'abuse.ch-feodo' AS Feed")
+	gt.S(t, mock.Queries[0]).Contains("'otx-subscribed' AS Feed")
+	gt.S(t, mock.Queries[0]).Contains("l.`dst_ip`")
+	// Matches of earlier runs in the window are deleted after insert
+	gt.S(t, mock.Queries[1]).Contains("DELETE FROM `matches`")
+	gt.S(t, mock.Queries[1]).Contains("MatchedAt < @matched_at")
+	// domain source is matched with only OTX indicators
+	gt.S(t, mock.Queries[2]).NotContains("'abuse.ch-feodo' AS Feed")
+	gt.S(t, mock.Queries[2]).Contains("TIMESTAMP(l.`event_time`) >= @since")
+	gt.S(t, mock.Queries[3]).Contains("DELETE FROM `matches`")
+
+	gt.A(t, mock.InsertedTable[match.TableName]).Length(1)
+	matches := gt.Cast[[]model.Match](t, mock.InsertedTable[match.TableName][0])
+	gt.A(t, matches).Length(1).At(0, func(t testing.TB, v model.Match) {
+		gt.V(t, v.Feed).Equal("abuse.ch-feodo")
+		gt.V(t, v.IndicatorType).Equal("ip")
+		gt.V(t, v.SourceTable).Equal("vpc_flows")
+		gt.V(t, v.SourceColumn).Equal("dst_ip")
+		gt.V(t, v.LogTimestamp).Equal(logTime)
+		gt.V(t, v.MatchedAt.IsZero()).Equal(false)
+	})
+}
+
+func TestRunInsertFailure(t *testing.T) {
+	ctx := context.Background()
+	logTime := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	row := func(indicator string) map[string]bigquery.Value {
+		return map[string]bigquery.Value{
+			"Feed":         "abuse.ch-feodo",
+			"Indicator":    indicator,
+			"Value":        indicator,
+			"LogTimestamp": logTime,
+			"LogRowHash":   indicator,
+		}
+	}
+
+	mock := bq.NewMock()
+	mock.QueryFunc = func(query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+		if strings.HasPrefix(query, "DELETE") {
+			return nil, nil
+		}
+		return []map[string]bigquery.Value{row("192.0.2.10"), row("192.0.2.11")}, nil
+	}
+
+	indicators := gt.R1(feed.Indicators()).NoError(t)
+	sources := []*match.Source{gt.R1(match.ParseSource("vpc_flows.dst_ip=ip")).NoError(t)}
+	until := logTime.Add(time.Hour)
+	since := until.Add(-24 * time.Hour)
+
+	t.Run("failed rows are reported and matches of earlier runs are kept", func(t *testing.T) {
+		mock.Queries = nil
+		mock.InsertFunc = func(tableName string, data any) error {
+			return &types.PartialInsertError{Table: tableName, Total: 2, Rows: bigquery.PutMultiError{{RowIndex: 1}}}
+		}
+		hits, err := match.Run(ctx, mock, indicators, sources, since, until)
+		gt.True(t, errors.Is(err, types.ErrPartialFailure))
+		gt.A(t, hits).Length(1).At(0, func(t testing.TB, v model.Match) {
+			gt.V(t, v.Indicator).Equal("192.0.2.10")
+		})
+		gt.A(t, mock.Queries).Length(1)
+	})
+
+	t.Run("matches of earlier runs are kept if insert fails", func(t *testing.T) {
+		mock.Queries = nil
+		mock.InsertFunc = func(tableName string, data any) error {
+			return errors.New("insert failed")
+		}
+		_, err := match.Run(ctx, mock, indicators, sources, since, until)
+		gt.Error(t, err)
+		gt.False(t, errors.Is(err, types.ErrPartialFailure))
+		gt.A(t, mock.Queries).Length(1)
+	})
+}
+
+func TestAlerts(t *testing.T) {
+	now := time.Now()
+	matches := []model.Match{
+		{MatchedAt: now, Feed: "abuse.ch-feodo", IndicatorType: "ip", Indicator: "192.0.2.10", SourceTable: "vpc_flows", SourceColumn: "dst_ip", LogRowHash: "1"},
+		{MatchedAt: now, Feed: "abuse.ch-feodo", IndicatorType: "ip", Indicator: "192.0.2.10", SourceTable: "vpc_flows", SourceColumn: "dst_ip", LogRowHash: "2"},
+		{MatchedAt: now, Feed: "abuse.ch-feodo", IndicatorType: "ip", Indicator: "192.0.2.10", SourceTable: "vpc_flows", SourceColumn: "src_ip", LogRowHash: "3"},
+	}
+
+	// Rows of the same indicator and column are notified once
+	alerts := match.Alerts(matches)
+	gt.A(t, alerts).Length(2).At(0, func(t testing.TB, v *model.Alert) {
+		gt.V(t, v.Type).Equal(types.AlertMatch)
+		gt.V(t, v.Key).Equal("abuse.ch-feodo/ip/192.0.2.10/vpc_flows/dst_ip")
+		gt.V(t, v.Title).Equal("Indicator 192.0.2.10 of abuse.ch-feodo is found in vpc_flows.dst_ip")
+	})
+}
@@ -0,0 +1,123 @@
+// Package migration compares schema of tables declared by feeds with the live tables, and applies the differences.
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/goerr"
+)
+
+type Action string
+
+const (
+	// ActionNone means the table is up to date.
+	ActionNone Action = "none"
+	// ActionCreate creates a new table.
+	ActionCreate Action = "create"
+	// ActionUpdate adds columns to the existing table.
+	ActionUpdate Action = "update"
+	// ActionMigrate creates a new version of the table because of incompatible changes.
+	ActionMigrate Action = "migrate"
+)
+
+// TablePlan is a planned change of a table.
+type TablePlan struct {
+	Table   *model.Table
+	Action  Action
+	Changes []model.SchemaChange
+	// Dropped is columns whose data is not copied into the new version by migration.
+	Dropped []string
+}
+
+// Plan compares declared tables with the live tables.
+func Plan(ctx context.Context, client interfaces.BigQuery, tables []*model.Table) ([]*TablePlan, error) {
+	var plans []*TablePlan
+
+	for _, table := range tables {
+		current, err := client.GetSchema(ctx, table.Name)
+		if err != nil {
+			return nil, goerr.Wrap(err, "Fail to get schema").With("table", table.Name)
+		}
+
+		plan := &TablePlan{Table: table}
+		switch {
+		case current == nil:
+			plan.Action = ActionCreate
+
+		default:
+			plan.Changes = bq.DiffSchema(current, table.Schema)
+			plan.Action = ActionNone
+			for _, c := range plan.Changes {
+				if c.Kind == model.SchemaConflict {
+					plan.Action = ActionMigrate
+					break
+				}
+				plan.Action = ActionUpdate
+			}
+			if plan.Action == ActionMigrate {
+				plan.Dropped = bq.DroppedColumns(current, table.Schema)
+			}
+		}
+
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// Apply applies plans. Plans of ActionMigrate are applied only if migrate is true, otherwise they are skipped. It returns plans that are skipped.
+func Apply(ctx context.Context, client interfaces.BigQuery, plans []*TablePlan, migrate bool) ([]*TablePlan, error) {
+	var skipped []*TablePlan
+
+	for _, plan := range plans {
+		t := plan.Table
+		switch plan.Action {
+		case ActionCreate, ActionUpdate:
+			if err := client.CreateOrUpdateSchema(ctx, t.Name, t.Schema, t.Spec); err != nil {
+				return nil, goerr.Wrap(err, "Fail to update table").With("table", t.Name)
+			}
+
+		case ActionMigrate:
+			if !migrate {
+				skipped = append(skipped, plan)
+				continue
+			}
+			if _, err := client.MigrateTable(ctx, t.Name, t.Schema, t.Spec); err != nil {
+				return nil, goerr.Wrap(err, "Fail to migrate table").With("table", t.Name)
+			}
+		}
+	}
+
+	return skipped, nil
+}
+
+// Print writes plans in human readable format.
+func Print(w io.Writer, plans []*TablePlan) error {
+	for _, plan := range plans {
+		if _, err := fmt.Fprintf(w, "%s: %s\n", plan.Table.Name, plan.Action); err != nil {
+			return goerr.Wrap(err, "Fail to print plan")
+		}
+		for _, c := range plan.Changes {
+			if _, err := fmt.Fprintf(w, "  %s\n", c.String()); err != nil {
+				return goerr.Wrap(err, "Fail to print plan")
+			}
+		}
+		if plan.Action == ActionMigrate {
+			if _, err := fmt.Fprintf(w, "  -> create new version, copy rows and swap view %s (apply with --migrate)\n", plan.Table.Name); err != nil {
+				return goerr.Wrap(err, "Fail to print plan")
+			}
+			for _, col := range plan.Dropped {
+				if _, err := fmt.Fprintf(w, "  -> data of column %s is not copied\n", col); err != nil {
+					return goerr.Wrap(err, "Fail to print plan")
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package migration_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/migration"
+	"github.com/m-mizutani/gt"
+)
+
+func TestPlanAndApply(t *testing.T) {
+	ctx := context.Background()
+	mock := bq.NewMock()
+
+	str := func(name string) *bigquery.FieldSchema {
+		return &bigquery.FieldSchema{Name: name, Type: bigquery.StringFieldType}
+	}
+	gt.NoError(t, mock.CreateOrUpdateSchema(ctx, "same", bigquery.Schema{str("ID")}, nil))
+	gt.NoError(t, mock.CreateOrUpdateSchema(ctx, "added", bigquery.Schema{str("ID")}, nil))
+	gt.NoError(t, mock.CreateOrUpdateSchema(ctx, "conflict", bigquery.Schema{
+		str("ID"),
+		{Name: "Port", Type: bigquery.StringFieldType},
+		{Name: "Tags", Type: bigquery.StringFieldType},
+	}, nil))
+
+	tables := []*model.Table{
+		{Name: "same", Schema: bigquery.Schema{str("ID")}},
+		{Name: "added", Schema: bigquery.Schema{str("ID"), str("Name")}},
+		{Name: "conflict", Schema: bigquery.Schema{
+			str("ID"),
+			{Name: "Port", Type: bigquery.IntegerFieldType},
+			{Name: "Tags", Type: bigquery.StringFieldType, Repeated: true},
+		}},
+		{Name: "new", Schema: bigquery.Schema{str("ID")}},
+	}
+
+	plans := gt.R1(migration.Plan(ctx, mock, tables)).NoError(t)
+	gt.A(t, plans).Length(4).
+		At(0, func(t testing.TB, v *migration.TablePlan) {
+			gt.V(t, v.Action).Equal(migration.ActionNone)
+		}).
+		At(1, func(t testing.TB, v *migration.TablePlan) {
+			gt.V(t, v.Action).Equal(migration.ActionUpdate)
+			gt.A(t, v.Changes).Length(1)
+		}).
+		At(2, func(t testing.TB, v *migration.TablePlan) {
+			gt.V(t, v.Action).Equal(migration.ActionMigrate)
+			gt.A(t, v.Changes).Length(2)
+			// STRING -> INTEGER is converted by SAFE_CAST, but STRING -> REPEATED STRING can not be converted
+			gt.A(t, v.Dropped).Length(1).At(0, func(t testing.TB, v string) {
+				gt.V(t, v).Equal("Tags")
+			})
+		}).
+		At(3, func(t testing.TB, v *migration.TablePlan) {
+			gt.V(t, v.Action).Equal(migration.ActionCreate)
+		})
+
+	var out bytes.Buffer
+	gt.NoError(t, migration.Print(&out, plans))
+	gt.S(t, out.String()).Contains("conflict: migrate")
+	gt.S(t, out.String()).Contains("data of column Tags is not copied")
+
+	t.Run("apply without migrate", func(t *testing.T) {
+		skipped := gt.R1(migration.Apply(ctx, mock, plans, false)).NoError(t)
+		gt.A(t, skipped).Length(1)
+		gt.A(t, mock.Schemas["added"]).Length(2)
+		gt.A(t, mock.Schemas["new"]).Length(1)
+		gt.V(t, mock.Migrated["conflict"]).Equal(0)
+	})
+
+	t.Run("apply with migrate", func(t *testing.T) {
+		skipped := gt.R1(migration.Apply(ctx, mock, plans, true)).NoError(t)
+		gt.A(t, skipped).Length(0)
+		gt.V(t, mock.Migrated["conflict"]).Equal(1)
+
+		plans := gt.R1(migration.Plan(ctx, mock, tables)).NoError(t)
+		for _, plan := range plans {
+			gt.V(t, plan.Action).Equal(migration.ActionNone)
+		}
+	})
+}
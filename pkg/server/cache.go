@@ -0,0 +1,55 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// cache keeps results for TTL. Zero TTL disables the cache.
+type cache[T any] struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*cacheEntry[T]
+}
+
+type cacheEntry[T any] struct {
+	value     T
+	expiresAt time.Time
+}
+
+func newCache[T any](ttl time.Duration) *cache[T] {
+	return &cache[T]{
+		ttl:     ttl,
+		entries: map[string]*cacheEntry[T]{},
+	}
+}
+
+func (x *cache[T]) get(key string) (T, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	entry, ok := x.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		var zero T
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (x *cache[T]) put(key string, value T) {
+	if x.ttl <= 0 {
+		return
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	now := time.Now()
+	// Drop expired entries so that the cache doesn't grow with various requests
+	for k, entry := range x.entries {
+		if now.After(entry.expiresAt) {
+			delete(x.entries, k)
+		}
+	}
+	x.entries[key] = &cacheEntry[T]{value: value, expiresAt: now.Add(x.ttl)}
+}
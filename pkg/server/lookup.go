@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/m-mizutani/drone/pkg/lookup"
+	"github.com/m-mizutani/drone/pkg/utils"
+)
+
+const (
+	// maxLookupValues is the max number of values in a batch lookup request.
+	maxLookupValues = 10000
+	// maxLookupBodySize is the max size of batch lookup request body.
+	maxLookupBodySize = 4 * 1024 * 1024
+)
+
+// WithLookup enables lookup endpoints served by the lookup service.
+func WithLookup(svc *lookup.Service) Option {
+	return func(x *Server) {
+		x.lookup = svc
+	}
+}
+
+func (x *Server) routeLookup() {
+	x.mux.HandleFunc("GET /lookup", x.handleLookup)
+	x.mux.HandleFunc("POST /lookup", x.handleBatchLookup)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		utils.Logger().Warn("Fail to write JSON response", "err", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// currentIndex returns index of the lookup service. It returns nil and writes error response if the index is not built yet.
+func (x *Server) currentIndex(w http.ResponseWriter) *lookup.Index {
+	index := x.lookup.Index()
+	if index == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "lookup index is not ready")
+	}
+	return index
+}
+
+// handleLookup looks up a value given by "value" query parameter.
+func (x *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	value := r.URL.Query().Get("value")
+	if value == "" {
+		writeJSONError(w, http.StatusBadRequest, "value is required")
+		return
+	}
+
+	if index := x.currentIndex(w); index != nil {
+		writeJSON(w, http.StatusOK, index.Result(value))
+	}
+}
+
+type batchLookupRequest struct {
+	Values []string `json:"values"`
+}
+
+type batchLookupResponse struct {
+	Results []*lookup.Result `json:"results"`
+}
+
+// handleBatchLookup looks up values given as {"values": [...]} in request body. Results are in the same order as values.
+func (x *Server) handleBatchLookup(w http.ResponseWriter, r *http.Request) {
+	var req batchLookupRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLookupBodySize)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.Values) > maxLookupValues {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "too many values")
+		return
+	}
+
+	index := x.currentIndex(w)
+	if index == nil {
+		return
+	}
+
+	resp := batchLookupResponse{Results: make([]*lookup.Result, len(req.Values))}
+	for i, value := range req.Values {
+		resp.Results[i] = index.Result(value)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,87 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/infra/memdb"
+	"github.com/m-mizutani/drone/pkg/lookup"
+	"github.com/m-mizutani/drone/pkg/server"
+	"github.com/m-mizutani/gt"
+)
+
+func TestLookup(t *testing.T) {
+	mock := bq.NewMock()
+	mock.QueryFunc = func(query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+		return []map[string]bigquery.Value{
+			{"Feed": "abuse.ch-feodo", "Type": "ip", "Indicator": "192.0.2.10", "FirstSeen": time.Now(), "LastSeen": time.Now(), "Confidence": int64(90), "Tags": []bigquery.Value{"Emotet"}},
+			{"Feed": "otx-subscribed", "Type": "domain", "Indicator": "evil.example", "FirstSeen": time.Now(), "LastSeen": time.Now(), "Confidence": int64(70), "Tags": []bigquery.Value{}},
+		}, nil
+	}
+	sources := gt.R1(feed.Indicators()).NoError(t)
+	svc := lookup.NewService(mock, memdb.New(), sources)
+	srv := httptest.NewServer(server.New(mock, sources, server.WithLookup(svc)))
+	t.Cleanup(srv.Close)
+
+	do := func(method, path, body string) (int, []byte) {
+		req := gt.R1(http.NewRequest(method, srv.URL+path, strings.NewReader(body))).NoError(t)
+		resp := gt.R1(http.DefaultClient.Do(req)).NoError(t)
+		defer resp.Body.Close()
+		return resp.StatusCode, gt.R1(io.ReadAll(resp.Body)).NoError(t)
+	}
+
+	t.Run("not ready before index is built", func(t *testing.T) {
+		code, _ := do(http.MethodGet, "/lookup?value=192.0.2.10", "")
+		gt.V(t, code).Equal(http.StatusServiceUnavailable)
+	})
+
+	gt.R1(svc.Refresh(context.Background(), true)).NoError(t)
+
+	t.Run("single value", func(t *testing.T) {
+		code, body := do(http.MethodGet, "/lookup?value=192.0.2.10", "")
+		gt.V(t, code).Equal(http.StatusOK)
+
+		var result lookup.Result
+		gt.NoError(t, json.Unmarshal(body, &result))
+		gt.True(t, result.Found)
+		gt.V(t, result.Feeds).Equal([]types.FeedID{types.FeedAbuseChFeodo})
+		gt.V(t, result.Tags).Equal([]string{"Emotet"})
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		code, body := do(http.MethodPost, "/lookup", `{"values":["www.evil.example","198.51.100.1"]}`)
+		gt.V(t, code).Equal(http.StatusOK)
+
+		var resp struct {
+			Results []*lookup.Result `json:"results"`
+		}
+		gt.NoError(t, json.Unmarshal(body, &resp))
+		gt.A(t, resp.Results).Length(2).
+			At(0, func(t testing.TB, v *lookup.Result) {
+				gt.V(t, v.Found).Equal(true)
+				gt.A(t, v.Matches).Length(1).At(0, func(t testing.TB, m *lookup.ResultMatch) {
+					gt.V(t, m.Kind).Equal(lookup.MatchSubdomain)
+				})
+			}).
+			At(1, func(t testing.TB, v *lookup.Result) {
+				gt.V(t, v.Found).Equal(false)
+			})
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		code, _ := do(http.MethodGet, "/lookup", "")
+		gt.V(t, code).Equal(http.StatusBadRequest)
+		code, _ = do(http.MethodPost, "/lookup", `{"values":`)
+		gt.V(t, code).Equal(http.StatusBadRequest)
+	})
+}
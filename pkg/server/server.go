@@ -0,0 +1,147 @@
+// Package server provides HTTP API of drone for appliances and tools that poll or look up indicators.
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/model"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/export"
+	"github.com/m-mizutani/drone/pkg/lookup"
+	"github.com/m-mizutani/drone/pkg/stix"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+// DefaultCacheTTL is a default duration to reuse exported result for the same request.
+const DefaultCacheTTL = 5 * time.Minute
+
+type Server struct {
+	bq      interfaces.BigQuery
+	sources []*model.IndicatorSource
+	mux     *http.ServeMux
+
+	collections []*Collection
+	lookup      *lookup.Service
+
+	cacheTTL    time.Duration
+	exportCache *cache[[]byte]
+	stixCache   *cache[[]stix.Object]
+}
+
+type Option func(*Server)
+
+// WithCacheTTL sets duration to reuse exported result and STIX objects. Appliances usually poll blocklists every few minutes, then the cache prevents running BigQuery query for each poll. Zero disables the cache.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(x *Server) {
+		x.cacheTTL = ttl
+	}
+}
+
+// New returns HTTP handler of drone API. Indicators are selected from the sources.
+func New(bq interfaces.BigQuery, sources []*model.IndicatorSource, options ...Option) *Server {
+	s := &Server{
+		bq:       bq,
+		sources:  sources,
+		mux:      http.NewServeMux(),
+		cacheTTL: DefaultCacheTTL,
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	s.exportCache = newCache[[]byte](s.cacheTTL)
+	s.stixCache = newCache[[]stix.Object](s.cacheTTL)
+
+	s.mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	s.mux.HandleFunc("GET /export/{format}", s.handleExport)
+	if len(s.collections) > 0 {
+		s.routeTAXII()
+	}
+	if s.lookup != nil {
+		s.routeLookup()
+	}
+
+	return s
+}
+
+func (x *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	x.mux.ServeHTTP(w, r)
+}
+
+// handleExport writes indicators in the format given by path. Filter is given by query parameters: feed, type (both repeatable), max_age (duration, e.g. 720h) and min_confidence.
+func (x *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	format := export.Format(r.PathValue("format"))
+	if err := format.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := string(format) + "?" + r.URL.Query().Encode()
+	body, ok := x.exportCache.get(key)
+	if !ok {
+		var buf bytes.Buffer
+		if err := export.Export(r.Context(), &buf, x.bq, x.sources, format, *filter); err != nil {
+			if errors.Is(err, types.ErrInvalidOption) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			utils.HandleError(r.Context(), "Fail to export indicators", err)
+			http.Error(w, "failed to export indicators", http.StatusInternalServerError)
+			return
+		}
+		body = buf.Bytes()
+		x.exportCache.put(key, body)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		utils.Logger().Warn("Fail to write export response", "err", err)
+	}
+}
+
+func parseFilter(query url.Values) (*export.Filter, error) {
+	var filter export.Filter
+
+	for _, v := range query["feed"] {
+		filter.Feeds = append(filter.Feeds, types.FeedID(v))
+	}
+	for _, v := range query["type"] {
+		filter.Types = append(filter.Types, types.IndicatorType(v))
+	}
+
+	if v := query.Get("max_age"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "invalid max_age").With("max_age", v)
+		}
+		filter.MaxAge = d
+	}
+	if v := query.Get("min_confidence"); v != "" {
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "invalid min_confidence").With("min_confidence", v)
+		}
+		filter.MinConfidence = n
+	}
+
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
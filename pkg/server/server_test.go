@@ -0,0 +1,55 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/drone/pkg/feed"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/server"
+	"github.com/m-mizutani/gt"
+)
+
+func TestExport(t *testing.T) {
+	mock := bq.NewMock()
+	mock.QueryFunc = func(query string, params []bigquery.QueryParameter) ([]map[string]bigquery.Value, error) {
+		return []map[string]bigquery.Value{
+			{"Feed": "abuse.ch-feodo", "Type": "ip", "Indicator": "198.51.100.23", "LastSeen": time.Now(), "Confidence": int64(90)},
+			{"Feed": "abuse.ch-feodo", "Type": "ip", "Indicator": "192.0.2.10", "LastSeen": time.Now(), "Confidence": int64(90)},
+		}, nil
+	}
+	srv := httptest.NewServer(server.New(mock, gt.R1(feed.Indicators()).NoError(t)))
+	t.Cleanup(srv.Close)
+
+	get := func(path string) (int, string) {
+		resp := gt.R1(http.Get(srv.URL + path)).NoError(t)
+		defer resp.Body.Close()
+		return resp.StatusCode, string(gt.R1(io.ReadAll(resp.Body)).NoError(t))
+	}
+
+	code, body := get("/export/ip?feed=abuse.ch-feodo&max_age=720h&min_confidence=80")
+	gt.V(t, code).Equal(http.StatusOK)
+	gt.V(t, body).Equal("192.0.2.10\n198.51.100.23\n")
+	gt.A(t, mock.Queries).Length(1)
+
+	t.Run("cached for the same request", func(t *testing.T) {
+		code, _ := get("/export/ip?feed=abuse.ch-feodo&max_age=720h&min_confidence=80")
+		gt.V(t, code).Equal(http.StatusOK)
+		gt.A(t, mock.Queries).Length(1)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		code, _ := get("/export/csv")
+		gt.V(t, code).Equal(http.StatusNotFound)
+		code, _ = get("/export/ip?feed=unknown")
+		gt.V(t, code).Equal(http.StatusBadRequest)
+		code, _ = get("/export/ip?max_age=month")
+		gt.V(t, code).Equal(http.StatusBadRequest)
+		code, _ = get("/export/domain?type=ip")
+		gt.V(t, code).Equal(http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/stix"
+	"github.com/m-mizutani/drone/pkg/utils"
+	"github.com/m-mizutani/goerr"
+)
+
+const (
+	taxiiMediaType = "application/taxii+json;version=2.1"
+	taxiiAPIRoot   = "/taxii2/api/"
+
+	// taxiiMaxPageSize is the max number of objects in a response of objects and manifest endpoints.
+	taxiiMaxPageSize = 1000
+)
+
+// Collection is a read-only TAXII collection that provides STIX objects of a feed.
+type Collection struct {
+	Feed   types.FeedID
+	Source stix.Source
+}
+
+// ID returns collection ID. It's derived from the feed ID, then it doesn't change across restarts.
+func (x *Collection) ID() string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("drone:collection:"+string(x.Feed))).String()
+}
+
+// WithTAXII enables read-only TAXII 2.1 endpoints under /taxii2/ with the collections.
+func WithTAXII(collections ...*Collection) Option {
+	return func(x *Server) {
+		x.collections = append(x.collections, collections...)
+	}
+}
+
+func (x *Server) routeTAXII() {
+	x.mux.HandleFunc("GET /taxii2/{$}", x.handleTAXIIDiscovery)
+	x.mux.HandleFunc("GET "+taxiiAPIRoot+"{$}", x.handleTAXIIAPIRoot)
+	x.mux.HandleFunc("GET "+taxiiAPIRoot+"collections/{$}", x.handleTAXIICollections)
+	x.mux.HandleFunc("GET "+taxiiAPIRoot+"collections/{id}/{$}", x.handleTAXIICollection)
+	x.mux.HandleFunc("GET "+taxiiAPIRoot+"collections/{id}/objects/{$}", x.handleTAXIIObjects)
+	x.mux.HandleFunc("GET "+taxiiAPIRoot+"collections/{id}/objects/{objectID}/{$}", x.handleTAXIIObjects)
+	x.mux.HandleFunc("GET "+taxiiAPIRoot+"collections/{id}/objects/{objectID}/versions/{$}", x.handleTAXIIVersions)
+	x.mux.HandleFunc("GET "+taxiiAPIRoot+"collections/{id}/manifest/{$}", x.handleTAXIIManifest)
+}
+
+type taxiiCollection struct {
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	CanRead    bool     `json:"can_read"`
+	CanWrite   bool     `json:"can_write"`
+	MediaTypes []string `json:"media_types"`
+}
+
+func toTAXIICollection(c *Collection) *taxiiCollection {
+	return &taxiiCollection{
+		ID:         c.ID(),
+		Title:      string(c.Feed),
+		CanRead:    true,
+		CanWrite:   false,
+		MediaTypes: []string{stix.MediaType},
+	}
+}
+
+type taxiiManifestRecord struct {
+	ID        string         `json:"id"`
+	DateAdded stix.Timestamp `json:"date_added"`
+	Version   stix.Timestamp `json:"version"`
+	MediaType string         `json:"media_type"`
+}
+
+func writeTAXII(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", taxiiMediaType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		utils.Logger().Warn("Fail to write TAXII response", "err", err)
+	}
+}
+
+func writeTAXIIError(w http.ResponseWriter, status int, title string) {
+	writeTAXII(w, status, map[string]any{
+		"title":       title,
+		"http_status": strconv.Itoa(status),
+	})
+}
+
+func (x *Server) handleTAXIIDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeTAXII(w, http.StatusOK, map[string]any{
+		"title":       "drone",
+		"description": "Indicators imported by drone",
+		"default":     taxiiAPIRoot,
+		"api_roots":   []string{taxiiAPIRoot},
+	})
+}
+
+func (x *Server) handleTAXIIAPIRoot(w http.ResponseWriter, r *http.Request) {
+	writeTAXII(w, http.StatusOK, map[string]any{
+		"title":    "drone",
+		"versions": []string{taxiiMediaType},
+		// Objects can not be added, then any content length is not acceptable
+		"max_content_length": 0,
+	})
+}
+
+func (x *Server) handleTAXIICollections(w http.ResponseWriter, r *http.Request) {
+	collections := make([]*taxiiCollection, len(x.collections))
+	for i, c := range x.collections {
+		collections[i] = toTAXIICollection(c)
+	}
+	writeTAXII(w, http.StatusOK, map[string]any{"collections": collections})
+}
+
+func (x *Server) lookupCollection(w http.ResponseWriter, r *http.Request) *Collection {
+	id := r.PathValue("id")
+	for _, c := range x.collections {
+		if c.ID() == id {
+			return c
+		}
+	}
+	writeTAXIIError(w, http.StatusNotFound, "collection not found")
+	return nil
+}
+
+func (x *Server) handleTAXIICollection(w http.ResponseWriter, r *http.Request) {
+	if c := x.lookupCollection(w, r); c != nil {
+		writeTAXII(w, http.StatusOK, toTAXIICollection(c))
+	}
+}
+
+// collectionObjects returns objects of the collection sorted by date added and ID. It returns false if the response is already written.
+func (x *Server) collectionObjects(w http.ResponseWriter, r *http.Request) ([]stix.Object, bool) {
+	c := x.lookupCollection(w, r)
+	if c == nil {
+		return nil, false
+	}
+
+	objects, ok := x.stixCache.get(string(c.Feed))
+	if !ok {
+		var err error
+		objects, err = stix.Collect(r.Context(), x.bq, c.Source)
+		if err != nil {
+			utils.HandleError(r.Context(), "Fail to collect STIX objects", err)
+			writeTAXIIError(w, http.StatusInternalServerError, "failed to collect objects")
+			return nil, false
+		}
+
+		// TAXII paginates objects in order of date added, that is imported time of the source data
+		sort.SliceStable(objects, func(i, j int) bool {
+			return taxiiBefore(stix.DateAdded(objects[i]), objects[i].ObjectID(), objects[j])
+		})
+		x.stixCache.put(string(c.Feed), objects)
+	}
+
+	return objects, true
+}
+
+// filterTAXIIObjects applies object ID in path, and added_after, match[id], match[type], limit and next query parameters. It returns a page of objects and next value that is empty at the last page. It returns false if the response is already written.
+//
+// next is a cursor of date added and ID of the last object in the page, then pagination is not shifted when objects are collected again after the cache expires.
+func filterTAXIIObjects(w http.ResponseWriter, r *http.Request, objects []stix.Object) ([]stix.Object, string, bool) {
+	query := r.URL.Query()
+
+	var addedAfter time.Time
+	if v := query.Get("added_after"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeTAXIIError(w, http.StatusBadRequest, "invalid added_after")
+			return nil, "", false
+		}
+		addedAfter = t
+	}
+
+	ids := splitMatch(query.Get("match[id]"))
+	if objectID := r.PathValue("objectID"); objectID != "" {
+		ids = []string{objectID}
+	}
+	objectTypes := splitMatch(query.Get("match[type]"))
+
+	limit := taxiiMaxPageSize
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeTAXIIError(w, http.StatusBadRequest, "invalid limit")
+			return nil, "", false
+		}
+		limit = min(n, taxiiMaxPageSize)
+	}
+	var cursor *taxiiCursor
+	if v := query.Get("next"); v != "" {
+		c, err := parseTAXIICursor(v)
+		if err != nil {
+			writeTAXIIError(w, http.StatusBadRequest, "invalid next")
+			return nil, "", false
+		}
+		cursor = c
+	}
+
+	var matched []stix.Object
+	for _, obj := range objects {
+		if cursor != nil && !taxiiBefore(cursor.dateAdded, cursor.id, obj) {
+			continue
+		}
+		if !addedAfter.IsZero() && !stix.DateAdded(obj).After(addedAfter) {
+			continue
+		}
+		if len(ids) > 0 && !slices.Contains(ids, obj.ObjectID()) {
+			continue
+		}
+		if len(objectTypes) > 0 && !slices.Contains(objectTypes, obj.ObjectType()) {
+			continue
+		}
+		matched = append(matched, obj)
+	}
+
+	if len(matched) > limit {
+		last := matched[limit-1]
+		next := &taxiiCursor{dateAdded: stix.DateAdded(last), id: last.ObjectID()}
+		return matched[:limit], next.String(), true
+	}
+	return matched, "", true
+}
+
+// taxiiCursor is a position in objects sorted by date added and ID.
+type taxiiCursor struct {
+	dateAdded time.Time
+	id        string
+}
+
+func (x *taxiiCursor) String() string {
+	v := x.dateAdded.UTC().Format(time.RFC3339Nano) + "|" + x.id
+	return base64.RawURLEncoding.EncodeToString([]byte(v))
+}
+
+func parseTAXIICursor(v string) (*taxiiCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, err
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, goerr.New("invalid cursor").With("next", v)
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return nil, err
+	}
+	return &taxiiCursor{dateAdded: t, id: id}, nil
+}
+
+// taxiiBefore returns true if the position of date added and ID is before obj in order of objects.
+func taxiiBefore(dateAdded time.Time, id string, obj stix.Object) bool {
+	t := stix.DateAdded(obj)
+	if !dateAdded.Equal(t) {
+		return dateAdded.Before(t)
+	}
+	return id < obj.ObjectID()
+}
+
+func splitMatch(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+func setDateAddedHeaders(w http.ResponseWriter, objects []stix.Object) {
+	if len(objects) == 0 {
+		return
+	}
+	first, _ := stix.Timestamp(stix.DateAdded(objects[0])).MarshalJSON()
+	last, _ := stix.Timestamp(stix.DateAdded(objects[len(objects)-1])).MarshalJSON()
+	w.Header().Set("X-TAXII-Date-Added-First", strings.Trim(string(first), `"`))
+	w.Header().Set("X-TAXII-Date-Added-Last", strings.Trim(string(last), `"`))
+}
+
+func (x *Server) handleTAXIIObjects(w http.ResponseWriter, r *http.Request) {
+	objects, ok := x.collectionObjects(w, r)
+	if !ok {
+		return
+	}
+	page, next, ok := filterTAXIIObjects(w, r, objects)
+	if !ok {
+		return
+	}
+	if r.PathValue("objectID") != "" && len(page) == 0 {
+		writeTAXIIError(w, http.StatusNotFound, "object not found")
+		return
+	}
+
+	setDateAddedHeaders(w, page)
+	envelope := map[string]any{"more": next != ""}
+	if len(page) > 0 {
+		envelope["objects"] = page
+	}
+	if next != "" {
+		envelope["next"] = next
+	}
+	writeTAXII(w, http.StatusOK, envelope)
+}
+
+func (x *Server) handleTAXIIManifest(w http.ResponseWriter, r *http.Request) {
+	objects, ok := x.collectionObjects(w, r)
+	if !ok {
+		return
+	}
+	page, next, ok := filterTAXIIObjects(w, r, objects)
+	if !ok {
+		return
+	}
+
+	records := make([]*taxiiManifestRecord, len(page))
+	for i, obj := range page {
+		records[i] = &taxiiManifestRecord{
+			ID:        obj.ObjectID(),
+			DateAdded: stix.Timestamp(stix.DateAdded(obj)),
+			Version:   stix.Timestamp(obj.Version()),
+			MediaType: stix.MediaType,
+		}
+	}
+
+	setDateAddedHeaders(w, page)
+	manifest := map[string]any{"more": next != ""}
+	if len(records) > 0 {
+		manifest["objects"] = records
+	}
+	if next != "" {
+		manifest["next"] = next
+	}
+	writeTAXII(w, http.StatusOK, manifest)
+}
+
+// handleTAXIIVersions returns the only version of the object because drone keeps the latest version of each object.
+func (x *Server) handleTAXIIVersions(w http.ResponseWriter, r *http.Request) {
+	objects, ok := x.collectionObjects(w, r)
+	if !ok {
+		return
+	}
+
+	objectID := r.PathValue("objectID")
+	for _, obj := range objects {
+		if obj.ObjectID() == objectID {
+			version, _ := stix.Timestamp(obj.Version()).MarshalJSON()
+			setDateAddedHeaders(w, []stix.Object{obj})
+			writeTAXII(w, http.StatusOK, map[string]any{
+				"more":     false,
+				"versions": []json.RawMessage{version},
+			})
+			return
+		}
+	}
+	writeTAXIIError(w, http.StatusNotFound, "object not found")
+}
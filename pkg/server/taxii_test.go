@@ -0,0 +1,165 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/drone/pkg/infra/bq"
+	"github.com/m-mizutani/drone/pkg/server"
+	"github.com/m-mizutani/drone/pkg/stix"
+	"github.com/m-mizutani/gt"
+)
+
+func TestTAXII(t *testing.T) {
+	base := time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)
+	var calls int
+	src := func(ctx context.Context, client interfaces.BigQuery) ([]stix.Object, error) {
+		calls++
+		var objects []stix.Object
+		for i, v := range []string{"192.0.2.10", "192.0.2.11", "192.0.2.12"} {
+			ind := stix.NewIndicator(stix.NewID("indicator", v), v, "[ipv4-addr:value = '"+v+"']", base, base.Add(time.Duration(i)*time.Hour), time.Time{})
+			ind.ObjectMarkingRefs = []string{stix.TLPWhite}
+			// Imported in reverse order of version
+			ind.DateAdded = base.Add(24*time.Hour - time.Duration(i)*time.Hour)
+			objects = append(objects, ind)
+		}
+		return objects, nil
+	}
+
+	collection := &server.Collection{Feed: types.FeedAbuseChFeodo, Source: src}
+	srv := httptest.NewServer(server.New(bq.NewMock(), nil, server.WithTAXII(collection)))
+	t.Cleanup(srv.Close)
+
+	get := func(path string, v any) *http.Response {
+		resp := gt.R1(http.Get(srv.URL + path)).NoError(t)
+		defer resp.Body.Close()
+		gt.V(t, resp.Header.Get("Content-Type")).Equal("application/taxii+json;version=2.1")
+		gt.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		return resp
+	}
+
+	var discovery struct {
+		APIRoots []string `json:"api_roots"`
+	}
+	get("/taxii2/", &discovery)
+	gt.V(t, discovery.APIRoots).Equal([]string{"/taxii2/api/"})
+
+	type taxiiCollection struct {
+		ID       string `json:"id"`
+		Title    string `json:"title"`
+		CanWrite bool   `json:"can_write"`
+	}
+	var collections struct {
+		Collections []taxiiCollection `json:"collections"`
+	}
+	get("/taxii2/api/collections/", &collections)
+	gt.A(t, collections.Collections).Length(1).At(0, func(t testing.TB, v taxiiCollection) {
+		gt.V(t, v.ID).Equal(collection.ID())
+		gt.V(t, v.Title).Equal("abuse.ch-feodo")
+		gt.V(t, v.CanWrite).Equal(false)
+	})
+
+	type envelope struct {
+		More    bool             `json:"more"`
+		Next    string           `json:"next"`
+		Objects []map[string]any `json:"objects"`
+	}
+	objectsPath := "/taxii2/api/collections/" + collection.ID() + "/objects/"
+
+	t.Run("paginate objects", func(t *testing.T) {
+		var page1 envelope
+		resp := get(objectsPath+"?limit=3", &page1)
+		gt.V(t, page1.More).Equal(true)
+		gt.A(t, page1.Objects).Length(3)
+		gt.V(t, page1.Objects[0]["type"]).Equal("marking-definition")
+		gt.V(t, resp.Header.Get("X-TAXII-Date-Added-First")).Equal("2017-01-20T00:00:00.000Z")
+
+		var page2 envelope
+		get(objectsPath+"?limit=3&next="+page1.Next, &page2)
+		gt.V(t, page2.More).Equal(false)
+		gt.A(t, page2.Objects).Length(1)
+		gt.V(t, page2.Objects[0]["name"]).Equal("192.0.2.10")
+	})
+
+	t.Run("filter objects", func(t *testing.T) {
+		// added_after is compared with date added, not version
+		var result envelope
+		resp := get(objectsPath+"?match[type]=indicator&added_after=2024-01-14T22:30:00Z", &result)
+		gt.A(t, result.Objects).Length(2)
+		gt.V(t, result.Objects[0]["name"]).Equal("192.0.2.11")
+		gt.V(t, resp.Header.Get("X-TAXII-Date-Added-Last")).Equal("2024-01-15T00:00:00.000Z")
+
+		id := stix.NewID("indicator", "192.0.2.11")
+		get(objectsPath+id+"/", &result)
+		gt.A(t, result.Objects).Length(1)
+		gt.V(t, result.Objects[0]["id"]).Equal(id)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var errResp map[string]any
+		resp := get(objectsPath+stix.NewID("indicator", "unknown")+"/", &errResp)
+		gt.V(t, resp.StatusCode).Equal(http.StatusNotFound)
+		resp = get("/taxii2/api/collections/unknown/", &errResp)
+		gt.V(t, resp.StatusCode).Equal(http.StatusNotFound)
+	})
+
+	// Objects are collected once in cache TTL
+	gt.V(t, calls).Equal(1)
+}
+
+func TestTAXIICursor(t *testing.T) {
+	base := time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)
+	values := []string{"192.0.2.10", "192.0.2.11", "192.0.2.12"}
+	added := map[string]time.Time{}
+	for i, v := range values {
+		added[v] = base.Add(time.Duration(i) * time.Hour)
+	}
+	src := func(ctx context.Context, client interfaces.BigQuery) ([]stix.Object, error) {
+		var objects []stix.Object
+		for _, v := range values {
+			ind := stix.NewIndicator(stix.NewID("indicator", v), v, "[ipv4-addr:value = '"+v+"']", base, added[v], time.Time{})
+			ind.DateAdded = added[v]
+			objects = append(objects, ind)
+		}
+		return objects, nil
+	}
+
+	// Objects are collected for each request without cache
+	collection := &server.Collection{Feed: types.FeedAbuseChFeodo, Source: src}
+	srv := httptest.NewServer(server.New(bq.NewMock(), nil, server.WithTAXII(collection), server.WithCacheTTL(0)))
+	t.Cleanup(srv.Close)
+
+	type envelope struct {
+		Next    string           `json:"next"`
+		Objects []map[string]any `json:"objects"`
+	}
+	get := func(query string) *envelope {
+		resp := gt.R1(http.Get(srv.URL + "/taxii2/api/collections/" + collection.ID() + "/objects/?match[type]=indicator&limit=2" + query)).NoError(t)
+		defer resp.Body.Close()
+		var v envelope
+		gt.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+		return &v
+	}
+
+	page1 := get("")
+	gt.A(t, page1.Objects).Length(2)
+
+	// An object in the first page is updated and moves to the end, but the next page is not shifted
+	added["192.0.2.10"] = base.Add(5 * time.Hour)
+	page2 := get("&next=" + page1.Next)
+	gt.A(t, page2.Objects).Length(2).At(0, func(t testing.TB, v map[string]any) {
+		gt.V(t, v["name"]).Equal("192.0.2.12")
+	}).At(1, func(t testing.TB, v map[string]any) {
+		gt.V(t, v["name"]).Equal("192.0.2.10")
+	})
+
+	resp := gt.R1(http.Get(srv.URL + "/taxii2/api/collections/" + collection.ID() + "/objects/?next=invalid")).NoError(t)
+	defer resp.Body.Close()
+	gt.V(t, resp.StatusCode).Equal(http.StatusBadRequest)
+}
@@ -0,0 +1,102 @@
+package stix
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/m-mizutani/drone/pkg/domain/types"
+	"github.com/m-mizutani/goerr"
+)
+
+// HashAlgorithm is a hash algorithm name in STIX hashes dictionary.
+type HashAlgorithm string
+
+const (
+	HashMD5    HashAlgorithm = "MD5"
+	HashSHA1   HashAlgorithm = "SHA-1"
+	HashSHA256 HashAlgorithm = "SHA-256"
+)
+
+var hashPatterns = map[HashAlgorithm]*regexp.Regexp{
+	HashMD5:    regexp.MustCompile(`^[0-9a-fA-F]{32}$`),
+	HashSHA1:   regexp.MustCompile(`^[0-9a-fA-F]{40}$`),
+	HashSHA256: regexp.MustCompile(`^[0-9a-fA-F]{64}$`),
+}
+
+// quote returns string literal of STIX pattern.
+func quote(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+func invalidValue(kind, v string) error {
+	return goerr.Wrap(types.ErrInvalidOption, "invalid "+kind+" for STIX pattern").With("value", v)
+}
+
+// IPPattern returns pattern of IPv4 or IPv6 address. CIDR is also acceptable.
+func IPPattern(v string) (string, error) {
+	var addr netip.Addr
+	if prefix, err := netip.ParsePrefix(v); err == nil {
+		addr, v = prefix.Addr(), prefix.Masked().String()
+	} else if addr, err = netip.ParseAddr(v); err == nil {
+		addr = addr.Unmap().WithZone("")
+		v = addr.String()
+	} else {
+		return "", invalidValue("IP address", v)
+	}
+
+	objectType := "ipv4-addr"
+	if addr.Is6() {
+		objectType = "ipv6-addr"
+	}
+	return fmt.Sprintf("[%s:value = %s]", objectType, quote(v)), nil
+}
+
+// NetworkTrafficPattern returns pattern of traffic to the IP address and port.
+func NetworkTrafficPattern(ip string, port int64) (string, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", invalidValue("IP address", ip)
+	}
+	addr = addr.Unmap().WithZone("")
+	if port < 0 || 65535 < port {
+		return "", invalidValue("port", fmt.Sprint(port))
+	}
+
+	objectType := "ipv4-addr"
+	if addr.Is6() {
+		objectType = "ipv6-addr"
+	}
+	return fmt.Sprintf("[network-traffic:dst_ref.type = '%s' AND network-traffic:dst_ref.value = %s AND network-traffic:dst_port = %d]", objectType, quote(addr.String()), port), nil
+}
+
+func DomainPattern(v string) (string, error) {
+	v = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(v)), ".")
+	if v == "" || strings.ContainsAny(v, " /:@") {
+		return "", invalidValue("domain name", v)
+	}
+	return fmt.Sprintf("[domain-name:value = %s]", quote(v)), nil
+}
+
+func URLPattern(v string) (string, error) {
+	if !strings.Contains(v, "://") && !strings.Contains(v, "/") {
+		return "", invalidValue("URL", v)
+	}
+	return fmt.Sprintf("[url:value = %s]", quote(v)), nil
+}
+
+func EmailPattern(v string) (string, error) {
+	if strings.Count(v, "@") != 1 {
+		return "", invalidValue("email address", v)
+	}
+	return fmt.Sprintf("[email-addr:value = %s]", quote(v)), nil
+}
+
+func FileHashPattern(alg HashAlgorithm, v string) (string, error) {
+	p, ok := hashPatterns[alg]
+	if !ok || !p.MatchString(v) {
+		return "", invalidValue(string(alg)+" hash", v)
+	}
+	return fmt.Sprintf("[file:hashes.'%s' = %s]", alg, quote(strings.ToLower(v))), nil
+}
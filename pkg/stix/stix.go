@@ -0,0 +1,284 @@
+// Package stix provides STIX 2.1 objects to share indicators imported by drone. IDs of objects are derived from feed data, then the same data produces the same bundle.
+package stix
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+)
+
+const (
+	SpecVersion = "2.1"
+	MediaType   = "application/stix+json;version=2.1"
+)
+
+// namespace is a namespace of deterministic IDs. It's the namespace of STIX Cyber-observable Object IDs defined in STIX 2.1 specification.
+var namespace = uuid.MustParse("00abedb4-aa42-466c-9c01-fed23315a9b7")
+
+// NewID returns deterministic ID of the object type. The same names return the same ID.
+func NewID(objectType string, names ...string) string {
+	return objectType + "--" + uuid.NewSHA1(namespace, []byte(strings.Join(names, "\x00"))).String()
+}
+
+// Timestamp is a time in STIX format, UTC with millisecond precision.
+type Timestamp time.Time
+
+func (x Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Time(x).UTC().Format("2006-01-02T15:04:05.000Z"))
+}
+
+func (x *Timestamp) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return err
+	}
+	*x = Timestamp(t)
+	return nil
+}
+
+// Object is a STIX object in bundle.
+type Object interface {
+	ObjectID() string
+	ObjectType() string
+	// Version is modified time of the object. It's created time if the object is immutable.
+	Version() time.Time
+}
+
+// Common is common properties of STIX Domain Objects and Relationship.
+type Common struct {
+	Type               string              `json:"type"`
+	SpecVersion        string              `json:"spec_version"`
+	ID                 string              `json:"id"`
+	Created            Timestamp           `json:"created"`
+	Modified           Timestamp           `json:"modified"`
+	CreatedByRef       string              `json:"created_by_ref,omitempty"`
+	Labels             []string            `json:"labels,omitempty"`
+	ExternalReferences []ExternalReference `json:"external_references,omitempty"`
+	ObjectMarkingRefs  []string            `json:"object_marking_refs,omitempty"`
+
+	// DateAdded is time when the source data of the object was imported. It's not a STIX property, and TAXII server uses it as date added of the object.
+	DateAdded time.Time `json:"-"`
+}
+
+// newCommon returns common properties. Modified is adjusted to created if it's before created.
+func newCommon(objectType, id string, created, modified time.Time) Common {
+	if modified.Before(created) {
+		modified = created
+	}
+	return Common{
+		Type:        objectType,
+		SpecVersion: SpecVersion,
+		ID:          id,
+		Created:     Timestamp(created),
+		Modified:    Timestamp(modified),
+	}
+}
+
+func (x *Common) ObjectID() string   { return x.ID }
+func (x *Common) ObjectType() string { return x.Type }
+func (x *Common) Version() time.Time { return time.Time(x.Modified) }
+
+type ExternalReference struct {
+	SourceName  string `json:"source_name"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	ExternalID  string `json:"external_id,omitempty"`
+}
+
+type Identity struct {
+	Common
+	Name          string `json:"name"`
+	IdentityClass string `json:"identity_class,omitempty"`
+}
+
+// identityCreated is created time of identities. It's fixed because identities of feed providers are not derived from feed data.
+var identityCreated = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// NewIdentity returns identity of an organization. ID is derived from the name.
+func NewIdentity(name string) *Identity {
+	return &Identity{
+		Common:        newCommon("identity", NewID("identity", name), identityCreated, identityCreated),
+		Name:          name,
+		IdentityClass: "organization",
+	}
+}
+
+type Indicator struct {
+	Common
+	Name           string     `json:"name,omitempty"`
+	Description    string     `json:"description,omitempty"`
+	IndicatorTypes []string   `json:"indicator_types,omitempty"`
+	Pattern        string     `json:"pattern"`
+	PatternType    string     `json:"pattern_type"`
+	ValidFrom      Timestamp  `json:"valid_from"`
+	ValidUntil     *Timestamp `json:"valid_until,omitempty"`
+}
+
+// NewIndicator returns indicator of malicious activity with STIX pattern. validUntil is ignored if it's zero or not after validFrom.
+func NewIndicator(id, name, pattern string, created, modified, validUntil time.Time) *Indicator {
+	ind := &Indicator{
+		Common:         newCommon("indicator", id, created, modified),
+		Name:           name,
+		IndicatorTypes: []string{"malicious-activity"},
+		Pattern:        pattern,
+		PatternType:    "stix",
+		ValidFrom:      Timestamp(created),
+	}
+	if validUntil.After(created) {
+		ts := Timestamp(validUntil)
+		ind.ValidUntil = &ts
+	}
+	return ind
+}
+
+type Malware struct {
+	Common
+	Name     string `json:"name"`
+	IsFamily bool   `json:"is_family"`
+}
+
+// NewMalware returns malware family. ID is derived from the name in lower case, then the same family from multiple feeds is merged.
+func NewMalware(name string, created, modified time.Time) *Malware {
+	return &Malware{
+		Common:   newCommon("malware", NewID("malware", strings.ToLower(name)), created, modified),
+		Name:     name,
+		IsFamily: true,
+	}
+}
+
+type Relationship struct {
+	Common
+	RelationshipType string `json:"relationship_type"`
+	SourceRef        string `json:"source_ref"`
+	TargetRef        string `json:"target_ref"`
+}
+
+// NewRelationship returns relationship between objects. ID is derived from the type and refs.
+func NewRelationship(relationshipType, sourceRef, targetRef string, created, modified time.Time) *Relationship {
+	return &Relationship{
+		Common:           newCommon("relationship", NewID("relationship", relationshipType, sourceRef, targetRef), created, modified),
+		RelationshipType: relationshipType,
+		SourceRef:        sourceRef,
+		TargetRef:        targetRef,
+	}
+}
+
+type Report struct {
+	Common
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	ReportTypes []string  `json:"report_types,omitempty"`
+	Published   Timestamp `json:"published"`
+	ObjectRefs  []string  `json:"object_refs"`
+}
+
+// NewReport returns threat report that refers to the objects. It's published at created time.
+func NewReport(id, name string, created, modified time.Time, objectRefs []string) *Report {
+	return &Report{
+		Common:      newCommon("report", id, created, modified),
+		Name:        name,
+		ReportTypes: []string{"threat-report"},
+		Published:   Timestamp(created),
+		ObjectRefs:  objectRefs,
+	}
+}
+
+// Source builds STIX objects from tables of a feed.
+type Source func(ctx context.Context, client interfaces.BigQuery) ([]Object, error)
+
+// Bundle is a collection of STIX objects.
+type Bundle struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id"`
+	Objects []Object `json:"objects"`
+}
+
+// NewBundle returns bundle of the objects. Objects are deduplicated by ID with the latest version, and sorted by type and ID. Marking definitions referred by the objects are added. Bundle ID is derived from IDs and versions of the objects.
+func NewBundle(objects ...Object) *Bundle {
+	objects = Normalize(objects)
+
+	names := make([]string, 0, len(objects)*2)
+	for _, obj := range objects {
+		names = append(names, obj.ObjectID(), obj.Version().UTC().Format(time.RFC3339Nano))
+	}
+
+	return &Bundle{
+		Type:    "bundle",
+		ID:      NewID("bundle", names...),
+		Objects: objects,
+	}
+}
+
+// Normalize deduplicates objects by ID with the latest version, adds marking definitions referred by the objects, and sorts them by type and ID.
+func Normalize(objects []Object) []Object {
+	index := map[string]Object{}
+	for _, obj := range objects {
+		if found, ok := index[obj.ObjectID()]; ok && !obj.Version().After(found.Version()) {
+			continue
+		}
+		index[obj.ObjectID()] = obj
+
+		for _, ref := range markingRefs(obj) {
+			if def, ok := tlpDefinitions[ref]; ok {
+				index[ref] = def
+			}
+		}
+	}
+
+	result := make([]Object, 0, len(index))
+	for _, obj := range index {
+		result = append(result, obj)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ObjectType() != result[j].ObjectType() {
+			return result[i].ObjectType() < result[j].ObjectType()
+		}
+		return result[i].ObjectID() < result[j].ObjectID()
+	})
+
+	return result
+}
+
+// DateAdded returns time when the object was added, e.g. imported time of the source data. Version is returned if the object does not have it.
+func DateAdded(obj Object) time.Time {
+	if v, ok := obj.(interface{ dateAdded() time.Time }); ok {
+		if t := v.dateAdded(); !t.IsZero() {
+			return t
+		}
+	}
+	return obj.Version()
+}
+
+func (x *Common) dateAdded() time.Time { return x.DateAdded }
+
+func markingRefs(obj Object) []string {
+	if v, ok := obj.(interface{ markingRefs() []string }); ok {
+		return v.markingRefs()
+	}
+	return nil
+}
+
+func (x *Common) markingRefs() []string { return x.ObjectMarkingRefs }
+
+// Collect runs the sources and returns objects normalized by Normalize.
+func Collect(ctx context.Context, client interfaces.BigQuery, sources ...Source) ([]Object, error) {
+	var objects []Object
+	for _, src := range sources {
+		objs, err := src(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, objs...)
+	}
+
+	return Normalize(objects), nil
+}
@@ -0,0 +1,147 @@
+package stix_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/stix"
+	"github.com/m-mizutani/gt"
+)
+
+func TestNewID(t *testing.T) {
+	id := stix.NewID("indicator", "otx-subscribed", "pulse", "1")
+	gt.S(t, id).HasPrefix("indicator--")
+	gt.V(t, stix.NewID("indicator", "otx-subscribed", "pulse", "1")).Equal(id)
+	gt.V(t, stix.NewID("indicator", "otx-subscribed", "pulse1")).NotEqual(id)
+}
+
+func TestPattern(t *testing.T) {
+	testCases := map[string]struct {
+		f     func(string) (string, error)
+		input string
+		want  string
+		err   bool
+	}{
+		"ipv4":           {f: stix.IPPattern, input: "192.0.2.10", want: "[ipv4-addr:value = '192.0.2.10']"},
+		"ipv6":           {f: stix.IPPattern, input: "2001:db8::1", want: "[ipv6-addr:value = '2001:db8::1']"},
+		"cidr":           {f: stix.IPPattern, input: "203.0.113.7/24", want: "[ipv4-addr:value = '203.0.113.0/24']"},
+		"invalid ip":     {f: stix.IPPattern, input: "192.0.2.256", err: true},
+		"domain":         {f: stix.DomainPattern, input: "C2.Example.NET.", want: "[domain-name:value = 'c2.example.net']"},
+		"invalid":        {f: stix.DomainPattern, input: "evil.example/path", err: true},
+		"url with quote": {f: stix.URLPattern, input: `https://example.com/a'b\c`, want: `[url:value = 'https://example.com/a\'b\\c']`},
+		"email":          {f: stix.EmailPattern, input: "phish@example.com", want: "[email-addr:value = 'phish@example.com']"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.f(tc.input)
+			if tc.err {
+				gt.Error(t, err)
+				return
+			}
+			gt.NoError(t, err)
+			gt.V(t, got).Equal(tc.want)
+		})
+	}
+
+	t.Run("file hash", func(t *testing.T) {
+		sha256 := "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"
+		gt.V(t, gt.R1(stix.FileHashPattern(stix.HashSHA256, sha256)).NoError(t)).
+			Equal("[file:hashes.'SHA-256' = 'e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855']")
+		_, err := stix.FileHashPattern(stix.HashMD5, sha256)
+		gt.Error(t, err)
+	})
+
+	t.Run("network traffic", func(t *testing.T) {
+		gt.V(t, gt.R1(stix.NetworkTrafficPattern("192.0.2.10", 443)).NoError(t)).
+			Equal("[network-traffic:dst_ref.type = 'ipv4-addr' AND network-traffic:dst_ref.value = '192.0.2.10' AND network-traffic:dst_port = 443]")
+		_, err := stix.NetworkTrafficPattern("192.0.2.10", 70000)
+		gt.Error(t, err)
+	})
+}
+
+func TestTLPMarking(t *testing.T) {
+	for input, want := range map[string]string{
+		"white":        stix.TLPWhite,
+		"TLP:CLEAR":    stix.TLPWhite,
+		"green":        stix.TLPGreen,
+		"amber+strict": stix.TLPAmber,
+		"Red":          stix.TLPRed,
+	} {
+		got, ok := stix.TLPMarking(input)
+		gt.True(t, ok)
+		gt.V(t, got).Equal(want)
+	}
+	_, ok := stix.TLPMarking("purple")
+	gt.False(t, ok)
+}
+
+func testObjects() []stix.Object {
+	created := time.Date(2024, 1, 14, 8, 12, 40, 0, time.UTC)
+	modified := time.Date(2024, 1, 15, 6, 40, 12, 500000000, time.UTC)
+
+	green := stix.NewIndicator(stix.NewID("indicator", "green"), "192.0.2.10", "[ipv4-addr:value = '192.0.2.10']", created, modified, time.Time{})
+	green.ObjectMarkingRefs = []string{stix.TLPGreen}
+	amber := stix.NewIndicator(stix.NewID("indicator", "amber"), "c2.example.net", "[domain-name:value = 'c2.example.net']", created, modified, time.Time{})
+	amber.ObjectMarkingRefs = []string{stix.TLPAmber}
+	malware := stix.NewMalware("Pikabot", created, modified)
+
+	return []stix.Object{
+		amber,
+		malware,
+		stix.NewRelationship("indicates", amber.ID, malware.ID, created, modified),
+		stix.NewRelationship("indicates", green.ID, malware.ID, created, modified),
+		green,
+		// Older version of the same indicator is dropped
+		stix.NewIndicator(green.ID, "192.0.2.10", "[ipv4-addr:value = '192.0.2.10']", created, created, time.Time{}),
+	}
+}
+
+func TestNewBundle(t *testing.T) {
+	bundle := stix.NewBundle(testObjects()...)
+	gt.A(t, bundle.Objects).Length(7)
+
+	reversed := testObjects()
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	gt.V(t, stix.NewBundle(reversed...)).Equal(bundle)
+
+	var types []string
+	for _, obj := range bundle.Objects {
+		types = append(types, obj.ObjectType())
+	}
+	gt.V(t, types).Equal([]string{"indicator", "indicator", "malware", "marking-definition", "marking-definition", "relationship", "relationship"})
+
+	raw := gt.R1(json.Marshal(bundle)).NoError(t)
+	var decoded struct {
+		Type    string           `json:"type"`
+		Objects []map[string]any `json:"objects"`
+	}
+	gt.NoError(t, json.Unmarshal(raw, &decoded))
+	gt.V(t, decoded.Type).Equal("bundle")
+	gt.A(t, decoded.Objects).At(0, func(t testing.TB, v map[string]any) {
+		gt.V(t, v["spec_version"]).Equal("2.1")
+		gt.V(t, v["modified"]).Equal("2024-01-15T06:40:12.500Z")
+		gt.V(t, v["valid_from"]).Equal("2024-01-14T08:12:40.000Z")
+	})
+}
+
+func TestFilterTLP(t *testing.T) {
+	objects := stix.Normalize(stix.FilterTLP(testObjects(), stix.TLPGreen))
+
+	var ids []string
+	for _, obj := range objects {
+		ids = append(ids, obj.ObjectID())
+		if rel, ok := obj.(*stix.Relationship); ok {
+			gt.V(t, rel.SourceRef).NotEqual(stix.NewID("indicator", "amber"))
+		}
+	}
+	gt.A(t, objects).Length(4)
+	gt.A(t, ids).Have(stix.TLPGreen)
+	gt.A(t, ids).NotHave(stix.TLPAmber)
+	gt.A(t, ids).NotHave(stix.NewID("indicator", "amber"))
+
+	gt.A(t, stix.FilterTLP(testObjects(), stix.TLPRed)).Length(6)
+}
@@ -0,0 +1,125 @@
+package stix
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/drone/pkg/domain/interfaces"
+)
+
+// MarkingDefinition is a data marking. drone uses only TLP markings predefined in STIX 2.1 specification.
+type MarkingDefinition struct {
+	Type           string            `json:"type"`
+	SpecVersion    string            `json:"spec_version"`
+	ID             string            `json:"id"`
+	Created        Timestamp         `json:"created"`
+	Name           string            `json:"name"`
+	DefinitionType string            `json:"definition_type"`
+	Definition     map[string]string `json:"definition"`
+}
+
+func (x *MarkingDefinition) ObjectID() string   { return x.ID }
+func (x *MarkingDefinition) ObjectType() string { return x.Type }
+func (x *MarkingDefinition) Version() time.Time { return time.Time(x.Created) }
+
+// IDs of TLP marking definitions in STIX 2.1 specification
+const (
+	TLPWhite = "marking-definition--613f2e26-407d-48c7-9eca-b8e91df99dc9"
+	TLPGreen = "marking-definition--34098fce-860f-48ae-8e50-ebd3cc5e41da"
+	TLPAmber = "marking-definition--f88d31f6-486f-44da-b317-01333bde0b82"
+	TLPRed   = "marking-definition--5e57c739-391a-4eb3-b6be-7d15ca92d5ed"
+)
+
+var tlpDefinitions = map[string]*MarkingDefinition{
+	TLPWhite: newTLP(TLPWhite, "white"),
+	TLPGreen: newTLP(TLPGreen, "green"),
+	TLPAmber: newTLP(TLPAmber, "amber"),
+	TLPRed:   newTLP(TLPRed, "red"),
+}
+
+func newTLP(id, tlp string) *MarkingDefinition {
+	return &MarkingDefinition{
+		Type:           "marking-definition",
+		SpecVersion:    SpecVersion,
+		ID:             id,
+		Created:        Timestamp(time.Date(2017, 1, 20, 0, 0, 0, 0, time.UTC)),
+		Name:           "TLP:" + strings.ToUpper(tlp),
+		DefinitionType: "tlp",
+		Definition:     map[string]string{"tlp": tlp},
+	}
+}
+
+// TLPMarking returns ID of TLP marking definition for the TLP name, e.g. "green" or "TLP:AMBER". TLP 2.0 "clear" is mapped to white, and "amber+strict" to amber. It returns false for unknown name.
+func TLPMarking(tlp string) (string, bool) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(tlp)), "tlp:") {
+	case "white", "clear":
+		return TLPWhite, true
+	case "green":
+		return TLPGreen, true
+	case "amber", "amber+strict":
+		return TLPAmber, true
+	case "red":
+		return TLPRed, true
+	default:
+		return "", false
+	}
+}
+
+var tlpLevels = map[string]int{
+	TLPWhite: 0,
+	TLPGreen: 1,
+	TLPAmber: 2,
+	TLPRed:   3,
+}
+
+// FilterTLP removes objects marked with TLP higher than maxTLP, which is ID of TLP marking definition. Relationships that refer removed objects are also removed.
+func FilterTLP(objects []Object, maxTLP string) []Object {
+	limit, ok := tlpLevels[maxTLP]
+	if !ok {
+		return objects
+	}
+
+	removed := map[string]struct{}{}
+	var result []Object
+	for _, obj := range objects {
+		if level, ok := tlpLevels[obj.ObjectID()]; ok && level > limit {
+			continue
+		}
+		exceeded := false
+		for _, ref := range markingRefs(obj) {
+			if level, ok := tlpLevels[ref]; ok && level > limit {
+				exceeded = true
+			}
+		}
+		if exceeded {
+			removed[obj.ObjectID()] = struct{}{}
+			continue
+		}
+		result = append(result, obj)
+	}
+
+	filtered := result[:0]
+	for _, obj := range result {
+		if rel, ok := obj.(*Relationship); ok {
+			_, src := removed[rel.SourceRef]
+			_, dst := removed[rel.TargetRef]
+			if src || dst {
+				continue
+			}
+		}
+		filtered = append(filtered, obj)
+	}
+	return filtered
+}
+
+// WithMaxTLP returns source that removes objects marked with TLP higher than maxTLP by FilterTLP.
+func WithMaxTLP(src Source, maxTLP string) Source {
+	return func(ctx context.Context, client interfaces.BigQuery) ([]Object, error) {
+		objects, err := src(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		return FilterTLP(objects, maxTLP), nil
+	}
+}
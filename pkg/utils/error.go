@@ -1,13 +1,16 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/m-mizutani/goerr"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func HandleError(msg string, err error) {
+// HandleError sends the error to Sentry and logs it. Trace ID of the span in ctx is attached to both.
+func HandleError(ctx context.Context, msg string, err error) {
 	// Sending error to Sentry
 	hub := sentry.CurrentHub().Clone()
 	hub.ConfigureScope(func(scope *sentry.Scope) {
@@ -16,8 +19,12 @@ func HandleError(msg string, err error) {
 				scope.SetExtra(fmt.Sprintf("%v", k), v)
 			}
 		}
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			scope.SetTag("trace_id", sc.TraceID().String())
+			scope.SetTag("span_id", sc.SpanID().String())
+		}
 	})
 	evID := hub.CaptureException(err)
 
-	logger.Error(msg, ErrLog(err), "sentry.EventID", evID)
+	logger.ErrorContext(ctx, msg, ErrLog(err), "sentry.EventID", evID)
 }
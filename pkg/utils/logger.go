@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"sync"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -13,10 +16,10 @@ var (
 )
 
 func init() {
-	logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+	logger = slog.New(&traceHandler{slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
 		AddSource: true,
 		Level:     slog.LevelInfo,
-	}))
+	})})
 }
 
 func Logger() *slog.Logger {
@@ -31,8 +34,31 @@ func FinalizeLogger(handler slog.Handler) {
 		logger.Warn("Logger is already locked, but try to update handler")
 		return
 	}
-	logger = slog.New(handler)
+	logger = slog.New(&traceHandler{handler})
 	loggerLocked = true
 }
 
 func ErrLog(err error) slog.Attr { return slog.Any("error", err) }
+
+// traceHandler adds trace ID and span ID of the span in context to log records. Use *Context methods of logger, e.g. InfoContext, to pass the context.
+type traceHandler struct {
+	slog.Handler
+}
+
+func (x *traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return x.Handler.Handle(ctx, r)
+}
+
+func (x *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &traceHandler{x.Handler.WithAttrs(attrs)}
+}
+
+func (x *traceHandler) WithGroup(name string) slog.Handler {
+	return &traceHandler{x.Handler.WithGroup(name)}
+}
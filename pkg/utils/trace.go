@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/m-mizutani/drone"
+
+// Attribute keys of spans.
+const (
+	AttrFeedID = attribute.Key("drone.feed_id")
+	AttrPage   = attribute.Key("drone.page")
+	AttrTable  = attribute.Key("drone.table")
+	AttrRows   = attribute.Key("drone.rows")
+)
+
+// StartSpan starts a span as a child of the span in ctx. Spans are discarded unless tracer provider is configured.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records err into the span if it's not nil, and ends the span.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}